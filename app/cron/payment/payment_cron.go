@@ -0,0 +1,21 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+
+	"ecom/app/cron/scheduler"
+	"ecom/service/payment"
+)
+
+// AuthorizationExpireJob expires authorizations that were never captured, and
+// payments that were never reviewed or authorized.
+func AuthorizationExpireJob(svc payment.Service) scheduler.Func {
+	return func(ctx context.Context) (string, error) {
+		expired, err := svc.ExpireStale(ctx)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%d payments expired", expired), nil
+	}
+}
@@ -0,0 +1,80 @@
+package scheduler_test
+
+import (
+	"testing"
+	"time"
+
+	"ecom/app/cron/scheduler"
+)
+
+func TestParse_Invalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"1-x * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"@every 500ms",
+		"@every soon",
+		"@weekly-ish",
+	} {
+		if _, err := scheduler.Parse(spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	// Rabu, 15 Januari 2025
+	from := time.Date(2025, 1, 15, 10, 7, 30, 0, time.UTC)
+
+	tests := []struct {
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		{spec: "*/15 * * * *", want: time.Date(2025, 1, 15, 10, 15, 0, 0, time.UTC)},
+		{spec: "*/15 * * * *", from: time.Date(2025, 1, 15, 10, 15, 0, 0, time.UTC), want: time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC)},
+		{spec: "0 * * * *", want: time.Date(2025, 1, 15, 11, 0, 0, 0, time.UTC)},
+		{spec: "@hourly", want: time.Date(2025, 1, 15, 11, 0, 0, 0, time.UTC)},
+		{spec: "@daily", want: time.Date(2025, 1, 16, 0, 0, 0, 0, time.UTC)},
+		{spec: "30 9 * * 1-5", want: time.Date(2025, 1, 16, 9, 30, 0, 0, time.UTC)},
+		{spec: "@weekly", want: time.Date(2025, 1, 19, 0, 0, 0, 0, time.UTC)},
+		{spec: "0 0 * * 7", want: time.Date(2025, 1, 19, 0, 0, 0, 0, time.UTC)},
+		{spec: "0 12 1 * *", want: time.Date(2025, 2, 1, 12, 0, 0, 0, time.UTC)},
+		{spec: "@yearly", want: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+		// tanggal 1/15 atau hari Jumat, mana yang lebih dulu
+		{spec: "0 0 1,15 * 5", want: time.Date(2025, 1, 17, 0, 0, 0, 0, time.UTC)},
+		{spec: "5/20 * * * *", want: time.Date(2025, 1, 15, 10, 25, 0, 0, time.UTC)},
+		{spec: "10-30/10 8 * * *", want: time.Date(2025, 1, 16, 8, 10, 0, 0, time.UTC)},
+		{spec: "0 0 29 2 *", want: time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{spec: "@every 90s", want: from.Add(90 * time.Second)},
+		// dievaluasi dalam UTC, bukan zona waktu input
+		{spec: "0 18 * * *", from: from.In(time.FixedZone("WIB", 7*3600)), want: time.Date(2025, 1, 15, 18, 0, 0, 0, time.UTC)},
+		// tidak pernah cocok: berhenti setelah 5 tahun
+		{spec: "0 0 30 2 *", want: time.Time{}},
+		{spec: "0 0 31 4,6 *", want: time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			sched, err := scheduler.Parse(tt.spec)
+			if err != nil {
+				t.Fatalf("Parse returned error: %v", err)
+			}
+			start := tt.from
+			if start.IsZero() {
+				start = from
+			}
+			if got := sched.Next(start); !got.Equal(tt.want) {
+				t.Fatalf("expected next run %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
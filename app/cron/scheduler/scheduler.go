@@ -0,0 +1,412 @@
+// Package scheduler runs background jobs on cron schedules. Each run takes a
+// lease lock in Mongo first, so with several replicas only one of them runs a
+// given job at a time, and every run is recorded in the job history.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"ecom/config"
+	"ecom/model"
+	"ecom/util/logging"
+	"ecom/util/tracing"
+)
+
+var (
+	ErrJobNotFound = errors.New("job not found")
+	ErrJobLocked   = errors.New("job is already running")
+	ErrStopped     = errors.New("scheduler is shutting down")
+)
+
+// leaseMargin is added to the job timeout, so a lease outlives a run that
+// is being cancelled but still cleaning up.
+const leaseMargin = 30 * time.Second
+
+// Func is the work of a job. The returned string is a short summary of what
+// it did, stored as the run result.
+type Func func(ctx context.Context) (string, error)
+
+// Store keeps lease locks and run history, see repository/job.
+type Store interface {
+	AcquireLease(ctx context.Context, job, owner string, ttl time.Duration) (bool, error)
+	ReleaseLease(ctx context.Context, job, owner string) error
+
+	CreateRun(ctx context.Context, run *model.JobRun) error
+	FinishRun(ctx context.Context, run *model.JobRun) error
+	FindRuns(ctx context.Context, job string, limit int) ([]model.JobRun, error)
+}
+
+// Metrics observes finished runs. See util/metrics for the Prometheus version.
+type Metrics interface {
+	ObserveJobRun(job string, status model.JobRunStatus, d time.Duration)
+}
+
+type job struct {
+	name     string
+	cfg      config.JobConfig
+	schedule Schedule
+	run      Func
+
+	// dijaga Scheduler.mu
+	next    time.Time
+	running bool
+}
+
+type Scheduler struct {
+	store   Store
+	owner   string
+	now     func() time.Time
+	metrics Metrics
+	logger  *slog.Logger
+
+	mu      sync.Mutex
+	jobs    map[string]*job
+	ctx     context.Context
+	started bool
+	stopped bool
+	wg      sync.WaitGroup
+}
+
+type Option func(*Scheduler)
+
+// WithOwner sets the lease owner name of this replica (default hostname-pid).
+func WithOwner(owner string) Option {
+	return func(s *Scheduler) {
+		if owner != "" {
+			s.owner = owner
+		}
+	}
+}
+
+func WithMetrics(m Metrics) Option {
+	return func(s *Scheduler) {
+		s.metrics = m
+	}
+}
+
+// WithClock sets the time source for schedules and run timestamps (default time.Now).
+func WithClock(now func() time.Time) Option {
+	return func(s *Scheduler) {
+		if now != nil {
+			s.now = now
+		}
+	}
+}
+
+// WithLogger sets the logger for runs and failures (default slog.Default()).
+func WithLogger(l *slog.Logger) Option {
+	return func(s *Scheduler) {
+		if l != nil {
+			s.logger = l
+		}
+	}
+}
+
+func New(store Store, opts ...Option) *Scheduler {
+	host, _ := os.Hostname()
+	s := &Scheduler{
+		store:  store,
+		owner:  fmt.Sprintf("%s-%d", host, os.Getpid()),
+		now:    time.Now,
+		jobs:   map[string]*job{},
+		ctx:    context.Background(),
+		logger: slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Register adds a job. It fails on an invalid schedule or a duplicate name.
+// Disabled jobs are listed and can be triggered by hand, but never scheduled.
+func (s *Scheduler) Register(name string, cfg config.JobConfig, fn Func) error {
+	sched, err := Parse(cfg.Schedule)
+	if err != nil {
+		return fmt.Errorf("job %s: %w", name, err)
+	}
+	if cfg.Timeout <= 0 {
+		return fmt.Errorf("job %s: timeout must be positive", name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, dup := s.jobs[name]; dup {
+		return fmt.Errorf("job %s registered twice", name)
+	}
+	s.jobs[name] = &job{name: name, cfg: cfg, schedule: sched, run: fn}
+	return nil
+}
+
+// Start schedules every enabled job until ctx is cancelled. Cancelling ctx
+// stops new runs only: a run in progress keeps going until it returns or hits
+// its own timeout. Use Wait to block until it has.
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	s.ctx = ctx
+	s.started = true
+	n := 0
+	for _, j := range s.jobs {
+		if j.cfg.Enabled {
+			s.wg.Add(1)
+			go s.loop(ctx, j)
+			n++
+		}
+	}
+	s.mu.Unlock()
+
+	s.logger.Info("scheduler started", "jobs", n, "owner", s.owner)
+}
+
+// Wait blocks until the context given to Start is cancelled and every run in
+// progress has finished, or until ctx is done. Trigger fails with ErrStopped
+// from the moment Wait is called.
+func (s *Scheduler) Wait(ctx context.Context) error {
+	s.mu.Lock()
+	s.stopped = true
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("scheduler: jobs still running: %w", ctx.Err())
+	}
+}
+
+// Check reports whether jobs are being scheduled, for the readiness probe.
+func (s *Scheduler) Check(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case !s.started:
+		return errors.New("scheduler not started")
+	case s.stopped || s.ctx.Err() != nil:
+		return ErrStopped
+	}
+	return nil
+}
+
+func (s *Scheduler) loop(ctx context.Context, j *job) {
+	defer s.wg.Done()
+
+	for {
+		next := j.schedule.Next(s.now())
+		if next.IsZero() {
+			s.logger.Warn("job has no next run, stopping", "job", j.name)
+			return
+		}
+		s.mu.Lock()
+		j.next = next
+		s.mu.Unlock()
+
+		timer := time.NewTimer(next.Sub(s.now()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		run, err := s.begin(ctx, j, model.JobTriggerSchedule)
+		if err != nil {
+			// lease dipegang replica lain: normal, bukan error
+			if !errors.Is(err, ErrJobLocked) {
+				s.logger.Error("job not started", "job", j.name, "error", err)
+			}
+			continue
+		}
+		s.execute(ctx, j, run)
+	}
+}
+
+// Trigger starts job name now, outside its schedule. The run continues in the
+// background; the returned run is a snapshot in status running.
+func (s *Scheduler) Trigger(name string) (*model.JobRun, error) {
+	s.mu.Lock()
+	j, ok := s.jobs[name]
+	ctx := s.ctx
+	stopped := s.stopped || ctx.Err() != nil
+	if ok && !stopped {
+		// dihitung sebelum begin supaya Wait menunggu run ini juga
+		s.wg.Add(1)
+	}
+	s.mu.Unlock()
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	if stopped {
+		return nil, ErrStopped
+	}
+
+	run, err := s.begin(ctx, j, model.JobTriggerManual)
+	if err != nil {
+		s.wg.Done()
+		return nil, err
+	}
+
+	// execute terus mengubah run, caller dapat salinannya
+	started := *run
+	go func() {
+		defer s.wg.Done()
+		s.execute(ctx, j, run)
+	}()
+	return &started, nil
+}
+
+// begin takes the lease of j and records the start of a run.
+func (s *Scheduler) begin(ctx context.Context, j *job, trigger model.JobTrigger) (*model.JobRun, error) {
+	s.mu.Lock()
+	if j.running {
+		s.mu.Unlock()
+		return nil, ErrJobLocked
+	}
+	j.running = true
+	s.mu.Unlock()
+
+	ok, err := s.store.AcquireLease(ctx, j.name, s.owner, j.cfg.Timeout+leaseMargin)
+	if err == nil && !ok {
+		err = ErrJobLocked
+	}
+	if err != nil {
+		s.setRunning(j, false)
+		return nil, err
+	}
+
+	run := &model.JobRun{
+		Job:       j.name,
+		Trigger:   trigger,
+		Owner:     s.owner,
+		Status:    model.JobRunStatusRunning,
+		StartedAt: s.now(),
+	}
+	if err := s.store.CreateRun(ctx, run); err != nil {
+		s.release(j)
+		return nil, fmt.Errorf("record run: %w", err)
+	}
+	return run, nil
+}
+
+// execute runs j within its timeout, records the outcome and releases the lease.
+func (s *Scheduler) execute(ctx context.Context, j *job, run *model.JobRun) {
+	defer s.release(j)
+
+	// shutdown tidak membatalkan run yang sedang jalan, hanya timeout job
+	runCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), j.cfg.Timeout)
+	// setiap run dapat request id sendiri, ikut ke log dan call ke service lain
+	runCtx = logging.WithRequestID(runCtx, logging.NewRequestID())
+	runCtx, span := tracing.Start(runCtx, "job "+j.name)
+	result, err := s.safeRun(runCtx, j)
+	if err != nil {
+		tracing.Fail(span, err)
+	}
+	span.End()
+	cancel()
+
+	finished := s.now()
+	run.FinishedAt = &finished
+	run.Result = result
+	run.Status = model.JobRunStatusSuccess
+	if err != nil {
+		run.Status = model.JobRunStatusFailed
+		run.Error = err.Error()
+		s.logger.ErrorContext(runCtx, "job failed", "job", j.name, "trigger", run.Trigger, "error", err)
+	} else {
+		s.logger.InfoContext(runCtx, "job finished", "job", j.name, "trigger", run.Trigger, "result", result)
+	}
+	if s.metrics != nil {
+		s.metrics.ObserveJobRun(j.name, run.Status, finished.Sub(run.StartedAt))
+	}
+
+	// ctx bisa sudah dibatalkan (shutdown), hasil run tetap dicatat
+	saveCtx, cancelSave := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancelSave()
+	if err := s.store.FinishRun(saveCtx, run); err != nil {
+		s.logger.ErrorContext(runCtx, "record job run result", "job", j.name, "error", err)
+	}
+}
+
+// safeRun turns a panic in a job into a failed run instead of killing the process.
+func (s *Scheduler) safeRun(ctx context.Context, j *job) (result string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return j.run(ctx)
+}
+
+func (s *Scheduler) release(j *job) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := s.store.ReleaseLease(ctx, j.name, s.owner); err != nil {
+		s.logger.Error("release job lease", "job", j.name, "error", err)
+	}
+	s.setRunning(j, false)
+}
+
+func (s *Scheduler) setRunning(j *job, running bool) {
+	s.mu.Lock()
+	j.running = running
+	s.mu.Unlock()
+}
+
+// Jobs lists the registered jobs by name with their last recorded run.
+func (s *Scheduler) Jobs(ctx context.Context) ([]model.JobInfo, error) {
+	s.mu.Lock()
+	infos := make([]model.JobInfo, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		info := model.JobInfo{
+			Name:     j.name,
+			Schedule: j.cfg.Schedule,
+			Timeout:  j.cfg.Timeout.String(),
+			Enabled:  j.cfg.Enabled,
+			Running:  j.running,
+		}
+		if !j.next.IsZero() {
+			next := j.next
+			info.NextRun = &next
+		}
+		infos = append(infos, info)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(infos, func(a, b int) bool { return infos[a].Name < infos[b].Name })
+	for i := range infos {
+		runs, err := s.store.FindRuns(ctx, infos[i].Name, 1)
+		if err != nil {
+			return nil, err
+		}
+		if len(runs) > 0 {
+			infos[i].LastRun = &runs[0]
+		}
+	}
+	return infos, nil
+}
+
+// Runs returns the run history of job name, newest first.
+func (s *Scheduler) Runs(ctx context.Context, name string, limit int) ([]model.JobRun, error) {
+	s.mu.Lock()
+	_, ok := s.jobs[name]
+	s.mu.Unlock()
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	return s.store.FindRuns(ctx, name, limit)
+}
@@ -0,0 +1,407 @@
+package scheduler_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ecom/app/cron/scheduler"
+	"ecom/config"
+	"ecom/model"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func newClock() *fakeClock {
+	return &fakeClock{t: time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.t = c.t.Add(d)
+	c.mu.Unlock()
+}
+
+type lease struct {
+	owner   string
+	expires time.Time
+}
+
+// fakeStore meniru repository/job: lease hanya bisa diambil alih setelah expired.
+type fakeStore struct {
+	clock *fakeClock
+
+	mu        sync.Mutex
+	leases    map[string]lease
+	leaseTTLs []time.Duration
+	runs      []*model.JobRun
+	finished  []model.JobRun
+}
+
+func newStore(clock *fakeClock) *fakeStore {
+	return &fakeStore{clock: clock, leases: map[string]lease{}}
+}
+
+func (f *fakeStore) AcquireLease(ctx context.Context, job, owner string, ttl time.Duration) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := f.clock.Now()
+	if l, ok := f.leases[job]; ok && l.expires.After(now) {
+		return false, nil
+	}
+	f.leases[job] = lease{owner: owner, expires: now.Add(ttl)}
+	f.leaseTTLs = append(f.leaseTTLs, ttl)
+	return true, nil
+}
+
+func (f *fakeStore) ReleaseLease(ctx context.Context, job, owner string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.leases[job].owner == owner {
+		delete(f.leases, job)
+	}
+	return nil
+}
+
+func (f *fakeStore) CreateRun(ctx context.Context, run *model.JobRun) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	run.ID = primitive.NewObjectID()
+	f.runs = append(f.runs, run)
+	return nil
+}
+
+func (f *fakeStore) FinishRun(ctx context.Context, run *model.JobRun) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.finished = append(f.finished, *run)
+	return nil
+}
+
+func (f *fakeStore) FindRuns(ctx context.Context, job string, limit int) ([]model.JobRun, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []model.JobRun
+	for i := len(f.finished) - 1; i >= 0 && len(out) < limit; i-- {
+		if f.finished[i].Job == job {
+			out = append(out, f.finished[i])
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeStore) finishedRuns() []model.JobRun {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]model.JobRun(nil), f.finished...)
+}
+
+func (f *fakeStore) holder(job string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.leases[job].owner
+}
+
+// manual adalah job yang tidak dijadwalkan, hanya jalan lewat Trigger.
+func manual(timeout time.Duration) config.JobConfig {
+	return config.JobConfig{Schedule: "@every 1h", Timeout: timeout}
+}
+
+func startScheduler(t *testing.T, s *scheduler.Scheduler) context.CancelFunc {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	s.Start(ctx)
+	t.Cleanup(cancel)
+	return cancel
+}
+
+func waitIdle(t *testing.T, s *scheduler.Scheduler) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := s.Wait(ctx); err != nil {
+		t.Fatalf("Wait returned error: %v", err)
+	}
+}
+
+func TestRegister_Invalid(t *testing.T) {
+	s := scheduler.New(newStore(newClock()))
+	noop := func(ctx context.Context) (string, error) { return "", nil }
+
+	if err := s.Register("bad-schedule", config.JobConfig{Schedule: "every minute", Timeout: time.Second}, noop); err == nil {
+		t.Fatal("expected an error for an invalid schedule")
+	}
+	if err := s.Register("no-timeout", config.JobConfig{Schedule: "@hourly"}, noop); err == nil {
+		t.Fatal("expected an error for a job without timeout")
+	}
+	if err := s.Register("cleanup", manual(time.Second), noop); err != nil {
+		t.Fatalf("Register returned error: %v", err)
+	}
+	if err := s.Register("cleanup", manual(time.Second), noop); err == nil {
+		t.Fatal("expected an error for a duplicate job")
+	}
+}
+
+func TestTrigger_RecordsRuns(t *testing.T) {
+	tests := []struct {
+		name       string
+		run        scheduler.Func
+		wantStatus model.JobRunStatus
+		wantResult string
+		wantError  string
+	}{
+		{
+			name:       "success",
+			run:        func(ctx context.Context) (string, error) { return "3 rows", nil },
+			wantStatus: model.JobRunStatusSuccess,
+			wantResult: "3 rows",
+		},
+		{
+			name:       "error",
+			run:        func(ctx context.Context) (string, error) { return "", errors.New("mongo down") },
+			wantStatus: model.JobRunStatusFailed,
+			wantError:  "mongo down",
+		},
+		{
+			name:       "panic",
+			run:        func(ctx context.Context) (string, error) { panic("nil map") },
+			wantStatus: model.JobRunStatusFailed,
+			wantError:  "panic: nil map",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newClock()
+			store := newStore(clock)
+			s := scheduler.New(store, scheduler.WithOwner("replica-a"), scheduler.WithClock(clock.Now))
+			err := s.Register("cleanup", manual(5*time.Second), func(ctx context.Context) (string, error) {
+				clock.Advance(2 * time.Second)
+				return tt.run(ctx)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			startScheduler(t, s)
+
+			started := clock.Now()
+			run, err := s.Trigger("cleanup")
+			if err != nil {
+				t.Fatalf("Trigger returned error: %v", err)
+			}
+			if run.Status != model.JobRunStatusRunning || run.Trigger != model.JobTriggerManual || run.Owner != "replica-a" {
+				t.Fatalf("expected a running manual run of replica-a, got %+v", run)
+			}
+			waitIdle(t, s)
+
+			runs := store.finishedRuns()
+			if len(runs) != 1 {
+				t.Fatalf("expected one recorded run, got %d", len(runs))
+			}
+			got := runs[0]
+			if got.ID != run.ID || got.Status != tt.wantStatus || got.Result != tt.wantResult || got.Error != tt.wantError {
+				t.Fatalf("expected %s %q %q, got %+v", tt.wantStatus, tt.wantResult, tt.wantError, got)
+			}
+			if !got.StartedAt.Equal(started) || got.FinishedAt == nil || got.FinishedAt.Sub(got.StartedAt) != 2*time.Second {
+				t.Fatalf("expected the run timed by the clock, got %s - %v", got.StartedAt, got.FinishedAt)
+			}
+			if store.holder("cleanup") != "" {
+				t.Fatal("expected the lease released after the run")
+			}
+			// lease lebih lama dari timeout supaya run yang sedang dibatalkan masih memegangnya
+			if store.leaseTTLs[0] <= 5*time.Second {
+				t.Fatalf("expected the lease to outlive the job timeout, got %s", store.leaseTTLs[0])
+			}
+		})
+	}
+}
+
+func TestTrigger_LeaseHeldElsewhere(t *testing.T) {
+	clock := newClock()
+	store := newStore(clock)
+	s := scheduler.New(store, scheduler.WithOwner("replica-a"), scheduler.WithClock(clock.Now))
+	if err := s.Register("cleanup", manual(5*time.Second), func(ctx context.Context) (string, error) { return "ok", nil }); err != nil {
+		t.Fatal(err)
+	}
+	startScheduler(t, s)
+
+	// replica-b mati di tengah run tanpa melepas lease
+	if ok, _ := store.AcquireLease(context.Background(), "cleanup", "replica-b", time.Minute); !ok {
+		t.Fatal("expected replica-b to take the lease")
+	}
+	if _, err := s.Trigger("cleanup"); !errors.Is(err, scheduler.ErrJobLocked) {
+		t.Fatalf("expected ErrJobLocked while replica-b holds the lease, got %v", err)
+	}
+	if runs := store.finishedRuns(); len(runs) != 0 {
+		t.Fatalf("expected no run recorded, got %v", runs)
+	}
+
+	clock.Advance(time.Minute + time.Second)
+	if _, err := s.Trigger("cleanup"); err != nil {
+		t.Fatalf("expected the expired lease to be taken over, got %v", err)
+	}
+	waitIdle(t, s)
+	if runs := store.finishedRuns(); len(runs) != 1 || runs[0].Owner != "replica-a" {
+		t.Fatalf("expected one run by replica-a, got %v", runs)
+	}
+}
+
+func TestTrigger_AlreadyRunningHere(t *testing.T) {
+	store := newStore(newClock())
+	s := scheduler.New(store)
+	release := make(chan struct{})
+	if err := s.Register("cleanup", manual(5*time.Second), func(ctx context.Context) (string, error) {
+		<-release
+		return "ok", nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	startScheduler(t, s)
+
+	if _, err := s.Trigger("cleanup"); err != nil {
+		t.Fatalf("Trigger returned error: %v", err)
+	}
+	if _, err := s.Trigger("cleanup"); !errors.Is(err, scheduler.ErrJobLocked) {
+		t.Fatalf("expected ErrJobLocked for a second run, got %v", err)
+	}
+	infos, err := s.Jobs(context.Background())
+	if err != nil || len(infos) != 1 || !infos[0].Running {
+		t.Fatalf("expected the job listed as running, got %+v, %v", infos, err)
+	}
+	close(release)
+	waitIdle(t, s)
+}
+
+func TestTrigger_UnknownOrStopped(t *testing.T) {
+	s := scheduler.New(newStore(newClock()))
+	if err := s.Register("cleanup", manual(time.Second), func(ctx context.Context) (string, error) { return "", nil }); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Check(context.Background()); err == nil {
+		t.Fatal("expected Check to fail before Start")
+	}
+	startScheduler(t, s)
+	if err := s.Check(context.Background()); err != nil {
+		t.Fatalf("expected Check to pass after Start, got %v", err)
+	}
+
+	if _, err := s.Trigger("nope"); !errors.Is(err, scheduler.ErrJobNotFound) {
+		t.Fatalf("expected ErrJobNotFound, got %v", err)
+	}
+	if _, err := s.Runs(context.Background(), "nope", 10); !errors.Is(err, scheduler.ErrJobNotFound) {
+		t.Fatalf("expected ErrJobNotFound from Runs, got %v", err)
+	}
+
+	waitIdle(t, s)
+	if _, err := s.Trigger("cleanup"); !errors.Is(err, scheduler.ErrStopped) {
+		t.Fatalf("expected ErrStopped after Wait, got %v", err)
+	}
+	if err := s.Check(context.Background()); !errors.Is(err, scheduler.ErrStopped) {
+		t.Fatalf("expected Check to report ErrStopped, got %v", err)
+	}
+}
+
+// Shutdown tidak membatalkan run yang sedang jalan, hanya timeout job yang bisa.
+func TestShutdown_WaitsForRunsUntilTheirTimeout(t *testing.T) {
+	store := newStore(newClock())
+	s := scheduler.New(store)
+	release := make(chan struct{})
+	if err := s.Register("finishing", manual(5*time.Second), func(ctx context.Context) (string, error) {
+		<-release
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		return "done", nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Register("stuck", manual(100*time.Millisecond), func(ctx context.Context) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}); err != nil {
+		t.Fatal(err)
+	}
+	shutdown := startScheduler(t, s)
+
+	for _, name := range []string{"finishing", "stuck"} {
+		if _, err := s.Trigger(name); err != nil {
+			t.Fatalf("Trigger %s returned error: %v", name, err)
+		}
+	}
+	shutdown()
+
+	short, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := s.Wait(short); err == nil {
+		t.Fatal("expected Wait to give up while runs are in progress")
+	}
+
+	close(release)
+	waitIdle(t, s)
+
+	status := map[string]model.JobRun{}
+	for _, run := range store.finishedRuns() {
+		status[run.Job] = run
+	}
+	if got := status["finishing"]; got.Status != model.JobRunStatusSuccess || got.Result != "done" {
+		t.Fatalf("expected the run to finish despite shutdown, got %+v", got)
+	}
+	if got := status["stuck"]; got.Status != model.JobRunStatusFailed || !strings.Contains(got.Error, "deadline exceeded") {
+		t.Fatalf("expected the stuck run to fail on its timeout, got %+v", got)
+	}
+}
+
+func TestStart_RunsEnabledJobsOnSchedule(t *testing.T) {
+	store := newStore(newClock())
+	s := scheduler.New(store)
+	ran := make(chan string, 10)
+	job := func(name string) scheduler.Func {
+		return func(ctx context.Context) (string, error) {
+			ran <- name
+			return "ok", nil
+		}
+	}
+	if err := s.Register("enabled", config.JobConfig{Schedule: "@every 1s", Timeout: time.Second, Enabled: true}, job("enabled")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Register("disabled", config.JobConfig{Schedule: "@every 1s", Timeout: time.Second}, job("disabled")); err != nil {
+		t.Fatal(err)
+	}
+	shutdown := startScheduler(t, s)
+
+	select {
+	case name := <-ran:
+		if name != "enabled" {
+			t.Fatalf("expected only the enabled job to be scheduled, %s ran", name)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected the enabled job to run within its interval")
+	}
+	shutdown()
+	waitIdle(t, s)
+
+	runs, err := s.Runs(context.Background(), "enabled", 10)
+	if err != nil || len(runs) == 0 || runs[0].Trigger != model.JobTriggerSchedule {
+		t.Fatalf("expected a scheduled run in the history, got %+v, %v", runs, err)
+	}
+	infos, err := s.Jobs(context.Background())
+	if err != nil {
+		t.Fatalf("Jobs returned error: %v", err)
+	}
+	if infos[0].Name != "disabled" || infos[0].NextRun != nil || infos[1].NextRun == nil || infos[1].LastRun == nil {
+		t.Fatalf("expected next and last run for the enabled job only, got %+v", infos)
+	}
+}
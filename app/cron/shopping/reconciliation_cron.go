@@ -0,0 +1,54 @@
+package shopping
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"ecom/app/cron/scheduler"
+	"ecom/model"
+	"ecom/service/reconciliation"
+)
+
+// ReconciliationJob reconciles the previous UTC day and writes
+// reconciliation-YYYY-MM-DD.json and .csv into dir.
+func ReconciliationJob(svc reconciliation.Service, dir string) scheduler.Func {
+	return func(ctx context.Context) (string, error) {
+		to := time.Now().UTC().Truncate(24 * time.Hour)
+		from := to.AddDate(0, 0, -1)
+
+		report, err := svc.Run(ctx, from, to)
+		if err != nil {
+			return "", err
+		}
+		if err := writeReconciliation(dir, from, report); err != nil {
+			return "", fmt.Errorf("write report: %w", err)
+		}
+		return fmt.Sprintf("%s checked %d transactions, %d mismatches",
+			from.Format(time.DateOnly), report.Summary.TransactionsChecked, report.Summary.Mismatches), nil
+	}
+}
+
+func writeReconciliation(dir string, day time.Time, report *model.ReconciliationReport) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	base := filepath.Join(dir, "reconciliation-"+day.Format(time.DateOnly))
+
+	for _, format := range []string{"json", "csv"} {
+		f, err := os.Create(base + "." + format)
+		if err != nil {
+			return err
+		}
+		werr := reconciliation.Write(f, report, format)
+		if cerr := f.Close(); werr == nil {
+			werr = cerr
+		}
+		if werr != nil {
+			return werr
+		}
+	}
+	return nil
+}
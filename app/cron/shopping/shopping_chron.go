@@ -2,29 +2,25 @@ package shopping
 
 import (
 	"context"
-	"log"
-	"time"
+	"fmt"
 
+	"ecom/app/cron/scheduler"
 	"ecom/service/transaction"
 )
 
-func StartTransactionExpireJob(svc transaction.Service) {
-	go func() {
-		ticker := time.NewTicker(1 * time.Minute)
-		defer ticker.Stop()
-
-		for range ticker.C {
-			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
-			modified, err := svc.RunExpireJob(ctx)
-			cancel()
+// TransactionExpireJob releases expired stock reservations and expires
+// pending transactions older than the pending TTL.
+func TransactionExpireJob(svc transaction.Service) scheduler.Func {
+	return func(ctx context.Context) (string, error) {
+		released, err := svc.ReleaseExpiredReservations(ctx)
+		if err != nil {
+			return "", fmt.Errorf("release reservations: %w", err)
+		}
 
-			if err != nil {
-				log.Printf("expire job error: %v", err)
-				continue
-			}
-			if modified > 0 {
-				log.Printf("expire job: %d transactions expired", modified)
-			}
+		modified, err := svc.RunExpireJob(ctx)
+		if err != nil {
+			return "", fmt.Errorf("expire transactions: %w", err)
 		}
-	}()
+		return fmt.Sprintf("%d reservations released, %d transactions expired", released, modified), nil
+	}
 }
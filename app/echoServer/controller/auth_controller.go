@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"ecom/model"
+	customerservice "ecom/service/customer"
+
+	"github.com/labstack/echo/v4"
+)
+
+type AuthController struct {
+	svc customerservice.Service
+}
+
+func NewAuthController(svc customerservice.Service) *AuthController {
+	return &AuthController{svc: svc}
+}
+
+func (h *AuthController) Register(c echo.Context) error {
+	var req model.RegisterRequest
+	if err := c.Bind(&req); err != nil {
+		return respondError(c, http.StatusBadRequest, "invalid request body", err.Error())
+	}
+
+	customer, err := h.svc.Register(c.Request().Context(), req)
+	if err != nil {
+		if errors.Is(err, customerservice.ErrEmailTaken) {
+			return respondError(c, http.StatusConflict, "email already registered", nil)
+		}
+		return respondError(c, http.StatusBadRequest, "failed to register", err.Error())
+	}
+
+	return respondOK(c, customer)
+}
+
+func (h *AuthController) Login(c echo.Context) error {
+	var req model.LoginRequest
+	if err := c.Bind(&req); err != nil {
+		return respondError(c, http.StatusBadRequest, "invalid request body", err.Error())
+	}
+
+	tokens, err := h.svc.Login(c.Request().Context(), req)
+	if err != nil {
+		if errors.Is(err, customerservice.ErrInvalidCredentials) {
+			return respondError(c, http.StatusUnauthorized, "invalid email or password", nil)
+		}
+		return respondError(c, http.StatusInternalServerError, "failed to login", err.Error())
+	}
+
+	return respondOK(c, tokens)
+}
+
+func (h *AuthController) Refresh(c echo.Context) error {
+	var req model.RefreshTokenRequest
+	if err := c.Bind(&req); err != nil {
+		return respondError(c, http.StatusBadRequest, "invalid request body", err.Error())
+	}
+
+	tokens, err := h.svc.Refresh(c.Request().Context(), req)
+	if err != nil {
+		return respondError(c, http.StatusUnauthorized, "invalid refresh token", nil)
+	}
+
+	return respondOK(c, tokens)
+}
+
+func (h *AuthController) Me(c echo.Context) error {
+	p, err := currentPrincipal(c)
+	if err != nil {
+		return respondError(c, http.StatusUnauthorized, "unauthorized", nil)
+	}
+
+	customer, err := h.svc.GetByID(c.Request().Context(), p.CustomerID)
+	if err != nil {
+		return respondError(c, http.StatusNotFound, "customer not found", err.Error())
+	}
+	return respondOK(c, customer)
+}
+
+func (h *AuthController) SetRole(c echo.Context) error {
+	id := c.Param("id")
+	var req model.UpdateRoleRequest
+	if err := c.Bind(&req); err != nil {
+		return respondError(c, http.StatusBadRequest, "invalid request body", err.Error())
+	}
+	if !req.Role.Valid() {
+		return respondError(c, http.StatusBadRequest, "invalid role", req.Role)
+	}
+
+	customer, err := h.svc.SetRole(c.Request().Context(), id, req.Role)
+	if err != nil {
+		return respondError(c, http.StatusInternalServerError, "failed to update role", err.Error())
+	}
+	return respondOK(c, customer)
+}
@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"ecom/model"
+	categoryservice "ecom/service/category"
+
+	"github.com/labstack/echo/v4"
+)
+
+type CategoryController struct {
+	svc categoryservice.Service
+}
+
+func NewCategoryController(svc categoryservice.Service) *CategoryController {
+	return &CategoryController{svc: svc}
+}
+
+func (h *CategoryController) Create(c echo.Context) error {
+	var req model.CategoryRequest
+	if err := c.Bind(&req); err != nil {
+		return respondError(c, http.StatusBadRequest, "invalid request body", err.Error())
+	}
+
+	category, err := h.svc.Create(c.Request().Context(), req)
+	if err != nil {
+		return respondCategoryError(c, "failed to create category", err)
+	}
+	return respondOK(c, category)
+}
+
+func (h *CategoryController) GetAll(c echo.Context) error {
+	categories, err := h.svc.GetAll(c.Request().Context())
+	if err != nil {
+		return respondError(c, http.StatusInternalServerError, "failed to get categories", err.Error())
+	}
+	return respondOK(c, categories)
+}
+
+func (h *CategoryController) GetByID(c echo.Context) error {
+	category, err := h.svc.GetByID(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return respondError(c, http.StatusNotFound, "category not found", err.Error())
+	}
+	return respondOK(c, category)
+}
+
+func (h *CategoryController) Update(c echo.Context) error {
+	var req model.CategoryRequest
+	if err := c.Bind(&req); err != nil {
+		return respondError(c, http.StatusBadRequest, "invalid request body", err.Error())
+	}
+
+	category, err := h.svc.Update(c.Request().Context(), c.Param("id"), req)
+	if err != nil {
+		return respondCategoryError(c, "failed to update category", err)
+	}
+	return respondOK(c, category)
+}
+
+func (h *CategoryController) Delete(c echo.Context) error {
+	if err := h.svc.Delete(c.Request().Context(), c.Param("id")); err != nil {
+		return respondCategoryError(c, "failed to delete category", err)
+	}
+	return respondOK(c, echo.Map{"deleted": true})
+}
+
+func respondCategoryError(c echo.Context, msg string, err error) error {
+	switch {
+	case errors.Is(err, categoryservice.ErrCategoryNotFound):
+		return respondError(c, http.StatusNotFound, "category not found", err.Error())
+	case errors.Is(err, categoryservice.ErrSlugTaken), errors.Is(err, categoryservice.ErrCategoryInUse):
+		return respondError(c, http.StatusConflict, msg, err.Error())
+	case errors.Is(err, categoryservice.ErrInvalidCategory):
+		return respondError(c, http.StatusBadRequest, msg, err.Error())
+	}
+	return respondError(c, http.StatusInternalServerError, msg, err.Error())
+}
@@ -1,16 +1,21 @@
 package controller
 
 import (
+	"errors"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
+
+	"ecom/app/echoServer/middleware"
+	"ecom/model"
+	"ecom/util/patch"
 
 	"github.com/labstack/echo/v4"
 )
 
 func respondError(c echo.Context, code int, msg string, detail any) error {
-	return c.JSON(code, echo.Map{
-		"message": msg,
-		"detail":  detail,
-	})
+	return middleware.RespondError(c, code, msg, detail)
 }
 
 func respondOK(c echo.Context, data any) error {
@@ -19,3 +24,74 @@ func respondOK(c echo.Context, data any) error {
 		"data":    data,
 	})
 }
+
+// currentPrincipal returns the caller set by the auth middleware.
+func currentPrincipal(c echo.Context) (model.Principal, error) {
+	p, ok := middleware.PrincipalFrom(c)
+	if !ok {
+		return model.Principal{}, echo.ErrUnauthorized
+	}
+	return p, nil
+}
+
+var errBadIfMatch = errors.New("If-Match must be a single ETag returned by this API")
+
+// etag formats a document version as a strong ETag.
+func etag(version int64) string {
+	return strconv.Quote(strconv.FormatInt(version, 10))
+}
+
+// respondVersioned is respondOK with the ETag of the returned document.
+func respondVersioned(c echo.Context, version int64, data any) error {
+	c.Response().Header().Set("ETag", etag(version))
+	return respondOK(c, data)
+}
+
+// notModified answers a conditional GET whose If-None-Match is still current.
+func notModified(c echo.Context, version int64) bool {
+	inm := c.Request().Header.Get("If-None-Match")
+	if inm == "" {
+		return false
+	}
+	current := etag(version)
+	for _, tag := range strings.Split(inm, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == current {
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatchVersion reads the If-Match header. A missing header or "*" returns 0,
+// meaning the write is not tied to a version the client has seen.
+func ifMatchVersion(c echo.Context) (int64, error) {
+	h := strings.TrimSpace(c.Request().Header.Get("If-Match"))
+	if h == "" || h == "*" {
+		return 0, nil
+	}
+	raw, err := strconv.Unquote(h)
+	if err != nil {
+		return 0, errBadIfMatch
+	}
+	v, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || v <= 0 {
+		return 0, errBadIfMatch
+	}
+	return v, nil
+}
+
+// respondPreconditionFailed is the 412 for a stale or unusable If-Match.
+func respondPreconditionFailed(c echo.Context, err error) error {
+	return respondError(c, http.StatusPreconditionFailed, "resource was modified, fetch it again and retry", err.Error())
+}
+
+// bindMergePatch reads a JSON Merge Patch body. Plain application/json is
+// accepted too, since most clients send that for PATCH.
+func bindMergePatch(c echo.Context) (patch.Document, error) {
+	mediaType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	if mediaType != patch.MediaType && mediaType != echo.MIMEApplicationJSON {
+		return nil, echo.ErrUnsupportedMediaType
+	}
+	return patch.Decode(c.Request().Body)
+}
@@ -0,0 +1,32 @@
+package controller
+
+import (
+	"net/http"
+
+	"ecom/model"
+	"ecom/service/health"
+
+	"github.com/labstack/echo/v4"
+)
+
+type HealthController struct {
+	svc health.Service
+}
+
+func NewHealthController(svc health.Service) *HealthController {
+	return &HealthController{svc: svc}
+}
+
+// /healthz (GET)
+func (h *HealthController) Live(c echo.Context) error {
+	return respondOK(c, h.svc.Live())
+}
+
+// /readyz (GET), 503 selama ada dependency yang down
+func (h *HealthController) Ready(c echo.Context) error {
+	report := h.svc.Ready(c.Request().Context())
+	if report.Status != model.HealthStatusUp {
+		return respondError(c, http.StatusServiceUnavailable, "service not ready", report)
+	}
+	return respondOK(c, report)
+}
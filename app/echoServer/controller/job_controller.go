@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"ecom/app/cron/scheduler"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultJobRunsLimit = 20
+	maxJobRunsLimit     = 100
+)
+
+type JobController struct {
+	scheduler *scheduler.Scheduler
+}
+
+func NewJobController(s *scheduler.Scheduler) *JobController {
+	return &JobController{scheduler: s}
+}
+
+// /admin/jobs (GET)
+func (h *JobController) List(c echo.Context) error {
+	jobs, err := h.scheduler.Jobs(c.Request().Context())
+	if err != nil {
+		return respondError(c, http.StatusInternalServerError, "failed to list jobs", err.Error())
+	}
+	return respondOK(c, jobs)
+}
+
+// /admin/jobs/{name}/runs (GET)
+func (h *JobController) Runs(c echo.Context) error {
+	limit := defaultJobRunsLimit
+	if v := c.QueryParam("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxJobRunsLimit {
+			return respondError(c, http.StatusBadRequest, "invalid query", "limit must be 1-100")
+		}
+		limit = n
+	}
+
+	runs, err := h.scheduler.Runs(c.Request().Context(), c.Param("name"), limit)
+	if err != nil {
+		if errors.Is(err, scheduler.ErrJobNotFound) {
+			return respondError(c, http.StatusNotFound, "job not found", nil)
+		}
+		return respondError(c, http.StatusInternalServerError, "failed to get job runs", err.Error())
+	}
+	return respondOK(c, runs)
+}
+
+// /admin/jobs/{name}/trigger (POST), job jalan di background
+func (h *JobController) Trigger(c echo.Context) error {
+	run, err := h.scheduler.Trigger(c.Param("name"))
+	if err != nil {
+		switch {
+		case errors.Is(err, scheduler.ErrJobNotFound):
+			return respondError(c, http.StatusNotFound, "job not found", nil)
+		case errors.Is(err, scheduler.ErrJobLocked):
+			return respondError(c, http.StatusConflict, "job is already running", nil)
+		}
+		return respondError(c, http.StatusInternalServerError, "failed to trigger job", err.Error())
+	}
+	return c.JSON(http.StatusAccepted, echo.Map{
+		"message": "job triggered",
+		"data":    run,
+	})
+}
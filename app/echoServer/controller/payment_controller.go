@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"errors"
 	"net/http"
 
 	"ecom/model"
@@ -29,8 +30,121 @@ func (h *PaymentController) CreatePayment(c echo.Context) error {
 
 	payment, err := h.svc.CreatePayment(c.Request().Context(), req)
 	if err != nil {
-		return respondError(c, http.StatusInternalServerError, "failed to create payment", err.Error())
+		return respondPaymentError(c, "failed to create payment", err)
 	}
 
+	return respondPayment(c, payment)
+}
+
+func (h *PaymentController) CreateIntent(c echo.Context) error {
+	var req model.CreatePaymentRequest
+	if err := c.Bind(&req); err != nil {
+		return respondError(c, http.StatusBadRequest, "invalid request body", err.Error())
+	}
+
+	if req.Amount <= 0 {
+		return respondError(c, http.StatusBadRequest, "amount must be > 0", nil)
+	}
+
+	payment, err := h.svc.CreateIntent(c.Request().Context(), req)
+	if err != nil {
+		return respondPaymentError(c, "failed to create payment intent", err)
+	}
+
+	return respondPayment(c, payment)
+}
+
+func (h *PaymentController) Authorize(c echo.Context) error {
+	payment, err := h.svc.Authorize(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return respondPaymentError(c, "failed to authorize payment", err)
+	}
+	return respondOK(c, payment)
+}
+
+func (h *PaymentController) Capture(c echo.Context) error {
+	var req model.CapturePaymentRequest
+	if err := c.Bind(&req); err != nil {
+		return respondError(c, http.StatusBadRequest, "invalid request body", err.Error())
+	}
+
+	payment, err := h.svc.Capture(c.Request().Context(), c.Param("id"), req)
+	if err != nil {
+		return respondPaymentError(c, "failed to capture payment", err)
+	}
+	return respondOK(c, payment)
+}
+
+func (h *PaymentController) Void(c echo.Context) error {
+	payment, err := h.svc.Void(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return respondPaymentError(c, "failed to void payment", err)
+	}
+	return respondOK(c, payment)
+}
+
+func (h *PaymentController) Review(c echo.Context) error {
+	var req model.ReviewPaymentRequest
+	if err := c.Bind(&req); err != nil {
+		return respondError(c, http.StatusBadRequest, "invalid request body", err.Error())
+	}
+	if req.Reviewer == "" {
+		return respondError(c, http.StatusBadRequest, "reviewer is required", nil)
+	}
+
+	payment, err := h.svc.Review(c.Request().Context(), c.Param("id"), req)
+	if err != nil {
+		return respondPaymentError(c, "failed to review payment", err)
+	}
+	return respondOK(c, payment)
+}
+
+func (h *PaymentController) GetByID(c echo.Context) error {
+	payment, err := h.svc.GetByID(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return respondPaymentError(c, "failed to get payment", err)
+	}
 	return respondOK(c, payment)
 }
+
+func (h *PaymentController) List(c echo.Context) error {
+	var q model.ListPaymentsQuery
+	if err := c.Bind(&q); err != nil {
+		return respondError(c, http.StatusBadRequest, "invalid query", err.Error())
+	}
+
+	page, err := h.svc.List(c.Request().Context(), q)
+	if err != nil {
+		return respondPaymentError(c, "failed to list payments", err)
+	}
+	return respondOK(c, page)
+}
+
+// respondPayment marks idempotent replays so callers can tell them apart from new payments.
+func respondPayment(c echo.Context, payment *model.Payment) error {
+	if payment.Replayed {
+		c.Response().Header().Set("Idempotent-Replayed", "true")
+	}
+	return respondOK(c, payment)
+}
+
+func respondPaymentError(c echo.Context, msg string, err error) error {
+	var dup *paymentservice.DuplicatePaymentError
+	if errors.As(err, &dup) {
+		return respondError(c, http.StatusConflict, "payment already exists for transaction", echo.Map{
+			"existing_payment_id": dup.ExistingID.Hex(),
+			"status":              dup.Status,
+		})
+	}
+
+	switch {
+	case errors.Is(err, paymentservice.ErrPaymentNotFound):
+		return respondError(c, http.StatusNotFound, "payment not found", err.Error())
+	case errors.Is(err, paymentservice.ErrInvalidState):
+		return respondError(c, http.StatusConflict, msg, err.Error())
+	case errors.Is(err, paymentservice.ErrInvalidCapture), errors.Is(err, paymentservice.ErrInvalidQuery),
+		errors.Is(err, paymentservice.ErrInvalidReview):
+		return respondError(c, http.StatusBadRequest, msg, err.Error())
+	}
+	return respondError(c, http.StatusInternalServerError, msg, err.Error())
+}
@@ -1,7 +1,11 @@
 package controller
 
 import (
+	"errors"
+	"log/slog"
+	"mime"
 	"net/http"
+	"strconv"
 
 	"ecom/model"
 	productservice "ecom/service/product"
@@ -25,6 +29,12 @@ func (h *ProductController) Create(c echo.Context) error {
 
 	p, err := h.svc.Create(c.Request().Context(), req)
 	if err != nil {
+		if errors.Is(err, productservice.ErrSKUTaken) {
+			return respondError(c, http.StatusConflict, "sku already exists", err.Error())
+		}
+		if errors.Is(err, productservice.ErrInvalidProduct) {
+			return respondError(c, http.StatusBadRequest, "invalid product", err.Error())
+		}
 		return respondError(c, http.StatusInternalServerError, "failed to create product", err.Error())
 	}
 
@@ -32,20 +42,67 @@ func (h *ProductController) Create(c echo.Context) error {
 }
 
 func (h *ProductController) GetAll(c echo.Context) error {
-	products, err := h.svc.GetAll(c.Request().Context())
+	var q model.ListProductsQuery
+	if err := c.Bind(&q); err != nil {
+		return respondError(c, http.StatusBadRequest, "invalid query", err.Error())
+	}
+
+	products, err := h.svc.GetAll(c.Request().Context(), q)
 	if err != nil {
+		if errors.Is(err, productservice.ErrInvalidQuery) {
+			return respondError(c, http.StatusBadRequest, "invalid query", err.Error())
+		}
 		return respondError(c, http.StatusInternalServerError, "failed to get products", err.Error())
 	}
 	return respondOK(c, products)
 }
 
+func (h *ProductController) Search(c echo.Context) error {
+	var q model.SearchProductsQuery
+	if err := c.Bind(&q); err != nil {
+		return respondError(c, http.StatusBadRequest, "invalid query", err.Error())
+	}
+
+	res, err := h.svc.Search(c.Request().Context(), q)
+	if err != nil {
+		if errors.Is(err, productservice.ErrInvalidQuery) {
+			return respondError(c, http.StatusBadRequest, "invalid query", err.Error())
+		}
+		return respondError(c, http.StatusInternalServerError, "failed to search products", err.Error())
+	}
+	return respondOK(c, res)
+}
+
+func (h *ProductController) Suggest(c echo.Context) error {
+	limit := 0
+	if v := c.QueryParam("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return respondError(c, http.StatusBadRequest, "invalid query", "limit must be a number")
+		}
+		limit = n
+	}
+
+	suggestions, err := h.svc.Suggest(c.Request().Context(), c.QueryParam("q"), limit)
+	if err != nil {
+		if errors.Is(err, productservice.ErrInvalidQuery) {
+			return respondError(c, http.StatusBadRequest, "invalid query", err.Error())
+		}
+		return respondError(c, http.StatusInternalServerError, "failed to suggest products", err.Error())
+	}
+	return respondOK(c, suggestions)
+}
+
 func (h *ProductController) GetByID(c echo.Context) error {
 	id := c.Param("id")
 	p, err := h.svc.GetByID(c.Request().Context(), id)
 	if err != nil {
 		return respondError(c, http.StatusNotFound, "product not found", err.Error())
 	}
-	return respondOK(c, p)
+	if notModified(c, p.Version) {
+		return c.NoContent(http.StatusNotModified)
+	}
+	return respondVersioned(c, p.Version, p)
 }
 
 func (h *ProductController) Update(c echo.Context) error {
@@ -55,11 +112,53 @@ func (h *ProductController) Update(c echo.Context) error {
 		return respondError(c, http.StatusBadRequest, "invalid request body", err.Error())
 	}
 
-	p, err := h.svc.Update(c.Request().Context(), id, req)
+	ifMatch, err := ifMatchVersion(c)
+	if err != nil {
+		return respondPreconditionFailed(c, err)
+	}
+
+	p, err := h.svc.Update(c.Request().Context(), id, req, ifMatch)
+	if err != nil {
+		if errors.Is(err, model.ErrVersionConflict) {
+			return respondPreconditionFailed(c, err)
+		}
+		if errors.Is(err, productservice.ErrSKUTaken) {
+			return respondError(c, http.StatusConflict, "sku already exists", err.Error())
+		}
+		if errors.Is(err, productservice.ErrInvalidProduct) {
+			return respondError(c, http.StatusBadRequest, "invalid product", err.Error())
+		}
+		return respondError(c, http.StatusInternalServerError, "failed to update product", err.Error())
+	}
+	return respondVersioned(c, p.Version, p)
+}
+
+func (h *ProductController) Patch(c echo.Context) error {
+	doc, err := bindMergePatch(c)
+	if err != nil {
+		if errors.Is(err, echo.ErrUnsupportedMediaType) {
+			return respondError(c, http.StatusUnsupportedMediaType, "unsupported content type", "use application/merge-patch+json")
+		}
+		return respondError(c, http.StatusBadRequest, "invalid request body", err.Error())
+	}
+	ifMatch, err := ifMatchVersion(c)
+	if err != nil {
+		return respondPreconditionFailed(c, err)
+	}
+
+	p, err := h.svc.Patch(c.Request().Context(), c.Param("id"), doc, ifMatch)
 	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrVersionConflict):
+			return respondPreconditionFailed(c, err)
+		case errors.Is(err, productservice.ErrSKUTaken):
+			return respondError(c, http.StatusConflict, "sku already exists", err.Error())
+		case errors.Is(err, productservice.ErrInvalidProduct):
+			return respondError(c, http.StatusBadRequest, "invalid product", err.Error())
+		}
 		return respondError(c, http.StatusInternalServerError, "failed to update product", err.Error())
 	}
-	return respondOK(c, p)
+	return respondVersioned(c, p.Version, p)
 }
 
 func (h *ProductController) Delete(c echo.Context) error {
@@ -69,3 +168,105 @@ func (h *ProductController) Delete(c echo.Context) error {
 	}
 	return respondOK(c, echo.Map{"deleted": true})
 }
+
+func (h *ProductController) AddVariant(c echo.Context) error {
+	var req model.VariantRequest
+	if err := c.Bind(&req); err != nil {
+		return respondError(c, http.StatusBadRequest, "invalid request body", err.Error())
+	}
+
+	v, err := h.svc.AddVariant(c.Request().Context(), c.Param("id"), req)
+	if err != nil {
+		return respondVariantError(c, "failed to add variant", err)
+	}
+	return respondOK(c, v)
+}
+
+func (h *ProductController) UpdateVariant(c echo.Context) error {
+	var req model.VariantRequest
+	if err := c.Bind(&req); err != nil {
+		return respondError(c, http.StatusBadRequest, "invalid request body", err.Error())
+	}
+
+	v, err := h.svc.UpdateVariant(c.Request().Context(), c.Param("id"), c.Param("variantId"), req)
+	if err != nil {
+		return respondVariantError(c, "failed to update variant", err)
+	}
+	return respondOK(c, v)
+}
+
+func (h *ProductController) DeleteVariant(c echo.Context) error {
+	if err := h.svc.DeleteVariant(c.Request().Context(), c.Param("id"), c.Param("variantId")); err != nil {
+		return respondVariantError(c, "failed to delete variant", err)
+	}
+	return respondOK(c, echo.Map{"deleted": true})
+}
+
+func respondVariantError(c echo.Context, msg string, err error) error {
+	switch {
+	case errors.Is(err, productservice.ErrProductNotFound):
+		return respondError(c, http.StatusNotFound, "product not found", err.Error())
+	case errors.Is(err, productservice.ErrVariantNotFound):
+		return respondError(c, http.StatusNotFound, "variant not found", err.Error())
+	case errors.Is(err, productservice.ErrSKUTaken), errors.Is(err, productservice.ErrVariantInUse):
+		return respondError(c, http.StatusConflict, msg, err.Error())
+	case errors.Is(err, model.ErrVersionConflict):
+		return respondError(c, http.StatusConflict, "product was modified, retry", err.Error())
+	case errors.Is(err, productservice.ErrInvalidProduct):
+		return respondError(c, http.StatusBadRequest, msg, err.Error())
+	}
+	return respondError(c, http.StatusInternalServerError, msg, err.Error())
+}
+
+// Import menerima CSV atau NDJSON; format dari ?format= atau Content-Type.
+func (h *ProductController) Import(c echo.Context) error {
+	format := c.QueryParam("format")
+	if format == "" {
+		format = formatFromContentType(c.Request().Header.Get(echo.HeaderContentType))
+	}
+	dryRun, _ := strconv.ParseBool(c.QueryParam("dry_run"))
+
+	result, err := h.svc.Import(c.Request().Context(), c.Request().Body, format, dryRun)
+	if err != nil {
+		if errors.Is(err, productservice.ErrUnsupportedFormat) || errors.Is(err, productservice.ErrInvalidImport) {
+			return respondError(c, http.StatusBadRequest, "invalid import", err.Error())
+		}
+		return respondError(c, http.StatusInternalServerError, "failed to import products", err.Error())
+	}
+	return respondOK(c, result)
+}
+
+// Export menulis katalog langsung ke response, baris per baris dari cursor Mongo.
+func (h *ProductController) Export(c echo.Context) error {
+	format := c.QueryParam("format")
+	if format == "" {
+		format = productservice.FormatCSV
+	}
+	contentType, err := productservice.ContentType(format)
+	if err != nil {
+		return respondError(c, http.StatusBadRequest, "invalid format", err.Error())
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, contentType)
+	res.Header().Set(echo.HeaderContentDisposition, `attachment; filename="products.`+format+`"`)
+	res.WriteHeader(http.StatusOK)
+
+	// status sudah terkirim, error di tengah stream hanya bisa dicatat
+	ctx := c.Request().Context()
+	if err := h.svc.Export(ctx, res, format); err != nil {
+		slog.ErrorContext(ctx, "product export failed", "format", format, "error", err)
+	}
+	return nil
+}
+
+func formatFromContentType(header string) string {
+	mediaType, _, _ := mime.ParseMediaType(header)
+	switch mediaType {
+	case "text/csv":
+		return productservice.FormatCSV
+	case "application/x-ndjson", "application/ndjson":
+		return productservice.FormatNDJSON
+	}
+	return ""
+}
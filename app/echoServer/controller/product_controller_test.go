@@ -0,0 +1,58 @@
+package controller_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ecom/app/echoServer/controller"
+	"ecom/model"
+	productservice "ecom/service/product"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// fakeProductRepo hanya mengisi method yang dipakai test, sisanya panic.
+type fakeProductRepo struct {
+	productservice.Repository
+	product *model.Product
+}
+
+func (f *fakeProductRepo) FindByID(ctx context.Context, id primitive.ObjectID) (*model.Product, error) {
+	cp := *f.product
+	return &cp, nil
+}
+
+func TestProductUpdate_StockBelowReserved(t *testing.T) {
+	product := &model.Product{
+		ID: primitive.NewObjectID(), SKU: "FUT-01", Name: "Lapangan Futsal",
+		Price: 100_000, Stock: 10, Reserved: 4, Status: model.ProductStatusActive,
+	}
+	h := controller.NewProductController(productservice.NewService(&fakeProductRepo{product: product}, nil))
+	e := echo.New()
+	e.PUT("/products/:id", h.Update)
+	e.PATCH("/products/:id", h.Patch)
+
+	for _, tt := range []struct {
+		method, contentType string
+	}{
+		{http.MethodPut, echo.MIMEApplicationJSON},
+		{http.MethodPatch, "application/merge-patch+json"},
+	} {
+		body := `{"sku": "FUT-01", "name": "Lapangan Futsal", "price": 100000, "stock": 3}`
+		if tt.method == http.MethodPatch {
+			body = `{"stock": 3}`
+		}
+		req := httptest.NewRequest(tt.method, "/products/"+product.ID.Hex(), strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, tt.contentType)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "reserved") {
+			t.Fatalf("%s: expected 400 for stock below reserved, got %d: %s", tt.method, rec.Code, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"ecom/model"
+	"ecom/service/reconciliation"
+	"ecom/service/report"
+
+	"github.com/labstack/echo/v4"
+)
+
+type ReportController struct {
+	reconciliation reconciliation.Service
+	sales          report.Service
+}
+
+func NewReportController(reconciliation reconciliation.Service, sales report.Service) *ReportController {
+	return &ReportController{reconciliation: reconciliation, sales: sales}
+}
+
+func (h *ReportController) Sales(c echo.Context) error {
+	var q model.SalesReportQuery
+	if err := c.Bind(&q); err != nil {
+		return respondError(c, http.StatusBadRequest, "invalid query", err.Error())
+	}
+
+	r, err := h.sales.Sales(c.Request().Context(), q)
+	if err != nil {
+		if errors.Is(err, report.ErrInvalidQuery) {
+			return respondError(c, http.StatusBadRequest, "invalid query", err.Error())
+		}
+		return respondError(c, http.StatusInternalServerError, "failed to build sales report", err.Error())
+	}
+	return respondOK(c, r)
+}
+
+func (h *ReportController) ReconciliationSummary(c echo.Context) error {
+	var q model.ReconciliationQuery
+	if err := c.Bind(&q); err != nil {
+		return respondError(c, http.StatusBadRequest, "invalid query", err.Error())
+	}
+
+	summary, err := h.reconciliation.Summary(c.Request().Context(), q)
+	if err != nil {
+		if errors.Is(err, reconciliation.ErrInvalidRange) {
+			return respondError(c, http.StatusBadRequest, "invalid date range", err.Error())
+		}
+		return respondError(c, http.StatusInternalServerError, "failed to reconcile", err.Error())
+	}
+	return respondOK(c, summary)
+}
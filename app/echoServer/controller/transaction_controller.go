@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"errors"
 	"net/http"
 
 	"ecom/model"
@@ -18,13 +19,24 @@ func NewTransactionController(svc txservice.Service) *TransactionController {
 }
 
 func (h *TransactionController) Create(c echo.Context) error {
+	p, err := currentPrincipal(c)
+	if err != nil {
+		return respondError(c, http.StatusUnauthorized, "unauthorized", nil)
+	}
+
 	var req model.CreateTransactionRequest
 	if err := c.Bind(&req); err != nil {
 		return respondError(c, http.StatusBadRequest, "invalid request body", err.Error())
 	}
 
-	tx, err := h.svc.CreateTransaction(c.Request().Context(), req)
+	tx, err := h.svc.CreateTransaction(c.Request().Context(), p, req)
 	if err != nil {
+		if errors.Is(err, txservice.ErrProductNotActive) {
+			return respondError(c, http.StatusConflict, "product is not available for sale", err.Error())
+		}
+		if errors.Is(err, txservice.ErrVariantRequired) || errors.Is(err, txservice.ErrVariantNotFound) {
+			return respondError(c, http.StatusBadRequest, "invalid variant", err.Error())
+		}
 		return respondError(c, http.StatusInternalServerError, "failed to create transaction", err.Error())
 	}
 
@@ -32,7 +44,12 @@ func (h *TransactionController) Create(c echo.Context) error {
 }
 
 func (h *TransactionController) GetAll(c echo.Context) error {
-	txs, err := h.svc.GetAll(c.Request().Context())
+	p, err := currentPrincipal(c)
+	if err != nil {
+		return respondError(c, http.StatusUnauthorized, "unauthorized", nil)
+	}
+
+	txs, err := h.svc.GetAll(c.Request().Context(), p)
 	if err != nil {
 		return respondError(c, http.StatusInternalServerError, "failed to get transactions", err.Error())
 	}
@@ -40,31 +57,161 @@ func (h *TransactionController) GetAll(c echo.Context) error {
 }
 
 func (h *TransactionController) GetByID(c echo.Context) error {
+	p, err := currentPrincipal(c)
+	if err != nil {
+		return respondError(c, http.StatusUnauthorized, "unauthorized", nil)
+	}
+
+	id := c.Param("id")
+	tx, err := h.svc.GetByID(c.Request().Context(), p, id)
+	if err != nil {
+		return respondError(c, http.StatusNotFound, "transaction not found", err.Error())
+	}
+	if notModified(c, tx.Version) {
+		return c.NoContent(http.StatusNotModified)
+	}
+	return respondVersioned(c, tx.Version, tx)
+}
+
+// Lookup dipakai payment service (request sudah diverifikasi ServiceAuth).
+func (h *TransactionController) Lookup(c echo.Context) error {
 	id := c.Param("id")
-	tx, err := h.svc.GetByID(c.Request().Context(), id)
+	tx, err := h.svc.Lookup(c.Request().Context(), id)
 	if err != nil {
 		return respondError(c, http.StatusNotFound, "transaction not found", err.Error())
 	}
 	return respondOK(c, tx)
 }
 
+// ReviewPayment dipakai admin untuk approve/reject payment yang ditahan risk engine.
+func (h *TransactionController) ReviewPayment(c echo.Context) error {
+	p, err := currentPrincipal(c)
+	if err != nil {
+		return respondError(c, http.StatusUnauthorized, "unauthorized", nil)
+	}
+
+	var req model.TransactionPaymentReviewRequest
+	if err := c.Bind(&req); err != nil {
+		return respondError(c, http.StatusBadRequest, "invalid request body", err.Error())
+	}
+
+	tx, err := h.svc.ReviewPayment(c.Request().Context(), p, c.Param("id"), req)
+	if err != nil {
+		switch {
+		case errors.Is(err, txservice.ErrTransactionNotFound):
+			return respondError(c, http.StatusNotFound, "transaction not found", err.Error())
+		case errors.Is(err, txservice.ErrInvalidTransaction):
+			return respondError(c, http.StatusBadRequest, "invalid review", err.Error())
+		case errors.Is(err, txservice.ErrPaymentNotInReview):
+			return respondError(c, http.StatusConflict, "payment is not held for review", err.Error())
+		}
+		return respondError(c, http.StatusBadGateway, "failed to review payment", err.Error())
+	}
+	return respondOK(c, tx)
+}
+
+// ResolvePaymentReview dipanggil payment service setelah payment yang ditahan di-review.
+func (h *TransactionController) ResolvePaymentReview(c echo.Context) error {
+	var req model.PaymentReviewResult
+	if err := c.Bind(&req); err != nil {
+		return respondError(c, http.StatusBadRequest, "invalid request body", err.Error())
+	}
+
+	tx, err := h.svc.ResolvePaymentReview(c.Request().Context(), c.Param("id"), req)
+	if err != nil {
+		switch {
+		case errors.Is(err, txservice.ErrTransactionNotFound):
+			return respondError(c, http.StatusNotFound, "transaction not found", err.Error())
+		case errors.Is(err, txservice.ErrTransactionNotPending):
+			return respondError(c, http.StatusConflict, "transaction is no longer pending", err.Error())
+		}
+		return respondError(c, http.StatusInternalServerError, "failed to resolve payment review", err.Error())
+	}
+	return respondOK(c, tx)
+}
+
 func (h *TransactionController) Update(c echo.Context) error {
+	p, err := currentPrincipal(c)
+	if err != nil {
+		return respondError(c, http.StatusUnauthorized, "unauthorized", nil)
+	}
+
 	id := c.Param("id")
 	var req model.UpdateTransactionRequest
 	if err := c.Bind(&req); err != nil {
 		return respondError(c, http.StatusBadRequest, "invalid request body", err.Error())
 	}
 
-	tx, err := h.svc.Update(c.Request().Context(), id, req)
+	ifMatch, err := ifMatchVersion(c)
+	if err != nil {
+		return respondPreconditionFailed(c, err)
+	}
+
+	tx, err := h.svc.Update(c.Request().Context(), p, id, req, ifMatch)
 	if err != nil {
+		if errors.Is(err, txservice.ErrTransactionNotFound) {
+			return respondError(c, http.StatusNotFound, "transaction not found", err.Error())
+		}
+		if errors.Is(err, model.ErrVersionConflict) {
+			return respondPreconditionFailed(c, err)
+		}
+		if errors.Is(err, txservice.ErrTransactionNotEditable) {
+			return respondError(c, http.StatusConflict, "transaction can no longer be edited", err.Error())
+		}
+		if errors.Is(err, txservice.ErrInvalidTransaction) {
+			return respondError(c, http.StatusBadRequest, "invalid transaction", err.Error())
+		}
 		return respondError(c, http.StatusInternalServerError, "failed to update transaction", err.Error())
 	}
-	return respondOK(c, tx)
+	return respondVersioned(c, tx.Version, tx)
+}
+
+func (h *TransactionController) Patch(c echo.Context) error {
+	p, err := currentPrincipal(c)
+	if err != nil {
+		return respondError(c, http.StatusUnauthorized, "unauthorized", nil)
+	}
+
+	doc, err := bindMergePatch(c)
+	if err != nil {
+		if errors.Is(err, echo.ErrUnsupportedMediaType) {
+			return respondError(c, http.StatusUnsupportedMediaType, "unsupported content type", "use application/merge-patch+json")
+		}
+		return respondError(c, http.StatusBadRequest, "invalid request body", err.Error())
+	}
+	ifMatch, err := ifMatchVersion(c)
+	if err != nil {
+		return respondPreconditionFailed(c, err)
+	}
+
+	tx, err := h.svc.Patch(c.Request().Context(), p, c.Param("id"), doc, ifMatch)
+	if err != nil {
+		switch {
+		case errors.Is(err, txservice.ErrTransactionNotFound):
+			return respondError(c, http.StatusNotFound, "transaction not found", err.Error())
+		case errors.Is(err, model.ErrVersionConflict):
+			return respondPreconditionFailed(c, err)
+		case errors.Is(err, txservice.ErrTransactionNotEditable):
+			return respondError(c, http.StatusConflict, "transaction can no longer be edited", err.Error())
+		case errors.Is(err, txservice.ErrInvalidTransaction):
+			return respondError(c, http.StatusBadRequest, "invalid transaction", err.Error())
+		}
+		return respondError(c, http.StatusInternalServerError, "failed to update transaction", err.Error())
+	}
+	return respondVersioned(c, tx.Version, tx)
 }
 
 func (h *TransactionController) Delete(c echo.Context) error {
+	p, err := currentPrincipal(c)
+	if err != nil {
+		return respondError(c, http.StatusUnauthorized, "unauthorized", nil)
+	}
+
 	id := c.Param("id")
-	if err := h.svc.Delete(c.Request().Context(), id); err != nil {
+	if err := h.svc.Delete(c.Request().Context(), p, id); err != nil {
+		if errors.Is(err, txservice.ErrTransactionNotFound) {
+			return respondError(c, http.StatusNotFound, "transaction not found", err.Error())
+		}
 		return respondError(c, http.StatusInternalServerError, "failed to delete transaction", err.Error())
 	}
 	return respondOK(c, echo.Map{"deleted": true})
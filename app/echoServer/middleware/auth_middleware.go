@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"ecom/model"
+
+	"github.com/labstack/echo/v4"
+)
+
+const principalKey = "principal"
+
+type AccessTokenParser interface {
+	ParseAccess(token string) (*model.Principal, error)
+}
+
+// Auth requires a valid "Authorization: Bearer <access token>" header and
+// stores the caller on the echo context.
+func Auth(parser AccessTokenParser) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			header := c.Request().Header.Get(echo.HeaderAuthorization)
+			token, ok := strings.CutPrefix(header, "Bearer ")
+			if !ok || token == "" {
+				return RespondError(c, http.StatusUnauthorized, "missing bearer token", nil)
+			}
+
+			p, err := parser.ParseAccess(token)
+			if err != nil {
+				return RespondError(c, http.StatusUnauthorized, "invalid access token", err.Error())
+			}
+
+			c.Set(principalKey, *p)
+			return next(c)
+		}
+	}
+}
+
+// PrincipalFrom returns the caller stored by Auth.
+func PrincipalFrom(c echo.Context) (model.Principal, bool) {
+	p, ok := c.Get(principalKey).(model.Principal)
+	return p, ok
+}
+
+// RequirePermission rejects callers whose role lacks perm. It must run after Auth.
+func RequirePermission(perm model.Permission) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			p, ok := PrincipalFrom(c)
+			if !ok {
+				return RespondError(c, http.StatusUnauthorized, "missing bearer token", nil)
+			}
+
+			if !p.Can(perm) {
+				return RespondError(c, http.StatusForbidden, "forbidden", echo.Map{
+					"required_permission": perm,
+					"role":                p.Role,
+				})
+			}
+			return next(c)
+		}
+	}
+}
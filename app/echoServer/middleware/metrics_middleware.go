@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type HTTPMetrics interface {
+	ObserveHTTPRequest(method, route string, status int, d time.Duration)
+}
+
+// Metrics reports every request to m, labelled with the route pattern
+// (e.g. /products/:id) rather than the raw path to keep label values bounded.
+func Metrics(m HTTPMetrics) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+			if err != nil {
+				// tulis response error sekarang supaya status-nya tercatat
+				c.Error(err)
+			}
+
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+			m.ObserveHTTPRequest(c.Request().Method, route, c.Response().Status, time.Since(start))
+			return nil
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"ecom/model"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maxKeyBodySize bounds how much of the body RateLimitByBodyEmail reads.
+const maxKeyBodySize = 1 << 20
+
+type RateLimiter interface {
+	Allow(ctx context.Context, key string) (model.RateLimitDecision, error)
+}
+
+// RateLimitKey picks the client a request is counted against. An empty key
+// means the request is not counted by that key.
+type RateLimitKey func(c echo.Context) string
+
+// IPExtractor tells echo how to find the client IP for c.RealIP. With no
+// trusted proxies it is the address of the connection, since X-Forwarded-For
+// and X-Real-IP are sent by the client and anyone can change them. Behind
+// proxies, only the X-Forwarded-For entries appended by a proxy in cidrs are
+// believed.
+func IPExtractor(cidrs []string) (echo.IPExtractor, error) {
+	if len(cidrs) == 0 {
+		return echo.ExtractIPDirect(), nil
+	}
+	// loopback, link-local dan private network tidak dipercaya otomatis
+	opts := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q: %w", cidr, err)
+		}
+		opts = append(opts, echo.TrustIPRange(ipNet))
+	}
+	return echo.ExtractIPFromXFFHeader(opts...), nil
+}
+
+// RateLimitByIP counts requests per client IP, as found by the IPExtractor
+// of the server.
+func RateLimitByIP(c echo.Context) string {
+	return "ip:" + c.RealIP()
+}
+
+// RateLimitByPrincipalEmail counts requests per logged in customer. It must run after Auth.
+func RateLimitByPrincipalEmail(c echo.Context) string {
+	p, ok := PrincipalFrom(c)
+	if !ok || p.Email == "" {
+		return ""
+	}
+	return "email:" + strings.ToLower(p.Email)
+}
+
+// RateLimitByBodyEmail counts requests per "email" field of a JSON body, for
+// routes without a logged in customer (login, payments from shopping).
+func RateLimitByBodyEmail(c echo.Context) string {
+	req := c.Request()
+	body, err := io.ReadAll(io.LimitReader(req.Body, maxKeyBodySize))
+	if err != nil {
+		return ""
+	}
+	// body dikembalikan untuk handler berikutnya
+	req.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), req.Body))
+
+	var payload struct {
+		Email string `json:"email"`
+	}
+	if json.Unmarshal(body, &payload) != nil || payload.Email == "" {
+		return ""
+	}
+	return "email:" + strings.ToLower(strings.TrimSpace(payload.Email))
+}
+
+// RateLimit takes a token for every key of the request and answers 429 with
+// Retry-After as soon as one of them is out. The X-RateLimit-* headers show
+// the tightest of the buckets. If the limiter's store fails the request is let
+// through: an outage of the store must not take the route down with it. A nil
+// limiter (a disabled route) lets every request through.
+func RateLimit(limiter RateLimiter, keys ...RateLimitKey) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		if limiter == nil {
+			return next
+		}
+		return func(c echo.Context) error {
+			ctx := c.Request().Context()
+
+			var tightest *model.RateLimitDecision
+			for _, keyOf := range keys {
+				key := keyOf(c)
+				if key == "" {
+					continue
+				}
+				d, err := limiter.Allow(ctx, key)
+				if err != nil {
+					slog.WarnContext(ctx, "rate limit unavailable, request let through", "key", key, "error", err)
+					continue
+				}
+				if tightest == nil || !d.Allowed || d.Remaining < tightest.Remaining {
+					tightest = &d
+				}
+				if !d.Allowed {
+					break
+				}
+			}
+			if tightest == nil {
+				return next(c)
+			}
+
+			h := c.Response().Header()
+			h.Set("X-RateLimit-Limit", strconv.Itoa(tightest.Limit))
+			h.Set("X-RateLimit-Remaining", strconv.Itoa(tightest.Remaining))
+			h.Set("X-RateLimit-Reset", strconv.Itoa(seconds(tightest.Reset)))
+			if tightest.Allowed {
+				return next(c)
+			}
+
+			retryAfter := seconds(tightest.RetryAfter)
+			h.Set("Retry-After", strconv.Itoa(retryAfter))
+			return RespondError(c, http.StatusTooManyRequests, "too many requests", echo.Map{"retry_after_seconds": retryAfter})
+		}
+	}
+}
+
+// seconds rounds d up to whole seconds, as Retry-After and X-RateLimit-Reset
+// can't express less; a client waiting that long finds a token.
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
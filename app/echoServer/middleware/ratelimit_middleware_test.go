@@ -0,0 +1,104 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ecom/app/echoServer/middleware"
+	"ecom/model"
+
+	"github.com/labstack/echo/v4"
+)
+
+// keyRecorder mengizinkan satu request per key.
+type keyRecorder struct {
+	keys []string
+	seen map[string]bool
+}
+
+func (r *keyRecorder) Allow(ctx context.Context, key string) (model.RateLimitDecision, error) {
+	r.keys = append(r.keys, key)
+	allowed := !r.seen[key]
+	r.seen[key] = true
+	return model.RateLimitDecision{Allowed: allowed, Limit: 1}, nil
+}
+
+func TestRateLimitByIP_SpoofedHeadersShareTheBucket(t *testing.T) {
+	tests := []struct {
+		name       string
+		proxies    []string
+		remoteAddr string
+		headers    []map[string]string
+		wantKey    string
+	}{
+		{
+			name:       "direct client",
+			remoteAddr: "203.0.113.7:5000",
+			headers: []map[string]string{
+				{"X-Forwarded-For": "1.1.1.1"},
+				{"X-Real-IP": "2.2.2.2"},
+				{"X-Forwarded-For": "10.0.0.1, 3.3.3.3"},
+			},
+			wantKey: "ip:203.0.113.7",
+		},
+		{
+			name:       "behind a trusted proxy",
+			proxies:    []string{"10.0.0.0/8"},
+			remoteAddr: "10.0.0.2:5000",
+			headers: []map[string]string{
+				{"X-Forwarded-For": "203.0.113.7"},
+				{"X-Forwarded-For": "1.1.1.1, 203.0.113.7"},
+				{"X-Forwarded-For": "10.9.9.9, 203.0.113.7", "X-Real-IP": "2.2.2.2"},
+			},
+			wantKey: "ip:203.0.113.7",
+		},
+		{
+			name:       "untrusted hop in the private network",
+			proxies:    []string{"10.0.0.0/8"},
+			remoteAddr: "192.168.1.5:5000",
+			headers: []map[string]string{
+				{"X-Forwarded-For": "1.1.1.1"},
+				{"X-Forwarded-For": "2.2.2.2"},
+			},
+			wantKey: "ip:192.168.1.5",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			extractor, err := middleware.IPExtractor(tt.proxies)
+			if err != nil {
+				t.Fatalf("IPExtractor returned error: %v", err)
+			}
+			limiter := &keyRecorder{seen: map[string]bool{}}
+			e := echo.New()
+			e.IPExtractor = extractor
+			e.POST("/auth/login", func(c echo.Context) error { return c.NoContent(http.StatusNoContent) },
+				middleware.RateLimit(limiter, middleware.RateLimitByIP))
+
+			for i, headers := range tt.headers {
+				req := httptest.NewRequest(http.MethodPost, "/auth/login", nil)
+				req.RemoteAddr = tt.remoteAddr
+				for k, v := range headers {
+					req.Header.Set(k, v)
+				}
+				rec := httptest.NewRecorder()
+				e.ServeHTTP(rec, req)
+
+				if limiter.keys[i] != tt.wantKey {
+					t.Fatalf("request %d: expected key %q, got %q", i+1, tt.wantKey, limiter.keys[i])
+				}
+				if i > 0 && rec.Code != http.StatusTooManyRequests {
+					t.Fatalf("request %d: expected a spoofed header not to get a new bucket, got %d", i+1, rec.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestIPExtractor_InvalidCIDR(t *testing.T) {
+	if _, err := middleware.IPExtractor([]string{"10.0.0.0"}); err == nil {
+		t.Fatal("expected an error for a proxy that is not a CIDR")
+	}
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"ecom/util/logging"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maxRequestIDLen bounds request IDs accepted from clients, since they end up
+// in every log line.
+const maxRequestIDLen = 128
+
+// RequestID gives every request an ID: the X-Request-ID sent by the caller
+// (e.g. shopping calling payment) when it is usable, a new one otherwise. The
+// ID is put in the request context and echoed in the response header.
+func RequestID() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			id := req.Header.Get(logging.HeaderRequestID)
+			if !validRequestID(id) {
+				id = logging.NewRequestID()
+			}
+			c.SetRequest(req.WithContext(logging.WithRequestID(req.Context(), id)))
+			c.Response().Header().Set(logging.HeaderRequestID, id)
+			return next(c)
+		}
+	}
+}
+
+// RespondError writes the error body shared by the middlewares and the
+// controllers. It carries the request ID, so a failed call reported by a
+// client can be found in the logs.
+func RespondError(c echo.Context, code int, msg string, detail any) error {
+	return c.JSON(code, echo.Map{
+		"message":    msg,
+		"detail":     detail,
+		"request_id": logging.RequestID(c.Request().Context()),
+	})
+}
+
+// validRequestID accepts printable ASCII without spaces, so a client can't
+// inject fields or line breaks into the logs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' || id[i] == '"' {
+			return false
+		}
+	}
+	return true
+}
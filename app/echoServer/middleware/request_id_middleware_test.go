@@ -0,0 +1,108 @@
+package middleware_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ecom/app/echoServer/middleware"
+	"ecom/model"
+	"ecom/util/logging"
+
+	"github.com/labstack/echo/v4"
+)
+
+type fakeTokenParser struct {
+	principal model.Principal
+}
+
+func (f fakeTokenParser) ParseAccess(token string) (*model.Principal, error) {
+	if token != "valid" {
+		return nil, errors.New("token is malformed")
+	}
+	return &f.principal, nil
+}
+
+type rejectingVerifier struct{}
+
+func (rejectingVerifier) VerifyRequest(req *http.Request, body []byte) error {
+	return errors.New("invalid request signature")
+}
+
+func TestRequestID_GeneratedWhenMissingOrInvalid(t *testing.T) {
+	e := echo.New()
+	e.Use(middleware.RequestID())
+	var inCtx string
+	e.GET("/ping", func(c echo.Context) error {
+		inCtx = logging.RequestID(c.Request().Context())
+		return c.NoContent(http.StatusNoContent)
+	})
+
+	for _, header := range []string{"", "bad id\nwith newline", strings.Repeat("x", 200)} {
+		req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		if header != "" {
+			req.Header.Set(logging.HeaderRequestID, header)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		got := rec.Header().Get(logging.HeaderRequestID)
+		if got == "" || got == header || got != inCtx {
+			t.Fatalf("header %q: expected a new request id in the response and context, got %q / %q", header, got, inCtx)
+		}
+	}
+}
+
+// Error dari middleware memakai bentuk body yang sama dengan controller.
+func TestRequestID_InMiddlewareErrorBodies(t *testing.T) {
+	const requestID = "checkout-42"
+
+	e := echo.New()
+	e.Use(middleware.RequestID())
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusNoContent) }
+	auth := middleware.Auth(fakeTokenParser{principal: model.Principal{Role: model.RoleCustomer}})
+	e.GET("/me", ok, auth)
+	e.GET("/admin", ok, auth, middleware.RequirePermission(model.PermissionJobManage))
+	e.POST("/internal", ok, middleware.ServiceAuth(rejectingVerifier{}))
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		code   int
+	}{
+		{name: "missing token", method: http.MethodGet, path: "/me", code: http.StatusUnauthorized},
+		{name: "invalid token", method: http.MethodGet, path: "/me", token: "forged", code: http.StatusUnauthorized},
+		{name: "missing permission", method: http.MethodGet, path: "/admin", token: "valid", code: http.StatusForbidden},
+		{name: "bad signature", method: http.MethodPost, path: "/internal", code: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set(logging.HeaderRequestID, requestID)
+			if tt.token != "" {
+				req.Header.Set(echo.HeaderAuthorization, "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tt.code {
+				t.Fatalf("expected %d, got %d: %s", tt.code, rec.Code, rec.Body)
+			}
+			var body map[string]any
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("expected a JSON body, got %s", rec.Body)
+			}
+			if body["request_id"] != requestID || body["message"] == "" {
+				t.Fatalf("expected message and request_id %q in the body, got %s", requestID, rec.Body)
+			}
+			if _, ok := body["detail"]; !ok {
+				t.Fatalf("expected a detail field, got %s", rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package middleware_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ecom/app/echoServer/middleware"
+
+	"github.com/labstack/echo/v4"
+)
+
+type acceptingVerifier struct{}
+
+func (acceptingVerifier) VerifyRequest(req *http.Request, body []byte) error { return nil }
+
+func TestServiceAuth_BodySize(t *testing.T) {
+	e := echo.New()
+	var got int
+	e.POST("/internal", func(c echo.Context) error {
+		body, err := io.ReadAll(c.Request().Body)
+		if err != nil {
+			return err
+		}
+		got = len(body)
+		return c.NoContent(http.StatusNoContent)
+	}, middleware.ServiceAuth(acceptingVerifier{}))
+
+	tests := []struct {
+		name string
+		size int
+		code int
+	}{
+		{name: "within limit", size: 1 << 20, code: http.StatusNoContent},
+		{name: "over limit", size: 1<<20 + 1, code: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = 0
+			req := httptest.NewRequest(http.MethodPost, "/internal", strings.NewReader(strings.Repeat("x", tt.size)))
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tt.code {
+				t.Fatalf("expected %d, got %d: %s", tt.code, rec.Code, rec.Body)
+			}
+			// handler tetap menerima body utuh setelah diverifikasi
+			if tt.code == http.StatusNoContent && got != tt.size {
+				t.Fatalf("expected the handler to read %d bytes, got %d", tt.size, got)
+			}
+		})
+	}
+}
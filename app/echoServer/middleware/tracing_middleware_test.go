@@ -0,0 +1,88 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ecom/app/echoServer/middleware"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func installTracer(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	exp := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+	prevTP, prevProp := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevTP)
+		otel.SetTextMapPropagator(prevProp)
+	})
+	return exp
+}
+
+func TestTracing_ServerSpanContinuesIncomingTrace(t *testing.T) {
+	exp := installTracer(t)
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+	e := echo.New()
+	e.Use(middleware.Tracing())
+	var inHandler trace.SpanContext
+	e.GET("/products/:id", func(c echo.Context) error {
+		inHandler = trace.SpanContextFromContext(c.Request().Context())
+		return echo.NewHTTPError(http.StatusInternalServerError, "boom")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/products/42", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected the handler error to be answered, got %d", rec.Code)
+	}
+	spans := exp.GetSpans()
+	if len(spans) != 1 || spans[0].Name != "GET /products/:id" {
+		t.Fatalf("expected one span named after the route, got %v", spans)
+	}
+	span := spans[0]
+	if span.SpanKind != trace.SpanKindServer || span.SpanContext.TraceID().String() != traceID {
+		t.Fatalf("expected a server span continuing trace %s, got %s", traceID, span.SpanContext.TraceID())
+	}
+	if inHandler.SpanID() != span.SpanContext.SpanID() {
+		t.Fatal("expected the handler to run inside the server span")
+	}
+	if span.Status.Code != codes.Error {
+		t.Fatal("expected a 5xx response to mark the span as failed")
+	}
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	if attrs["http.route"].AsString() != "/products/:id" || attrs["http.response.status_code"].AsInt64() != http.StatusInternalServerError {
+		t.Fatalf("expected route and status attributes, got %v", span.Attributes)
+	}
+}
+
+func TestTracing_UnmatchedRoute(t *testing.T) {
+	exp := installTracer(t)
+	e := echo.New()
+	e.Use(middleware.Tracing())
+
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/nope", nil))
+
+	spans := exp.GetSpans()
+	if len(spans) != 1 || spans[0].Name != "GET unmatched" {
+		t.Fatalf("expected a span for the unmatched route, got %v", spans)
+	}
+}
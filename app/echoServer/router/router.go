@@ -1,35 +1,118 @@
 package router
 
 import (
+	"net/http"
+
 	Controller "ecom/app/echoServer/controller"
+	"ecom/app/echoServer/middleware"
+	"ecom/model"
 
 	"github.com/labstack/echo/v4"
 )
 
-func New(e *echo.Echo, paymentController *Controller.PaymentController) {
-	e.POST("/payments", paymentController.CreatePayment)
-}
+func RegisterPaymentRoutes(
+	e *echo.Echo,
+	paymentController *Controller.PaymentController,
+	healthController *Controller.HealthController,
+	metrics http.Handler,
+	serviceAuth echo.MiddlewareFunc,
+	paymentLimit echo.MiddlewareFunc,
+) {
+	// probes docker/k8s dan scrape Prometheus, publik
+	e.GET("/healthz", healthController.Live)
+	e.GET("/readyz", healthController.Ready)
+	e.GET("/metrics", echo.WrapHandler(metrics))
 
-func RegisterPaymentRoutes(e *echo.Echo, paymentController *Controller.PaymentController) {
-	e.POST("/payments", paymentController.CreatePayment)
+	// hanya boleh dipanggil service lain (request ditandatangani HMAC);
+	// review oleh admin masuk lewat POST /transactions/:id/payment-review di shopping
+	payments := e.Group("/payments", serviceAuth)
+	payments.POST("", paymentController.CreatePayment, paymentLimit)
+	payments.GET("", paymentController.List)
+	payments.GET("/:id", paymentController.GetByID)
+	payments.POST("/intents", paymentController.CreateIntent, paymentLimit)
+	payments.POST("/:id/authorize", paymentController.Authorize)
+	payments.POST("/:id/capture", paymentController.Capture)
+	payments.POST("/:id/void", paymentController.Void)
+	payments.POST("/:id/review", paymentController.Review)
 }
 
 func RegisterShoppingRoutes(
 	e *echo.Echo,
 	productController *Controller.ProductController,
+	categoryController *Controller.CategoryController,
 	transactionController *Controller.TransactionController,
+	authController *Controller.AuthController,
+	reportController *Controller.ReportController,
+	jobController *Controller.JobController,
+	healthController *Controller.HealthController,
+	metrics http.Handler,
+	authMiddleware echo.MiddlewareFunc,
+	serviceAuth echo.MiddlewareFunc,
+	authLimit echo.MiddlewareFunc,
+	transactionLimit echo.MiddlewareFunc,
 ) {
-	// products
-	e.POST("/products", productController.Create)
+	// probes docker/k8s dan scrape Prometheus, publik
+	e.GET("/healthz", healthController.Live)
+	e.GET("/readyz", healthController.Ready)
+	e.GET("/metrics", echo.WrapHandler(metrics))
+
+	// auth (rate limit per IP dan per email, tebak password / spam register)
+	e.POST("/auth/register", authController.Register, authLimit)
+	e.POST("/auth/login", authController.Login, authLimit)
+	e.POST("/auth/refresh", authController.Refresh, authLimit)
+	e.GET("/auth/me", authController.Me, authMiddleware)
+
+	// customers (admin)
+	e.PUT("/customers/:id/role", authController.SetRole, authMiddleware, middleware.RequirePermission(model.PermissionCustomerManage))
+
+	// products (read publik, write admin)
+	productWrite := []echo.MiddlewareFunc{authMiddleware, middleware.RequirePermission(model.PermissionProductWrite)}
+	e.POST("/products", productController.Create, productWrite...)
 	e.GET("/products", productController.GetAll)
+	e.GET("/products/search", productController.Search)
+	e.GET("/products/search/suggest", productController.Suggest)
+	e.POST("/products/import", productController.Import, productWrite...)
+	e.GET("/products/export", productController.Export, productWrite...)
 	e.GET("/products/:id", productController.GetByID)
-	e.PUT("/products/:id", productController.Update)
-	e.DELETE("/products/:id", productController.Delete)
-
-	// transactions
-	e.POST("/transactions", transactionController.Create)
-	e.GET("/transactions", transactionController.GetAll)
-	e.GET("/transactions/:id", transactionController.GetByID)
-	e.PUT("/transactions/:id", transactionController.Update)
-	e.DELETE("/transactions/:id", transactionController.Delete)
+	e.PUT("/products/:id", productController.Update, productWrite...)
+	e.PATCH("/products/:id", productController.Patch, productWrite...)
+	e.DELETE("/products/:id", productController.Delete, productWrite...)
+	e.POST("/products/:id/variants", productController.AddVariant, productWrite...)
+	e.PUT("/products/:id/variants/:variantId", productController.UpdateVariant, productWrite...)
+	e.DELETE("/products/:id/variants/:variantId", productController.DeleteVariant, productWrite...)
+
+	// categories (read publik, write admin)
+	e.GET("/categories", categoryController.GetAll)
+	e.GET("/categories/:id", categoryController.GetByID)
+	e.POST("/categories", categoryController.Create, productWrite...)
+	e.PUT("/categories/:id", categoryController.Update, productWrite...)
+	e.DELETE("/categories/:id", categoryController.Delete, productWrite...)
+
+	// transactions (customer login required)
+	tx := e.Group("/transactions", authMiddleware)
+	tx.POST("", transactionController.Create, transactionLimit)
+	tx.GET("", transactionController.GetAll)
+	tx.GET("/:id", transactionController.GetByID)
+	// koreksi transaksi PENDING hanya oleh admin, customer tidak bisa mengubah pesanan sendiri
+	tx.PUT("/:id", transactionController.Update, middleware.RequirePermission(model.PermissionTransactionWriteAll))
+	tx.PATCH("/:id", transactionController.Patch, middleware.RequirePermission(model.PermissionTransactionWriteAll))
+	tx.DELETE("/:id", transactionController.Delete, middleware.RequirePermission(model.PermissionTransactionDelete))
+	// review payment yang ditahan risk engine, diteruskan ke payment service dengan request bertanda tangan
+	tx.POST("/:id/payment-review", transactionController.ReviewPayment, middleware.RequirePermission(model.PermissionPaymentReview))
+
+	// reports (admin/staff)
+	reports := e.Group("/reports", authMiddleware, middleware.RequirePermission(model.PermissionReportRead))
+	reports.GET("/sales", reportController.Sales)
+	reports.GET("/reconciliation/summary", reportController.ReconciliationSummary)
+
+	// scheduled jobs (admin)
+	admin := e.Group("/admin", authMiddleware, middleware.RequirePermission(model.PermissionJobManage))
+	admin.GET("/jobs", jobController.List)
+	admin.GET("/jobs/:name/runs", jobController.Runs)
+	admin.POST("/jobs/:name/trigger", jobController.Trigger)
+
+	// internal (service-to-service, request ditandatangani HMAC)
+	internal := e.Group("/internal", serviceAuth)
+	internal.GET("/transactions/:id", transactionController.Lookup)
+	internal.POST("/transactions/:id/payment-review", transactionController.ResolvePaymentReview)
 }
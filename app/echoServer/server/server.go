@@ -0,0 +1,51 @@
+// Package server runs an Echo server until the process is asked to stop, then
+// shuts it down gracefully.
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Hook releases a resource after the HTTP server has drained, e.g. stopping
+// the scheduler or disconnecting Mongo. ctx carries the shutdown deadline.
+type Hook func(ctx context.Context) error
+
+// Run serves e on addr until ctx is done. It then stops accepting requests,
+// waits up to timeout for in-flight ones to finish, and runs hooks in order
+// within what is left of that deadline.
+func Run(ctx context.Context, e *echo.Echo, addr string, timeout time.Duration, hooks ...Hook) error {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- e.Start(addr)
+	}()
+
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+	case <-ctx.Done():
+		slog.Info("shutting down, draining requests", "timeout", timeout)
+	}
+
+	// ctx sudah dibatalkan, deadline shutdown dihitung dari sekarang
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	var errs []error
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		errs = append(errs, err)
+	}
+	for _, hook := range hooks {
+		if err := hook(shutdownCtx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,164 @@
+package server_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"ecom/app/echoServer/server"
+
+	"github.com/labstack/echo/v4"
+)
+
+type result struct {
+	status int
+	body   string
+	err    error
+}
+
+// start runs e with server.Run until the returned stop is called, and a
+// handler on /slow that blocks until release is closed.
+func start(t *testing.T, timeout time.Duration, release <-chan struct{}, hooks ...server.Hook) (addr string, inFlight <-chan struct{}, stop context.CancelFunc, runErr <-chan error) {
+	t.Helper()
+	started := make(chan struct{}, 1)
+
+	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+	e.GET("/slow", func(c echo.Context) error {
+		started <- struct{}{}
+		<-release
+		return c.String(http.StatusOK, "done")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.Run(ctx, e, "127.0.0.1:0", timeout, hooks...)
+	}()
+
+	for i := 0; i < 200; i++ {
+		if a := e.ListenerAddr(); a != nil {
+			return a.String(), started, cancel, errCh
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("server did not start")
+	return "", nil, nil, nil
+}
+
+func get(addr string) <-chan result {
+	resCh := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr + "/slow")
+		if err != nil {
+			resCh <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		resCh <- result{status: resp.StatusCode, body: string(body)}
+	}()
+	return resCh
+}
+
+func waitInFlight(t *testing.T, inFlight <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-inFlight:
+	case <-time.After(5 * time.Second):
+		t.Fatal("request never reached the handler")
+	}
+}
+
+// SIGTERM di tengah request: listener ditutup, request yang sedang jalan
+// selesai, baru hook (stop scheduler, tutup Mongo) dijalankan.
+func TestRun_DrainsInFlightRequests(t *testing.T) {
+	release := make(chan struct{})
+	requestDone := make(chan struct{})
+	var hookAfterRequest bool
+	hook := func(context.Context) error {
+		select {
+		case <-requestDone:
+			hookAfterRequest = true
+		default:
+		}
+		return nil
+	}
+	addr, inFlight, stop, runErr := start(t, 5*time.Second, release, hook)
+
+	resCh := get(addr)
+	waitInFlight(t, inFlight)
+
+	// SIGTERM
+	stop()
+
+	// listener ditutup, koneksi baru ditolak
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		conn, err := net.DialTimeout("tcp", addr, 100*time.Millisecond)
+		if err != nil {
+			break
+		}
+		conn.Close()
+		if time.Now().After(deadline) {
+			t.Fatal("server still accepts connections after shutdown started")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	select {
+	case err := <-runErr:
+		t.Fatalf("server stopped with a request in flight: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	res := <-resCh
+	close(requestDone)
+	if res.err != nil {
+		t.Fatalf("in-flight request failed: %v", res.err)
+	}
+	if res.status != http.StatusOK || res.body != "done" {
+		t.Fatalf("expected 200 done, got %d: %s", res.status, res.body)
+	}
+
+	if err := <-runErr; err != nil {
+		t.Fatalf("server.Run returned error: %v", err)
+	}
+	if !hookAfterRequest {
+		t.Fatal("expected the shutdown hook to run after the request finished")
+	}
+}
+
+// Request yang melewati timeout tidak ditunggu; hook tetap dijalankan.
+func TestRun_GivesUpAfterTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	hookRan := false
+	addr, inFlight, stop, runErr := start(t, 100*time.Millisecond, release, func(context.Context) error {
+		hookRan = true
+		return nil
+	})
+
+	get(addr)
+	waitInFlight(t, inFlight)
+	stop()
+
+	select {
+	case err := <-runErr:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server.Run did not give up after the timeout")
+	}
+	if !hookRan {
+		t.Fatal("expected the shutdown hook to run after the timeout")
+	}
+}
@@ -1,43 +1,143 @@
 package main
 
 import (
-	"log"
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
 
+	"ecom/app/cron/payment"
+	"ecom/app/cron/scheduler"
 	controller "ecom/app/echoServer/controller"
+	appmiddleware "ecom/app/echoServer/middleware"
 	"ecom/app/echoServer/router"
+	"ecom/app/echoServer/server"
 	"ecom/config"
+	jobrepo "ecom/repository/job"
 	paymentrepo "ecom/repository/payment"
+	ratelimitrepo "ecom/repository/ratelimit"
+	healthservice "ecom/service/health"
 	paymentservice "ecom/service/payment"
+	"ecom/service/ratelimit"
+	"ecom/util/auth"
 	"ecom/util/database"
+	"ecom/util/logging"
+	"ecom/util/metrics"
+	"ecom/util/tracing"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 )
 
 func main() {
-	// Load config (env)
-	cfg := config.Load()
+	// Config: default -> file (-config / CONFIG_FILE) -> env -> flag.
+	// "config print" menampilkan config efektif lalu keluar.
+	cfg := config.FromCommandLine(os.Args[1:])
+
+	// Log JSON ke stdout, dengan request_id dan trace_id dari context
+	level, err := logging.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		logging.Fatal("invalid LOG_LEVEL", "value", cfg.LogLevel, "error", err)
+	}
+	logger := logging.New(os.Stdout, level, "payment")
+	slog.SetDefault(logger)
+
+	// SIGTERM/SIGINT: stop terima request, tunggu yang sedang jalan, lalu tutup
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// OpenTelemetry; exporter "none" tetap meneruskan traceparent
+	shutdownTracing, err := tracing.Setup(ctx, cfg, "payment")
+	if err != nil {
+		logging.Fatal("tracing setup", "error", err)
+	}
 
 	// Connect ke Mongo
-	client := database.NewMongoClient(cfg)
+	m := metrics.New()
+	client := database.NewMongoClient(cfg, database.WithCommandMetrics(m), database.WithCommandTracing())
 	paymentCol := database.PaymentCollection(client, cfg)
+	jobLockCol := database.JobLockCollection(client, cfg)
+	jobRunCol := database.JobRunCollection(client, cfg)
 
 	// Wiring: repo → service → controller
 	paymentRepo := paymentrepo.NewRepository(paymentCol)
-	paymentSvc := paymentservice.NewService(paymentRepo)
+	shoppingClient := paymentservice.NewHTTPShoppingClient(cfg.ShoppingBaseURL, cfg.ServiceSecret)
+
+	// Rule risk engine (default kalau RISK_RULES_FILE kosong)
+	riskRules, err := paymentservice.LoadRiskRules(cfg.RiskRulesFile)
+	if err != nil {
+		logging.Fatal("load risk rules", "file", cfg.RiskRulesFile, "error", err)
+	}
+
+	paymentSvc := paymentservice.NewService(paymentRepo, shoppingClient,
+		paymentservice.WithAuthorizationTTL(cfg.AuthorizationTTL),
+		// intent yang tidak di-authorize tidak berguna lagi setelah transaksinya di-expire shopping
+		paymentservice.WithIntentTTL(cfg.PendingTransactionTTL),
+		paymentservice.WithReviewTTL(cfg.PaymentReviewTTL),
+		paymentservice.WithRiskEngine(paymentservice.NewRiskEngine(riskRules, paymentRepo)),
+		paymentservice.WithLogger(logger),
+	)
 	paymentCtrl := controller.NewPaymentController(paymentSvc)
 
+	// Start cron job (expire otorisasi yang tidak di-capture)
+	sched := scheduler.New(jobrepo.NewRepository(jobLockCol, jobRunCol, jobrepo.WithLogger(logger)),
+		scheduler.WithMetrics(m),
+		scheduler.WithLogger(logger),
+	)
+	if err := sched.Register(config.JobAuthorizationExpire, cfg.Jobs[config.JobAuthorizationExpire],
+		payment.AuthorizationExpireJob(paymentSvc)); err != nil {
+		logging.Fatal("scheduler: register job", "error", err)
+	}
+	schedCtx, stopScheduler := context.WithCancel(context.Background())
+	sched.Start(schedCtx)
+
 	// Setup Echo
 	e := echo.New()
 
-	e.Use(middleware.Logger())
+	e.HideBanner = true
+	e.HidePort = true
+	// IP client untuk rate limit dan log, header hanya dipercaya dari proxy
+	ipExtractor, err := appmiddleware.IPExtractor(cfg.TrustedProxyCIDRs())
+	if err != nil {
+		logging.Fatal("trusted proxies", "error", err)
+	}
+	e.IPExtractor = ipExtractor
+	e.Use(appmiddleware.RequestID())
+	e.Use(appmiddleware.Tracing())
+	e.Use(appmiddleware.Logger(logger))
+	e.Use(appmiddleware.Metrics(m))
 	e.Use(middleware.Recover())
 
 	//routes khusus Payment
-	router.RegisterPaymentRoutes(e, paymentCtrl)
+	verifier := auth.NewSignatureVerifier(cfg.ServiceSecret, cfg.SignatureMaxSkew)
+	healthCtrl := controller.NewHealthController(healthservice.NewService(
+		healthservice.WithTimeout(cfg.HealthCheckTimeout),
+		healthservice.WithCheck("mongo", healthservice.MongoCheck(client)),
+		healthservice.WithCheck("scheduler", sched.Check),
+	))
+	limiters, err := ratelimit.Limiters(cfg, func() ratelimit.Store {
+		return ratelimitrepo.NewRepository(database.RateLimitCollection(client, cfg))
+	})
+	if err != nil {
+		logging.Fatal("rate limit config", "error", err)
+	}
+	// semua call datang dari shopping, jadi dibatasi per email customer, bukan per IP
+	router.RegisterPaymentRoutes(e, paymentCtrl, healthCtrl, m.Handler(), appmiddleware.ServiceAuth(verifier),
+		appmiddleware.RateLimit(limiters[config.RateLimitPaymentCreate], appmiddleware.RateLimitByBodyEmail),
+	)
 
-	log.Printf("Payment service listening on %s", cfg.PaymentPort)
-	if err := e.Start(cfg.PaymentPort); err != nil {
-		log.Fatal(err)
+	logger.Info("payment service listening", "addr", cfg.PaymentPort)
+	err = server.Run(ctx, e, cfg.PaymentPort, cfg.ShutdownTimeout,
+		func(ctx context.Context) error {
+			stopScheduler()
+			return sched.Wait(ctx)
+		},
+		client.Disconnect,
+		shutdownTracing,
+	)
+	if err != nil {
+		logging.Fatal("server stopped with error", "error", err)
 	}
+	logger.Info("payment service stopped")
 }
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"ecom/config"
+	paymentrepo "ecom/repository/payment"
+	txrepo "ecom/repository/transaction"
+	"ecom/service/reconciliation"
+	"ecom/util/database"
+)
+
+// Rekonsiliasi manual transaksi vs payment:
+//
+//	go run ./app/reconcile -from 2025-01-01 -to 2025-01-07 -format csv -out jan.csv
+//
+// Exit code 2 berarti ada mismatch, supaya bisa dipakai di script/CI.
+func main() {
+	from := flag.String("from", "", "start date (YYYY-MM-DD or RFC3339), default yesterday UTC")
+	to := flag.String("to", "", "end date, inclusive when a plain date")
+	format := flag.String("format", "json", "output format: json or csv")
+	out := flag.String("out", "", "output file, default stdout")
+	loader := config.NewLoader(flag.CommandLine)
+	flag.Parse()
+
+	cfg, err := loader.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	start, end, err := reconciliation.ParseRange(*from, *to, time.Now())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	client := database.NewMongoClient(cfg)
+	defer client.Disconnect(context.Background())
+
+	svc := reconciliation.NewService(
+		txrepo.NewRepository(database.TransactionCollection(client, cfg)),
+		paymentrepo.NewRepository(database.PaymentCollectionReadOnly(client, cfg)),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	report, err := svc.Run(ctx, start, end)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := reconciliation.Write(w, report, *format); err != nil {
+		log.Fatal(err)
+	}
+
+	s := report.Summary
+	fmt.Fprintf(os.Stderr, "checked %d transactions / %d payments: %d matched, %d mismatches\n",
+		s.TransactionsChecked, s.PaymentsChecked, s.Matched, s.Mismatches)
+	if s.Mismatches > 0 {
+		os.Exit(2)
+	}
+}
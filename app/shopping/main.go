@@ -1,58 +1,191 @@
 package main
 
 import (
-	"log"
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
 
+	"ecom/app/cron/scheduler"
 	"ecom/app/cron/shopping"
 	"ecom/app/echoServer/controller"
+	appmiddleware "ecom/app/echoServer/middleware"
 	"ecom/app/echoServer/router"
+	"ecom/app/echoServer/server"
 	"ecom/config"
+	categoryrepo "ecom/repository/category"
+	customerrepo "ecom/repository/customer"
+	jobrepo "ecom/repository/job"
+	paymentrepo "ecom/repository/payment"
 	productrepo "ecom/repository/product"
+	ratelimitrepo "ecom/repository/ratelimit"
+	reservationrepo "ecom/repository/reservation"
 	txrepo "ecom/repository/transaction"
+	categoryservice "ecom/service/category"
+	customerservice "ecom/service/customer"
+	healthservice "ecom/service/health"
 	productservice "ecom/service/product"
+	"ecom/service/ratelimit"
+	"ecom/service/reconciliation"
+	reportservice "ecom/service/report"
 	txservice "ecom/service/transaction"
+	"ecom/util/auth"
 	"ecom/util/database"
+	"ecom/util/logging"
+	"ecom/util/metrics"
+	"ecom/util/tracing"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 )
 
 func main() {
-	// Load config
-	cfg := config.Load()
+	// Config: default -> file (-config / CONFIG_FILE) -> env -> flag.
+	// "config print" menampilkan config efektif lalu keluar.
+	cfg := config.FromCommandLine(os.Args[1:])
+
+	// Log JSON ke stdout, dengan request_id dan trace_id dari context
+	level, err := logging.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		logging.Fatal("invalid LOG_LEVEL", "value", cfg.LogLevel, "error", err)
+	}
+	logger := logging.New(os.Stdout, level, "shopping")
+	slog.SetDefault(logger)
+
+	// SIGTERM/SIGINT: stop terima request, tunggu yang sedang jalan, lalu tutup
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// OpenTelemetry; exporter "none" tetap meneruskan traceparent
+	shutdownTracing, err := tracing.Setup(ctx, cfg, "shopping")
+	if err != nil {
+		logging.Fatal("tracing setup", "error", err)
+	}
+
+	// Prometheus, dipakai semua komponen di bawah
+	m := metrics.New()
 
 	// Connect Mongo
-	client := database.NewMongoClient(cfg)
+	client := database.NewMongoClient(cfg, database.WithCommandMetrics(m), database.WithCommandTracing())
 	productCol := database.ProductCollection(client, cfg)
+	categoryCol := database.CategoryCollection(client, cfg)
 	txCol := database.TransactionCollection(client, cfg)
+	reservationCol := database.ReservationCollection(client, cfg)
+	customerCol := database.CustomerCollection(client, cfg)
+	// payments hanya dibaca untuk rekonsiliasi; index dikelola service payment
+	paymentCol := database.PaymentCollectionReadOnly(client, cfg)
+	jobLockCol := database.JobLockCollection(client, cfg)
+	jobRunCol := database.JobRunCollection(client, cfg)
 
 	//Repo
-	prodRepo := productrepo.NewRepository(productCol)
-	transactionRepo := txrepo.NewRepository(txCol)
+	prodRepo := productrepo.NewRepository(productCol, productrepo.WithLogger(logger))
+	categoryRepo := categoryrepo.NewRepository(categoryCol)
+	transactionRepo := txrepo.NewRepository(txCol, txrepo.WithLogger(logger))
+	reservationRepo := reservationrepo.NewRepository(reservationCol)
+	customerRepo := customerrepo.NewRepository(customerCol)
+
+	// JWT access/refresh token
+	tokens := auth.NewTokenManager(cfg.JWTSecret, cfg.AccessTokenTTL, cfg.RefreshTokenTTL)
 
 	// Payment client
-	paymentClient := txservice.NewHTTPPaymentClient(cfg.PaymentBaseURL)
+	paymentClient := txservice.NewHTTPPaymentClient(cfg.PaymentBaseURL, cfg.ServiceSecret,
+		txservice.WithClientMetrics(m),
+	)
 
 	// Service
-	prodSvc := productservice.NewService(prodRepo)
-	txSvc := txservice.NewService(prodRepo, transactionRepo, paymentClient)
+	prodSvc := productservice.NewService(prodRepo, categoryRepo)
+	categorySvc := categoryservice.NewService(categoryRepo, prodRepo)
+	customerSvc := customerservice.NewService(customerRepo, tokens)
 
-	//Start cron job
-	shopping.StartTransactionExpireJob(txSvc)
+	// Promote admin pertama (harus sudah register)
+	if cfg.AdminEmail != "" {
+		if err := customerSvc.PromoteAdmin(context.Background(), cfg.AdminEmail); err != nil {
+			logger.Error("promote admin", "email", cfg.AdminEmail, "error", err)
+		}
+	}
+	txSvc := txservice.NewService(prodRepo, transactionRepo, reservationRepo, paymentClient,
+		txservice.WithReservationTTL(cfg.ReservationTTL),
+		txservice.WithPendingTTL(cfg.PendingTransactionTTL),
+		txservice.WithReviewTTL(cfg.PaymentReviewTTL),
+		txservice.WithMetrics(m),
+		txservice.WithLogger(logger),
+	)
+
+	reconciliationSvc := reconciliation.NewService(transactionRepo, paymentrepo.NewRepository(paymentCol))
+	salesSvc := reportservice.NewService(transactionRepo)
+
+	// Cron job, lease di Mongo supaya tiap job hanya jalan di satu replica
+	sched := scheduler.New(jobrepo.NewRepository(jobLockCol, jobRunCol, jobrepo.WithLogger(logger)),
+		scheduler.WithMetrics(m),
+		scheduler.WithLogger(logger),
+	)
+	for name, fn := range map[string]scheduler.Func{
+		config.JobTransactionExpire: shopping.TransactionExpireJob(txSvc),
+		config.JobReconciliation:    shopping.ReconciliationJob(reconciliationSvc, cfg.ReconciliationDir),
+	} {
+		if err := sched.Register(name, cfg.Jobs[name], fn); err != nil {
+			logging.Fatal("scheduler: register job", "error", err)
+		}
+	}
+	schedCtx, stopScheduler := context.WithCancel(context.Background())
+	sched.Start(schedCtx)
 
 	// Echo & controllers
 	e := echo.New()
-	e.Use(middleware.Logger())
+	e.HideBanner = true
+	e.HidePort = true
+	// IP client untuk rate limit dan log, header hanya dipercaya dari proxy
+	ipExtractor, err := appmiddleware.IPExtractor(cfg.TrustedProxyCIDRs())
+	if err != nil {
+		logging.Fatal("trusted proxies", "error", err)
+	}
+	e.IPExtractor = ipExtractor
+	e.Use(appmiddleware.RequestID())
+	e.Use(appmiddleware.Tracing())
+	e.Use(appmiddleware.Logger(logger))
+	e.Use(appmiddleware.Metrics(m))
 	e.Use(middleware.Recover())
 
 	productCtrl := controller.NewProductController(prodSvc)
+	categoryCtrl := controller.NewCategoryController(categorySvc)
 	transactionCtrl := controller.NewTransactionController(txSvc)
+	authCtrl := controller.NewAuthController(customerSvc)
+	reportCtrl := controller.NewReportController(reconciliationSvc, salesSvc)
+	jobCtrl := controller.NewJobController(sched)
+	healthCtrl := controller.NewHealthController(healthservice.NewService(
+		healthservice.WithTimeout(cfg.HealthCheckTimeout),
+		healthservice.WithCheck("mongo", healthservice.MongoCheck(client)),
+		healthservice.WithCheck("payment", healthservice.HTTPCheck(cfg.PaymentBaseURL+"/healthz")),
+		healthservice.WithCheck("scheduler", sched.Check),
+	))
 
-	//routes shopping (products + transactions)
-	router.RegisterShoppingRoutes(e, productCtrl, transactionCtrl)
+	//routes shopping (auth + products + transactions)
+	limiters, err := ratelimit.Limiters(cfg, func() ratelimit.Store {
+		return ratelimitrepo.NewRepository(database.RateLimitCollection(client, cfg))
+	})
+	if err != nil {
+		logging.Fatal("rate limit config", "error", err)
+	}
+	verifier := auth.NewSignatureVerifier(cfg.ServiceSecret, cfg.SignatureMaxSkew)
+	router.RegisterShoppingRoutes(e, productCtrl, categoryCtrl, transactionCtrl, authCtrl, reportCtrl, jobCtrl, healthCtrl, m.Handler(),
+		appmiddleware.Auth(tokens),
+		appmiddleware.ServiceAuth(verifier),
+		appmiddleware.RateLimit(limiters[config.RateLimitAuth], appmiddleware.RateLimitByIP, appmiddleware.RateLimitByBodyEmail),
+		appmiddleware.RateLimit(limiters[config.RateLimitTransactionCreate], appmiddleware.RateLimitByIP, appmiddleware.RateLimitByPrincipalEmail),
+	)
 
-	log.Printf("Shopping service listening on %s", cfg.ShoppingPort)
-	if err := e.Start(cfg.ShoppingPort); err != nil {
-		log.Fatal(err)
+	logger.Info("shopping service listening", "addr", cfg.ShoppingPort)
+	err = server.Run(ctx, e, cfg.ShoppingPort, cfg.ShutdownTimeout,
+		func(ctx context.Context) error {
+			stopScheduler()
+			return sched.Wait(ctx)
+		},
+		client.Disconnect,
+		shutdownTracing,
+	)
+	if err != nil {
+		logging.Fatal("server stopped with error", "error", err)
 	}
+	logger.Info("shopping service stopped")
 }
@@ -0,0 +1,297 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// setting is one leaf of Config, e.g. jobs.reconciliation.timeout.
+type setting struct {
+	key    string // path in the file, "jobs.reconciliation.timeout"
+	env    string // "JOB_RECONCILIATION_TIMEOUT"
+	secret string // "" for plain values, "true" or "url" (only the password is secret)
+	typ    reflect.Type
+	get    func() reflect.Value
+	set    func(reflect.Value)
+}
+
+// flagName is the command line flag of the setting, e.g. -jobs.reconciliation.timeout.
+func (s setting) flagName() string {
+	return strings.ReplaceAll(s.key, "_", "-")
+}
+
+// settings lists the leaves of c in field order, map entries sorted by name.
+// Setting a map entry writes the whole entry back, map values not being addressable.
+func settings(c *Config) []setting {
+	var out []setting
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f, fv := t.Field(i), v.Field(i)
+		if fv.Kind() != reflect.Map {
+			out = append(out, leaf(f, f.Tag.Get("yaml"), f.Tag.Get("env"), fv.Addr))
+			continue
+		}
+
+		names := make([]string, 0, fv.Len())
+		for _, k := range fv.MapKeys() {
+			names = append(names, k.String())
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			m, key := fv, reflect.ValueOf(name)
+			entry := func() reflect.Value {
+				e := reflect.New(m.Type().Elem())
+				e.Elem().Set(m.MapIndex(key))
+				return e
+			}
+			et := m.Type().Elem()
+			for j := 0; j < et.NumField(); j++ {
+				ef := et.Field(j)
+				j := j
+				s := leaf(ef,
+					f.Tag.Get("yaml")+"."+name+"."+ef.Tag.Get("yaml"),
+					f.Tag.Get("env")+"_"+strings.ToUpper(strings.ReplaceAll(name, "-", "_"))+"_"+ef.Tag.Get("env"),
+					nil,
+				)
+				s.get = func() reflect.Value { return entry().Elem().Field(j) }
+				s.set = func(val reflect.Value) {
+					e := entry()
+					e.Elem().Field(j).Set(val)
+					m.SetMapIndex(key, e.Elem())
+				}
+				out = append(out, s)
+			}
+		}
+	}
+	return out
+}
+
+func leaf(f reflect.StructField, key, env string, addr func() reflect.Value) setting {
+	s := setting{key: key, env: env, secret: f.Tag.Get("secret"), typ: f.Type}
+	if addr != nil {
+		s.get = func() reflect.Value { return addr().Elem() }
+		s.set = func(val reflect.Value) { addr().Elem().Set(val) }
+	}
+	return s
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// parse converts a value from an env var or a flag to typ.
+func parse(typ reflect.Type, raw string) (reflect.Value, error) {
+	v := reflect.New(typ).Elem()
+	switch {
+	case typ == durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return v, fmt.Errorf("invalid duration %q (e.g. 30s, 5m, 1h30m)", raw)
+		}
+		v.SetInt(int64(d))
+	case typ.Kind() == reflect.String:
+		v.SetString(raw)
+	case typ.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return v, fmt.Errorf("invalid bool %q (want true or false)", raw)
+		}
+		v.SetBool(b)
+	case typ.Kind() == reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return v, fmt.Errorf("invalid integer %q", raw)
+		}
+		v.SetInt(int64(n))
+	case typ.Kind() == reflect.Float64:
+		x, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return v, fmt.Errorf("invalid number %q", raw)
+		}
+		v.SetFloat(x)
+	default:
+		return v, fmt.Errorf("unsupported type %s", typ)
+	}
+	return v, nil
+}
+
+// Loader reads Config layer by layer. Its flags are registered on a FlagSet
+// given by the caller, so a command can mix them with its own flags.
+type Loader struct {
+	file  *string
+	flags map[string]*flagValue
+}
+
+type flagValue struct {
+	raw    string
+	isBool bool
+}
+
+func (f *flagValue) String() string     { return f.raw }
+func (f *flagValue) Set(s string) error { f.raw = s; return nil }
+func (f *flagValue) IsBoolFlag() bool   { return f.isBool }
+
+// NewLoader registers -config (the file, default $CONFIG_FILE) and one flag
+// per setting on fs, e.g. -mongo-uri or -jobs.reconciliation.timeout.
+func NewLoader(fs *flag.FlagSet) *Loader {
+	l := &Loader{
+		file:  fs.String("config", os.Getenv("CONFIG_FILE"), "YAML or JSON config file (env CONFIG_FILE)"),
+		flags: map[string]*flagValue{},
+	}
+	defaults := Defaults()
+	for _, s := range settings(&defaults) {
+		v := &flagValue{isBool: s.typ.Kind() == reflect.Bool}
+		l.flags[s.flagName()] = v
+		fs.Var(v, s.flagName(), "overrides "+s.key+" (env "+s.env+")")
+	}
+	return l
+}
+
+// Load parses args as flags (see NewLoader) and loads the config with them.
+func Load(args []string) (Config, error) {
+	fs := flag.NewFlagSet("config", flag.ContinueOnError)
+	l := NewLoader(fs)
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+	if fs.NArg() > 0 {
+		return Config{}, fmt.Errorf("unexpected arguments %q", fs.Args())
+	}
+	return l.Load()
+}
+
+// Load builds the config from the defaults, the file, the env and the flags
+// set on the command line, in that order, then validates it. The returned
+// Config is filled in even when it is invalid, so it can still be printed.
+func (l *Loader) Load() (Config, error) {
+	c := Defaults()
+	all := settings(&c)
+
+	var errs []error
+	if *l.file != "" {
+		if err := applyFile(all, *l.file); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	errs = append(errs, applyEnv(all)...)
+	for _, s := range all {
+		f := l.flags[s.flagName()]
+		if f == nil || f.raw == "" {
+			continue
+		}
+		v, err := parse(s.typ, f.raw)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("-%s: %w", s.flagName(), err))
+			continue
+		}
+		s.set(v)
+	}
+	if len(errs) > 0 {
+		return c, fmt.Errorf("config: %w", errors.Join(errs...))
+	}
+
+	if err := c.Validate(); err != nil {
+		return c, fmt.Errorf("invalid config (set values in the config file, env vars or flags, see -h):\n%w", err)
+	}
+	return c, nil
+}
+
+// applyFile sets every key present in the YAML (or JSON, a subset of YAML)
+// file at path. Unknown keys are an error, so a typo doesn't go unnoticed.
+func applyFile(all []setting, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	leaves := map[string]*yaml.Node{}
+	if len(root.Content) > 0 {
+		if err := flatten(root.Content[0], "", leaves); err != nil {
+			return fmt.Errorf("config file %s: %w", path, err)
+		}
+	}
+
+	var errs []error
+	for _, s := range all {
+		node, ok := leaves[s.key]
+		if !ok {
+			continue
+		}
+		delete(leaves, s.key)
+		v := reflect.New(s.typ)
+		if err := node.Decode(v.Interface()); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s: %w", path, s.key, err))
+			continue
+		}
+		s.set(v.Elem())
+	}
+	unknown := make([]string, 0, len(leaves))
+	for key := range leaves {
+		unknown = append(unknown, key)
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		errs = append(errs, fmt.Errorf("%s line %d: unknown key %s", path, leaves[key].Line, key))
+	}
+	return errors.Join(errs...)
+}
+
+// flatten indexes the scalars of a mapping node by their dotted path.
+func flatten(n *yaml.Node, prefix string, out map[string]*yaml.Node) error {
+	if n.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: %s must be a mapping", n.Line, strings.TrimSuffix(prefix, "."))
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, val := prefix+n.Content[i].Value, n.Content[i+1]
+		if val.Kind == yaml.MappingNode {
+			if err := flatten(val, key+".", out); err != nil {
+				return err
+			}
+			continue
+		}
+		out[key] = val
+	}
+	return nil
+}
+
+// applyEnv sets every setting whose env var, or <env>_FILE for secrets
+// mounted as files, is set and not empty.
+func applyEnv(all []setting) []error {
+	var errs []error
+	for _, s := range all {
+		raw, fromFile := os.Getenv(s.env), os.Getenv(s.env+"_FILE")
+		switch {
+		case raw != "" && fromFile != "":
+			errs = append(errs, fmt.Errorf("%s and %s_FILE are both set, use one", s.env, s.env))
+			continue
+		case fromFile != "":
+			data, err := os.ReadFile(fromFile)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s_FILE: %w", s.env, err))
+				continue
+			}
+			// file secret biasanya diakhiri newline
+			raw = strings.TrimRight(string(data), "\r\n")
+		case raw == "":
+			continue
+		}
+		v, err := parse(s.typ, raw)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.env, err))
+			continue
+		}
+		s.set(v)
+	}
+	return errs
+}
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"reflect"
+
+	"gopkg.in/yaml.v3"
+)
+
+const redacted = "REDACTED"
+
+// Redacted returns c with its secrets replaced, for printing. Of a Mongo URI
+// only the password is hidden.
+func (c Config) Redacted() Config {
+	// map di-copy supaya c asli tidak ikut berubah
+	c.Jobs = cloneMap(c.Jobs)
+	c.RateLimits = cloneMap(c.RateLimits)
+
+	for _, s := range settings(&c) {
+		v := s.get()
+		if s.secret == "" || v.Kind() != reflect.String || v.String() == "" {
+			continue
+		}
+		hidden := redacted
+		if s.secret == "url" {
+			hidden = redactURL(v.String())
+		}
+		s.set(reflect.ValueOf(hidden))
+	}
+	return c
+}
+
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return redacted
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	}
+	return u.String()
+}
+
+func cloneMap[V any](m map[string]V) map[string]V {
+	out := make(map[string]V, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+// Print writes c as YAML, in the format of the config file, with its secrets
+// redacted.
+func Print(w io.Writer, c Config) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(c.Redacted()); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// FromCommandLine loads the config of a service from its arguments (see Load)
+// and exits on an invalid config. It also runs `<service> config print
+// [flags]`: print the effective config, secrets redacted, and exit.
+func FromCommandLine(args []string) Config {
+	printOnly := len(args) >= 2 && args[0] == "config" && args[1] == "print"
+	if printOnly {
+		args = args[2:]
+	}
+
+	cfg, err := Load(args)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if printOnly {
+		if perr := Print(os.Stdout, cfg); perr != nil {
+			err = errors.Join(err, perr)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if printOnly {
+		os.Exit(0)
+	}
+	return cfg
+}
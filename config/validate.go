@@ -0,0 +1,192 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// minSecretLen is the shortest JWT or service secret accepted.
+const minSecretLen = 16
+
+// knownSecrets are the dev defaults of older versions, still around in old
+// .env files; they are public, so never accepted.
+var knownSecrets = map[string]bool{
+	"dev-secret-change-me":         true,
+	"dev-service-secret-change-me": true,
+}
+
+// Validate reports every invalid setting at once, one per line, keyed like
+// the config file.
+func (c Config) Validate() error {
+	var errs []error
+	fail := func(key, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: "+format, append([]any{key}, args...)...))
+	}
+	positive := func(key string, d time.Duration) {
+		if d <= 0 {
+			fail(key, "must be a positive duration, got %s", d)
+		}
+	}
+	secret := func(key, env, v string) {
+		switch {
+		case v == "":
+			fail(key, "is required (env %s or %s_FILE, flag -%s)", env, env, strings.ReplaceAll(key, "_", "-"))
+		case len(v) < minSecretLen:
+			fail(key, "must be at least %d characters", minSecretLen)
+		case knownSecrets[v]:
+			fail(key, "is a well-known example value, generate a random one")
+		}
+	}
+
+	switch {
+	case c.MongoURI == "":
+		fail("mongo_uri", "is required (env MONGO_URI or MONGO_URI_FILE, flag -mongo-uri)")
+	case !strings.HasPrefix(c.MongoURI, "mongodb://") && !strings.HasPrefix(c.MongoURI, "mongodb+srv://"):
+		fail("mongo_uri", "must start with mongodb:// or mongodb+srv://")
+	}
+	if c.MongoDBName == "" {
+		fail("mongo_db_name", "is required")
+	}
+	positive("mongo_connect_timeout", c.MongoConnectTimeout)
+
+	for _, kv := range [][2]string{{"shopping_port", c.ShoppingPort}, {"payment_port", c.PaymentPort}} {
+		key, addr := kv[0], kv[1]
+		if _, port, err := net.SplitHostPort(addr); err != nil {
+			fail(key, "must be a listen address like :9063, got %q", addr)
+		} else if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			fail(key, "invalid port in %q", addr)
+		}
+	}
+	for _, kv := range [][2]string{{"payment_base_url", c.PaymentBaseURL}, {"shopping_base_url", c.ShoppingBaseURL}} {
+		key, raw := kv[0], kv[1]
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fail(key, "must be an http(s) URL, got %q", raw)
+		}
+	}
+
+	positive("shutdown_timeout", c.ShutdownTimeout)
+	positive("health_check_timeout", c.HealthCheckTimeout)
+	positive("reservation_ttl", c.ReservationTTL)
+	positive("pending_transaction_ttl", c.PendingTransactionTTL)
+	// reservasi tidak boleh hidup lebih lama dari transaksi PENDING pemiliknya
+	if c.ReservationTTL > c.PendingTransactionTTL && c.PendingTransactionTTL > 0 {
+		fail("reservation_ttl", "must not be longer than pending_transaction_ttl (%s)", c.PendingTransactionTTL)
+	}
+
+	secret("jwt_secret", "JWT_SECRET", c.JWTSecret)
+	positive("access_token_ttl", c.AccessTokenTTL)
+	positive("refresh_token_ttl", c.RefreshTokenTTL)
+	if c.RefreshTokenTTL > 0 && c.RefreshTokenTTL <= c.AccessTokenTTL {
+		fail("refresh_token_ttl", "must be longer than access_token_ttl (%s)", c.AccessTokenTTL)
+	}
+	if c.AdminEmail != "" && !strings.Contains(c.AdminEmail, "@") {
+		fail("admin_email", "is not an email address: %q", c.AdminEmail)
+	}
+
+	secret("service_secret", "SERVICE_SECRET", c.ServiceSecret)
+	positive("signature_max_skew", c.SignatureMaxSkew)
+
+	positive("authorization_ttl", c.AuthorizationTTL)
+	positive("payment_review_ttl", c.PaymentReviewTTL)
+	if c.RiskRulesFile != "" {
+		if _, err := os.Stat(c.RiskRulesFile); err != nil {
+			fail("risk_rules_file", "%v", err)
+		}
+	}
+	if c.ReconciliationDir == "" {
+		fail("reconciliation_dir", "is required")
+	}
+
+	for _, name := range sortedKeys(c.Jobs) {
+		j, key := c.Jobs[name], "jobs."+name
+		if err := validateSchedule(j.Schedule); err != nil {
+			fail(key+".schedule", "%v", err)
+		}
+		positive(key+".timeout", j.Timeout)
+	}
+
+	switch c.TraceExporter {
+	case "none", "stdout":
+	case "otlp":
+		if c.OTLPEndpoint == "" {
+			fail("otlp_endpoint", "is required with trace_exporter otlp")
+		}
+	default:
+		fail("trace_exporter", "must be otlp, stdout or none, got %q", c.TraceExporter)
+	}
+	if c.TraceSampleRatio < 0 || c.TraceSampleRatio > 1 {
+		fail("trace_sample_ratio", "must be between 0 and 1, got %v", c.TraceSampleRatio)
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		fail("log_level", "must be debug, info, warn or error, got %q", c.LogLevel)
+	}
+
+	if c.RateLimitStore != "memory" && c.RateLimitStore != "mongo" {
+		fail("rate_limit_store", "must be memory or mongo, got %q", c.RateLimitStore)
+	}
+	for _, cidr := range c.TrustedProxyCIDRs() {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			fail("trusted_proxies", "%q is not a CIDR like 10.0.0.0/8", cidr)
+		}
+	}
+	for _, name := range sortedKeys(c.RateLimits) {
+		r, key := c.RateLimits[name], "rate_limits."+name
+		if !r.Enabled {
+			continue
+		}
+		if r.Requests <= 0 {
+			fail(key+".requests", "must be positive, got %d", r.Requests)
+		}
+		positive(key+".period", r.Period)
+		if r.Burst <= 0 {
+			fail(key+".burst", "must be positive, got %d", r.Burst)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateSchedule checks the form of a job schedule; the cron fields
+// themselves are checked when the scheduler registers the job.
+func validateSchedule(spec string) error {
+	switch {
+	case spec == "":
+		return errors.New("is required")
+	case strings.HasPrefix(spec, "@every "):
+		d, err := time.ParseDuration(strings.TrimPrefix(spec, "@every "))
+		if err != nil || d <= 0 {
+			return fmt.Errorf("@every needs a positive duration, got %q", spec)
+		}
+	case strings.HasPrefix(spec, "@"):
+		switch spec {
+		case "@yearly", "@annually", "@monthly", "@weekly", "@daily", "@midnight", "@hourly":
+		default:
+			return fmt.Errorf("unknown descriptor %q", spec)
+		}
+	default:
+		if n := len(strings.Fields(spec)); n != 5 {
+			return fmt.Errorf("cron expression needs 5 fields (minute hour day month weekday), got %d in %q", n, spec)
+		}
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
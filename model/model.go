@@ -1,25 +1,124 @@
 package model
 
 import (
+	"errors"
+	"strings"
 	"time"
+	"unicode"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// ErrVersionConflict is returned when a versioned document (product,
+// transaction) was changed since the caller read it.
+var ErrVersionConflict = errors.New("document was modified by another request")
+
+// ErrStockBelowReserved is returned when a write would set a product's stock
+// below the stock already reserved by pending transactions.
+var ErrStockBelowReserved = errors.New("stock cannot be lower than reserved stock")
+
 type PaymentStatus string
 
+// Lifecycle payment intent: CREATED -> AUTHORIZED -> SUCCESS (captured).
+// CREATED/AUTHORIZED can be VOIDED, and an AUTHORIZED payment that is never
+// captured becomes EXPIRED. FAILED means the payment was declined. REVIEW is
+// held by the risk engine until approved (-> CREATED) or rejected (-> FAILED).
 const (
-	PaymentStatusSuccess PaymentStatus = "SUCCESS"
-	PaymentStatusFailed  PaymentStatus = "FAILED"
+	PaymentStatusReview     PaymentStatus = "REVIEW"
+	PaymentStatusCreated    PaymentStatus = "CREATED"
+	PaymentStatusAuthorized PaymentStatus = "AUTHORIZED"
+	PaymentStatusSuccess    PaymentStatus = "SUCCESS"
+	PaymentStatusFailed     PaymentStatus = "FAILED"
+	PaymentStatusVoided     PaymentStatus = "VOIDED"
+	PaymentStatusExpired    PaymentStatus = "EXPIRED"
 )
 
+type DeclineReason string
+
+const (
+	DeclineReasonInvalidAmount       DeclineReason = "invalid_amount"
+	DeclineReasonTransactionNotFound DeclineReason = "transaction_not_found"
+	DeclineReasonTransactionSettled  DeclineReason = "transaction_not_pending"
+	DeclineReasonAmountMismatch      DeclineReason = "amount_mismatch"
+	DeclineReasonEmailMismatch       DeclineReason = "email_mismatch"
+	DeclineReasonRiskDeclined        DeclineReason = "risk_declined"
+	DeclineReasonReviewRejected      DeclineReason = "review_rejected"
+)
+
+type RiskDecision string
+
+const (
+	RiskDecisionApprove RiskDecision = "APPROVE"
+	RiskDecisionReview  RiskDecision = "REVIEW"
+	RiskDecisionDecline RiskDecision = "DECLINE"
+)
+
+// RiskAssessment is the risk engine decision stored on the payment, plus the
+// manual review outcome when the payment was held.
+type RiskAssessment struct {
+	Decision       RiskDecision `bson:"decision" json:"decision"`
+	TriggeredRules []string     `bson:"triggered_rules" json:"triggered_rules"`
+	EvaluatedAt    time.Time    `bson:"evaluated_at" json:"evaluated_at"`
+
+	ReviewDecision RiskDecision `bson:"review_decision,omitempty" json:"review_decision,omitempty"`
+	ReviewedBy     string       `bson:"reviewed_by,omitempty" json:"reviewed_by,omitempty"`
+	ReviewNote     string       `bson:"review_note,omitempty" json:"review_note,omitempty"`
+	ReviewedAt     *time.Time   `bson:"reviewed_at,omitempty" json:"reviewed_at,omitempty"`
+}
+
+// ReviewPaymentRequest is sent to the payment service, which records Reviewer
+// on the payment.
+type ReviewPaymentRequest struct {
+	Decision string `json:"decision" validate:"required,oneof=approve reject"`
+	Reviewer string `json:"reviewer" validate:"required"`
+	Note     string `json:"note"`
+}
+
+// TransactionPaymentReviewRequest is the body of the shopping review route;
+// the reviewer is the admin who is logged in.
+type TransactionPaymentReviewRequest struct {
+	Decision string `json:"decision" validate:"required,oneof=approve reject"`
+	Note     string `json:"note"`
+}
+
+// PaymentReviewResult is sent by the payment service to the shopping service
+// once a payment held for review is approved or rejected.
+type PaymentReviewResult struct {
+	PaymentID string `json:"payment_id"`
+	Approved  bool   `json:"approved"`
+}
+
 type Payment struct {
 	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
 	TransactionID primitive.ObjectID `bson:"transaction_id" json:"transaction_id"`
 	Amount        float64            `bson:"amount" json:"amount"`
 	Email         string             `bson:"email" json:"email"`
 	Status        PaymentStatus      `bson:"status" json:"status"`
-	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
+	DeclineReason DeclineReason      `bson:"decline_reason,omitempty" json:"decline_reason,omitempty"`
+
+	// Attempt starts at 1; a new attempt for the same transaction is only
+	// allowed after the previous one FAILED.
+	Attempt int `bson:"attempt" json:"attempt"`
+
+	Risk *RiskAssessment `bson:"risk,omitempty" json:"risk,omitempty"`
+
+	// Replayed is set when a duplicate request returned the existing payment.
+	Replayed bool `bson:"-" json:"replayed,omitempty"`
+
+	CapturedAmount float64    `bson:"captured_amount" json:"captured_amount"`
+	AuthorizedAt   *time.Time `bson:"authorized_at,omitempty" json:"authorized_at,omitempty"`
+	ExpiresAt      *time.Time `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+	CapturedAt     *time.Time `bson:"captured_at,omitempty" json:"captured_at,omitempty"`
+	VoidedAt       *time.Time `bson:"voided_at,omitempty" json:"voided_at,omitempty"`
+
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// APIResponse is the success envelope written by the controllers ({"message", "data"}).
+type APIResponse[T any] struct {
+	Message string `json:"message"`
+	Data    T      `json:"data"`
 }
 
 type CreatePaymentRequest struct {
@@ -28,25 +127,312 @@ type CreatePaymentRequest struct {
 	Email         string  `json:"email" validate:"required,email"`
 }
 
+// ListPaymentsQuery is bound from GET /payments query params.
+// From/To accept RFC3339 or YYYY-MM-DD (To as a date includes the whole day).
+type ListPaymentsQuery struct {
+	TransactionID string `query:"transaction_id"`
+	Email         string `query:"email"`
+	Status        string `query:"status"`
+	From          string `query:"from"`
+	To            string `query:"to"`
+	Page          int    `query:"page"`
+	Limit         int    `query:"limit"`
+}
+
+// PaymentFilter is the parsed form of ListPaymentsQuery used by the repository.
+type PaymentFilter struct {
+	TransactionID *primitive.ObjectID
+	Email         string
+	Status        PaymentStatus
+	From          *time.Time
+	To            *time.Time
+	Skip          int64
+	Limit         int64
+}
+
+// Page is a single page of a paginated list.
+type Page[T any] struct {
+	Items []T   `json:"items"`
+	Page  int   `json:"page"`
+	Limit int   `json:"limit"`
+	Total int64 `json:"total"`
+}
+
+// CapturePaymentRequest captures Amount of an authorized payment; 0 captures the full amount.
+type CapturePaymentRequest struct {
+	Amount float64 `json:"amount" validate:"gte=0"`
+}
+
+type ProductStatus string
+
+// Only ACTIVE products can be bought; DRAFT is not published yet and
+// ARCHIVED is no longer sold.
+const (
+	ProductStatusActive   ProductStatus = "active"
+	ProductStatusDraft    ProductStatus = "draft"
+	ProductStatusArchived ProductStatus = "archived"
+)
+
+func (s ProductStatus) Valid() bool {
+	switch s {
+	case ProductStatusActive, ProductStatusDraft, ProductStatusArchived:
+		return true
+	}
+	return false
+}
+
+// Dimensions in centimeters.
+type Dimensions struct {
+	Length float64 `bson:"length" json:"length"`
+	Width  float64 `bson:"width" json:"width"`
+	Height float64 `bson:"height" json:"height"`
+}
+
 type Product struct {
-	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	Name      string             `bson:"name" json:"name"`
-	Price     float64            `bson:"price" json:"price"`
-	Stock     int                `bson:"stock" json:"stock"`
-	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
-	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+	ID          primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	SKU         string               `bson:"sku,omitempty" json:"sku,omitempty"`
+	Name        string               `bson:"name" json:"name"`
+	Description string               `bson:"description" json:"description"`
+	CategoryIDs []primitive.ObjectID `bson:"category_ids" json:"category_ids"`
+	Tags        []string             `bson:"tags" json:"tags"`
+	Images      []string             `bson:"images" json:"images"`
+	WeightGrams float64              `bson:"weight_grams" json:"weight_grams"`
+	Dimensions  *Dimensions          `bson:"dimensions,omitempty" json:"dimensions,omitempty"`
+	Status      ProductStatus        `bson:"status" json:"status"`
+	Price       float64              `bson:"price" json:"price"`
+	Stock       int                  `bson:"stock" json:"stock"`
+	Reserved    int                  `bson:"reserved" json:"reserved"`
+	Variants    []Variant            `bson:"variants,omitempty" json:"variants,omitempty"`
+	// Words diisi repository dari SearchWords(Name, Tags), untuk autocomplete
+	Words []string `bson:"words" json:"-"`
+	// Version naik setiap kali dokumen berubah, termasuk perubahan stok
+	Version   int64     `bson:"version" json:"version"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// Variant is a sellable option of a product (e.g. size M / color red) with its
+// own SKU and stock. Price overrides the product price when set.
+type Variant struct {
+	ID       primitive.ObjectID `bson:"_id" json:"id"`
+	SKU      string             `bson:"sku" json:"sku"`
+	Options  map[string]string  `bson:"options" json:"options"`
+	Price    *float64           `bson:"price,omitempty" json:"price,omitempty"`
+	Stock    int                `bson:"stock" json:"stock"`
+	Reserved int                `bson:"reserved" json:"reserved"`
+}
+
+func (v Variant) AvailableStock() int {
+	return v.Stock - v.Reserved
+}
+
+// FindVariant returns the variant with id, or nil if the product has none.
+func (p Product) FindVariant(id primitive.ObjectID) *Variant {
+	for i := range p.Variants {
+		if p.Variants[i].ID == id {
+			return &p.Variants[i]
+		}
+	}
+	return nil
+}
+
+// SearchWords returns the distinct lowercased words of name and tags, split on
+// anything that isn't a letter or digit. Products store them in Words so
+// autocomplete can match a word prefix on an index.
+func SearchWords(name string, tags []string) []string {
+	words := []string{}
+	seen := map[string]bool{}
+	for _, s := range append([]string{name}, tags...) {
+		for _, w := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		}) {
+			if !seen[w] {
+				seen[w] = true
+				words = append(words, w)
+			}
+		}
+	}
+	return words
+}
+
+// PriceOf returns the unit price of v, falling back to the product price.
+func (p Product) PriceOf(v *Variant) float64 {
+	if v != nil && v.Price != nil {
+		return *v.Price
+	}
+	return p.Price
+}
+
+type VariantRequest struct {
+	SKU     string            `json:"sku" validate:"required"`
+	Options map[string]string `json:"options" validate:"required"`
+	Price   *float64          `json:"price"`
+	Stock   int               `json:"stock" validate:"gte=0"`
+}
+
+// ProductImportRow is one CSV row / NDJSON line of POST /products/import.
+// ProductImportRow is one row of a product import. The catalog fields are
+// optional: when their column (CSV) or key (NDJSON) is missing the stored
+// value is kept, or the default is used for a new product.
+type ProductImportRow struct {
+	SKU         string         `json:"sku"`
+	Name        string         `json:"name"`
+	Price       float64        `json:"price"`
+	Stock       int            `json:"stock"`
+	Description *string        `json:"description"`
+	Status      *ProductStatus `json:"status"`
+	CategoryIDs *[]string      `json:"category_ids"`
+	Tags        *[]string      `json:"tags"`
+}
+
+type ImportRowError struct {
+	Line  int    `json:"line"`
+	SKU   string `json:"sku,omitempty"`
+	Error string `json:"error"`
+}
+
+type ProductImportResult struct {
+	DryRun  bool             `json:"dry_run"`
+	Rows    int              `json:"rows"`
+	Created int              `json:"created"`
+	Updated int              `json:"updated"`
+	Failed  int              `json:"failed"`
+	Errors  []ImportRowError `json:"errors"`
+}
+
+// AvailableStock is the stock that can still be reserved by new transactions.
+func (p Product) AvailableStock() int {
+	return p.Stock - p.Reserved
 }
 
 type CreateProductRequest struct {
-	Name  string  `json:"name" validate:"required"`
-	Price float64 `json:"price" validate:"required,gt=0"`
-	Stock int     `json:"stock" validate:"required,gte=0"`
+	SKU         string        `json:"sku"`
+	Name        string        `json:"name" validate:"required"`
+	Description string        `json:"description"`
+	CategoryIDs []string      `json:"category_ids"`
+	Tags        []string      `json:"tags"`
+	Images      []string      `json:"images"`
+	WeightGrams float64       `json:"weight_grams" validate:"gte=0"`
+	Dimensions  *Dimensions   `json:"dimensions"`
+	Status      ProductStatus `json:"status"`
+	Price       float64       `json:"price" validate:"required,gt=0"`
+	Stock       int           `json:"stock" validate:"required,gte=0"`
 }
 
 type UpdateProductRequest struct {
-	Name  string  `json:"name" validate:"required"`
-	Price float64 `json:"price" validate:"required,gt=0"`
-	Stock int     `json:"stock" validate:"required,gte=0"`
+	SKU         string        `json:"sku"`
+	Name        string        `json:"name" validate:"required"`
+	Description string        `json:"description"`
+	CategoryIDs []string      `json:"category_ids"`
+	Tags        []string      `json:"tags"`
+	Images      []string      `json:"images"`
+	WeightGrams float64       `json:"weight_grams" validate:"gte=0"`
+	Dimensions  *Dimensions   `json:"dimensions"`
+	Status      ProductStatus `json:"status"`
+	Price       float64       `json:"price" validate:"required,gt=0"`
+	Stock       int           `json:"stock" validate:"required,gte=0"`
+}
+
+// ListProductsQuery filters GET /products. Category accepts an ID or slug and
+// status defaults to active ("all" lists every status).
+type ListProductsQuery struct {
+	Category string `query:"category"`
+	Tag      string `query:"tag"`
+	Status   string `query:"status"`
+}
+
+type ProductFilter struct {
+	CategoryID *primitive.ObjectID
+	Tag        string
+	Status     ProductStatus
+}
+
+type SearchSort string
+
+const (
+	SearchSortRelevance SearchSort = "relevance"
+	SearchSortPriceAsc  SearchSort = "price_asc"
+	SearchSortPriceDesc SearchSort = "price_desc"
+	SearchSortNewest    SearchSort = "newest"
+)
+
+// SearchProductsQuery is the query string of GET /products/search. Category
+// accepts an ID or slug; a zero price bound means no bound.
+type SearchProductsQuery struct {
+	Q        string     `query:"q"`
+	Category string     `query:"category"`
+	MinPrice float64    `query:"min_price"`
+	MaxPrice float64    `query:"max_price"`
+	Sort     SearchSort `query:"sort"`
+	Limit    int        `query:"limit"`
+	Offset   int        `query:"offset"`
+}
+
+// ProductSearchFilter is the repository side of a search. PriceBoundaries are
+// the lower bounds of the price range facet, in ascending order.
+type ProductSearchFilter struct {
+	Text            string
+	CategoryID      *primitive.ObjectID
+	MinPrice        float64
+	MaxPrice        float64
+	Sort            SearchSort
+	Skip            int
+	Limit           int
+	PriceBoundaries []float64
+}
+
+type ProductSearchHit struct {
+	Product `bson:",inline"`
+	Score   float64 `bson:"score" json:"score"`
+}
+
+type CategoryFacet struct {
+	ID    primitive.ObjectID `bson:"_id" json:"id"`
+	Name  string             `bson:"name" json:"name"`
+	Slug  string             `bson:"slug" json:"slug"`
+	Count int64              `bson:"count" json:"count"`
+}
+
+// PriceRangeFacet counts products with Min <= price < Max. The last range has no Max.
+type PriceRangeFacet struct {
+	Min   float64  `json:"min"`
+	Max   *float64 `json:"max,omitempty"`
+	Count int64    `json:"count"`
+}
+
+type SearchFacets struct {
+	Categories  []CategoryFacet   `json:"categories"`
+	PriceRanges []PriceRangeFacet `json:"price_ranges"`
+}
+
+type ProductSearchResult struct {
+	Query string `json:"query"`
+	// CorrectedQuery is set when the original query found nothing and the
+	// results are for a typo-corrected version of it.
+	CorrectedQuery string             `json:"corrected_query,omitempty"`
+	Total          int64              `json:"total"`
+	Items          []ProductSearchHit `json:"items"`
+	Facets         SearchFacets       `json:"facets"`
+}
+
+type ProductSuggestion struct {
+	ID   primitive.ObjectID `json:"id"`
+	Name string             `json:"name"`
+}
+
+type Category struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name        string             `bson:"name" json:"name"`
+	Slug        string             `bson:"slug" json:"slug"`
+	Description string             `bson:"description" json:"description"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+type CategoryRequest struct {
+	Name        string `json:"name" validate:"required"`
+	Slug        string `json:"slug"`
+	Description string `json:"description"`
 }
 
 type TransactionStatus string
@@ -59,22 +445,353 @@ const (
 
 type Transaction struct {
 	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	CustomerID  primitive.ObjectID `bson:"customer_id" json:"customer_id"`
 	ProductID   primitive.ObjectID `bson:"product_id" json:"product_id"`
+	VariantID   primitive.ObjectID `bson:"variant_id,omitempty" json:"variant_id,omitempty"`
+	PaymentID   primitive.ObjectID `bson:"payment_id,omitempty" json:"payment_id,omitempty"`
 	Qty         int                `bson:"qty" json:"qty"`
 	TotalAmount float64            `bson:"total_amount" json:"total_amount"`
 	Email       string             `bson:"email" json:"email"`
 	Status      TransactionStatus  `bson:"status" json:"status"`
-	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
-	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at"`
+	// HoldUntil ditetapkan selama payment-nya di-review; sampai saat itu
+	// transaksi tidak di-expire walaupun sudah lewat pending TTL
+	HoldUntil *time.Time `bson:"hold_until,omitempty" json:"hold_until,omitempty"`
+	Version   int64      `bson:"version" json:"version"`
+	CreatedAt time.Time  `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time  `bson:"updated_at" json:"updated_at"`
 }
 
 type CreateTransactionRequest struct {
 	ProductID string `json:"product_id" validate:"required"`
+	// VariantID wajib untuk produk yang punya variant
+	VariantID string `json:"variant_id"`
 	Qty       int    `json:"qty" validate:"required,gt=0"`
-	Email     string `json:"email" validate:"required,email"`
 }
 
 type UpdateTransactionRequest struct {
 	Qty   int    `json:"qty" validate:"required,gt=0"`
 	Email string `json:"email" validate:"required,email"`
 }
+
+type ReservationStatus string
+
+const (
+	ReservationStatusActive    ReservationStatus = "ACTIVE"
+	ReservationStatusCommitted ReservationStatus = "COMMITTED"
+	ReservationStatusReleased  ReservationStatus = "RELEASED"
+	ReservationStatusExpired   ReservationStatus = "EXPIRED"
+)
+
+// Reservation holds stock for a PENDING transaction until payment settles or ExpiresAt passes.
+type Reservation struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ProductID     primitive.ObjectID `bson:"product_id" json:"product_id"`
+	VariantID     primitive.ObjectID `bson:"variant_id,omitempty" json:"variant_id,omitempty"`
+	TransactionID primitive.ObjectID `bson:"transaction_id" json:"transaction_id"`
+	Qty           int                `bson:"qty" json:"qty"`
+	Status        ReservationStatus  `bson:"status" json:"status"`
+	ExpiresAt     time.Time          `bson:"expires_at" json:"expires_at"`
+	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt     time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+type Role string
+
+const (
+	RoleAdmin    Role = "admin"
+	RoleStaff    Role = "staff"
+	RoleCustomer Role = "customer"
+)
+
+type Permission string
+
+const (
+	PermissionProductWrite        Permission = "products:write"
+	PermissionTransactionReadAll  Permission = "transactions:read_all"
+	PermissionTransactionWriteAll Permission = "transactions:write_all"
+	PermissionTransactionDelete   Permission = "transactions:delete"
+	PermissionCustomerManage      Permission = "customers:manage"
+	PermissionReportRead          Permission = "reports:read"
+	PermissionJobManage           Permission = "jobs:manage"
+	PermissionPaymentReview       Permission = "payments:review"
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleAdmin: {
+		PermissionProductWrite,
+		PermissionTransactionReadAll,
+		PermissionTransactionWriteAll,
+		PermissionTransactionDelete,
+		PermissionCustomerManage,
+		PermissionReportRead,
+		PermissionJobManage,
+		PermissionPaymentReview,
+	},
+	RoleStaff: {
+		PermissionTransactionReadAll,
+		PermissionReportRead,
+	},
+	RoleCustomer: {},
+}
+
+func (r Role) Valid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+func (r Role) Can(perm Permission) bool {
+	for _, p := range rolePermissions[r] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+type Customer struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name         string             `bson:"name" json:"name"`
+	Email        string             `bson:"email" json:"email"`
+	Role         Role               `bson:"role" json:"role"`
+	PasswordHash string             `bson:"password_hash" json:"-"`
+	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt    time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+type RegisterRequest struct {
+	Name     string `json:"name" validate:"required"`
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required,min=8"`
+}
+
+type LoginRequest struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+}
+
+type UpdateRoleRequest struct {
+	Role Role `json:"role" validate:"required,oneof=admin staff customer"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type AuthTokens struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	TokenType    string    `json:"token_type"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// Principal is the authenticated caller, taken from a verified access token.
+type Principal struct {
+	CustomerID primitive.ObjectID
+	Email      string
+	Role       Role
+}
+
+func (p Principal) Can(perm Permission) bool {
+	return p.Role.Can(perm)
+}
+
+// ===== Reconciliation =====
+
+type MismatchType string
+
+const (
+	MismatchMissingPayment     MismatchType = "missing_payment"
+	MismatchMissingTransaction MismatchType = "missing_transaction"
+	MismatchAmount             MismatchType = "amount_mismatch"
+	MismatchStatus             MismatchType = "status_mismatch"
+)
+
+// Mismatch is one transaction/payment pair that does not settle.
+type Mismatch struct {
+	Type              MismatchType      `json:"type"`
+	TransactionID     string            `json:"transaction_id"`
+	PaymentID         string            `json:"payment_id,omitempty"`
+	TransactionStatus TransactionStatus `json:"transaction_status,omitempty"`
+	PaymentStatus     PaymentStatus     `json:"payment_status,omitempty"`
+	TransactionAmount float64           `json:"transaction_amount"`
+	PaymentAmount     float64           `json:"payment_amount"`
+}
+
+type ReconciliationSummary struct {
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	GeneratedAt time.Time `json:"generated_at"`
+
+	TransactionsChecked int `json:"transactions_checked"`
+	PaymentsChecked     int `json:"payments_checked"`
+	Matched             int `json:"matched"`
+
+	Mismatches int                  `json:"mismatches"`
+	ByType     map[MismatchType]int `json:"by_type"`
+
+	// total SUCCESS di masing-masing sisi, selisihnya yang harus dijelaskan finance
+	TransactionTotal float64 `json:"transaction_total"`
+	CapturedTotal    float64 `json:"captured_total"`
+}
+
+type ReconciliationReport struct {
+	Summary    ReconciliationSummary `json:"summary"`
+	Mismatches []Mismatch            `json:"mismatches"`
+}
+
+type ReconciliationQuery struct {
+	From string `query:"from"`
+	To   string `query:"to"`
+}
+
+// ===== Sales report =====
+
+type SalesGroupBy string
+
+const (
+	SalesGroupByDay   SalesGroupBy = "day"
+	SalesGroupByWeek  SalesGroupBy = "week"
+	SalesGroupByMonth SalesGroupBy = "month"
+)
+
+type SalesReportQuery struct {
+	From    string `query:"from"`
+	To      string `query:"to"`
+	GroupBy string `query:"group_by"`
+	Top     int    `query:"top"`
+}
+
+// SalesBucket is the SUCCESS revenue of one day, week (starting Monday) or month.
+type SalesBucket struct {
+	Period            string    `bson:"-" json:"period"`
+	Start             time.Time `bson:"start" json:"start"`
+	Revenue           float64   `bson:"revenue" json:"revenue"`
+	Orders            int64     `bson:"orders" json:"orders"`
+	Units             int64     `bson:"units" json:"units"`
+	AverageOrderValue float64   `bson:"average_order_value" json:"average_order_value"`
+}
+
+type ProductSales struct {
+	ProductID primitive.ObjectID `bson:"_id" json:"product_id"`
+	Name      string             `bson:"name" json:"name"`
+	Units     int64              `bson:"units" json:"units"`
+	Revenue   float64            `bson:"revenue" json:"revenue"`
+	Orders    int64              `bson:"orders" json:"orders"`
+}
+
+// SalesConversion counts transactions by outcome. Rates are over settled
+// (SUCCESS + FAILED) transactions; PENDING ones are not decided yet.
+type SalesConversion struct {
+	Success     int64   `json:"success"`
+	Failed      int64   `json:"failed"`
+	Pending     int64   `json:"pending"`
+	SuccessRate float64 `json:"success_rate"`
+	FailedRate  float64 `json:"failed_rate"`
+}
+
+type SalesReport struct {
+	From    time.Time    `json:"from"`
+	To      time.Time    `json:"to"`
+	GroupBy SalesGroupBy `json:"group_by"`
+
+	Revenue           float64 `json:"revenue"`
+	Orders            int64   `json:"orders"`
+	AverageOrderValue float64 `json:"average_order_value"`
+
+	Buckets      []SalesBucket   `json:"buckets"`
+	TopByUnits   []ProductSales  `json:"top_by_units"`
+	TopByRevenue []ProductSales  `json:"top_by_revenue"`
+	Conversion   SalesConversion `json:"conversion"`
+}
+
+type JobRunStatus string
+
+const (
+	JobRunStatusRunning JobRunStatus = "running"
+	JobRunStatusSuccess JobRunStatus = "success"
+	JobRunStatusFailed  JobRunStatus = "failed"
+)
+
+type JobTrigger string
+
+const (
+	JobTriggerSchedule JobTrigger = "schedule"
+	JobTriggerManual   JobTrigger = "manual"
+)
+
+// JobRun is one execution of a scheduled job, kept in the job_runs collection.
+type JobRun struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Job        string             `bson:"job" json:"job"`
+	Trigger    JobTrigger         `bson:"trigger" json:"trigger"`
+	Owner      string             `bson:"owner" json:"owner"`
+	Status     JobRunStatus       `bson:"status" json:"status"`
+	Result     string             `bson:"result,omitempty" json:"result,omitempty"`
+	Error      string             `bson:"error,omitempty" json:"error,omitempty"`
+	StartedAt  time.Time          `bson:"started_at" json:"started_at"`
+	FinishedAt *time.Time         `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+}
+
+// JobInfo is what GET /admin/jobs shows for each registered job.
+type JobInfo struct {
+	Name     string     `json:"name"`
+	Schedule string     `json:"schedule"`
+	Timeout  string     `json:"timeout"`
+	Enabled  bool       `json:"enabled"`
+	NextRun  *time.Time `json:"next_run,omitempty"`
+	// Running is true while this replica is executing the job.
+	Running bool    `json:"running"`
+	LastRun *JobRun `json:"last_run,omitempty"`
+}
+
+// ===== Health =====
+
+type HealthStatus string
+
+const (
+	HealthStatusUp   HealthStatus = "up"
+	HealthStatusDown HealthStatus = "down"
+)
+
+// HealthCheck is the outcome of one dependency check of GET /readyz.
+type HealthCheck struct {
+	Name      string       `json:"name"`
+	Status    HealthStatus `json:"status"`
+	LatencyMs float64      `json:"latency_ms"`
+	Error     string       `json:"error,omitempty"`
+}
+
+// HealthReport is down as soon as one of its checks is down.
+type HealthReport struct {
+	Status HealthStatus  `json:"status"`
+	Checks []HealthCheck `json:"checks"`
+}
+
+// ===== Rate limit =====
+
+// RateLimitRule is a token bucket: it holds up to Burst tokens and refills at
+// Rate tokens per second. Every request takes one token.
+type RateLimitRule struct {
+	Rate  float64
+	Burst int
+}
+
+// Refill is how long the bucket takes to gain n tokens.
+func (r RateLimitRule) Refill(n float64) time.Duration {
+	if n <= 0 {
+		return 0
+	}
+	return time.Duration(n / r.Rate * float64(time.Second))
+}
+
+// RateLimitDecision is the outcome of taking a token from one bucket.
+type RateLimitDecision struct {
+	Allowed bool
+	// Limit is the bucket size, i.e. the burst a client may send at once.
+	Limit     int
+	Remaining int
+	// RetryAfter is how long until the next token, zero when Allowed.
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+}
@@ -0,0 +1,122 @@
+package category
+
+import (
+	"context"
+	"time"
+
+	"ecom/model"
+	"ecom/util/tracing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type Repository interface {
+	Create(ctx context.Context, c *model.Category) error
+	FindAll(ctx context.Context) ([]model.Category, error)
+	FindByID(ctx context.Context, id primitive.ObjectID) (*model.Category, error)
+	FindBySlug(ctx context.Context, slug string) (*model.Category, error)
+	Update(ctx context.Context, c *model.Category) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+	CountByIDs(ctx context.Context, ids []primitive.ObjectID) (int64, error)
+}
+
+type mongoRepository struct {
+	col *mongo.Collection
+}
+
+func NewRepository(col *mongo.Collection) Repository {
+	return &mongoRepository{col: col}
+}
+
+func (r *mongoRepository) Create(ctx context.Context, c *model.Category) error {
+	ctx, span := tracing.Start(ctx, "CategoryRepository.Create")
+	defer span.End()
+
+	c.ID = primitive.NewObjectID()
+	now := time.Now()
+	c.CreatedAt = now
+	c.UpdatedAt = now
+
+	_, err := r.col.InsertOne(ctx, c)
+	return err
+}
+
+func (r *mongoRepository) FindAll(ctx context.Context) ([]model.Category, error) {
+	ctx, span := tracing.Start(ctx, "CategoryRepository.FindAll")
+	defer span.End()
+
+	cur, err := r.col.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"name": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	categories := []model.Category{}
+	if err := cur.All(ctx, &categories); err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+func (r *mongoRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*model.Category, error) {
+	ctx, span := tracing.Start(ctx, "CategoryRepository.FindByID")
+	defer span.End()
+
+	var c model.Category
+	if err := r.col.FindOne(ctx, bson.M{"_id": id}).Decode(&c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (r *mongoRepository) FindBySlug(ctx context.Context, slug string) (*model.Category, error) {
+	ctx, span := tracing.Start(ctx, "CategoryRepository.FindBySlug")
+	defer span.End()
+
+	var c model.Category
+	if err := r.col.FindOne(ctx, bson.M{"slug": slug}).Decode(&c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (r *mongoRepository) Update(ctx context.Context, c *model.Category) error {
+	ctx, span := tracing.Start(ctx, "CategoryRepository.Update")
+	defer span.End()
+
+	c.UpdatedAt = time.Now()
+	res, err := r.col.UpdateByID(ctx, c.ID, bson.M{
+		"$set": bson.M{
+			"name":        c.Name,
+			"slug":        c.Slug,
+			"description": c.Description,
+			"updated_at":  c.UpdatedAt,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r *mongoRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	ctx, span := tracing.Start(ctx, "CategoryRepository.Delete")
+	defer span.End()
+
+	_, err := r.col.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+// CountByIDs counts how many of ids exist, used to validate product category references.
+func (r *mongoRepository) CountByIDs(ctx context.Context, ids []primitive.ObjectID) (int64, error) {
+	ctx, span := tracing.Start(ctx, "CategoryRepository.CountByIDs")
+	defer span.End()
+
+	return r.col.CountDocuments(ctx, bson.M{"_id": bson.M{"$in": ids}})
+}
@@ -0,0 +1,82 @@
+package customer
+
+import (
+	"context"
+	"time"
+
+	"ecom/model"
+	"ecom/util/tracing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type Repository interface {
+	Create(ctx context.Context, c *model.Customer) error
+	FindByID(ctx context.Context, id primitive.ObjectID) (*model.Customer, error)
+	FindByEmail(ctx context.Context, email string) (*model.Customer, error)
+	UpdateRole(ctx context.Context, id primitive.ObjectID, role model.Role) error
+}
+
+type mongoRepository struct {
+	col *mongo.Collection
+}
+
+func NewRepository(col *mongo.Collection) Repository {
+	return &mongoRepository{col: col}
+}
+
+func (r *mongoRepository) Create(ctx context.Context, c *model.Customer) error {
+	ctx, span := tracing.Start(ctx, "CustomerRepository.Create")
+	defer span.End()
+
+	c.ID = primitive.NewObjectID()
+	now := time.Now()
+	c.CreatedAt = now
+	c.UpdatedAt = now
+
+	_, err := r.col.InsertOne(ctx, c)
+	return err
+}
+
+func (r *mongoRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*model.Customer, error) {
+	ctx, span := tracing.Start(ctx, "CustomerRepository.FindByID")
+	defer span.End()
+
+	var c model.Customer
+	if err := r.col.FindOne(ctx, bson.M{"_id": id}).Decode(&c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (r *mongoRepository) FindByEmail(ctx context.Context, email string) (*model.Customer, error) {
+	ctx, span := tracing.Start(ctx, "CustomerRepository.FindByEmail")
+	defer span.End()
+
+	var c model.Customer
+	if err := r.col.FindOne(ctx, bson.M{"email": email}).Decode(&c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (r *mongoRepository) UpdateRole(ctx context.Context, id primitive.ObjectID, role model.Role) error {
+	ctx, span := tracing.Start(ctx, "CustomerRepository.UpdateRole")
+	defer span.End()
+
+	res, err := r.col.UpdateByID(ctx, id, bson.M{
+		"$set": bson.M{
+			"role":       role,
+			"updated_at": time.Now(),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package job
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"ecom/model"
+	"ecom/util/tracing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Repository stores the scheduler's lease locks and run history.
+type Repository interface {
+	AcquireLease(ctx context.Context, job, owner string, ttl time.Duration) (bool, error)
+	ReleaseLease(ctx context.Context, job, owner string) error
+
+	CreateRun(ctx context.Context, run *model.JobRun) error
+	FinishRun(ctx context.Context, run *model.JobRun) error
+	FindRuns(ctx context.Context, job string, limit int) ([]model.JobRun, error)
+}
+
+type mongoRepository struct {
+	locks  *mongo.Collection
+	runs   *mongo.Collection
+	logger *slog.Logger
+}
+
+type Option func(*mongoRepository)
+
+// WithLogger sets the logger for lease contention (default slog.Default()).
+func WithLogger(l *slog.Logger) Option {
+	return func(r *mongoRepository) {
+		if l != nil {
+			r.logger = l
+		}
+	}
+}
+
+func NewRepository(locks, runs *mongo.Collection, opts ...Option) Repository {
+	r := &mongoRepository{locks: locks, runs: runs, logger: slog.Default()}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// AcquireLease takes the lock of job for ttl. Only an expired lease can be
+// taken over, so it returns false while another replica (or an earlier run
+// on this one) still holds it.
+func (r *mongoRepository) AcquireLease(ctx context.Context, job, owner string, ttl time.Duration) (bool, error) {
+	ctx, span := tracing.Start(ctx, "JobRepository.AcquireLease")
+	defer span.End()
+
+	now := time.Now()
+	_, err := r.locks.UpdateOne(ctx,
+		bson.M{"_id": job, "expires_at": bson.M{"$lte": now}},
+		bson.M{"$set": bson.M{
+			"owner":       owner,
+			"acquired_at": now,
+			"expires_at":  now.Add(ttl),
+		}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		// lease masih dipegang: filter tidak match, upsert bentrok di _id
+		if mongo.IsDuplicateKeyError(err) {
+			r.logger.DebugContext(ctx, "job lease held by another owner", "job", job, "owner", owner)
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// ReleaseLease drops the lock, but only if owner still holds it.
+func (r *mongoRepository) ReleaseLease(ctx context.Context, job, owner string) error {
+	ctx, span := tracing.Start(ctx, "JobRepository.ReleaseLease")
+	defer span.End()
+
+	_, err := r.locks.DeleteOne(ctx, bson.M{"_id": job, "owner": owner})
+	return err
+}
+
+func (r *mongoRepository) CreateRun(ctx context.Context, run *model.JobRun) error {
+	ctx, span := tracing.Start(ctx, "JobRepository.CreateRun")
+	defer span.End()
+
+	run.ID = primitive.NewObjectID()
+	_, err := r.runs.InsertOne(ctx, run)
+	return err
+}
+
+func (r *mongoRepository) FinishRun(ctx context.Context, run *model.JobRun) error {
+	ctx, span := tracing.Start(ctx, "JobRepository.FinishRun")
+	defer span.End()
+
+	_, err := r.runs.UpdateByID(ctx, run.ID, bson.M{"$set": bson.M{
+		"status":      run.Status,
+		"result":      run.Result,
+		"error":       run.Error,
+		"finished_at": run.FinishedAt,
+	}})
+	return err
+}
+
+// FindRuns returns the latest runs of job, newest first.
+func (r *mongoRepository) FindRuns(ctx context.Context, job string, limit int) ([]model.JobRun, error) {
+	ctx, span := tracing.Start(ctx, "JobRepository.FindRuns")
+	defer span.End()
+
+	cur, err := r.runs.Find(ctx,
+		bson.M{"job": job},
+		options.Find().SetSort(bson.M{"started_at": -1}).SetLimit(int64(limit)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	runs := []model.JobRun{}
+	if err := cur.All(ctx, &runs); err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
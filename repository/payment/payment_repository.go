@@ -5,13 +5,24 @@ import (
 	"time"
 
 	"ecom/model"
+	"ecom/util/tracing"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type Repository interface {
 	Create(ctx context.Context, p *model.Payment) error
+	FindByID(ctx context.Context, id primitive.ObjectID) (*model.Payment, error)
+	FindLatestByTransaction(ctx context.Context, txID primitive.ObjectID) (*model.Payment, error)
+	CountByEmailSince(ctx context.Context, email string, since time.Time) (int64, error)
+	FindCreatedBetween(ctx context.Context, from, to time.Time) ([]model.Payment, error)
+	FindByTransactionIDs(ctx context.Context, txIDs []primitive.ObjectID) ([]model.Payment, error)
+	List(ctx context.Context, f model.PaymentFilter) ([]model.Payment, int64, error)
+	Transition(ctx context.Context, p *model.Payment, from ...model.PaymentStatus) (bool, error)
+	ExpireStale(ctx context.Context, now time.Time) (int64, error)
 }
 
 type repo struct {
@@ -23,8 +34,188 @@ func NewRepository(col *mongo.Collection) Repository {
 }
 
 func (r *repo) Create(ctx context.Context, p *model.Payment) error {
+	ctx, span := tracing.Start(ctx, "PaymentRepository.Create")
+	defer span.End()
+
 	p.ID = primitive.NewObjectID()
 	p.CreatedAt = time.Now()
+	p.UpdatedAt = p.CreatedAt
 	_, err := r.col.InsertOne(ctx, p)
 	return err
 }
+
+func (r *repo) FindByID(ctx context.Context, id primitive.ObjectID) (*model.Payment, error) {
+	ctx, span := tracing.Start(ctx, "PaymentRepository.FindByID")
+	defer span.End()
+
+	var p model.Payment
+	if err := r.col.FindOne(ctx, bson.M{"_id": id}).Decode(&p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// FindLatestByTransaction returns the highest attempt for a transaction.
+func (r *repo) FindLatestByTransaction(ctx context.Context, txID primitive.ObjectID) (*model.Payment, error) {
+	ctx, span := tracing.Start(ctx, "PaymentRepository.FindLatestByTransaction")
+	defer span.End()
+
+	var p model.Payment
+	err := r.col.FindOne(ctx,
+		bson.M{"transaction_id": txID},
+		options.FindOne().SetSort(bson.D{{Key: "attempt", Value: -1}}),
+	).Decode(&p)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r *repo) CountByEmailSince(ctx context.Context, email string, since time.Time) (int64, error) {
+	ctx, span := tracing.Start(ctx, "PaymentRepository.CountByEmailSince")
+	defer span.End()
+
+	return r.col.CountDocuments(ctx, bson.M{
+		"email":      email,
+		"created_at": bson.M{"$gte": since},
+	})
+}
+
+func (r *repo) FindCreatedBetween(ctx context.Context, from, to time.Time) ([]model.Payment, error) {
+	ctx, span := tracing.Start(ctx, "PaymentRepository.FindCreatedBetween")
+	defer span.End()
+
+	return r.find(ctx, bson.M{"created_at": bson.M{"$gte": from, "$lt": to}})
+}
+
+func (r *repo) FindByTransactionIDs(ctx context.Context, txIDs []primitive.ObjectID) ([]model.Payment, error) {
+	ctx, span := tracing.Start(ctx, "PaymentRepository.FindByTransactionIDs")
+	defer span.End()
+
+	if len(txIDs) == 0 {
+		return []model.Payment{}, nil
+	}
+	return r.find(ctx, bson.M{"transaction_id": bson.M{"$in": txIDs}})
+}
+
+func (r *repo) find(ctx context.Context, filter bson.M) ([]model.Payment, error) {
+	cur, err := r.col.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	payments := []model.Payment{}
+	if err := cur.All(ctx, &payments); err != nil {
+		return nil, err
+	}
+	return payments, nil
+}
+
+// List returns one page of payments matching f (newest first) and the total match count.
+func (r *repo) List(ctx context.Context, f model.PaymentFilter) ([]model.Payment, int64, error) {
+	ctx, span := tracing.Start(ctx, "PaymentRepository.List")
+	defer span.End()
+
+	filter := bson.M{}
+	if f.TransactionID != nil {
+		filter["transaction_id"] = *f.TransactionID
+	}
+	if f.Email != "" {
+		filter["email"] = f.Email
+	}
+	if f.Status != "" {
+		filter["status"] = f.Status
+	}
+	if f.From != nil || f.To != nil {
+		created := bson.M{}
+		if f.From != nil {
+			created["$gte"] = *f.From
+		}
+		if f.To != nil {
+			created["$lt"] = *f.To
+		}
+		filter["created_at"] = created
+	}
+
+	total, err := r.col.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetSkip(f.Skip).
+		SetLimit(f.Limit)
+
+	cur, err := r.col.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cur.Close(ctx)
+
+	payments := []model.Payment{}
+	if err := cur.All(ctx, &payments); err != nil {
+		return nil, 0, err
+	}
+	return payments, total, nil
+}
+
+// Transition saves the lifecycle fields of p, but only while the stored payment
+// is still in one of the from statuses. It returns false when another request
+// (or the expire job) moved the payment first.
+func (r *repo) Transition(ctx context.Context, p *model.Payment, from ...model.PaymentStatus) (bool, error) {
+	ctx, span := tracing.Start(ctx, "PaymentRepository.Transition")
+	defer span.End()
+
+	p.UpdatedAt = time.Now()
+	res, err := r.col.UpdateOne(ctx,
+		bson.M{
+			"_id":    p.ID,
+			"status": bson.M{"$in": from},
+		},
+		bson.M{
+			"$set": bson.M{
+				"status":          p.Status,
+				"decline_reason":  p.DeclineReason,
+				"captured_amount": p.CapturedAmount,
+				"authorized_at":   p.AuthorizedAt,
+				"expires_at":      p.ExpiresAt,
+				"captured_at":     p.CapturedAt,
+				"voided_at":       p.VoidedAt,
+				"risk":            p.Risk,
+				"updated_at":      p.UpdatedAt,
+			},
+		},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount == 1, nil
+}
+
+// ExpireStale expires payments still waiting for review, authorize or capture
+// after their expires_at.
+func (r *repo) ExpireStale(ctx context.Context, now time.Time) (int64, error) {
+	ctx, span := tracing.Start(ctx, "PaymentRepository.ExpireStale")
+	defer span.End()
+
+	res, err := r.col.UpdateMany(ctx,
+		bson.M{
+			"status": bson.M{"$in": []model.PaymentStatus{
+				model.PaymentStatusReview, model.PaymentStatusCreated, model.PaymentStatusAuthorized,
+			}},
+			"expires_at": bson.M{"$lt": now},
+		},
+		bson.M{
+			"$set": bson.M{
+				"status":     model.PaymentStatusExpired,
+				"updated_at": now,
+			},
+		},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
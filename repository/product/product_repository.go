@@ -2,43 +2,107 @@ package product
 
 import (
 	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
 	"time"
 
 	"ecom/model"
+	"ecom/util/tracing"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type Repository interface {
 	Create(ctx context.Context, p *model.Product) error
-	FindAll(ctx context.Context) ([]model.Product, error)
+	FindAll(ctx context.Context, f model.ProductFilter) ([]model.Product, error)
 	FindByID(ctx context.Context, id primitive.ObjectID) (*model.Product, error)
 	Update(ctx context.Context, p *model.Product) error
+	UpdateFields(ctx context.Context, p *model.Product, fields []string) error
 	Delete(ctx context.Context, id primitive.ObjectID) error
+
+	FindBySKU(ctx context.Context, sku string) (*model.Product, error)
+	UpsertBySKU(ctx context.Context, p *model.Product, fields []string) (bool, error)
+	Stream(ctx context.Context, fn func(p *model.Product) error) error
+	CountByCategory(ctx context.Context, categoryID primitive.ObjectID) (int64, error)
+
+	Search(ctx context.Context, f model.ProductSearchFilter) (*model.ProductSearchResult, error)
+	SuggestWords(ctx context.Context, prefix string) ([]string, error)
+	SuggestCandidates(ctx context.Context, groups [][]string) ([]model.Product, error)
+
+	AddVariant(ctx context.Context, p *model.Product, v *model.Variant) error
+	UpdateVariant(ctx context.Context, p *model.Product, v *model.Variant) error
+	RemoveVariant(ctx context.Context, productID, variantID primitive.ObjectID) (bool, error)
+
+	// Stock operations work on the product, or on one of its variants when
+	// variantID is not zero.
+	Reserve(ctx context.Context, id, variantID primitive.ObjectID, qty int) (bool, error)
+	CommitReserved(ctx context.Context, id, variantID primitive.ObjectID, qty int) error
+	ReleaseReserved(ctx context.Context, id, variantID primitive.ObjectID, qty int) error
+	Restock(ctx context.Context, id, variantID primitive.ObjectID, qty int) error
 }
 
 type mongoRepository struct {
-	col *mongo.Collection
+	col    *mongo.Collection
+	logger *slog.Logger
+}
+
+type Option func(*mongoRepository)
+
+// WithLogger sets the logger for version conflicts and lost stock reservations (default slog.Default()).
+func WithLogger(l *slog.Logger) Option {
+	return func(r *mongoRepository) {
+		if l != nil {
+			r.logger = l
+		}
+	}
 }
 
-func NewRepository(col *mongo.Collection) Repository {
-	return &mongoRepository{col: col}
+func NewRepository(col *mongo.Collection, opts ...Option) Repository {
+	r := &mongoRepository{col: col, logger: slog.Default()}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
 }
 
 func (r *mongoRepository) Create(ctx context.Context, p *model.Product) error {
+	ctx, span := tracing.Start(ctx, "ProductRepository.Create")
+	defer span.End()
+
 	p.ID = primitive.NewObjectID()
 	now := time.Now()
 	p.CreatedAt = now
 	p.UpdatedAt = now
+	p.Version = 1
+	p.Words = model.SearchWords(p.Name, p.Tags)
 
 	_, err := r.col.InsertOne(ctx, p)
 	return err
 }
 
-func (r *mongoRepository) FindAll(ctx context.Context) ([]model.Product, error) {
-	cur, err := r.col.Find(ctx, bson.M{})
+func (r *mongoRepository) FindAll(ctx context.Context, f model.ProductFilter) ([]model.Product, error) {
+	ctx, span := tracing.Start(ctx, "ProductRepository.FindAll")
+	defer span.End()
+
+	filter := bson.M{}
+	if f.CategoryID != nil {
+		filter["category_ids"] = *f.CategoryID
+	}
+	if f.Tag != "" {
+		filter["tags"] = f.Tag
+	}
+	if f.Status != "" {
+		filter["status"] = f.Status
+	}
+
+	cur, err := r.col.Find(ctx, filter)
 	if err != nil {
 		return nil, err
 	}
@@ -52,6 +116,9 @@ func (r *mongoRepository) FindAll(ctx context.Context) ([]model.Product, error)
 }
 
 func (r *mongoRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*model.Product, error) {
+	ctx, span := tracing.Start(ctx, "ProductRepository.FindByID")
+	defer span.End()
+
 	var p model.Product
 	if err := r.col.FindOne(ctx, bson.M{"_id": id}).Decode(&p); err != nil {
 		return nil, err
@@ -59,20 +126,621 @@ func (r *mongoRepository) FindByID(ctx context.Context, id primitive.ObjectID) (
 	return &p, nil
 }
 
+// editableFields are the product fields Update and UpdateFields write, keyed
+// by their bson name.
+func editableFields(p *model.Product) bson.M {
+	return bson.M{
+		"sku":          p.SKU,
+		"name":         p.Name,
+		"description":  p.Description,
+		"category_ids": p.CategoryIDs,
+		"tags":         p.Tags,
+		"images":       p.Images,
+		"weight_grams": p.WeightGrams,
+		"dimensions":   p.Dimensions,
+		"status":       p.Status,
+		"price":        p.Price,
+		"stock":        p.Stock,
+	}
+}
+
+// Update saves p only if the stored version is still p.Version, and returns
+// model.ErrVersionConflict otherwise. On success p.Version is the new version.
 func (r *mongoRepository) Update(ctx context.Context, p *model.Product) error {
-	p.UpdatedAt = time.Now()
-	_, err := r.col.UpdateByID(ctx, p.ID, bson.M{
-		"$set": bson.M{
-			"name":       p.Name,
-			"price":      p.Price,
-			"stock":      p.Stock,
-			"updated_at": p.UpdatedAt,
+	ctx, span := tracing.Start(ctx, "ProductRepository.Update")
+	defer span.End()
+
+	fields := editableFields(p)
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	return r.UpdateFields(ctx, p, names)
+}
+
+// UpdateFields is Update limited to the given fields (bson names), so values
+// the caller didn't touch, like stock during a price change, are left alone.
+func (r *mongoRepository) UpdateFields(ctx context.Context, p *model.Product, fields []string) error {
+	ctx, span := tracing.Start(ctx, "ProductRepository.UpdateFields")
+	defer span.End()
+
+	editable := editableFields(p)
+	updatedAt := time.Now()
+	set := bson.M{"updated_at": updatedAt}
+	unset := bson.M{}
+	for _, name := range fields {
+		v, ok := editable[name]
+		if !ok {
+			return fmt.Errorf("product field %q is not editable", name)
+		}
+		// sku kosong di-unset, "" ikut unique index sku dan bentrok antar produk
+		if name == "sku" && p.SKU == "" {
+			unset[name] = ""
+			continue
+		}
+		set[name] = v
+	}
+	words := p.Words
+	_, nameSet := set["name"]
+	_, tagsSet := set["tags"]
+	if nameSet || tagsSet {
+		words = model.SearchWords(p.Name, p.Tags)
+		set["words"] = words
+	}
+
+	update := bson.M{"$set": set, "$inc": bson.M{"version": 1}}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	res, err := r.col.UpdateOne(ctx, bson.M{"_id": p.ID, "version": p.Version}, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		r.logger.WarnContext(ctx, "product version conflict", "product_id", p.ID.Hex(), "version", p.Version)
+		return model.ErrVersionConflict
+	}
+	p.Version++
+	p.UpdatedAt = updatedAt
+	p.Words = words
+	return nil
+}
+
+func (r *mongoRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	ctx, span := tracing.Start(ctx, "ProductRepository.Delete")
+	defer span.End()
+
+	_, err := r.col.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+func (r *mongoRepository) FindBySKU(ctx context.Context, sku string) (*model.Product, error) {
+	ctx, span := tracing.Start(ctx, "ProductRepository.FindBySKU")
+	defer span.End()
+
+	var p model.Product
+	if err := r.col.FindOne(ctx, bson.M{"sku": sku}).Decode(&p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// UpsertBySKU creates or updates the product with p.SKU and reports whether it was created.
+// Name, price and stock are always written; fields lists the catalog fields
+// (bson names: description, status, category_ids, tags) to write as well.
+// The others keep their stored value, or get their default on create.
+// Reserved stock is left alone on update, and an update that would put stock
+// below it fails with model.ErrStockBelowReserved. The check is part of the
+// filter, so a Reserve running at the same time can't slip in between.
+func (r *mongoRepository) UpsertBySKU(ctx context.Context, p *model.Product, fields []string) (bool, error) {
+	ctx, span := tracing.Start(ctx, "ProductRepository.UpsertBySKU")
+	defer span.End()
+
+	now := time.Now()
+	set := bson.M{
+		"name":       p.Name,
+		"price":      p.Price,
+		"stock":      p.Stock,
+		"updated_at": now,
+	}
+	onInsert := bson.M{
+		"description":  "",
+		"status":       model.ProductStatusActive,
+		"category_ids": bson.A{},
+		"tags":         bson.A{},
+		"images":       bson.A{},
+		"reserved":     0,
+		"created_at":   now,
+	}
+	importable := bson.M{
+		"description":  p.Description,
+		"status":       p.Status,
+		"category_ids": p.CategoryIDs,
+		"tags":         p.Tags,
+	}
+	for _, name := range fields {
+		v, ok := importable[name]
+		if !ok {
+			return false, fmt.Errorf("product field %q is not importable", name)
+		}
+		// field yang sama tidak boleh ada di $set dan $setOnInsert
+		set[name] = v
+		delete(onInsert, name)
+	}
+
+	res, err := r.col.UpdateOne(ctx,
+		bson.M{
+			"sku": p.SKU,
+			// produk baru belum punya reserved: null <= stock
+			"$expr": bson.M{"$lte": bson.A{"$reserved", p.Stock}},
 		},
+		bson.M{
+			"$set":         set,
+			"$inc":         bson.M{"version": 1},
+			"$setOnInsert": onInsert,
+		},
+		options.Update().SetUpsert(true),
+	)
+	// filter tidak cocok karena reserved > stock, upsert lalu bentrok dengan index unik sku
+	if mongo.IsDuplicateKeyError(err) {
+		return false, model.ErrStockBelowReserved
+	}
+	if err != nil {
+		return false, err
+	}
+	// tags produk yang sudah ada tidak diketahui di sini, words dihitung ulang dari dokumen
+	if err := r.syncWords(ctx, p.SKU); err != nil {
+		return false, err
+	}
+	return res.UpsertedID != nil, nil
+}
+
+// syncWords recomputes words of the product with sku from its stored name and
+// tags. The write matches on version, so a concurrent edit (which sets words
+// itself) isn't overwritten with stale words.
+func (r *mongoRepository) syncWords(ctx context.Context, sku string) error {
+	var p model.Product
+	err := r.col.FindOne(ctx, bson.M{"sku": sku},
+		options.FindOne().SetProjection(bson.M{"name": 1, "tags": 1, "words": 1, "version": 1}),
+	).Decode(&p)
+	if err != nil {
+		return err
+	}
+	words := model.SearchWords(p.Name, p.Tags)
+	if slices.Equal(words, p.Words) {
+		return nil
+	}
+	_, err = r.col.UpdateOne(ctx,
+		bson.M{"_id": p.ID, "version": p.Version},
+		bson.M{"$set": bson.M{"words": words}},
+	)
+	return err
+}
+
+// Stream calls fn for every product in _id order, reading from the cursor
+// one document at a time.
+func (r *mongoRepository) Stream(ctx context.Context, fn func(p *model.Product) error) error {
+	ctx, span := tracing.Start(ctx, "ProductRepository.Stream")
+	defer span.End()
+
+	cur, err := r.col.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var p model.Product
+		if err := cur.Decode(&p); err != nil {
+			return err
+		}
+		if err := fn(&p); err != nil {
+			return err
+		}
+	}
+	return cur.Err()
+}
+
+func (r *mongoRepository) CountByCategory(ctx context.Context, categoryID primitive.ObjectID) (int64, error) {
+	ctx, span := tracing.Start(ctx, "ProductRepository.CountByCategory")
+	defer span.End()
+
+	return r.col.CountDocuments(ctx, bson.M{"category_ids": categoryID})
+}
+
+// Search runs a text search over active products. Facets are computed in the
+// same query: the category facet ignores the category filter and the price
+// facet ignores the price filter, so picking one doesn't hide its alternatives.
+func (r *mongoRepository) Search(ctx context.Context, f model.ProductSearchFilter) (*model.ProductSearchResult, error) {
+	ctx, span := tracing.Start(ctx, "ProductRepository.Search")
+	defer span.End()
+
+	byCategory := bson.M{}
+	if f.CategoryID != nil {
+		byCategory["category_ids"] = *f.CategoryID
+	}
+	byPrice := bson.M{}
+	price := bson.M{}
+	if f.MinPrice > 0 {
+		price["$gte"] = f.MinPrice
+	}
+	if f.MaxPrice > 0 {
+		price["$lte"] = f.MaxPrice
+	}
+	if len(price) > 0 {
+		byPrice["price"] = price
+	}
+	both := bson.M{}
+	for k, v := range byCategory {
+		both[k] = v
+	}
+	for k, v := range byPrice {
+		both[k] = v
+	}
+
+	var sort bson.D
+	switch f.Sort {
+	case model.SearchSortPriceAsc:
+		sort = bson.D{{Key: "price", Value: 1}, {Key: "_id", Value: 1}}
+	case model.SearchSortPriceDesc:
+		sort = bson.D{{Key: "price", Value: -1}, {Key: "_id", Value: 1}}
+	case model.SearchSortNewest:
+		sort = bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}
+	default:
+		sort = bson.D{{Key: "score", Value: -1}, {Key: "_id", Value: 1}}
+	}
+
+	// batas atas terakhir supaya semua harga masuk salah satu bucket
+	boundaries := append(append([]float64{}, f.PriceBoundaries...), math.MaxFloat64)
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"$text":  bson.M{"$search": f.Text},
+			"status": model.ProductStatusActive,
+		}}},
+		{{Key: "$addFields", Value: bson.M{"score": bson.M{"$meta": "textScore"}}}},
+		{{Key: "$facet", Value: bson.M{
+			"items": bson.A{
+				bson.M{"$match": both},
+				bson.M{"$sort": sort},
+				bson.M{"$skip": f.Skip},
+				bson.M{"$limit": f.Limit},
+			},
+			"total": bson.A{
+				bson.M{"$match": both},
+				bson.M{"$count": "n"},
+			},
+			"categories": bson.A{
+				bson.M{"$match": byPrice},
+				bson.M{"$unwind": "$category_ids"},
+				bson.M{"$group": bson.M{"_id": "$category_ids", "count": bson.M{"$sum": 1}}},
+				bson.M{"$sort": bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}},
+				bson.M{"$limit": 20},
+				bson.M{"$lookup": bson.M{
+					"from":         "categories",
+					"localField":   "_id",
+					"foreignField": "_id",
+					"as":           "category",
+				}},
+				bson.M{"$unwind": "$category"},
+				bson.M{"$project": bson.M{"count": 1, "name": "$category.name", "slug": "$category.slug"}},
+			},
+			"price_ranges": bson.A{
+				bson.M{"$match": byCategory},
+				bson.M{"$bucket": bson.M{
+					"groupBy":    "$price",
+					"boundaries": boundaries,
+					"default":    "other",
+					"output":     bson.M{"count": bson.M{"$sum": 1}},
+				}},
+			},
+		}}},
+	}
+
+	cur, err := r.col.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var out []struct {
+		Items []model.ProductSearchHit `bson:"items"`
+		Total []struct {
+			N int64 `bson:"n"`
+		} `bson:"total"`
+		Categories  []model.CategoryFacet `bson:"categories"`
+		PriceRanges []struct {
+			Min   any   `bson:"_id"`
+			Count int64 `bson:"count"`
+		} `bson:"price_ranges"`
+	}
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+
+	res := &model.ProductSearchResult{
+		Items: []model.ProductSearchHit{},
+		Facets: model.SearchFacets{
+			Categories:  []model.CategoryFacet{},
+			PriceRanges: []model.PriceRangeFacet{},
+		},
+	}
+	if len(out) == 0 {
+		return res, nil
+	}
+	o := out[0]
+	if o.Items != nil {
+		res.Items = o.Items
+	}
+	if len(o.Total) > 0 {
+		res.Total = o.Total[0].N
+	}
+	if o.Categories != nil {
+		res.Facets.Categories = o.Categories
+	}
+	for _, b := range o.PriceRanges {
+		// bucket "other" berisi produk tanpa harga, tidak ditampilkan
+		lower, ok := b.Min.(float64)
+		if !ok {
+			continue
+		}
+		pr := model.PriceRangeFacet{Min: lower, Count: b.Count}
+		for i := 0; i < len(boundaries)-2; i++ {
+			if boundaries[i] == lower {
+				upper := boundaries[i+1]
+				pr.Max = &upper
+			}
+		}
+		res.Facets.PriceRanges = append(res.Facets.PriceRanges, pr)
+	}
+	return res, nil
+}
+
+// SuggestWords returns the distinct words starting with prefix in the names
+// and tags of active products, the vocabulary autocomplete matches against.
+func (r *mongoRepository) SuggestWords(ctx context.Context, prefix string) ([]string, error) {
+	ctx, span := tracing.Start(ctx, "ProductRepository.SuggestWords")
+	defer span.End()
+
+	// regex ter-anchor tanpa flag i bisa memakai index {status, words}; words sudah lowercase
+	re := primitive.Regex{Pattern: "^" + regexp.QuoteMeta(strings.ToLower(prefix))}
+	cur, err := r.col.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"status": model.ProductStatusActive, "words": re}}},
+		{{Key: "$unwind", Value: "$words"}},
+		{{Key: "$match", Value: bson.M{"words": re}}},
+		{{Key: "$group", Value: bson.M{"_id": "$words"}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var out []struct {
+		Word string `bson:"_id"`
+	}
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	words := make([]string, len(out))
+	for i, o := range out {
+		words[i] = o.Word
+	}
+	return words, nil
+}
+
+// SuggestCandidates returns the name and tags of active products that have at
+// least one word of every group, e.g. the catalog words close enough to each
+// word typed so far. The typo ranking happens in the service on this set.
+func (r *mongoRepository) SuggestCandidates(ctx context.Context, groups [][]string) ([]model.Product, error) {
+	ctx, span := tracing.Start(ctx, "ProductRepository.SuggestCandidates")
+	defer span.End()
+
+	and := bson.A{}
+	for _, g := range groups {
+		and = append(and, bson.M{"words": bson.M{"$in": g}})
+	}
+	cur, err := r.col.Find(ctx,
+		bson.M{"status": model.ProductStatusActive, "$and": and},
+		options.Find().SetProjection(bson.M{"name": 1, "tags": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var products []model.Product
+	if err := cur.All(ctx, &products); err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+// AddVariant appends v to the variants of p, only if the stored version is
+// still p.Version: the duplicate SKU/options check ran on that version. It
+// returns model.ErrVersionConflict otherwise.
+func (r *mongoRepository) AddVariant(ctx context.Context, p *model.Product, v *model.Variant) error {
+	ctx, span := tracing.Start(ctx, "ProductRepository.AddVariant")
+	defer span.End()
+
+	v.ID = primitive.NewObjectID()
+	res, err := r.col.UpdateOne(ctx, bson.M{"_id": p.ID, "version": p.Version}, bson.M{
+		"$push": bson.M{"variants": v},
+		"$inc":  bson.M{"version": 1},
+		"$set":  bson.M{"updated_at": time.Now()},
 	})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		r.logger.WarnContext(ctx, "product version conflict", "product_id", p.ID.Hex(), "version", p.Version)
+		return model.ErrVersionConflict
+	}
+	p.Version++
+	return nil
+}
+
+// UpdateVariant replaces the editable fields of v, only if the stored version
+// of p is still p.Version, so the duplicate check and reserved stock the
+// caller saw still hold. It returns model.ErrVersionConflict otherwise.
+func (r *mongoRepository) UpdateVariant(ctx context.Context, p *model.Product, v *model.Variant) error {
+	ctx, span := tracing.Start(ctx, "ProductRepository.UpdateVariant")
+	defer span.End()
+
+	set := bson.M{
+		"variants.$.sku":     v.SKU,
+		"variants.$.options": v.Options,
+		"variants.$.stock":   v.Stock,
+		"updated_at":         time.Now(),
+	}
+	update := bson.M{"$set": set, "$inc": bson.M{"version": 1}}
+	// price kosong berarti variant kembali memakai harga produk
+	if v.Price != nil {
+		set["variants.$.price"] = *v.Price
+	} else {
+		update["$unset"] = bson.M{"variants.$.price": ""}
+	}
+
+	res, err := r.col.UpdateOne(ctx,
+		bson.M{"_id": p.ID, "version": p.Version, "variants._id": v.ID},
+		update,
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		r.logger.WarnContext(ctx, "product version conflict", "product_id", p.ID.Hex(), "version", p.Version)
+		return model.ErrVersionConflict
+	}
+	p.Version++
+	return nil
+}
+
+// RemoveVariant deletes a variant that has no reserved units. It returns false
+// when the variant is gone or still reserved by a pending transaction.
+func (r *mongoRepository) RemoveVariant(ctx context.Context, productID, variantID primitive.ObjectID) (bool, error) {
+	ctx, span := tracing.Start(ctx, "ProductRepository.RemoveVariant")
+	defer span.End()
+
+	res, err := r.col.UpdateOne(ctx,
+		bson.M{
+			"_id":      productID,
+			"variants": bson.M{"$elemMatch": bson.M{"_id": variantID, "reserved": bson.M{"$lte": 0}}},
+		},
+		bson.M{
+			"$pull": bson.M{"variants": bson.M{"_id": variantID}},
+			"$inc":  bson.M{"version": 1},
+			"$set":  bson.M{"updated_at": time.Now()},
+		},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount == 1, nil
+}
+
+// stockTarget points the stock operations below at the product itself, or at
+// one of its variants when variantID is set.
+type stockTarget struct {
+	prefix string
+	opts   *options.UpdateOptions
+}
+
+func targetOf(variantID primitive.ObjectID) stockTarget {
+	if variantID.IsZero() {
+		return stockTarget{opts: options.Update()}
+	}
+	return stockTarget{
+		prefix: "variants.$[v].",
+		opts: options.Update().SetArrayFilters(options.ArrayFilters{
+			Filters: []interface{}{bson.M{"v._id": variantID}},
+		}),
+	}
+}
+
+func (t stockTarget) field(name string) string {
+	return t.prefix + name
+}
+
+// availableExpr computes stock - reserved of the target inside $expr.
+func availableExpr(variantID primitive.ObjectID) bson.M {
+	if variantID.IsZero() {
+		return bson.M{"$subtract": bson.A{"$stock", bson.M{"$ifNull": bson.A{"$reserved", 0}}}}
+	}
+	return bson.M{"$let": bson.M{
+		"vars": bson.M{"v": bson.M{"$first": bson.M{"$filter": bson.M{
+			"input": bson.M{"$ifNull": bson.A{"$variants", bson.A{}}},
+			"cond":  bson.M{"$eq": bson.A{"$$this._id", variantID}},
+		}}}},
+		"in": bson.M{"$subtract": bson.A{"$$v.stock", bson.M{"$ifNull": bson.A{"$$v.reserved", 0}}}},
+	}}
+}
+
+// Reserve atomically moves qty units into reserved, only if enough stock is still available.
+// With a non-zero variantID the variant's stock is reserved instead of the product's.
+// It returns false when the product (or variant) does not have qty units available.
+func (r *mongoRepository) Reserve(ctx context.Context, id, variantID primitive.ObjectID, qty int) (bool, error) {
+	ctx, span := tracing.Start(ctx, "ProductRepository.Reserve")
+	defer span.End()
+
+	t := targetOf(variantID)
+	res, err := r.col.UpdateOne(ctx,
+		bson.M{
+			"_id": id,
+			// variant yang tidak ada menghasilkan null, dan null < qty
+			"$expr": bson.M{"$gte": bson.A{availableExpr(variantID), qty}},
+		},
+		bson.M{
+			"$inc": bson.M{t.field("reserved"): qty, "version": 1},
+			"$set": bson.M{"updated_at": time.Now()},
+		},
+		t.opts,
+	)
+	if err != nil {
+		return false, err
+	}
+	if res.MatchedCount == 0 {
+		r.logger.DebugContext(ctx, "reserve: not enough stock available",
+			"product_id", id.Hex(), "variant_id", variantID.Hex(), "qty", qty)
+		return false, nil
+	}
+	return true, nil
+}
+
+// CommitReserved turns reserved units into sold units (stock and reserved both decrease).
+func (r *mongoRepository) CommitReserved(ctx context.Context, id, variantID primitive.ObjectID, qty int) error {
+	ctx, span := tracing.Start(ctx, "ProductRepository.CommitReserved")
+	defer span.End()
+
+	t := targetOf(variantID)
+	_, err := r.col.UpdateByID(ctx, id, bson.M{
+		"$inc": bson.M{t.field("stock"): -qty, t.field("reserved"): -qty, "version": 1},
+		"$set": bson.M{"updated_at": time.Now()},
+	}, t.opts)
 	return err
 }
 
-func (r *mongoRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
-	_, err := r.col.DeleteOne(ctx, bson.M{"_id": id})
+// Restock puts sold units back into stock (e.g. when capturing the payment fails after commit).
+func (r *mongoRepository) Restock(ctx context.Context, id, variantID primitive.ObjectID, qty int) error {
+	ctx, span := tracing.Start(ctx, "ProductRepository.Restock")
+	defer span.End()
+
+	t := targetOf(variantID)
+	_, err := r.col.UpdateByID(ctx, id, bson.M{
+		"$inc": bson.M{t.field("stock"): qty, "version": 1},
+		"$set": bson.M{"updated_at": time.Now()},
+	}, t.opts)
+	return err
+}
+
+// ReleaseReserved gives reserved units back to available stock.
+func (r *mongoRepository) ReleaseReserved(ctx context.Context, id, variantID primitive.ObjectID, qty int) error {
+	ctx, span := tracing.Start(ctx, "ProductRepository.ReleaseReserved")
+	defer span.End()
+
+	t := targetOf(variantID)
+	_, err := r.col.UpdateByID(ctx, id, bson.M{
+		"$inc": bson.M{t.field("reserved"): -qty, "version": 1},
+		"$set": bson.M{"updated_at": time.Now()},
+	}, t.opts)
 	return err
 }
@@ -0,0 +1,73 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"ecom/model"
+	"ecom/util/tracing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Repository keeps rate limit token buckets, one document per key, so all
+// replicas share the same budget.
+type Repository interface {
+	Take(ctx context.Context, key string, rule model.RateLimitRule, now time.Time) (float64, bool, error)
+}
+
+type mongoRepository struct {
+	col *mongo.Collection
+}
+
+func NewRepository(col *mongo.Collection) Repository {
+	return &mongoRepository{col: col}
+}
+
+type bucketDoc struct {
+	Tokens  float64 `bson:"tokens"`
+	Allowed bool    `bson:"allowed"`
+}
+
+// Take refills and takes a token in a single pipeline update, so concurrent
+// requests on different replicas can't spend the same token twice.
+func (r *mongoRepository) Take(ctx context.Context, key string, rule model.RateLimitRule, now time.Time) (float64, bool, error) {
+	ctx, span := tracing.Start(ctx, "RateLimitRepository.Take")
+	defer span.End()
+
+	burst := float64(rule.Burst)
+	// detik sejak bucket terakhir dipakai; clock replica bisa sedikit mundur
+	elapsed := bson.M{"$max": bson.A{0, bson.M{"$divide": bson.A{
+		bson.M{"$subtract": bson.A{now, bson.M{"$ifNull": bson.A{"$updated_at", now}}}},
+		1000,
+	}}}}
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"tokens": bson.M{"$min": bson.A{burst, bson.M{"$add": bson.A{
+				bson.M{"$ifNull": bson.A{"$tokens", burst}},
+				bson.M{"$multiply": bson.A{elapsed, rule.Rate}},
+			}}}},
+		}}},
+		{{Key: "$set", Value: bson.M{"allowed": bson.M{"$gte": bson.A{"$tokens", 1}}}}},
+		{{Key: "$set", Value: bson.M{
+			"tokens":     bson.M{"$cond": bson.A{"$allowed", bson.M{"$subtract": bson.A{"$tokens", 1}}, "$tokens"}},
+			"updated_at": now,
+			// bucket yang sudah penuh lagi sama dengan bucket baru, dibuang TTL index
+			"expires_at": now.Add(rule.Refill(burst)),
+		}}},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var doc bucketDoc
+	err := r.col.FindOneAndUpdate(ctx, bson.M{"_id": key}, pipeline, opts).Decode(&doc)
+	if mongo.IsDuplicateKeyError(err) {
+		// dua upsert pertama untuk key yang sama bersamaan, yang kalah diulang
+		err = r.col.FindOneAndUpdate(ctx, bson.M{"_id": key}, pipeline, opts).Decode(&doc)
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return doc.Tokens, doc.Allowed, nil
+}
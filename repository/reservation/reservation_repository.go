@@ -0,0 +1,123 @@
+package reservation
+
+import (
+	"context"
+	"time"
+
+	"ecom/model"
+	"ecom/util/tracing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type Repository interface {
+	Create(ctx context.Context, r *model.Reservation) error
+	FindByTransactionID(ctx context.Context, txID primitive.ObjectID) (*model.Reservation, error)
+	FindExpired(ctx context.Context, now time.Time) ([]model.Reservation, error)
+	UpdateStatus(ctx context.Context, id primitive.ObjectID, from, to model.ReservationStatus) (bool, error)
+	UpdateQty(ctx context.Context, id primitive.ObjectID, from, to int) (bool, error)
+	Extend(ctx context.Context, id primitive.ObjectID, until time.Time) (bool, error)
+}
+
+type mongoRepository struct {
+	col *mongo.Collection
+}
+
+func NewRepository(col *mongo.Collection) Repository {
+	return &mongoRepository{col: col}
+}
+
+func (r *mongoRepository) Create(ctx context.Context, res *model.Reservation) error {
+	ctx, span := tracing.Start(ctx, "ReservationRepository.Create")
+	defer span.End()
+
+	res.ID = primitive.NewObjectID()
+	now := time.Now()
+	res.CreatedAt = now
+	res.UpdatedAt = now
+
+	_, err := r.col.InsertOne(ctx, res)
+	return err
+}
+
+func (r *mongoRepository) FindByTransactionID(ctx context.Context, txID primitive.ObjectID) (*model.Reservation, error) {
+	ctx, span := tracing.Start(ctx, "ReservationRepository.FindByTransactionID")
+	defer span.End()
+
+	var res model.Reservation
+	if err := r.col.FindOne(ctx, bson.M{"transaction_id": txID}).Decode(&res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (r *mongoRepository) FindExpired(ctx context.Context, now time.Time) ([]model.Reservation, error) {
+	ctx, span := tracing.Start(ctx, "ReservationRepository.FindExpired")
+	defer span.End()
+
+	cur, err := r.col.Find(ctx, bson.M{
+		"status":     model.ReservationStatusActive,
+		"expires_at": bson.M{"$lt": now},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var list []model.Reservation
+	if err := cur.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// UpdateStatus moves a reservation from one status to another.
+// It returns false when the reservation is no longer in the "from" status,
+// so only one caller (payment flow or expire job) can settle it.
+func (r *mongoRepository) UpdateStatus(ctx context.Context, id primitive.ObjectID, from, to model.ReservationStatus) (bool, error) {
+	ctx, span := tracing.Start(ctx, "ReservationRepository.UpdateStatus")
+	defer span.End()
+
+	res, err := r.col.UpdateOne(ctx,
+		bson.M{"_id": id, "status": from},
+		bson.M{"$set": bson.M{"status": to, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount == 1, nil
+}
+
+// UpdateQty resizes an ACTIVE reservation from one qty to another. It returns
+// false when the reservation was settled or resized by someone else.
+func (r *mongoRepository) UpdateQty(ctx context.Context, id primitive.ObjectID, from, to int) (bool, error) {
+	ctx, span := tracing.Start(ctx, "ReservationRepository.UpdateQty")
+	defer span.End()
+
+	res, err := r.col.UpdateOne(ctx,
+		bson.M{"_id": id, "status": model.ReservationStatusActive, "qty": from},
+		bson.M{"$set": bson.M{"qty": to, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount == 1, nil
+}
+
+// Extend moves the expires_at of an ACTIVE reservation to until. It returns
+// false when the reservation was already settled.
+func (r *mongoRepository) Extend(ctx context.Context, id primitive.ObjectID, until time.Time) (bool, error) {
+	ctx, span := tracing.Start(ctx, "ReservationRepository.Extend")
+	defer span.End()
+
+	res, err := r.col.UpdateOne(ctx,
+		bson.M{"_id": id, "status": model.ReservationStatusActive},
+		bson.M{"$set": bson.M{"expires_at": until, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount == 1, nil
+}
@@ -2,44 +2,81 @@ package transaction
 
 import (
 	"context"
+	"fmt"
+	"log/slog"
 	"time"
 
 	"ecom/model"
+	"ecom/util/tracing"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type Repository interface {
 	Create(ctx context.Context, t *model.Transaction) error
 	FindAll(ctx context.Context) ([]model.Transaction, error)
+	FindAllByCustomer(ctx context.Context, customerID primitive.ObjectID) ([]model.Transaction, error)
 	FindByID(ctx context.Context, id primitive.ObjectID) (*model.Transaction, error)
 	Update(ctx context.Context, t *model.Transaction) error
+	UpdateFields(ctx context.Context, t *model.Transaction, fields []string) error
+	SetStatus(ctx context.Context, t *model.Transaction, from []model.TransactionStatus) (bool, error)
 	Delete(ctx context.Context, id primitive.ObjectID) error
 
+	FindCreatedBetween(ctx context.Context, from, to time.Time) ([]model.Transaction, error)
+	FindByIDs(ctx context.Context, ids []primitive.ObjectID) ([]model.Transaction, error)
+
+	SalesByPeriod(ctx context.Context, from, to time.Time, groupBy model.SalesGroupBy) ([]model.SalesBucket, error)
+	TopProducts(ctx context.Context, from, to time.Time, sortBy string, limit int) ([]model.ProductSales, error)
+	CountByStatus(ctx context.Context, from, to time.Time) (map[model.TransactionStatus]int64, error)
+
 	ExpireOldPending(ctx context.Context, olderThan time.Duration) (int64, error)
 }
 
 type mongoRepository struct {
-	col *mongo.Collection
+	col    *mongo.Collection
+	logger *slog.Logger
 }
 
-func NewRepository(col *mongo.Collection) Repository {
-	return &mongoRepository{col: col}
+type Option func(*mongoRepository)
+
+// WithLogger sets the logger for version conflicts (default slog.Default()).
+func WithLogger(l *slog.Logger) Option {
+	return func(r *mongoRepository) {
+		if l != nil {
+			r.logger = l
+		}
+	}
+}
+
+func NewRepository(col *mongo.Collection, opts ...Option) Repository {
+	r := &mongoRepository{col: col, logger: slog.Default()}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
 }
 
 func (r *mongoRepository) Create(ctx context.Context, t *model.Transaction) error {
+	ctx, span := tracing.Start(ctx, "TransactionRepository.Create")
+	defer span.End()
+
 	t.ID = primitive.NewObjectID()
 	now := time.Now()
 	t.CreatedAt = now
 	t.UpdatedAt = now
+	t.Version = 1
 
 	_, err := r.col.InsertOne(ctx, t)
 	return err
 }
 
 func (r *mongoRepository) FindAll(ctx context.Context) ([]model.Transaction, error) {
+	ctx, span := tracing.Start(ctx, "TransactionRepository.FindAll")
+	defer span.End()
+
 	cur, err := r.col.Find(ctx, bson.M{})
 	if err != nil {
 		return nil, err
@@ -53,7 +90,30 @@ func (r *mongoRepository) FindAll(ctx context.Context) ([]model.Transaction, err
 	return txs, nil
 }
 
+func (r *mongoRepository) FindAllByCustomer(ctx context.Context, customerID primitive.ObjectID) ([]model.Transaction, error) {
+	ctx, span := tracing.Start(ctx, "TransactionRepository.FindAllByCustomer")
+	defer span.End()
+
+	cur, err := r.col.Find(ctx,
+		bson.M{"customer_id": customerID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var txs []model.Transaction
+	if err := cur.All(ctx, &txs); err != nil {
+		return nil, err
+	}
+	return txs, nil
+}
+
 func (r *mongoRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*model.Transaction, error) {
+	ctx, span := tracing.Start(ctx, "TransactionRepository.FindByID")
+	defer span.End()
+
 	var t model.Transaction
 	if err := r.col.FindOne(ctx, bson.M{"_id": id}).Decode(&t); err != nil {
 		return nil, err
@@ -61,39 +121,266 @@ func (r *mongoRepository) FindByID(ctx context.Context, id primitive.ObjectID) (
 	return &t, nil
 }
 
+// Update saves t only if the stored version is still t.Version, and returns
+// model.ErrVersionConflict otherwise. On success t.Version is the new version.
 func (r *mongoRepository) Update(ctx context.Context, t *model.Transaction) error {
-	t.UpdatedAt = time.Now()
-	_, err := r.col.UpdateByID(ctx, t.ID, bson.M{
-		"$set": bson.M{
-			"product_id":   t.ProductID,
-			"qty":          t.Qty,
-			"total_amount": t.TotalAmount,
-			"email":        t.Email,
-			"status":       t.Status,
-			"updated_at":   t.UpdatedAt,
-		},
-	})
-	return err
+	ctx, span := tracing.Start(ctx, "TransactionRepository.Update")
+	defer span.End()
+
+	fields := []string{"product_id", "qty", "total_amount", "email", "status"}
+	if !t.PaymentID.IsZero() {
+		fields = append(fields, "payment_id")
+	}
+	if t.HoldUntil != nil {
+		fields = append(fields, "hold_until")
+	}
+	return r.UpdateFields(ctx, t, fields)
+}
+
+// UpdateFields is Update limited to the given fields (bson names).
+func (r *mongoRepository) UpdateFields(ctx context.Context, t *model.Transaction, fields []string) error {
+	ctx, span := tracing.Start(ctx, "TransactionRepository.UpdateFields")
+	defer span.End()
+
+	editable := bson.M{
+		"product_id":   t.ProductID,
+		"payment_id":   t.PaymentID,
+		"qty":          t.Qty,
+		"total_amount": t.TotalAmount,
+		"email":        t.Email,
+		"status":       t.Status,
+		"hold_until":   t.HoldUntil,
+	}
+	updatedAt := time.Now()
+	set := bson.M{"updated_at": updatedAt}
+	for _, name := range fields {
+		v, ok := editable[name]
+		if !ok {
+			return fmt.Errorf("transaction field %q is not editable", name)
+		}
+		set[name] = v
+	}
+
+	res, err := r.col.UpdateOne(ctx,
+		bson.M{"_id": t.ID, "version": t.Version},
+		bson.M{"$set": set, "$inc": bson.M{"version": 1}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		r.logger.WarnContext(ctx, "transaction version conflict", "transaction_id", t.ID.Hex(), "version", t.Version)
+		return model.ErrVersionConflict
+	}
+	t.Version++
+	t.UpdatedAt = updatedAt
+	return nil
+}
+
+// SetStatus saves t.Status (and t.PaymentID) if the stored status is still one
+// of from, whatever the version. It is for transitions that must not be lost
+// to a concurrent write, e.g. SUCCESS after the payment was captured. It
+// reports whether the transaction matched; t.Version is then the new version.
+func (r *mongoRepository) SetStatus(ctx context.Context, t *model.Transaction, from []model.TransactionStatus) (bool, error) {
+	ctx, span := tracing.Start(ctx, "TransactionRepository.SetStatus")
+	defer span.End()
+
+	updatedAt := time.Now()
+	set := bson.M{"status": t.Status, "updated_at": updatedAt}
+	if !t.PaymentID.IsZero() {
+		set["payment_id"] = t.PaymentID
+	}
+
+	var updated struct {
+		Version int64 `bson:"version"`
+	}
+	err := r.col.FindOneAndUpdate(ctx,
+		bson.M{"_id": t.ID, "status": bson.M{"$in": from}},
+		bson.M{"$set": set, "$inc": bson.M{"version": 1}},
+		options.FindOneAndUpdate().
+			SetReturnDocument(options.After).
+			SetProjection(bson.M{"version": 1}),
+	).Decode(&updated)
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	t.Version = updated.Version
+	t.UpdatedAt = updatedAt
+	return true, nil
 }
 
 func (r *mongoRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	ctx, span := tracing.Start(ctx, "TransactionRepository.Delete")
+	defer span.End()
+
 	_, err := r.col.DeleteOne(ctx, bson.M{"_id": id})
 	return err
 }
 
+func (r *mongoRepository) FindCreatedBetween(ctx context.Context, from, to time.Time) ([]model.Transaction, error) {
+	ctx, span := tracing.Start(ctx, "TransactionRepository.FindCreatedBetween")
+	defer span.End()
+
+	return r.find(ctx, bson.M{"created_at": bson.M{"$gte": from, "$lt": to}})
+}
+
+func (r *mongoRepository) FindByIDs(ctx context.Context, ids []primitive.ObjectID) ([]model.Transaction, error) {
+	ctx, span := tracing.Start(ctx, "TransactionRepository.FindByIDs")
+	defer span.End()
+
+	if len(ids) == 0 {
+		return []model.Transaction{}, nil
+	}
+	return r.find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+}
+
+func (r *mongoRepository) find(ctx context.Context, filter bson.M) ([]model.Transaction, error) {
+	cur, err := r.col.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	txs := []model.Transaction{}
+	if err := cur.All(ctx, &txs); err != nil {
+		return nil, err
+	}
+	return txs, nil
+}
+
+func successBetween(from, to time.Time) bson.D {
+	return bson.D{{Key: "$match", Value: bson.M{
+		"status":     model.TransactionStatusSuccess,
+		"created_at": bson.M{"$gte": from, "$lt": to},
+	}}}
+}
+
+// SalesByPeriod groups SUCCESS transactions into UTC day/week/month buckets.
+// Periods without sales are not returned.
+func (r *mongoRepository) SalesByPeriod(ctx context.Context, from, to time.Time, groupBy model.SalesGroupBy) ([]model.SalesBucket, error) {
+	ctx, span := tracing.Start(ctx, "TransactionRepository.SalesByPeriod")
+	defer span.End()
+
+	pipeline := mongo.Pipeline{
+		successBetween(from, to),
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{"$dateTrunc": bson.M{
+				"date":        "$created_at",
+				"unit":        string(groupBy),
+				"startOfWeek": "monday",
+			}},
+			"revenue": bson.M{"$sum": "$total_amount"},
+			"orders":  bson.M{"$sum": 1},
+			"units":   bson.M{"$sum": "$qty"},
+		}}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+		{{Key: "$project", Value: bson.M{
+			"_id":                 0,
+			"start":               "$_id",
+			"revenue":             1,
+			"orders":              1,
+			"units":               1,
+			"average_order_value": bson.M{"$divide": bson.A{"$revenue", "$orders"}},
+		}}},
+	}
+
+	buckets := []model.SalesBucket{}
+	if err := r.aggregate(ctx, pipeline, &buckets); err != nil {
+		return nil, err
+	}
+	return buckets, nil
+}
+
+// TopProducts ranks products by "units" or "revenue" over SUCCESS transactions.
+func (r *mongoRepository) TopProducts(ctx context.Context, from, to time.Time, sortBy string, limit int) ([]model.ProductSales, error) {
+	ctx, span := tracing.Start(ctx, "TransactionRepository.TopProducts")
+	defer span.End()
+
+	pipeline := mongo.Pipeline{
+		successBetween(from, to),
+		{{Key: "$group", Value: bson.M{
+			"_id":     "$product_id",
+			"units":   bson.M{"$sum": "$qty"},
+			"revenue": bson.M{"$sum": "$total_amount"},
+			"orders":  bson.M{"$sum": 1},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: sortBy, Value: -1}, {Key: "_id", Value: 1}}}},
+		{{Key: "$limit", Value: limit}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         "products",
+			"localField":   "_id",
+			"foreignField": "_id",
+			"as":           "product",
+		}}},
+		{{Key: "$set", Value: bson.M{
+			"name": bson.M{"$ifNull": bson.A{bson.M{"$first": "$product.name"}, ""}},
+		}}},
+		{{Key: "$unset", Value: "product"}},
+	}
+
+	products := []model.ProductSales{}
+	if err := r.aggregate(ctx, pipeline, &products); err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+func (r *mongoRepository) CountByStatus(ctx context.Context, from, to time.Time) (map[model.TransactionStatus]int64, error) {
+	ctx, span := tracing.Start(ctx, "TransactionRepository.CountByStatus")
+	defer span.End()
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"created_at": bson.M{"$gte": from, "$lt": to}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$status", "count": bson.M{"$sum": 1}}}},
+	}
+
+	var rows []struct {
+		Status model.TransactionStatus `bson:"_id"`
+		Count  int64                   `bson:"count"`
+	}
+	if err := r.aggregate(ctx, pipeline, &rows); err != nil {
+		return nil, err
+	}
+
+	counts := map[model.TransactionStatus]int64{}
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+	return counts, nil
+}
+
+func (r *mongoRepository) aggregate(ctx context.Context, pipeline mongo.Pipeline, out any) error {
+	cur, err := r.col.Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+	return cur.All(ctx, out)
+}
+
 func (r *mongoRepository) ExpireOldPending(ctx context.Context, olderThan time.Duration) (int64, error) {
-	cutoff := time.Now().Add(-olderThan)
+	ctx, span := tracing.Start(ctx, "TransactionRepository.ExpireOldPending")
+	defer span.End()
+
+	now := time.Now()
+	cutoff := now.Add(-olderThan)
 
 	res, err := r.col.UpdateMany(ctx,
 		bson.M{
 			"status":     model.TransactionStatusPending,
 			"created_at": bson.M{"$lt": cutoff},
+			// yang payment-nya masih di-review ditunggu sampai hold_until
+			"hold_until": bson.M{"$not": bson.M{"$gt": now}},
 		},
 		bson.M{
 			"$set": bson.M{
 				"status":     model.TransactionStatusFailed,
 				"updated_at": time.Now(),
 			},
+			"$inc": bson.M{"version": 1},
 		},
 	)
 	if err != nil {
@@ -0,0 +1,174 @@
+package category
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"ecom/model"
+	"ecom/util/tracing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrCategoryNotFound = errors.New("category not found")
+	ErrSlugTaken        = errors.New("category slug already exists")
+	ErrCategoryInUse    = errors.New("category still has products")
+	ErrInvalidCategory  = errors.New("invalid category")
+)
+
+type Repository interface {
+	Create(ctx context.Context, c *model.Category) error
+	FindAll(ctx context.Context) ([]model.Category, error)
+	FindByID(ctx context.Context, id primitive.ObjectID) (*model.Category, error)
+	Update(ctx context.Context, c *model.Category) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
+
+// ProductCounter tells whether a category is still referenced by products.
+type ProductCounter interface {
+	CountByCategory(ctx context.Context, categoryID primitive.ObjectID) (int64, error)
+}
+
+type Service interface {
+	Create(ctx context.Context, req model.CategoryRequest) (*model.Category, error)
+	GetAll(ctx context.Context) ([]model.Category, error)
+	GetByID(ctx context.Context, id string) (*model.Category, error)
+	Update(ctx context.Context, id string, req model.CategoryRequest) (*model.Category, error)
+	Delete(ctx context.Context, id string) error
+}
+
+type service struct {
+	repo     Repository
+	products ProductCounter
+}
+
+func NewService(repo Repository, products ProductCounter) Service {
+	return &service{repo: repo, products: products}
+}
+
+// /categories (POST)
+func (s *service) Create(ctx context.Context, req model.CategoryRequest) (*model.Category, error) {
+	ctx, span := tracing.Start(ctx, "CategoryService.Create")
+	defer span.End()
+
+	c := &model.Category{}
+	if err := apply(c, req); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.Create(ctx, c); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrSlugTaken
+		}
+		return nil, err
+	}
+	return c, nil
+}
+
+// /categories (GET)
+func (s *service) GetAll(ctx context.Context) ([]model.Category, error) {
+	ctx, span := tracing.Start(ctx, "CategoryService.GetAll")
+	defer span.End()
+
+	return s.repo.FindAll(ctx)
+}
+
+// /categories/{id} (GET)
+func (s *service) GetByID(ctx context.Context, id string) (*model.Category, error) {
+	ctx, span := tracing.Start(ctx, "CategoryService.GetByID")
+	defer span.End()
+
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id")
+	}
+	c, err := s.repo.FindByID(ctx, objID)
+	if err != nil {
+		return nil, ErrCategoryNotFound
+	}
+	return c, nil
+}
+
+// /categories/{id} (PUT)
+func (s *service) Update(ctx context.Context, id string, req model.CategoryRequest) (*model.Category, error) {
+	ctx, span := tracing.Start(ctx, "CategoryService.Update")
+	defer span.End()
+
+	c, err := s.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := apply(c, req); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.Update(ctx, c); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrSlugTaken
+		}
+		return nil, err
+	}
+	return c, nil
+}
+
+// /categories/{id} (DELETE), ditolak kalau masih dipakai produk
+func (s *service) Delete(ctx context.Context, id string) error {
+	ctx, span := tracing.Start(ctx, "CategoryService.Delete")
+	defer span.End()
+
+	c, err := s.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := s.products.CountByCategory(ctx, c.ID)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return fmt.Errorf("%w (%d products)", ErrCategoryInUse, n)
+	}
+	return s.repo.Delete(ctx, c.ID)
+}
+
+func apply(c *model.Category, req model.CategoryRequest) error {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidCategory)
+	}
+
+	slug := Slugify(req.Slug)
+	if slug == "" {
+		slug = Slugify(name)
+	}
+	if slug == "" {
+		return fmt.Errorf("%w: slug must contain letters or digits", ErrInvalidCategory)
+	}
+
+	c.Name = name
+	c.Slug = slug
+	c.Description = strings.TrimSpace(req.Description)
+	return nil
+}
+
+// Slugify lowercases s and joins its letters/digits runs with "-".
+func Slugify(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if ('a' <= r && r <= 'z') || ('0' <= r && r <= '9') {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		dash = true
+	}
+	return b.String()
+}
@@ -0,0 +1,113 @@
+package category_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"ecom/model"
+	categorysvc "ecom/service/category"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type fakeCategoryRepo struct {
+	categories map[primitive.ObjectID]*model.Category
+	createErr  error
+	deleted    []primitive.ObjectID
+}
+
+func (f *fakeCategoryRepo) Create(ctx context.Context, c *model.Category) error {
+	if f.createErr != nil {
+		return f.createErr
+	}
+	c.ID = primitive.NewObjectID()
+	if f.categories == nil {
+		f.categories = map[primitive.ObjectID]*model.Category{}
+	}
+	f.categories[c.ID] = c
+	return nil
+}
+
+func (f *fakeCategoryRepo) FindAll(ctx context.Context) ([]model.Category, error) {
+	out := []model.Category{}
+	for _, c := range f.categories {
+		out = append(out, *c)
+	}
+	return out, nil
+}
+
+func (f *fakeCategoryRepo) FindByID(ctx context.Context, id primitive.ObjectID) (*model.Category, error) {
+	if c, ok := f.categories[id]; ok {
+		return c, nil
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (f *fakeCategoryRepo) Update(ctx context.Context, c *model.Category) error {
+	f.categories[c.ID] = c
+	return nil
+}
+
+func (f *fakeCategoryRepo) Delete(ctx context.Context, id primitive.ObjectID) error {
+	f.deleted = append(f.deleted, id)
+	delete(f.categories, id)
+	return nil
+}
+
+type fakeProductCounter struct {
+	n int64
+}
+
+func (f fakeProductCounter) CountByCategory(ctx context.Context, categoryID primitive.ObjectID) (int64, error) {
+	return f.n, nil
+}
+
+func TestCreate_GeneratesSlug(t *testing.T) {
+	svc := categorysvc.NewService(&fakeCategoryRepo{}, fakeProductCounter{})
+
+	c, err := svc.Create(context.Background(), model.CategoryRequest{Name: "  Sepak Bola & Futsal "})
+	if err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+	if c.Name != "Sepak Bola & Futsal" || c.Slug != "sepak-bola-futsal" {
+		t.Fatalf("expected trimmed name and generated slug, got %q / %q", c.Name, c.Slug)
+	}
+
+	if _, err := svc.Create(context.Background(), model.CategoryRequest{Name: "!!!"}); !errors.Is(err, categorysvc.ErrInvalidCategory) {
+		t.Fatalf("expected ErrInvalidCategory for name without letters, got %v", err)
+	}
+}
+
+func TestCreate_DuplicateSlug(t *testing.T) {
+	repo := &fakeCategoryRepo{
+		createErr: mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000, Message: "E11000 duplicate key"}}},
+	}
+	svc := categorysvc.NewService(repo, fakeProductCounter{})
+
+	if _, err := svc.Create(context.Background(), model.CategoryRequest{Name: "Olahraga"}); !errors.Is(err, categorysvc.ErrSlugTaken) {
+		t.Fatalf("expected ErrSlugTaken, got %v", err)
+	}
+}
+
+func TestDelete_RefusesCategoryInUse(t *testing.T) {
+	existing := &model.Category{ID: primitive.NewObjectID(), Name: "Olahraga", Slug: "olahraga"}
+	repo := &fakeCategoryRepo{categories: map[primitive.ObjectID]*model.Category{existing.ID: existing}}
+
+	inUse := categorysvc.NewService(repo, fakeProductCounter{n: 3})
+	if err := inUse.Delete(context.Background(), existing.ID.Hex()); !errors.Is(err, categorysvc.ErrCategoryInUse) {
+		t.Fatalf("expected ErrCategoryInUse, got %v", err)
+	}
+	if len(repo.deleted) != 0 {
+		t.Fatal("expected category NOT to be deleted")
+	}
+
+	unused := categorysvc.NewService(repo, fakeProductCounter{})
+	if err := unused.Delete(context.Background(), existing.ID.Hex()); err != nil {
+		t.Fatalf("Delete returned error: %v", err)
+	}
+	if err := unused.Delete(context.Background(), existing.ID.Hex()); !errors.Is(err, categorysvc.ErrCategoryNotFound) {
+		t.Fatalf("expected ErrCategoryNotFound after delete, got %v", err)
+	}
+}
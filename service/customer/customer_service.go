@@ -0,0 +1,178 @@
+package customer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"ecom/model"
+	"ecom/util/tracing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrEmailTaken         = errors.New("email already registered")
+	ErrInvalidCredentials = errors.New("invalid email or password")
+)
+
+// dummyPasswordHash is compared against when the email is unknown, so Login
+// takes as long as for a wrong password and doesn't reveal which emails are
+// registered. Same cost as the hashes Register creates (bcrypt.DefaultCost).
+const dummyPasswordHash = "$2a$10$yLFMFA/0zoMlardKNnLYiOhRS.mDznUYpIXl.Zr/bg1NOz068tklm"
+
+type Service interface {
+	Register(ctx context.Context, req model.RegisterRequest) (*model.Customer, error)
+	Login(ctx context.Context, req model.LoginRequest) (*model.AuthTokens, error)
+	Refresh(ctx context.Context, req model.RefreshTokenRequest) (*model.AuthTokens, error)
+	GetByID(ctx context.Context, id primitive.ObjectID) (*model.Customer, error)
+	SetRole(ctx context.Context, id string, role model.Role) (*model.Customer, error)
+	PromoteAdmin(ctx context.Context, email string) error
+}
+
+type Repository interface {
+	Create(ctx context.Context, c *model.Customer) error
+	FindByID(ctx context.Context, id primitive.ObjectID) (*model.Customer, error)
+	FindByEmail(ctx context.Context, email string) (*model.Customer, error)
+	UpdateRole(ctx context.Context, id primitive.ObjectID, role model.Role) error
+}
+
+type TokenIssuer interface {
+	Issue(c *model.Customer) (*model.AuthTokens, error)
+	ParseRefresh(token string) (*model.Principal, error)
+}
+
+type service struct {
+	repo   Repository
+	tokens TokenIssuer
+}
+
+func NewService(repo Repository, tokens TokenIssuer) Service {
+	return &service{repo: repo, tokens: tokens}
+}
+
+// /auth/register (POST)
+func (s *service) Register(ctx context.Context, req model.RegisterRequest) (*model.Customer, error) {
+	ctx, span := tracing.Start(ctx, "CustomerService.Register")
+	defer span.End()
+
+	email := normalizeEmail(req.Email)
+	if email == "" || !strings.Contains(email, "@") {
+		return nil, fmt.Errorf("invalid email")
+	}
+	if len(req.Password) < 8 {
+		return nil, fmt.Errorf("password must be at least 8 characters")
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("hash password: %w", err)
+	}
+
+	c := &model.Customer{
+		Name:         strings.TrimSpace(req.Name),
+		Email:        email,
+		Role:         model.RoleCustomer,
+		PasswordHash: string(hash),
+	}
+
+	// unique index di customers.email yang jadi penentu akhir
+	if err := s.repo.Create(ctx, c); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrEmailTaken
+		}
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// /auth/login (POST)
+func (s *service) Login(ctx context.Context, req model.LoginRequest) (*model.AuthTokens, error) {
+	ctx, span := tracing.Start(ctx, "CustomerService.Login")
+	defer span.End()
+
+	c, err := s.repo.FindByEmail(ctx, normalizeEmail(req.Email))
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			_ = bcrypt.CompareHashAndPassword([]byte(dummyPasswordHash), []byte(req.Password))
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(c.PasswordHash), []byte(req.Password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	return s.tokens.Issue(c)
+}
+
+// /auth/refresh (POST)
+func (s *service) Refresh(ctx context.Context, req model.RefreshTokenRequest) (*model.AuthTokens, error) {
+	ctx, span := tracing.Start(ctx, "CustomerService.Refresh")
+	defer span.End()
+
+	p, err := s.tokens.ParseRefresh(req.RefreshToken)
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	// customer bisa saja sudah dihapus sejak refresh token diterbitkan
+	c, err := s.repo.FindByID(ctx, p.CustomerID)
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	return s.tokens.Issue(c)
+}
+
+// /auth/me (GET)
+func (s *service) GetByID(ctx context.Context, id primitive.ObjectID) (*model.Customer, error) {
+	ctx, span := tracing.Start(ctx, "CustomerService.GetByID")
+	defer span.End()
+
+	return s.repo.FindByID(ctx, id)
+}
+
+// /customers/{id}/role (PUT)
+func (s *service) SetRole(ctx context.Context, id string, role model.Role) (*model.Customer, error) {
+	ctx, span := tracing.Start(ctx, "CustomerService.SetRole")
+	defer span.End()
+
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id")
+	}
+	if !role.Valid() {
+		return nil, fmt.Errorf("invalid role %q", role)
+	}
+
+	if err := s.repo.UpdateRole(ctx, objID, role); err != nil {
+		return nil, err
+	}
+	return s.repo.FindByID(ctx, objID)
+}
+
+// PromoteAdmin gives the admin role to an already registered customer.
+// Dipakai saat startup supaya ada admin pertama tanpa akses langsung ke Mongo.
+func (s *service) PromoteAdmin(ctx context.Context, email string) error {
+	ctx, span := tracing.Start(ctx, "CustomerService.PromoteAdmin")
+	defer span.End()
+
+	c, err := s.repo.FindByEmail(ctx, normalizeEmail(email))
+	if err != nil {
+		return err
+	}
+	if c.Role == model.RoleAdmin {
+		return nil
+	}
+	return s.repo.UpdateRole(ctx, c.ID, model.RoleAdmin)
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,209 @@
+package customer_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"ecom/model"
+	customersvc "ecom/service/customer"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type fakeCustomerRepo struct {
+	createCalled bool
+	createInput  *model.Customer
+	createErr    error
+
+	byEmail map[string]*model.Customer
+	byID    map[primitive.ObjectID]*model.Customer
+}
+
+func (f *fakeCustomerRepo) Create(ctx context.Context, c *model.Customer) error {
+	f.createCalled = true
+	f.createInput = c
+	if f.createErr != nil {
+		return f.createErr
+	}
+	c.ID = primitive.NewObjectID()
+	return nil
+}
+
+func (f *fakeCustomerRepo) FindByID(ctx context.Context, id primitive.ObjectID) (*model.Customer, error) {
+	if c, ok := f.byID[id]; ok {
+		return c, nil
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (f *fakeCustomerRepo) FindByEmail(ctx context.Context, email string) (*model.Customer, error) {
+	if c, ok := f.byEmail[email]; ok {
+		return c, nil
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (f *fakeCustomerRepo) UpdateRole(ctx context.Context, id primitive.ObjectID, role model.Role) error {
+	c, ok := f.byID[id]
+	if !ok {
+		return mongo.ErrNoDocuments
+	}
+	c.Role = role
+	return nil
+}
+
+type fakeTokens struct {
+	issuedFor *model.Customer
+
+	refreshPrincipal *model.Principal
+	refreshErr       error
+}
+
+func (f *fakeTokens) Issue(c *model.Customer) (*model.AuthTokens, error) {
+	f.issuedFor = c
+	return &model.AuthTokens{AccessToken: "access", RefreshToken: "refresh", TokenType: "Bearer"}, nil
+}
+
+func (f *fakeTokens) ParseRefresh(token string) (*model.Principal, error) {
+	return f.refreshPrincipal, f.refreshErr
+}
+
+func TestRegister_HashesPasswordAndNormalizesEmail(t *testing.T) {
+	repo := &fakeCustomerRepo{}
+	svc := customersvc.NewService(repo, &fakeTokens{})
+
+	c, err := svc.Register(context.Background(), model.RegisterRequest{
+		Name:     "Budi",
+		Email:    "  Budi@Example.com ",
+		Password: "rahasia123",
+	})
+	if err != nil {
+		t.Fatalf("Register returned error: %v", err)
+	}
+
+	if c.Email != "budi@example.com" {
+		t.Fatalf("expected normalized email, got %q", c.Email)
+	}
+	if c.Role != model.RoleCustomer {
+		t.Fatalf("expected new account role customer, got %q", c.Role)
+	}
+	if repo.createInput.PasswordHash == "rahasia123" {
+		t.Fatal("expected password to be hashed, got plain text")
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(repo.createInput.PasswordHash), []byte("rahasia123")); err != nil {
+		t.Fatalf("expected bcrypt hash of password: %v", err)
+	}
+}
+
+func TestRegister_DuplicateEmail(t *testing.T) {
+	repo := &fakeCustomerRepo{
+		createErr: mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000, Message: "E11000 duplicate key"}}},
+	}
+	svc := customersvc.NewService(repo, &fakeTokens{})
+
+	_, err := svc.Register(context.Background(), model.RegisterRequest{
+		Name:     "Budi",
+		Email:    "budi@example.com",
+		Password: "rahasia123",
+	})
+	if !errors.Is(err, customersvc.ErrEmailTaken) {
+		t.Fatalf("expected ErrEmailTaken, got %v", err)
+	}
+}
+
+func TestRegister_ShortPassword(t *testing.T) {
+	repo := &fakeCustomerRepo{}
+	svc := customersvc.NewService(repo, &fakeTokens{})
+
+	_, err := svc.Register(context.Background(), model.RegisterRequest{
+		Name:     "Budi",
+		Email:    "budi@example.com",
+		Password: "123",
+	})
+	if err == nil {
+		t.Fatal("expected error for short password, got nil")
+	}
+	if repo.createCalled {
+		t.Fatal("expected repo.Create NOT to be called")
+	}
+}
+
+func TestLogin(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("rahasia123"), bcrypt.MinCost)
+	existing := &model.Customer{
+		ID:           primitive.NewObjectID(),
+		Email:        "budi@example.com",
+		PasswordHash: string(hash),
+	}
+	repo := &fakeCustomerRepo{
+		byEmail: map[string]*model.Customer{existing.Email: existing},
+	}
+	tokens := &fakeTokens{}
+	svc := customersvc.NewService(repo, tokens)
+
+	if _, err := svc.Login(context.Background(), model.LoginRequest{Email: "budi@example.com", Password: "salah"}); !errors.Is(err, customersvc.ErrInvalidCredentials) {
+		t.Fatalf("expected ErrInvalidCredentials for wrong password, got %v", err)
+	}
+	if _, err := svc.Login(context.Background(), model.LoginRequest{Email: "nobody@example.com", Password: "rahasia123"}); !errors.Is(err, customersvc.ErrInvalidCredentials) {
+		t.Fatalf("expected ErrInvalidCredentials for unknown email, got %v", err)
+	}
+
+	got, err := svc.Login(context.Background(), model.LoginRequest{Email: "BUDI@example.com", Password: "rahasia123"})
+	if err != nil {
+		t.Fatalf("Login returned error: %v", err)
+	}
+	if got.AccessToken == "" || tokens.issuedFor != existing {
+		t.Fatal("expected tokens issued for the existing customer")
+	}
+}
+
+func TestRefresh_DeletedCustomer(t *testing.T) {
+	tokens := &fakeTokens{
+		refreshPrincipal: &model.Principal{CustomerID: primitive.NewObjectID()},
+	}
+	svc := customersvc.NewService(&fakeCustomerRepo{}, tokens)
+
+	_, err := svc.Refresh(context.Background(), model.RefreshTokenRequest{RefreshToken: "refresh"})
+	if !errors.Is(err, customersvc.ErrInvalidCredentials) {
+		t.Fatalf("expected ErrInvalidCredentials, got %v", err)
+	}
+}
+
+func TestSetRole(t *testing.T) {
+	existing := &model.Customer{ID: primitive.NewObjectID(), Email: "staff@example.com", Role: model.RoleCustomer}
+	repo := &fakeCustomerRepo{
+		byID: map[primitive.ObjectID]*model.Customer{existing.ID: existing},
+	}
+	svc := customersvc.NewService(repo, &fakeTokens{})
+
+	if _, err := svc.SetRole(context.Background(), existing.ID.Hex(), model.Role("root")); err == nil {
+		t.Fatal("expected error for unknown role, got nil")
+	}
+
+	got, err := svc.SetRole(context.Background(), existing.ID.Hex(), model.RoleStaff)
+	if err != nil {
+		t.Fatalf("SetRole returned error: %v", err)
+	}
+	if got.Role != model.RoleStaff {
+		t.Fatalf("expected role staff, got %q", got.Role)
+	}
+}
+
+func TestPromoteAdmin(t *testing.T) {
+	existing := &model.Customer{ID: primitive.NewObjectID(), Email: "admin@example.com", Role: model.RoleCustomer}
+	repo := &fakeCustomerRepo{
+		byID:    map[primitive.ObjectID]*model.Customer{existing.ID: existing},
+		byEmail: map[string]*model.Customer{existing.Email: existing},
+	}
+	svc := customersvc.NewService(repo, &fakeTokens{})
+
+	if err := svc.PromoteAdmin(context.Background(), "Admin@Example.com"); err != nil {
+		t.Fatalf("PromoteAdmin returned error: %v", err)
+	}
+	if existing.Role != model.RoleAdmin {
+		t.Fatalf("expected role admin, got %q", existing.Role)
+	}
+}
@@ -0,0 +1,147 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"ecom/model"
+	"ecom/util/tracing"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+const defaultCheckTimeout = 2 * time.Second
+
+// Check returns nil when the dependency it probes is usable.
+type Check func(ctx context.Context) error
+
+type Service interface {
+	Live() model.HealthReport
+	Ready(ctx context.Context) model.HealthReport
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+type service struct {
+	checks  []namedCheck
+	timeout time.Duration
+	now     func() time.Time
+}
+
+type Option func(*service)
+
+// WithCheck adds a readiness check. Checks are reported in the order added.
+func WithCheck(name string, check Check) Option {
+	return func(s *service) {
+		s.checks = append(s.checks, namedCheck{name: name, check: check})
+	}
+}
+
+// WithTimeout bounds each check; a check that takes longer is down.
+func WithTimeout(d time.Duration) Option {
+	return func(s *service) {
+		if d > 0 {
+			s.timeout = d
+		}
+	}
+}
+
+func NewService(opts ...Option) Service {
+	s := &service{
+		timeout: defaultCheckTimeout,
+		now:     time.Now,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// /healthz (GET): proses hidup dan bisa melayani HTTP, tanpa cek dependency
+// supaya Mongo yang down tidak membuat container di-restart terus
+func (s *service) Live() model.HealthReport {
+	return model.HealthReport{Status: model.HealthStatusUp, Checks: []model.HealthCheck{}}
+}
+
+// /readyz (GET): semua check dijalankan paralel
+func (s *service) Ready(ctx context.Context) model.HealthReport {
+	ctx, span := tracing.Start(ctx, "HealthService.Ready")
+	defer span.End()
+
+	report := model.HealthReport{
+		Status: model.HealthStatusUp,
+		Checks: make([]model.HealthCheck, len(s.checks)),
+	}
+
+	var wg sync.WaitGroup
+	for i, c := range s.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Checks[i] = s.run(ctx, c)
+		}()
+	}
+	wg.Wait()
+
+	for _, c := range report.Checks {
+		if c.Status != model.HealthStatusUp {
+			report.Status = model.HealthStatusDown
+		}
+	}
+	return report
+}
+
+func (s *service) run(ctx context.Context, c namedCheck) model.HealthCheck {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	start := s.now()
+	err := c.check(ctx)
+	// check yang baru selesai setelah timeout tetap dianggap down
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	result := model.HealthCheck{
+		Name:      c.name,
+		Status:    model.HealthStatusUp,
+		LatencyMs: float64(s.now().Sub(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = model.HealthStatusDown
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// MongoCheck pings the primary.
+func MongoCheck(client *mongo.Client) Check {
+	return func(ctx context.Context) error {
+		return client.Ping(ctx, readpref.Primary())
+	}
+}
+
+// HTTPCheck expects a 2xx from GET url, e.g. the /healthz of another service.
+func HTTPCheck(url string) Check {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("%s returned status %d", url, resp.StatusCode)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,117 @@
+package health_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"ecom/model"
+	"ecom/service/health"
+)
+
+func up(ctx context.Context) error { return nil }
+
+func TestLive_AlwaysUp(t *testing.T) {
+	svc := health.NewService(health.WithCheck("mongo", func(ctx context.Context) error {
+		return errors.New("connection refused")
+	}))
+
+	report := svc.Live()
+	if report.Status != model.HealthStatusUp {
+		t.Fatalf("expected liveness up regardless of dependencies, got %s", report.Status)
+	}
+	if len(report.Checks) != 0 {
+		t.Fatalf("expected no dependency checks in liveness, got %+v", report.Checks)
+	}
+}
+
+func TestReady_AllUp(t *testing.T) {
+	svc := health.NewService(
+		health.WithCheck("mongo", up),
+		health.WithCheck("scheduler", up),
+	)
+
+	report := svc.Ready(context.Background())
+	if report.Status != model.HealthStatusUp {
+		t.Fatalf("expected up, got %+v", report)
+	}
+	if len(report.Checks) != 2 || report.Checks[0].Name != "mongo" || report.Checks[1].Name != "scheduler" {
+		t.Fatalf("expected checks in registration order, got %+v", report.Checks)
+	}
+	for _, c := range report.Checks {
+		if c.Status != model.HealthStatusUp || c.Error != "" {
+			t.Fatalf("expected check %s up, got %+v", c.Name, c)
+		}
+	}
+}
+
+func TestReady_OneDown(t *testing.T) {
+	svc := health.NewService(
+		health.WithCheck("mongo", up),
+		health.WithCheck("payment", func(ctx context.Context) error {
+			time.Sleep(5 * time.Millisecond)
+			return errors.New("connection refused")
+		}),
+	)
+
+	report := svc.Ready(context.Background())
+	if report.Status != model.HealthStatusDown {
+		t.Fatalf("expected down, got %s", report.Status)
+	}
+	if report.Checks[0].Status != model.HealthStatusUp {
+		t.Fatalf("expected mongo up, got %+v", report.Checks[0])
+	}
+	payment := report.Checks[1]
+	if payment.Status != model.HealthStatusDown || payment.Error != "connection refused" {
+		t.Fatalf("expected payment down with its error, got %+v", payment)
+	}
+	if payment.LatencyMs < 5 {
+		t.Fatalf("expected latency >= 5ms, got %v", payment.LatencyMs)
+	}
+}
+
+func TestReady_SlowCheckTimesOut(t *testing.T) {
+	svc := health.NewService(
+		health.WithTimeout(20*time.Millisecond),
+		health.WithCheck("payment", func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}),
+	)
+
+	start := time.Now()
+	report := svc.Ready(context.Background())
+	if time.Since(start) > time.Second {
+		t.Fatal("expected the check to be cut off by the timeout")
+	}
+	if report.Status != model.HealthStatusDown {
+		t.Fatalf("expected down, got %s", report.Status)
+	}
+	if report.Checks[0].Error != context.DeadlineExceeded.Error() {
+		t.Fatalf("expected deadline exceeded, got %q", report.Checks[0].Error)
+	}
+}
+
+func TestHTTPCheck(t *testing.T) {
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	check := health.HTTPCheck(srv.URL + "/healthz")
+	if err := check(context.Background()); err != nil {
+		t.Fatalf("expected up, got %v", err)
+	}
+
+	status = http.StatusServiceUnavailable
+	if err := check(context.Background()); err == nil {
+		t.Fatal("expected error for 503")
+	}
+}
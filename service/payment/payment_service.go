@@ -1,51 +1,686 @@
 package payment
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strings"
+	"time"
 
 	"ecom/model"
+	"ecom/util/auth"
+	"ecom/util/logging"
+	"ecom/util/tracing"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrTransactionNotFound = errors.New("transaction not found")
+	ErrPaymentNotFound     = errors.New("payment not found")
+	ErrInvalidState        = errors.New("payment is not in a valid state for this operation")
+	ErrInvalidCapture      = errors.New("capture amount must be between 0 and the authorized amount")
+	ErrInvalidQuery        = errors.New("invalid query")
+	ErrDuplicatePayment    = errors.New("payment already exists for transaction")
+	ErrInvalidReview       = errors.New("review decision must be approve or reject")
+)
+
+// DuplicatePaymentError is returned when a transaction already has a payment
+// that is not FAILED and the new request does not match it.
+type DuplicatePaymentError struct {
+	ExistingID primitive.ObjectID
+	Status     model.PaymentStatus
+}
+
+func (e *DuplicatePaymentError) Error() string {
+	return fmt.Sprintf("%s: payment %s is %s", ErrDuplicatePayment, e.ExistingID.Hex(), e.Status)
+}
+
+func (e *DuplicatePaymentError) Unwrap() error {
+	return ErrDuplicatePayment
+}
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
 )
 
 type Service interface {
+	// CreatePayment is the one-shot flow: verify, authorize and capture at once.
 	CreatePayment(ctx context.Context, req model.CreatePaymentRequest) (*model.Payment, error)
+
+	CreateIntent(ctx context.Context, req model.CreatePaymentRequest) (*model.Payment, error)
+	Authorize(ctx context.Context, id string) (*model.Payment, error)
+	Capture(ctx context.Context, id string, req model.CapturePaymentRequest) (*model.Payment, error)
+	Void(ctx context.Context, id string) (*model.Payment, error)
+	// ExpireStale expires REVIEW, CREATED and AUTHORIZED payments that were
+	// left past their expires_at.
+	ExpireStale(ctx context.Context) (int64, error)
+
+	// Review approves (-> CREATED) or rejects (-> FAILED) a payment held by the
+	// risk engine, until the review TTL runs out.
+	Review(ctx context.Context, id string, req model.ReviewPaymentRequest) (*model.Payment, error)
+
+	GetByID(ctx context.Context, id string) (*model.Payment, error)
+	List(ctx context.Context, q model.ListPaymentsQuery) (*model.Page[model.Payment], error)
 }
 
 type Repository interface {
 	Create(ctx context.Context, p *model.Payment) error
+	FindByID(ctx context.Context, id primitive.ObjectID) (*model.Payment, error)
+	FindLatestByTransaction(ctx context.Context, txID primitive.ObjectID) (*model.Payment, error)
+	CountByEmailSince(ctx context.Context, email string, since time.Time) (int64, error)
+	List(ctx context.Context, f model.PaymentFilter) ([]model.Payment, int64, error)
+	Transition(ctx context.Context, p *model.Payment, from ...model.PaymentStatus) (bool, error)
+	ExpireStale(ctx context.Context, now time.Time) (int64, error)
+}
+
+// ShoppingClient looks up the transaction a payment is made for, so the
+// payment service never has to trust the amount sent by the caller. It also
+// tells shopping how a payment held for review was resolved.
+type ShoppingClient interface {
+	GetTransaction(ctx context.Context, id string) (*model.Transaction, error)
+	NotifyReview(ctx context.Context, txID string, result model.PaymentReviewResult) error
+}
+
+type httpShoppingClient struct {
+	baseURL    string
+	secret     []byte
+	httpClient *http.Client
+}
+
+// NewHTTPShoppingClient calls the shopping internal API, signing every request with the shared secret.
+func NewHTTPShoppingClient(baseURL, secret string) ShoppingClient {
+	return &httpShoppingClient{
+		baseURL: baseURL,
+		secret:  []byte(secret),
+		httpClient: &http.Client{
+			Timeout:   5 * time.Second,
+			Transport: tracing.Transport(logging.Transport(nil)),
+		},
+	}
+}
+
+func (c *httpShoppingClient) GetTransaction(ctx context.Context, id string) (*model.Transaction, error) {
+	url := c.baseURL + "/internal/transactions/" + id
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := auth.SignRequest(httpReq, c.secret, nil); err != nil {
+		return nil, fmt.Errorf("sign shopping request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrTransactionNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("shopping service returned status %d", resp.StatusCode)
+	}
+
+	var out model.APIResponse[model.Transaction]
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	return &out.Data, nil
+}
+
+func (c *httpShoppingClient) NotifyReview(ctx context.Context, txID string, result model.PaymentReviewResult) error {
+	url := c.baseURL + "/internal/transactions/" + txID + "/payment-review"
+
+	body, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if err := auth.SignRequest(httpReq, c.secret, body); err != nil {
+		return fmt.Errorf("sign shopping request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("shopping service returned status %d", resp.StatusCode)
+	}
+	return nil
 }
 
+const (
+	defaultAuthorizationTTL = 30 * time.Minute
+	defaultIntentTTL        = 30 * time.Minute
+	defaultReviewTTL        = 24 * time.Hour
+)
+
 type service struct {
-	repo Repository
+	repo             Repository
+	shopping         ShoppingClient
+	authorizationTTL time.Duration
+	intentTTL        time.Duration
+	reviewTTL        time.Duration
+	risk             RiskEvaluator
+	now              func() time.Time
+	logger           *slog.Logger
 }
 
-func NewService(repo Repository) Service {
-	return &service{repo: repo}
+type Option func(*service)
+
+// WithAuthorizationTTL sets how long an authorized payment can wait for capture.
+func WithAuthorizationTTL(ttl time.Duration) Option {
+	return func(s *service) {
+		if ttl > 0 {
+			s.authorizationTTL = ttl
+		}
+	}
 }
 
+// WithIntentTTL sets how long a CREATED payment can wait for authorize.
+func WithIntentTTL(ttl time.Duration) Option {
+	return func(s *service) {
+		if ttl > 0 {
+			s.intentTTL = ttl
+		}
+	}
+}
+
+// WithReviewTTL sets how long a payment held by the risk engine waits for review.
+func WithReviewTTL(ttl time.Duration) Option {
+	return func(s *service) {
+		if ttl > 0 {
+			s.reviewTTL = ttl
+		}
+	}
+}
+
+// WithRiskEngine runs every verified payment through risk before it is opened.
+func WithRiskEngine(risk RiskEvaluator) Option {
+	return func(s *service) {
+		s.risk = risk
+	}
+}
+
+// WithLogger sets the logger for risk decisions and failed notifications (default slog.Default()).
+func WithLogger(l *slog.Logger) Option {
+	return func(s *service) {
+		if l != nil {
+			s.logger = l
+		}
+	}
+}
+
+func NewService(repo Repository, shopping ShoppingClient, opts ...Option) Service {
+	s := &service{
+		repo:             repo,
+		shopping:         shopping,
+		authorizationTTL: defaultAuthorizationTTL,
+		intentTTL:        defaultIntentTTL,
+		reviewTTL:        defaultReviewTTL,
+		now:              time.Now,
+		logger:           slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// /payments (POST)
 func (s *service) CreatePayment(ctx context.Context, req model.CreatePaymentRequest) (*model.Payment, error) {
+	ctx, span := tracing.Start(ctx, "PaymentService.CreatePayment")
+	defer span.End()
+
+	return s.open(ctx, req, func(p *model.Payment) {
+		if p.Status != model.PaymentStatusCreated {
+			return
+		}
+		now := s.now()
+		p.Status = model.PaymentStatusSuccess
+		p.CapturedAmount = p.Amount
+		p.AuthorizedAt = &now
+		p.CapturedAt = &now
+	})
+}
+
+// /payments/intents (POST)
+func (s *service) CreateIntent(ctx context.Context, req model.CreatePaymentRequest) (*model.Payment, error) {
+	ctx, span := tracing.Start(ctx, "PaymentService.CreateIntent")
+	defer span.End()
+
+	return s.open(ctx, req, nil)
+}
+
+// open creates the next payment attempt for a transaction. A request for a
+// transaction that already has a non-FAILED payment is answered with that
+// payment (same amount/email) or a DuplicatePaymentError.
+func (s *service) open(ctx context.Context, req model.CreatePaymentRequest, settle func(p *model.Payment)) (*model.Payment, error) {
 	txID, err := primitive.ObjectIDFromHex(req.TransactionID)
 	if err != nil {
 		return nil, fmt.Errorf("invalid transaction_id: %w", err)
 	}
 
-	status := model.PaymentStatusSuccess
-	if req.Amount <= 0 {
+	attempt := 1
+	latest, err := s.repo.FindLatestByTransaction(ctx, txID)
+	switch {
+	case err == nil && latest.Status != model.PaymentStatusFailed:
+		return replayOrConflict(latest, req)
+	case err == nil:
+		attempt = max(latest.Attempt, 1) + 1
+	case !errors.Is(err, mongo.ErrNoDocuments):
+		return nil, err
+	}
+
+	p, err := s.newPayment(ctx, txID, req)
+	if err != nil {
+		return nil, err
+	}
+	p.Attempt = attempt
+	if err := s.assessRisk(ctx, p); err != nil {
+		return nil, err
+	}
+	if settle != nil {
+		settle(p)
+	}
+	s.setExpiry(p, s.now())
+
+	if err := s.repo.Create(ctx, p); err != nil {
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, err
+		}
+		// request lain untuk transaksi yang sama menang duluan
+		latest, ferr := s.repo.FindLatestByTransaction(ctx, txID)
+		if ferr != nil {
+			return nil, err
+		}
+		return replayOrConflict(latest, req)
+	}
+
+	return p, nil
+}
+
+// assessRisk stores the risk decision on a verified payment and holds or
+// declines it accordingly. Payments already declined by verify are not scored.
+func (s *service) assessRisk(ctx context.Context, p *model.Payment) error {
+	if s.risk == nil || p.Status != model.PaymentStatusCreated {
+		return nil
+	}
+
+	a, err := s.risk.Evaluate(ctx, p)
+	if err != nil {
+		return fmt.Errorf("risk check: %w", err)
+	}
+	p.Risk = a
+
+	switch a.Decision {
+	case model.RiskDecisionDecline:
+		p.Status = model.PaymentStatusFailed
+		p.DeclineReason = model.DeclineReasonRiskDeclined
+	case model.RiskDecisionReview:
+		p.Status = model.PaymentStatusReview
+	default:
+		return nil
+	}
+	s.logger.InfoContext(ctx, "payment flagged by risk engine",
+		"transaction_id", p.TransactionID.Hex(), "decision", a.Decision, "rules", a.TriggeredRules)
+	return nil
+}
+
+// setExpiry gives a payment that waits for the next step, review or
+// authorize, the time ExpireStale gives up on it.
+func (s *service) setExpiry(p *model.Payment, now time.Time) {
+	var ttl time.Duration
+	switch p.Status {
+	case model.PaymentStatusReview:
+		ttl = s.reviewTTL
+	case model.PaymentStatusCreated:
+		ttl = s.intentTTL
+	default:
+		return
+	}
+	expires := now.Add(ttl)
+	p.ExpiresAt = &expires
+}
+
+func replayOrConflict(existing *model.Payment, req model.CreatePaymentRequest) (*model.Payment, error) {
+	if sameAmount(existing.Amount, req.Amount) && strings.EqualFold(existing.Email, req.Email) {
+		existing.Replayed = true
+		return existing, nil
+	}
+	return nil, &DuplicatePaymentError{ExistingID: existing.ID, Status: existing.Status}
+}
+
+func sameAmount(a, b float64) bool {
+	return math.Abs(a-b) <= 1e-6
+}
+
+// /payments/{id}/authorize (POST)
+func (s *service) Authorize(ctx context.Context, id string) (*model.Payment, error) {
+	ctx, span := tracing.Start(ctx, "PaymentService.Authorize")
+	defer span.End()
+
+	p, err := s.find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if p.Status != model.PaymentStatusCreated {
+		return nil, ErrInvalidState
+	}
+	now := s.now()
+	if p.ExpiresAt != nil && now.After(*p.ExpiresAt) {
+		return nil, ErrInvalidState
+	}
+
+	expires := now.Add(s.authorizationTTL)
+	p.Status = model.PaymentStatusAuthorized
+	p.AuthorizedAt = &now
+	p.ExpiresAt = &expires
+
+	return s.transition(ctx, p, model.PaymentStatusCreated)
+}
+
+// /payments/{id}/capture (POST)
+func (s *service) Capture(ctx context.Context, id string, req model.CapturePaymentRequest) (*model.Payment, error) {
+	ctx, span := tracing.Start(ctx, "PaymentService.Capture")
+	defer span.End()
+
+	p, err := s.find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if p.Status != model.PaymentStatusAuthorized {
+		return nil, ErrInvalidState
+	}
+	now := s.now()
+	if p.ExpiresAt != nil && now.After(*p.ExpiresAt) {
+		return nil, ErrInvalidState
+	}
+
+	// amount 0 = capture penuh, selebihnya partial capture
+	amount := req.Amount
+	if amount == 0 {
+		amount = p.Amount
+	}
+	if amount < 0 || amount > p.Amount {
+		return nil, ErrInvalidCapture
+	}
+
+	p.Status = model.PaymentStatusSuccess
+	p.CapturedAmount = amount
+	p.CapturedAt = &now
+
+	return s.transition(ctx, p, model.PaymentStatusAuthorized)
+}
+
+// /payments/{id}/void (POST)
+func (s *service) Void(ctx context.Context, id string) (*model.Payment, error) {
+	ctx, span := tracing.Start(ctx, "PaymentService.Void")
+	defer span.End()
+
+	p, err := s.find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if p.Status != model.PaymentStatusCreated && p.Status != model.PaymentStatusAuthorized {
+		return nil, ErrInvalidState
+	}
+
+	now := s.now()
+	p.Status = model.PaymentStatusVoided
+	p.VoidedAt = &now
+
+	return s.transition(ctx, p, model.PaymentStatusCreated, model.PaymentStatusAuthorized)
+}
+
+// /payments/{id}/review (POST)
+func (s *service) Review(ctx context.Context, id string, req model.ReviewPaymentRequest) (*model.Payment, error) {
+	ctx, span := tracing.Start(ctx, "PaymentService.Review")
+	defer span.End()
+
+	approved := strings.EqualFold(req.Decision, "approve")
+	if !approved && !strings.EqualFold(req.Decision, "reject") {
+		return nil, ErrInvalidReview
+	}
+
+	p, err := s.find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if p.Status != model.PaymentStatusReview {
+		return nil, ErrInvalidState
+	}
+	now := s.now()
+	if p.ExpiresAt != nil && now.After(*p.ExpiresAt) {
+		return nil, ErrInvalidState
+	}
+
+	if p.Risk == nil {
+		p.Risk = &model.RiskAssessment{Decision: model.RiskDecisionReview, TriggeredRules: []string{}}
+	}
+	p.Risk.ReviewedBy = req.Reviewer
+	p.Risk.ReviewNote = req.Note
+	p.Risk.ReviewedAt = &now
+
+	if approved {
+		p.Risk.ReviewDecision = model.RiskDecisionApprove
+		p.Status = model.PaymentStatusCreated
+		s.setExpiry(p, now)
+	} else {
+		p.Risk.ReviewDecision = model.RiskDecisionDecline
+		p.Status = model.PaymentStatusFailed
+		p.DeclineReason = model.DeclineReasonReviewRejected
+	}
+
+	if _, err := s.transition(ctx, p, model.PaymentStatusReview); err != nil {
+		return nil, err
+	}
+
+	// keputusan review sudah tersimpan; kalau shopping gagal dihubungi,
+	// transaksinya tetap PENDING sampai di-expire cron shopping
+	result := model.PaymentReviewResult{PaymentID: p.ID.Hex(), Approved: approved}
+	if err := s.shopping.NotifyReview(ctx, p.TransactionID.Hex(), result); err != nil {
+		s.logger.ErrorContext(ctx, "notify shopping of review result",
+			"payment_id", p.ID.Hex(), "transaction_id", p.TransactionID.Hex(), "error", err)
+	}
+	return p, nil
+}
+
+// cron job payment yang tidak di-review, di-authorize atau di-capture sampai expires_at
+func (s *service) ExpireStale(ctx context.Context) (int64, error) {
+	ctx, span := tracing.Start(ctx, "PaymentService.ExpireStale")
+	defer span.End()
+
+	return s.repo.ExpireStale(ctx, s.now())
+}
+
+// /payments/{id} (GET)
+func (s *service) GetByID(ctx context.Context, id string) (*model.Payment, error) {
+	ctx, span := tracing.Start(ctx, "PaymentService.GetByID")
+	defer span.End()
+
+	return s.find(ctx, id)
+}
+
+// /payments (GET)
+func (s *service) List(ctx context.Context, q model.ListPaymentsQuery) (*model.Page[model.Payment], error) {
+	ctx, span := tracing.Start(ctx, "PaymentService.List")
+	defer span.End()
+
+	f, page, err := parsePaymentQuery(q)
+	if err != nil {
+		return nil, err
+	}
+
+	items, total, err := s.repo.List(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.Page[model.Payment]{
+		Items: items,
+		Page:  page,
+		Limit: int(f.Limit),
+		Total: total,
+	}, nil
+}
+
+func parsePaymentQuery(q model.ListPaymentsQuery) (model.PaymentFilter, int, error) {
+	var f model.PaymentFilter
+
+	if q.TransactionID != "" {
+		id, err := primitive.ObjectIDFromHex(q.TransactionID)
+		if err != nil {
+			return f, 0, fmt.Errorf("%w: transaction_id", ErrInvalidQuery)
+		}
+		f.TransactionID = &id
+	}
+
+	f.Email = strings.TrimSpace(q.Email)
+
+	if q.Status != "" {
+		st := model.PaymentStatus(strings.ToUpper(q.Status))
+		switch st {
+		case model.PaymentStatusReview, model.PaymentStatusCreated, model.PaymentStatusAuthorized, model.PaymentStatusSuccess,
+			model.PaymentStatusFailed, model.PaymentStatusVoided, model.PaymentStatusExpired:
+			f.Status = st
+		default:
+			return f, 0, fmt.Errorf("%w: status %q", ErrInvalidQuery, q.Status)
+		}
+	}
+
+	if q.From != "" {
+		from, _, err := parseQueryTime(q.From)
+		if err != nil {
+			return f, 0, fmt.Errorf("%w: from", ErrInvalidQuery)
+		}
+		f.From = &from
+	}
+	if q.To != "" {
+		to, dateOnly, err := parseQueryTime(q.To)
+		if err != nil {
+			return f, 0, fmt.Errorf("%w: to", ErrInvalidQuery)
+		}
+		// to=2025-01-31 artinya sampai akhir hari itu
+		if dateOnly {
+			to = to.AddDate(0, 0, 1)
+		}
+		f.To = &to
+	}
+	if f.From != nil && f.To != nil && !f.From.Before(*f.To) {
+		return f, 0, fmt.Errorf("%w: from must be before to", ErrInvalidQuery)
+	}
+
+	page := q.Page
+	if page < 1 {
+		page = 1
+	}
+	limit := q.Limit
+	if limit < 1 {
+		limit = defaultPageLimit
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+	f.Limit = int64(limit)
+	f.Skip = int64((page - 1) * limit)
+
+	return f, page, nil
+}
+
+// parseQueryTime accepts RFC3339 or a plain date; dateOnly reports the latter.
+func parseQueryTime(v string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, false, nil
+	}
+	t, err := time.Parse(time.DateOnly, v)
+	return t, true, err
+}
+
+// newPayment builds a verified payment: CREATED, or FAILED with a decline reason.
+func (s *service) newPayment(ctx context.Context, txID primitive.ObjectID, req model.CreatePaymentRequest) (*model.Payment, error) {
+	reason, err := s.verify(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	status := model.PaymentStatusCreated
+	if reason != "" {
 		status = model.PaymentStatusFailed
 	}
 
-	p := &model.Payment{
+	return &model.Payment{
 		TransactionID: txID,
 		Amount:        req.Amount,
 		Email:         req.Email,
 		Status:        status,
+		DeclineReason: reason,
+	}, nil
+}
+
+func (s *service) find(ctx context.Context, id string) (*model.Payment, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id")
 	}
+	p, err := s.repo.FindByID(ctx, objID)
+	if err != nil {
+		return nil, ErrPaymentNotFound
+	}
+	return p, nil
+}
 
-	if err := s.repo.Create(ctx, p); err != nil {
+func (s *service) transition(ctx context.Context, p *model.Payment, from ...model.PaymentStatus) (*model.Payment, error) {
+	ok, err := s.repo.Transition(ctx, p, from...)
+	if err != nil {
 		return nil, err
 	}
-
+	if !ok {
+		return nil, ErrInvalidState
+	}
 	return p, nil
 }
+
+// verify compares the request with the transaction stored by the shopping service.
+// A non-empty reason means the payment must be declined.
+func (s *service) verify(ctx context.Context, req model.CreatePaymentRequest) (model.DeclineReason, error) {
+	if req.Amount <= 0 {
+		return model.DeclineReasonInvalidAmount, nil
+	}
+
+	tx, err := s.shopping.GetTransaction(ctx, req.TransactionID)
+	if err != nil {
+		if errors.Is(err, ErrTransactionNotFound) {
+			return model.DeclineReasonTransactionNotFound, nil
+		}
+		return "", fmt.Errorf("lookup transaction: %w", err)
+	}
+
+	switch {
+	case tx.Status != model.TransactionStatusPending:
+		return model.DeclineReasonTransactionSettled, nil
+	case !sameAmount(tx.TotalAmount, req.Amount):
+		return model.DeclineReasonAmountMismatch, nil
+	case !strings.EqualFold(tx.Email, req.Email):
+		return model.DeclineReasonEmailMismatch, nil
+	}
+	return "", nil
+}
@@ -3,28 +3,159 @@ package payment_test
 import (
 	"context"
 	"errors"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"ecom/model"
 	paymentsvc "ecom/service/payment"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type fakePaymentRepo struct {
 	createCalled bool
 	createInput  *model.Payment
 	createErr    error
+
+	payments map[primitive.ObjectID]*model.Payment
+
+	hideLatestOnce bool
+
+	listFilter model.PaymentFilter
+	listResult []model.Payment
+	listTotal  int64
 }
 
 func (f *fakePaymentRepo) Create(ctx context.Context, p *model.Payment) error {
 	f.createCalled = true
 	f.createInput = p
-	return f.createErr
+	if f.createErr != nil {
+		return f.createErr
+	}
+	for _, existing := range f.payments {
+		if existing.TransactionID == p.TransactionID && existing.Attempt == p.Attempt {
+			return mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000, Message: "E11000 duplicate key"}}}
+		}
+	}
+	if p.ID.IsZero() {
+		p.ID = primitive.NewObjectID()
+	}
+	f.store(p)
+	return nil
+}
+
+func (f *fakePaymentRepo) FindByID(ctx context.Context, id primitive.ObjectID) (*model.Payment, error) {
+	p, ok := f.payments[id]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	cp := *p
+	return &cp, nil
+}
+
+func (f *fakePaymentRepo) FindLatestByTransaction(ctx context.Context, txID primitive.ObjectID) (*model.Payment, error) {
+	var latest *model.Payment
+	for _, p := range f.payments {
+		if p.TransactionID == txID && (latest == nil || p.Attempt > latest.Attempt) {
+			latest = p
+		}
+	}
+	// simulasi request lain yang insert duluan di antara FindLatest dan Create
+	if f.hideLatestOnce {
+		f.hideLatestOnce = false
+		latest = nil
+	}
+	if latest == nil {
+		return nil, mongo.ErrNoDocuments
+	}
+	cp := *latest
+	return &cp, nil
+}
+
+func (f *fakePaymentRepo) CountByEmailSince(ctx context.Context, email string, since time.Time) (int64, error) {
+	var n int64
+	for _, p := range f.payments {
+		if p.Email == email && !p.CreatedAt.Before(since) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (f *fakePaymentRepo) List(ctx context.Context, filter model.PaymentFilter) ([]model.Payment, int64, error) {
+	f.listFilter = filter
+	return f.listResult, f.listTotal, nil
+}
+
+func (f *fakePaymentRepo) Transition(ctx context.Context, p *model.Payment, from ...model.PaymentStatus) (bool, error) {
+	stored, ok := f.payments[p.ID]
+	if !ok {
+		return false, nil
+	}
+	for _, st := range from {
+		if stored.Status == st {
+			f.store(p)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *fakePaymentRepo) ExpireStale(ctx context.Context, now time.Time) (int64, error) {
+	var n int64
+	for _, p := range f.payments {
+		waiting := p.Status == model.PaymentStatusReview || p.Status == model.PaymentStatusCreated || p.Status == model.PaymentStatusAuthorized
+		if waiting && p.ExpiresAt != nil && p.ExpiresAt.Before(now) {
+			p.Status = model.PaymentStatusExpired
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (f *fakePaymentRepo) store(p *model.Payment) {
+	if f.payments == nil {
+		f.payments = map[primitive.ObjectID]*model.Payment{}
+	}
+	cp := *p
+	f.payments[p.ID] = &cp
+}
+
+type fakeShoppingClient struct {
+	tx  *model.Transaction
+	err error
+
+	called bool
+
+	notified []model.PaymentReviewResult
+}
+
+func (f *fakeShoppingClient) GetTransaction(ctx context.Context, id string) (*model.Transaction, error) {
+	f.called = true
+	return f.tx, f.err
+}
+
+func (f *fakeShoppingClient) NotifyReview(ctx context.Context, txID string, result model.PaymentReviewResult) error {
+	f.notified = append(f.notified, result)
+	return nil
+}
+
+// pendingTx mengembalikan transaksi PENDING yang cocok dengan request
+func pendingTx(amount float64, email string) *fakeShoppingClient {
+	return &fakeShoppingClient{
+		tx: &model.Transaction{
+			TotalAmount: amount,
+			Email:       email,
+			Status:      model.TransactionStatusPending,
+		},
+	}
 }
 
 func newServiceWithRepo(repo paymentsvc.Repository) paymentsvc.Service {
-	return paymentsvc.NewService(repo)
+	return paymentsvc.NewService(repo, pendingTx(100_000, "user@example.com"))
 }
 
 func TestCreatePayment_SuccessAmountPositive(t *testing.T) {
@@ -83,7 +214,7 @@ func TestCreatePayment_RepoErrorIsReturned(t *testing.T) {
 	repo := &fakePaymentRepo{
 		createErr: errors.New("db error"),
 	}
-	svc := newServiceWithRepo(repo)
+	svc := paymentsvc.NewService(repo, pendingTx(50_000, "user@example.com"))
 
 	req := model.CreatePaymentRequest{
 		TransactionID: primitive.NewObjectID().Hex(),
@@ -96,3 +227,632 @@ func TestCreatePayment_RepoErrorIsReturned(t *testing.T) {
 		t.Fatal("expected error, got nil")
 	}
 }
+
+func TestCreatePayment_DeclinedOnMismatch(t *testing.T) {
+	cases := []struct {
+		name     string
+		shopping *fakeShoppingClient
+		amount   float64
+		email    string
+		reason   model.DeclineReason
+	}{
+		{
+			name:     "amount tampered",
+			shopping: pendingTx(100_000, "user@example.com"),
+			amount:   1,
+			email:    "user@example.com",
+			reason:   model.DeclineReasonAmountMismatch,
+		},
+		{
+			name:     "email mismatch",
+			shopping: pendingTx(100_000, "user@example.com"),
+			amount:   100_000,
+			email:    "attacker@example.com",
+			reason:   model.DeclineReasonEmailMismatch,
+		},
+		{
+			name:     "transaction not found",
+			shopping: &fakeShoppingClient{err: paymentsvc.ErrTransactionNotFound},
+			amount:   100_000,
+			email:    "user@example.com",
+			reason:   model.DeclineReasonTransactionNotFound,
+		},
+		{
+			name: "transaction already settled",
+			shopping: &fakeShoppingClient{tx: &model.Transaction{
+				TotalAmount: 100_000,
+				Email:       "user@example.com",
+				Status:      model.TransactionStatusSuccess,
+			}},
+			amount: 100_000,
+			email:  "user@example.com",
+			reason: model.DeclineReasonTransactionSettled,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := &fakePaymentRepo{}
+			svc := paymentsvc.NewService(repo, tc.shopping)
+
+			p, err := svc.CreatePayment(context.Background(), model.CreatePaymentRequest{
+				TransactionID: primitive.NewObjectID().Hex(),
+				Amount:        tc.amount,
+				Email:         tc.email,
+			})
+			if err != nil {
+				t.Fatalf("CreatePayment returned error: %v", err)
+			}
+			if p.Status != model.PaymentStatusFailed {
+				t.Fatalf("expected payment status FAILED, got %s", p.Status)
+			}
+			if p.DeclineReason != tc.reason {
+				t.Fatalf("expected decline reason %s, got %s", tc.reason, p.DeclineReason)
+			}
+			if !repo.createCalled {
+				t.Fatal("expected declined payment to be stored")
+			}
+		})
+	}
+}
+
+func TestCreatePayment_ShoppingUnavailable(t *testing.T) {
+	repo := &fakePaymentRepo{}
+	svc := paymentsvc.NewService(repo, &fakeShoppingClient{err: errors.New("connection refused")})
+
+	_, err := svc.CreatePayment(context.Background(), model.CreatePaymentRequest{
+		TransactionID: primitive.NewObjectID().Hex(),
+		Amount:        100_000,
+		Email:         "user@example.com",
+	})
+	if err == nil {
+		t.Fatal("expected error when shopping service is unavailable, got nil")
+	}
+	if repo.createCalled {
+		t.Fatal("expected no payment stored when verification could not run")
+	}
+}
+
+func newIntent(t *testing.T, svc paymentsvc.Service) *model.Payment {
+	t.Helper()
+	p, err := svc.CreateIntent(context.Background(), model.CreatePaymentRequest{
+		TransactionID: primitive.NewObjectID().Hex(),
+		Amount:        100_000,
+		Email:         "user@example.com",
+	})
+	if err != nil {
+		t.Fatalf("CreateIntent returned error: %v", err)
+	}
+	if p.Status != model.PaymentStatusCreated {
+		t.Fatalf("expected intent status CREATED, got %s", p.Status)
+	}
+	return p
+}
+
+func TestPaymentLifecycle_AuthorizeAndPartialCapture(t *testing.T) {
+	repo := &fakePaymentRepo{}
+	svc := newServiceWithRepo(repo)
+	ctx := context.Background()
+
+	intent := newIntent(t, svc)
+
+	if _, err := svc.Capture(ctx, intent.ID.Hex(), model.CapturePaymentRequest{}); !errors.Is(err, paymentsvc.ErrInvalidState) {
+		t.Fatalf("expected capture before authorize to fail with ErrInvalidState, got %v", err)
+	}
+
+	authorized, err := svc.Authorize(ctx, intent.ID.Hex())
+	if err != nil {
+		t.Fatalf("Authorize returned error: %v", err)
+	}
+	if authorized.Status != model.PaymentStatusAuthorized || authorized.ExpiresAt == nil {
+		t.Fatalf("expected AUTHORIZED with expiry, got %s", authorized.Status)
+	}
+
+	if _, err := svc.Capture(ctx, intent.ID.Hex(), model.CapturePaymentRequest{Amount: 150_000}); !errors.Is(err, paymentsvc.ErrInvalidCapture) {
+		t.Fatalf("expected ErrInvalidCapture for amount above authorized, got %v", err)
+	}
+
+	captured, err := svc.Capture(ctx, intent.ID.Hex(), model.CapturePaymentRequest{Amount: 40_000})
+	if err != nil {
+		t.Fatalf("Capture returned error: %v", err)
+	}
+	if captured.Status != model.PaymentStatusSuccess || captured.CapturedAmount != 40_000 {
+		t.Fatalf("expected SUCCESS with captured 40000, got %s / %f", captured.Status, captured.CapturedAmount)
+	}
+
+	if _, err := svc.Void(ctx, intent.ID.Hex()); !errors.Is(err, paymentsvc.ErrInvalidState) {
+		t.Fatalf("expected void after capture to fail with ErrInvalidState, got %v", err)
+	}
+}
+
+func TestPaymentLifecycle_VoidAuthorized(t *testing.T) {
+	repo := &fakePaymentRepo{}
+	svc := newServiceWithRepo(repo)
+	ctx := context.Background()
+
+	intent := newIntent(t, svc)
+	if _, err := svc.Authorize(ctx, intent.ID.Hex()); err != nil {
+		t.Fatalf("Authorize returned error: %v", err)
+	}
+
+	voided, err := svc.Void(ctx, intent.ID.Hex())
+	if err != nil {
+		t.Fatalf("Void returned error: %v", err)
+	}
+	if voided.Status != model.PaymentStatusVoided {
+		t.Fatalf("expected VOIDED, got %s", voided.Status)
+	}
+
+	if _, err := svc.Capture(ctx, intent.ID.Hex(), model.CapturePaymentRequest{}); !errors.Is(err, paymentsvc.ErrInvalidState) {
+		t.Fatalf("expected capture after void to fail with ErrInvalidState, got %v", err)
+	}
+}
+
+func TestPaymentLifecycle_ExpiredAuthorizationCannotBeCaptured(t *testing.T) {
+	repo := &fakePaymentRepo{}
+	svc := paymentsvc.NewService(repo, pendingTx(100_000, "user@example.com"),
+		paymentsvc.WithAuthorizationTTL(time.Nanosecond),
+	)
+	ctx := context.Background()
+
+	intent := newIntent(t, svc)
+	if _, err := svc.Authorize(ctx, intent.ID.Hex()); err != nil {
+		t.Fatalf("Authorize returned error: %v", err)
+	}
+	time.Sleep(time.Millisecond)
+
+	if _, err := svc.Capture(ctx, intent.ID.Hex(), model.CapturePaymentRequest{}); !errors.Is(err, paymentsvc.ErrInvalidState) {
+		t.Fatalf("expected capture of expired authorization to fail, got %v", err)
+	}
+
+	expired, err := svc.ExpireStale(ctx)
+	if err != nil {
+		t.Fatalf("ExpireStale returned error: %v", err)
+	}
+	if expired != 1 {
+		t.Fatalf("expected 1 expired authorization, got %d", expired)
+	}
+}
+
+func TestList_ParsesFiltersAndPagination(t *testing.T) {
+	repo := &fakePaymentRepo{
+		listResult: []model.Payment{{Status: model.PaymentStatusSuccess}},
+		listTotal:  41,
+	}
+	svc := newServiceWithRepo(repo)
+
+	txID := primitive.NewObjectID()
+	page, err := svc.List(context.Background(), model.ListPaymentsQuery{
+		TransactionID: txID.Hex(),
+		Email:         "user@example.com",
+		Status:        "success",
+		From:          "2025-01-01",
+		To:            "2025-01-31",
+		Page:          3,
+		Limit:         10,
+	})
+	if err != nil {
+		t.Fatalf("List returned error: %v", err)
+	}
+
+	f := repo.listFilter
+	if f.TransactionID == nil || *f.TransactionID != txID {
+		t.Fatal("expected transaction_id filter")
+	}
+	if f.Status != model.PaymentStatusSuccess {
+		t.Fatalf("expected status SUCCESS, got %s", f.Status)
+	}
+	if f.Skip != 20 || f.Limit != 10 {
+		t.Fatalf("expected skip 20 / limit 10, got %d / %d", f.Skip, f.Limit)
+	}
+	wantTo := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+	if f.To == nil || !f.To.Equal(wantTo) {
+		t.Fatalf("expected to = %s (end of day inclusive), got %v", wantTo, f.To)
+	}
+	if page.Total != 41 || page.Page != 3 || len(page.Items) != 1 {
+		t.Fatalf("unexpected page %+v", page)
+	}
+}
+
+func TestList_DefaultsAndLimits(t *testing.T) {
+	repo := &fakePaymentRepo{}
+	svc := newServiceWithRepo(repo)
+
+	if _, err := svc.List(context.Background(), model.ListPaymentsQuery{Limit: 1000}); err != nil {
+		t.Fatalf("List returned error: %v", err)
+	}
+	if repo.listFilter.Limit != 100 || repo.listFilter.Skip != 0 {
+		t.Fatalf("expected limit capped to 100 and skip 0, got %d / %d", repo.listFilter.Limit, repo.listFilter.Skip)
+	}
+}
+
+func TestList_InvalidQuery(t *testing.T) {
+	svc := newServiceWithRepo(&fakePaymentRepo{})
+
+	queries := []model.ListPaymentsQuery{
+		{Status: "PAID"},
+		{TransactionID: "not-an-id"},
+		{From: "yesterday"},
+		{From: "2025-02-01", To: "2025-01-01"},
+	}
+	for _, q := range queries {
+		if _, err := svc.List(context.Background(), q); !errors.Is(err, paymentsvc.ErrInvalidQuery) {
+			t.Fatalf("expected ErrInvalidQuery for %+v, got %v", q, err)
+		}
+	}
+}
+
+func TestCreatePayment_DuplicateIsReplayed(t *testing.T) {
+	repo := &fakePaymentRepo{}
+	svc := newServiceWithRepo(repo)
+
+	req := model.CreatePaymentRequest{
+		TransactionID: primitive.NewObjectID().Hex(),
+		Amount:        100_000,
+		Email:         "user@example.com",
+	}
+
+	first, err := svc.CreatePayment(context.Background(), req)
+	if err != nil {
+		t.Fatalf("CreatePayment returned error: %v", err)
+	}
+	if first.Attempt != 1 || first.Replayed {
+		t.Fatalf("expected first payment attempt 1 and not replayed, got %d / %v", first.Attempt, first.Replayed)
+	}
+
+	second, err := svc.CreatePayment(context.Background(), req)
+	if err != nil {
+		t.Fatalf("expected replay, got error: %v", err)
+	}
+	if !second.Replayed || second.ID != first.ID {
+		t.Fatalf("expected replay of payment %s, got %s (replayed=%v)", first.ID.Hex(), second.ID.Hex(), second.Replayed)
+	}
+	if len(repo.payments) != 1 {
+		t.Fatalf("expected 1 stored payment, got %d", len(repo.payments))
+	}
+}
+
+func TestCreatePayment_DuplicateWithDifferentAmountConflicts(t *testing.T) {
+	repo := &fakePaymentRepo{}
+	svc := newServiceWithRepo(repo)
+
+	txID := primitive.NewObjectID().Hex()
+	first, err := svc.CreatePayment(context.Background(), model.CreatePaymentRequest{
+		TransactionID: txID,
+		Amount:        100_000,
+		Email:         "user@example.com",
+	})
+	if err != nil {
+		t.Fatalf("CreatePayment returned error: %v", err)
+	}
+
+	_, err = svc.CreatePayment(context.Background(), model.CreatePaymentRequest{
+		TransactionID: txID,
+		Amount:        90_000,
+		Email:         "user@example.com",
+	})
+	var dup *paymentsvc.DuplicatePaymentError
+	if !errors.As(err, &dup) {
+		t.Fatalf("expected DuplicatePaymentError, got %v", err)
+	}
+	if dup.ExistingID != first.ID || !errors.Is(err, paymentsvc.ErrDuplicatePayment) {
+		t.Fatalf("expected conflict with payment %s, got %s", first.ID.Hex(), dup.ExistingID.Hex())
+	}
+}
+
+func TestCreatePayment_NewAttemptAfterFailed(t *testing.T) {
+	repo := &fakePaymentRepo{}
+	svc := newServiceWithRepo(repo)
+
+	txID := primitive.NewObjectID().Hex()
+	failed, err := svc.CreatePayment(context.Background(), model.CreatePaymentRequest{
+		TransactionID: txID,
+		Amount:        1, // amount mismatch -> FAILED
+		Email:         "user@example.com",
+	})
+	if err != nil {
+		t.Fatalf("CreatePayment returned error: %v", err)
+	}
+	if failed.Status != model.PaymentStatusFailed {
+		t.Fatalf("expected first attempt FAILED, got %s", failed.Status)
+	}
+
+	retry, err := svc.CreatePayment(context.Background(), model.CreatePaymentRequest{
+		TransactionID: txID,
+		Amount:        100_000,
+		Email:         "user@example.com",
+	})
+	if err != nil {
+		t.Fatalf("CreatePayment retry returned error: %v", err)
+	}
+	if retry.Attempt != 2 || retry.Status != model.PaymentStatusSuccess || retry.Replayed {
+		t.Fatalf("expected new SUCCESS attempt 2, got attempt %d status %s", retry.Attempt, retry.Status)
+	}
+}
+
+func TestCreatePayment_ConcurrentInsertIsReplayed(t *testing.T) {
+	repo := &fakePaymentRepo{}
+	svc := newServiceWithRepo(repo)
+
+	req := model.CreatePaymentRequest{
+		TransactionID: primitive.NewObjectID().Hex(),
+		Amount:        100_000,
+		Email:         "user@example.com",
+	}
+	first, err := svc.CreatePayment(context.Background(), req)
+	if err != nil {
+		t.Fatalf("CreatePayment returned error: %v", err)
+	}
+
+	// lookup awal tidak melihat payment pertama, insert kena duplicate key
+	repo.hideLatestOnce = true
+	second, err := svc.CreatePayment(context.Background(), req)
+	if err != nil {
+		t.Fatalf("expected replay after duplicate key, got error: %v", err)
+	}
+	if !second.Replayed || second.ID != first.ID {
+		t.Fatal("expected existing payment to be returned after duplicate key")
+	}
+}
+
+type fakeCounter struct {
+	n int64
+}
+
+func (f fakeCounter) CountByEmailSince(ctx context.Context, email string, since time.Time) (int64, error) {
+	return f.n, nil
+}
+
+func TestRiskEngine_Rules(t *testing.T) {
+	rules := paymentsvc.DefaultRiskRules()
+	rules.MaxAmount = 1_000_000
+	rules.ReviewAmount = 500_000
+
+	cases := []struct {
+		name     string
+		payment  model.Payment
+		recent   int64
+		decision model.RiskDecision
+		rules    []string
+	}{
+		{"clean", model.Payment{Amount: 100_000, Email: "user@example.com", Attempt: 1}, 0, model.RiskDecisionApprove, nil},
+		{"review amount", model.Payment{Amount: 600_000, Email: "user@example.com", Attempt: 1}, 0, model.RiskDecisionReview, []string{paymentsvc.RuleReviewAmount}},
+		{"max amount", model.Payment{Amount: 2_000_000, Email: "user@example.com", Attempt: 1}, 0, model.RiskDecisionDecline, []string{paymentsvc.RuleMaxAmount}},
+		{"disposable email", model.Payment{Amount: 100_000, Email: "x@Mail.Mailinator.com", Attempt: 1}, 0, model.RiskDecisionDecline, []string{paymentsvc.RuleDisposableEmail}},
+		{"too many attempts", model.Payment{Amount: 100_000, Email: "user@example.com", Attempt: 4}, 0, model.RiskDecisionDecline, []string{paymentsvc.RuleTransactionAttempts}},
+		{"email velocity", model.Payment{Amount: 100_000, Email: "user@example.com", Attempt: 1}, 5, model.RiskDecisionReview, []string{paymentsvc.RuleEmailVelocity}},
+		{"most severe wins", model.Payment{Amount: 600_000, Email: "user@example.com", Attempt: 4}, 0, model.RiskDecisionDecline, []string{paymentsvc.RuleReviewAmount, paymentsvc.RuleTransactionAttempts}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			engine := paymentsvc.NewRiskEngine(rules, fakeCounter{n: tc.recent})
+			a, err := engine.Evaluate(context.Background(), &tc.payment)
+			if err != nil {
+				t.Fatalf("Evaluate returned error: %v", err)
+			}
+			if a.Decision != tc.decision {
+				t.Fatalf("expected decision %s, got %s (rules %v)", tc.decision, a.Decision, a.TriggeredRules)
+			}
+			if len(a.TriggeredRules) != len(tc.rules) {
+				t.Fatalf("expected rules %v, got %v", tc.rules, a.TriggeredRules)
+			}
+			for i := range tc.rules {
+				if a.TriggeredRules[i] != tc.rules[i] {
+					t.Fatalf("expected rules %v, got %v", tc.rules, a.TriggeredRules)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadRiskRules(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "rules.json")
+	if err := os.WriteFile(path, []byte(`{"review_amount": 250000, "email_velocity": {"max": 2, "window": "10m", "action": "DECLINE"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	rules, err := paymentsvc.LoadRiskRules(path)
+	if err != nil {
+		t.Fatalf("LoadRiskRules returned error: %v", err)
+	}
+	if rules.ReviewAmount != 250_000 || rules.EmailVelocity.Max != 2 ||
+		time.Duration(rules.EmailVelocity.Window) != 10*time.Minute ||
+		rules.EmailVelocity.Action != model.RiskDecisionDecline {
+		t.Fatalf("expected overrides from file, got %+v", rules)
+	}
+	if rules.MaxAmount != paymentsvc.DefaultRiskRules().MaxAmount {
+		t.Fatalf("expected missing fields to keep defaults, got max_amount %v", rules.MaxAmount)
+	}
+
+	bad := filepath.Join(dir, "bad.json")
+	if err := os.WriteFile(bad, []byte(`{"disposable_email_action": "ALLOW"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := paymentsvc.LoadRiskRules(bad); err == nil {
+		t.Fatal("expected error for invalid action, got nil")
+	}
+}
+
+func newRiskService(repo *fakePaymentRepo, shopping *fakeShoppingClient, opts ...paymentsvc.Option) paymentsvc.Service {
+	rules := paymentsvc.DefaultRiskRules()
+	rules.ReviewAmount = 50_000
+	opts = append([]paymentsvc.Option{paymentsvc.WithRiskEngine(paymentsvc.NewRiskEngine(rules, repo))}, opts...)
+	return paymentsvc.NewService(repo, shopping, opts...)
+}
+
+func TestCreateIntent_HeldForReviewThenApproved(t *testing.T) {
+	repo := &fakePaymentRepo{}
+	shopping := pendingTx(100_000, "user@example.com")
+	svc := newRiskService(repo, shopping)
+
+	p, err := svc.CreateIntent(context.Background(), model.CreatePaymentRequest{
+		TransactionID: primitive.NewObjectID().Hex(),
+		Amount:        100_000,
+		Email:         "user@example.com",
+	})
+	if err != nil {
+		t.Fatalf("CreateIntent returned error: %v", err)
+	}
+	if p.Status != model.PaymentStatusReview {
+		t.Fatalf("expected status REVIEW, got %s", p.Status)
+	}
+	if p.Risk == nil || len(p.Risk.TriggeredRules) != 1 || p.Risk.TriggeredRules[0] != paymentsvc.RuleReviewAmount {
+		t.Fatalf("expected stored decision with review_amount rule, got %+v", p.Risk)
+	}
+
+	if _, err := svc.Authorize(context.Background(), p.ID.Hex()); !errors.Is(err, paymentsvc.ErrInvalidState) {
+		t.Fatalf("expected held payment to refuse authorize, got %v", err)
+	}
+
+	approved, err := svc.Review(context.Background(), p.ID.Hex(), model.ReviewPaymentRequest{
+		Decision: "approve",
+		Reviewer: "ops@example.com",
+		Note:     "customer confirmed by phone",
+	})
+	if err != nil {
+		t.Fatalf("Review returned error: %v", err)
+	}
+	if approved.Status != model.PaymentStatusCreated {
+		t.Fatalf("expected status CREATED after approve, got %s", approved.Status)
+	}
+	stored := repo.payments[p.ID]
+	if stored.Risk.ReviewDecision != model.RiskDecisionApprove || stored.Risk.ReviewedBy != "ops@example.com" || stored.Risk.ReviewedAt == nil {
+		t.Fatalf("expected review outcome stored, got %+v", stored.Risk)
+	}
+	if len(shopping.notified) != 1 || !shopping.notified[0].Approved || shopping.notified[0].PaymentID != p.ID.Hex() {
+		t.Fatalf("expected shopping notified of approval, got %+v", shopping.notified)
+	}
+
+	if _, err := svc.Authorize(context.Background(), p.ID.Hex()); err != nil {
+		t.Fatalf("expected approved payment to authorize, got %v", err)
+	}
+	if _, err := svc.Review(context.Background(), p.ID.Hex(), model.ReviewPaymentRequest{Decision: "reject", Reviewer: "ops@example.com"}); !errors.Is(err, paymentsvc.ErrInvalidState) {
+		t.Fatalf("expected second review to fail with ErrInvalidState, got %v", err)
+	}
+}
+
+func TestReview_Reject(t *testing.T) {
+	repo := &fakePaymentRepo{}
+	shopping := pendingTx(100_000, "user@example.com")
+	svc := newRiskService(repo, shopping)
+
+	p, err := svc.CreatePayment(context.Background(), model.CreatePaymentRequest{
+		TransactionID: primitive.NewObjectID().Hex(),
+		Amount:        100_000,
+		Email:         "user@example.com",
+	})
+	if err != nil {
+		t.Fatalf("CreatePayment returned error: %v", err)
+	}
+	if p.Status != model.PaymentStatusReview || p.CapturedAt != nil {
+		t.Fatalf("expected one-shot payment held uncaptured, got %s", p.Status)
+	}
+
+	if _, err := svc.Review(context.Background(), p.ID.Hex(), model.ReviewPaymentRequest{Decision: "maybe", Reviewer: "ops@example.com"}); !errors.Is(err, paymentsvc.ErrInvalidReview) {
+		t.Fatalf("expected ErrInvalidReview, got %v", err)
+	}
+
+	rejected, err := svc.Review(context.Background(), p.ID.Hex(), model.ReviewPaymentRequest{Decision: "reject", Reviewer: "ops@example.com"})
+	if err != nil {
+		t.Fatalf("Review returned error: %v", err)
+	}
+	if rejected.Status != model.PaymentStatusFailed || rejected.DeclineReason != model.DeclineReasonReviewRejected {
+		t.Fatalf("expected FAILED/review_rejected, got %s/%s", rejected.Status, rejected.DeclineReason)
+	}
+	if len(shopping.notified) != 1 || shopping.notified[0].Approved {
+		t.Fatalf("expected shopping notified of rejection, got %+v", shopping.notified)
+	}
+}
+
+// Payment yang tidak pernah di-review atau di-authorize tidak menggantung selamanya.
+func TestExpireStale_ReviewAndCreated(t *testing.T) {
+	repo := &fakePaymentRepo{}
+	svc := newRiskService(repo, pendingTx(100_000, "user@example.com"),
+		paymentsvc.WithReviewTTL(time.Nanosecond),
+	)
+	ctx := context.Background()
+	req := func(amount float64) model.CreatePaymentRequest {
+		return model.CreatePaymentRequest{TransactionID: primitive.NewObjectID().Hex(), Amount: amount, Email: "user@example.com"}
+	}
+
+	held, err := svc.CreateIntent(ctx, req(100_000))
+	if err != nil {
+		t.Fatalf("CreateIntent returned error: %v", err)
+	}
+	if held.Status != model.PaymentStatusReview || held.ExpiresAt == nil {
+		t.Fatalf("expected a held payment with expires_at, got %s / %v", held.Status, held.ExpiresAt)
+	}
+	// di bawah review_amount, langsung CREATED
+	svc = newRiskService(repo, pendingTx(10_000, "user@example.com"), paymentsvc.WithIntentTTL(time.Nanosecond))
+	created, err := svc.CreateIntent(ctx, req(10_000))
+	if err != nil {
+		t.Fatalf("CreateIntent returned error: %v", err)
+	}
+	if created.Status != model.PaymentStatusCreated || created.ExpiresAt == nil {
+		t.Fatalf("expected a created payment with expires_at, got %s / %v", created.Status, created.ExpiresAt)
+	}
+	time.Sleep(time.Millisecond)
+
+	if _, err := svc.Review(ctx, held.ID.Hex(), model.ReviewPaymentRequest{Decision: "approve", Reviewer: "ops@example.com"}); !errors.Is(err, paymentsvc.ErrInvalidState) {
+		t.Fatalf("expected review after the review TTL to fail, got %v", err)
+	}
+	if _, err := svc.Authorize(ctx, created.ID.Hex()); !errors.Is(err, paymentsvc.ErrInvalidState) {
+		t.Fatalf("expected authorize after the TTL to fail, got %v", err)
+	}
+
+	expired, err := svc.ExpireStale(ctx)
+	if err != nil {
+		t.Fatalf("ExpireStale returned error: %v", err)
+	}
+	if expired != 2 || repo.payments[held.ID].Status != model.PaymentStatusExpired || repo.payments[created.ID].Status != model.PaymentStatusExpired {
+		t.Fatalf("expected both payments EXPIRED, got %d", expired)
+	}
+}
+
+func TestReview_ApproveRestartsTheClock(t *testing.T) {
+	repo := &fakePaymentRepo{}
+	svc := newRiskService(repo, pendingTx(100_000, "user@example.com"), paymentsvc.WithIntentTTL(time.Hour))
+
+	p, err := svc.CreateIntent(context.Background(), model.CreatePaymentRequest{
+		TransactionID: primitive.NewObjectID().Hex(),
+		Amount:        100_000,
+		Email:         "user@example.com",
+	})
+	if err != nil {
+		t.Fatalf("CreateIntent returned error: %v", err)
+	}
+	if p.ExpiresAt.Sub(time.Now()) < 23*time.Hour {
+		t.Fatalf("expected the default review TTL of 24h, expires_at is %s", p.ExpiresAt)
+	}
+
+	approved, err := svc.Review(context.Background(), p.ID.Hex(), model.ReviewPaymentRequest{Decision: "approve", Reviewer: "ops@example.com"})
+	if err != nil {
+		t.Fatalf("Review returned error: %v", err)
+	}
+	if left := approved.ExpiresAt.Sub(time.Now()); left > time.Hour || left < 59*time.Minute {
+		t.Fatalf("expected an approved payment to get the intent TTL, %s left", left)
+	}
+}
+
+func TestCreatePayment_RiskDeclined(t *testing.T) {
+	repo := &fakePaymentRepo{}
+	svc := newRiskService(repo, pendingTx(100_000, "user@yopmail.com"))
+
+	p, err := svc.CreatePayment(context.Background(), model.CreatePaymentRequest{
+		TransactionID: primitive.NewObjectID().Hex(),
+		Amount:        100_000,
+		Email:         "user@yopmail.com",
+	})
+	if err != nil {
+		t.Fatalf("CreatePayment returned error: %v", err)
+	}
+	if p.Status != model.PaymentStatusFailed || p.DeclineReason != model.DeclineReasonRiskDeclined {
+		t.Fatalf("expected FAILED/risk_declined, got %s/%s", p.Status, p.DeclineReason)
+	}
+	if repo.createInput.Risk == nil || repo.createInput.Risk.Decision != model.RiskDecisionDecline {
+		t.Fatalf("expected decline decision stored, got %+v", repo.createInput.Risk)
+	}
+}
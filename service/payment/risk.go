@@ -0,0 +1,214 @@
+package payment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"ecom/model"
+)
+
+// Nama rule yang disimpan di RiskAssessment.TriggeredRules.
+const (
+	RuleMaxAmount           = "max_amount"
+	RuleReviewAmount        = "review_amount"
+	RuleEmailVelocity       = "email_velocity"
+	RuleTransactionAttempts = "transaction_attempts"
+	RuleDisposableEmail     = "disposable_email"
+)
+
+// Duration is a time.Duration written as a string ("1h", "15m") in the rules file.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// VelocityRule limits how many payments an email can open within Window.
+type VelocityRule struct {
+	Max    int                `json:"max"`
+	Window Duration           `json:"window"`
+	Action model.RiskDecision `json:"action"`
+}
+
+// RiskRules configures the risk engine. A zero limit disables that rule.
+type RiskRules struct {
+	// MaxAmount declines payments above it, ReviewAmount holds them for review.
+	MaxAmount    float64 `json:"max_amount"`
+	ReviewAmount float64 `json:"review_amount"`
+
+	EmailVelocity VelocityRule `json:"email_velocity"`
+
+	// MaxAttemptsPerTransaction declines retries past this attempt number.
+	MaxAttemptsPerTransaction int `json:"max_attempts_per_transaction"`
+
+	DisposableEmailDomains []string           `json:"disposable_email_domains"`
+	DisposableEmailAction  model.RiskDecision `json:"disposable_email_action"`
+}
+
+func DefaultRiskRules() RiskRules {
+	return RiskRules{
+		MaxAmount:    50_000_000,
+		ReviewAmount: 10_000_000,
+		EmailVelocity: VelocityRule{
+			Max:    5,
+			Window: Duration(time.Hour),
+			Action: model.RiskDecisionReview,
+		},
+		MaxAttemptsPerTransaction: 3,
+		DisposableEmailDomains: []string{
+			"mailinator.com",
+			"guerrillamail.com",
+			"10minutemail.com",
+			"temp-mail.org",
+			"yopmail.com",
+		},
+		DisposableEmailAction: model.RiskDecisionDecline,
+	}
+}
+
+// LoadRiskRules reads rules from a JSON file. Fields missing from the file
+// keep their default value; an empty path returns the defaults.
+func LoadRiskRules(path string) (RiskRules, error) {
+	rules := DefaultRiskRules()
+	if path == "" {
+		return rules, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return rules, fmt.Errorf("read risk rules: %w", err)
+	}
+	if err := json.Unmarshal(b, &rules); err != nil {
+		return rules, fmt.Errorf("parse risk rules %s: %w", path, err)
+	}
+	if err := rules.validate(); err != nil {
+		return rules, fmt.Errorf("risk rules %s: %w", path, err)
+	}
+	return rules, nil
+}
+
+func (r RiskRules) validate() error {
+	for name, action := range map[string]model.RiskDecision{
+		"email_velocity.action":   r.EmailVelocity.Action,
+		"disposable_email_action": r.DisposableEmailAction,
+	} {
+		if action != model.RiskDecisionReview && action != model.RiskDecisionDecline {
+			return fmt.Errorf("%s must be REVIEW or DECLINE, got %q", name, action)
+		}
+	}
+	if r.EmailVelocity.Max > 0 && r.EmailVelocity.Window <= 0 {
+		return fmt.Errorf("email_velocity.window must be positive")
+	}
+	return nil
+}
+
+// RiskEvaluator decides whether a verified payment can go ahead.
+type RiskEvaluator interface {
+	Evaluate(ctx context.Context, p *model.Payment) (*model.RiskAssessment, error)
+}
+
+// PaymentCounter is the part of the repository the velocity rule needs.
+type PaymentCounter interface {
+	CountByEmailSince(ctx context.Context, email string, since time.Time) (int64, error)
+}
+
+type riskEngine struct {
+	rules    RiskRules
+	payments PaymentCounter
+	now      func() time.Time
+}
+
+func NewRiskEngine(rules RiskRules, payments PaymentCounter) RiskEvaluator {
+	return &riskEngine{
+		rules:    rules,
+		payments: payments,
+		now:      time.Now,
+	}
+}
+
+// Evaluate runs every rule and returns the most severe decision together with
+// all rules that fired.
+func (e *riskEngine) Evaluate(ctx context.Context, p *model.Payment) (*model.RiskAssessment, error) {
+	a := &model.RiskAssessment{
+		Decision:       model.RiskDecisionApprove,
+		TriggeredRules: []string{},
+		EvaluatedAt:    e.now(),
+	}
+	hit := func(rule string, d model.RiskDecision) {
+		a.TriggeredRules = append(a.TriggeredRules, rule)
+		if severity(d) > severity(a.Decision) {
+			a.Decision = d
+		}
+	}
+
+	r := e.rules
+	switch {
+	case r.MaxAmount > 0 && p.Amount > r.MaxAmount:
+		hit(RuleMaxAmount, model.RiskDecisionDecline)
+	case r.ReviewAmount > 0 && p.Amount > r.ReviewAmount:
+		hit(RuleReviewAmount, model.RiskDecisionReview)
+	}
+
+	if r.MaxAttemptsPerTransaction > 0 && p.Attempt > r.MaxAttemptsPerTransaction {
+		hit(RuleTransactionAttempts, model.RiskDecisionDecline)
+	}
+
+	if isDisposable(p.Email, r.DisposableEmailDomains) {
+		hit(RuleDisposableEmail, r.DisposableEmailAction)
+	}
+
+	if v := r.EmailVelocity; v.Max > 0 {
+		since := a.EvaluatedAt.Add(-time.Duration(v.Window))
+		n, err := e.payments.CountByEmailSince(ctx, p.Email, since)
+		if err != nil {
+			return nil, fmt.Errorf("count payments by email: %w", err)
+		}
+		// payment yang sedang dievaluasi belum tersimpan, jadi ikut dihitung di sini
+		if n+1 > int64(v.Max) {
+			hit(RuleEmailVelocity, v.Action)
+		}
+	}
+
+	return a, nil
+}
+
+func severity(d model.RiskDecision) int {
+	switch d {
+	case model.RiskDecisionDecline:
+		return 2
+	case model.RiskDecisionReview:
+		return 1
+	}
+	return 0
+}
+
+func isDisposable(email string, domains []string) bool {
+	_, domain, ok := strings.Cut(strings.ToLower(strings.TrimSpace(email)), "@")
+	if !ok {
+		return false
+	}
+	for _, d := range domains {
+		d = strings.ToLower(d)
+		if domain == d || strings.HasSuffix(domain, "."+d) {
+			return true
+		}
+	}
+	return false
+}
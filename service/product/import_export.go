@@ -0,0 +1,397 @@
+package product
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"ecom/model"
+	"ecom/util/tracing"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Import and export columns (CSV header names, NDJSON keys): sku, name, price
+// and stock are required on import. description, status, category_ids and
+// tags are optional; when a column is missing (or a status cell is empty) the
+// stored value is kept, or the default is used for a new product. In CSV the
+// category_ids and tags lists are separated by listSeparator. Other columns of
+// an export (id, reserved, timestamps) are ignored on import, and images,
+// weight and dimensions are not part of the file.
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+
+	maxImportRows = 10_000
+	maxSKULength  = 64
+
+	listSeparator = "|"
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("format must be csv or ndjson")
+	ErrInvalidImport     = errors.New("invalid import file")
+)
+
+// ContentType returns the response content type for an export format.
+func ContentType(format string) (string, error) {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8", nil
+	case FormatNDJSON:
+		return "application/x-ndjson", nil
+	}
+	return "", ErrUnsupportedFormat
+}
+
+// /products/import (POST)
+func (s *service) Import(ctx context.Context, r io.Reader, format string, dryRun bool) (*model.ProductImportResult, error) {
+	ctx, span := tracing.Start(ctx, "ProductService.Import")
+	defer span.End()
+
+	rows, err := newRowReader(r, format)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &model.ProductImportResult{DryRun: dryRun, Errors: []model.ImportRowError{}}
+	fail := func(line int, sku string, err error) {
+		res.Failed++
+		res.Errors = append(res.Errors, model.ImportRowError{Line: line, SKU: sku, Error: err.Error()})
+	}
+
+	// semua baris dibaca dan divalidasi dulu, supaya file yang terlalu besar
+	// ditolak sebelum ada produk yang ditulis
+	var valid []importRow
+	seen := map[string]int{}
+	for {
+		line, row, err := rows.next()
+		if err == io.EOF {
+			break
+		}
+		var rowErr *rowError
+		if err != nil && !errors.As(err, &rowErr) {
+			return nil, err
+		}
+
+		res.Rows++
+		if res.Rows > maxImportRows {
+			return nil, fmt.Errorf("%w: more than %d rows", ErrInvalidImport, maxImportRows)
+		}
+		if err != nil {
+			fail(line, row.SKU, err)
+			continue
+		}
+
+		if err := validateRow(&row); err != nil {
+			fail(line, row.SKU, err)
+			continue
+		}
+		if first, dup := seen[row.SKU]; dup {
+			fail(line, row.SKU, fmt.Errorf("duplicate sku, first seen on line %d", first))
+			continue
+		}
+		p, fields, err := s.importProduct(ctx, row)
+		if errors.Is(err, ErrInvalidProduct) {
+			fail(line, row.SKU, err)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		seen[row.SKU] = line
+		valid = append(valid, importRow{line: line, product: p, fields: fields})
+	}
+
+	for _, r := range valid {
+		line, row := r.line, r.product
+		existing, err := s.repo.FindBySKU(ctx, row.SKU)
+		switch {
+		case errors.Is(err, mongo.ErrNoDocuments):
+			existing = nil
+		case err != nil:
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if existing != nil && row.Stock < existing.Reserved {
+			fail(line, row.SKU, fmt.Errorf("stock cannot be lower than reserved stock (%d)", existing.Reserved))
+			continue
+		}
+
+		created := existing == nil
+		if !dryRun {
+			created, err = s.repo.UpsertBySKU(ctx, row, r.fields)
+			if errors.Is(err, model.ErrStockBelowReserved) {
+				// stok sempat di-reserve setelah FindBySKU di atas
+				fail(line, row.SKU, err)
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+		}
+		if created {
+			res.Created++
+		} else {
+			res.Updated++
+		}
+	}
+	// error dikembalikan urut baris, baris invalid dan baris yang gagal ditulis bercampur
+	sort.SliceStable(res.Errors, func(i, j int) bool { return res.Errors[i].Line < res.Errors[j].Line })
+	return res, nil
+}
+
+// importRow is a row that passed validation, waiting to be written.
+type importRow struct {
+	line    int
+	product *model.Product
+	// fields are the catalog fields the row sets, see UpsertBySKU
+	fields []string
+}
+
+// importProduct builds the product to upsert from row, with the catalog
+// fields the row sets validated like on create.
+func (s *service) importProduct(ctx context.Context, row model.ProductImportRow) (*model.Product, []string, error) {
+	p := &model.Product{SKU: row.SKU, Name: row.Name, Price: row.Price, Stock: row.Stock}
+	var fields []string
+
+	if row.Description != nil {
+		p.Description = strings.TrimSpace(*row.Description)
+		fields = append(fields, "description")
+	}
+	if row.Status != nil {
+		p.Status = model.ProductStatus(strings.ToLower(strings.TrimSpace(string(*row.Status))))
+		if !p.Status.Valid() {
+			return nil, nil, fmt.Errorf("%w: status must be active, draft or archived", ErrInvalidProduct)
+		}
+		fields = append(fields, "status")
+	}
+	if row.CategoryIDs != nil {
+		ids, err := s.checkCategories(ctx, *row.CategoryIDs)
+		if err != nil {
+			return nil, nil, err
+		}
+		p.CategoryIDs = ids
+		fields = append(fields, "category_ids")
+	}
+	if row.Tags != nil {
+		p.Tags = normalizeTags(*row.Tags)
+		fields = append(fields, "tags")
+	}
+	return p, fields, nil
+}
+
+func validateRow(row *model.ProductImportRow) error {
+	row.SKU = strings.TrimSpace(row.SKU)
+	row.Name = strings.TrimSpace(row.Name)
+
+	switch {
+	case row.SKU == "":
+		return errors.New("sku is required")
+	case len(row.SKU) > maxSKULength:
+		return fmt.Errorf("sku longer than %d characters", maxSKULength)
+	case row.Name == "":
+		return errors.New("name is required")
+	case row.Price <= 0:
+		return errors.New("price must be > 0")
+	case row.Stock < 0:
+		return errors.New("stock must be >= 0")
+	}
+	return nil
+}
+
+// rowError is a problem with a single row; the import carries on with the next one.
+type rowError struct {
+	msg string
+}
+
+func (e *rowError) Error() string {
+	return e.msg
+}
+
+type rowReader interface {
+	// next returns the line number and row, a *rowError for a bad row,
+	// io.EOF at the end, or any other error when the stream can't be read.
+	next() (int, model.ProductImportRow, error)
+}
+
+func newRowReader(r io.Reader, format string) (rowReader, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVRowReader(r)
+	case FormatNDJSON:
+		sc := bufio.NewScanner(r)
+		sc.Buffer(make([]byte, 64*1024), 1024*1024)
+		return &ndjsonRowReader{sc: sc}, nil
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+type csvRowReader struct {
+	cr   *csv.Reader
+	cols map[string]int
+}
+
+// newCSVRowReader reads the header; columns are matched by name so extra
+// columns (like the ones in an export) are ignored.
+func newCSVRowReader(r io.Reader) (*csvRowReader, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%w: empty file", ErrInvalidImport)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrInvalidImport, err)
+	}
+
+	cols := map[string]int{}
+	for i, name := range header {
+		cols[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	for _, name := range []string{"sku", "name", "price", "stock"} {
+		if _, ok := cols[name]; !ok {
+			return nil, fmt.Errorf("%w: missing column %q", ErrInvalidImport, name)
+		}
+	}
+	return &csvRowReader{cr: cr, cols: cols}, nil
+}
+
+func (c *csvRowReader) next() (int, model.ProductImportRow, error) {
+	var row model.ProductImportRow
+
+	record, err := c.cr.Read()
+	if err == io.EOF {
+		return 0, row, io.EOF
+	}
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return parseErr.StartLine, row, &rowError{msg: parseErr.Err.Error()}
+	}
+	if err != nil {
+		return 0, row, err
+	}
+	line, _ := c.cr.FieldPos(0)
+
+	field := func(name string) string {
+		if i, ok := c.cols[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	row.SKU = field("sku")
+	row.Name = field("name")
+	// kolom katalog yang tidak ada di header dibiarkan nil: nilai tersimpan tidak diubah
+	if _, ok := c.cols["description"]; ok {
+		description := field("description")
+		row.Description = &description
+	}
+	if status := field("status"); status != "" {
+		st := model.ProductStatus(status)
+		row.Status = &st
+	}
+	if _, ok := c.cols["category_ids"]; ok {
+		ids := splitList(field("category_ids"))
+		row.CategoryIDs = &ids
+	}
+	if _, ok := c.cols["tags"]; ok {
+		tags := splitList(field("tags"))
+		row.Tags = &tags
+	}
+	if row.Price, err = strconv.ParseFloat(field("price"), 64); err != nil {
+		return line, row, &rowError{msg: fmt.Sprintf("invalid price %q", field("price"))}
+	}
+	if row.Stock, err = strconv.Atoi(field("stock")); err != nil {
+		return line, row, &rowError{msg: fmt.Sprintf("invalid stock %q", field("stock"))}
+	}
+	return line, row, nil
+}
+
+// splitList splits a CSV list cell on listSeparator, dropping empty items.
+func splitList(cell string) []string {
+	items := []string{}
+	for _, item := range strings.Split(cell, listSeparator) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+type ndjsonRowReader struct {
+	sc   *bufio.Scanner
+	line int
+}
+
+func (n *ndjsonRowReader) next() (int, model.ProductImportRow, error) {
+	var row model.ProductImportRow
+	for n.sc.Scan() {
+		n.line++
+		b := n.sc.Bytes()
+		if len(strings.TrimSpace(string(b))) == 0 {
+			continue
+		}
+		if err := json.Unmarshal(b, &row); err != nil {
+			return n.line, row, &rowError{msg: "invalid json: " + err.Error()}
+		}
+		return n.line, row, nil
+	}
+	if err := n.sc.Err(); err != nil {
+		return n.line, row, err
+	}
+	return n.line, row, io.EOF
+}
+
+// /products/export (GET)
+func (s *service) Export(ctx context.Context, w io.Writer, format string) error {
+	ctx, span := tracing.Start(ctx, "ProductService.Export")
+	defer span.End()
+
+	switch format {
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		_ = cw.Write([]string{"id", "sku", "name", "description", "status", "category_ids", "tags", "price", "stock", "reserved", "created_at", "updated_at"})
+		err := s.repo.Stream(ctx, func(p *model.Product) error {
+			categoryIDs := make([]string, len(p.CategoryIDs))
+			for i, id := range p.CategoryIDs {
+				categoryIDs[i] = id.Hex()
+			}
+			return cw.Write([]string{
+				p.ID.Hex(),
+				p.SKU,
+				p.Name,
+				p.Description,
+				string(p.Status),
+				strings.Join(categoryIDs, listSeparator),
+				strings.Join(p.Tags, listSeparator),
+				strconv.FormatFloat(p.Price, 'f', -1, 64),
+				strconv.Itoa(p.Stock),
+				strconv.Itoa(p.Reserved),
+				p.CreatedAt.UTC().Format(time.RFC3339),
+				p.UpdatedAt.UTC().Format(time.RFC3339),
+			})
+		})
+		cw.Flush()
+		if err != nil {
+			return err
+		}
+		return cw.Error()
+
+	case FormatNDJSON:
+		enc := json.NewEncoder(w)
+		return s.repo.Stream(ctx, func(p *model.Product) error {
+			return enc.Encode(p)
+		})
+	}
+	return ErrUnsupportedFormat
+}
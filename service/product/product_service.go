@@ -2,84 +2,386 @@ package product
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net/url"
+	"strings"
 
 	"ecom/model"
+	"ecom/util/patch"
+	"ecom/util/tracing"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrSKUTaken       = errors.New("sku already used by another product")
+	ErrInvalidProduct = errors.New("invalid product")
+	ErrInvalidQuery   = errors.New("invalid query")
 )
 
 type Repository interface {
 	Create(ctx context.Context, p *model.Product) error
-	FindAll(ctx context.Context) ([]model.Product, error)
+	FindAll(ctx context.Context, f model.ProductFilter) ([]model.Product, error)
 	FindByID(ctx context.Context, id primitive.ObjectID) (*model.Product, error)
 	Update(ctx context.Context, p *model.Product) error
+	UpdateFields(ctx context.Context, p *model.Product, fields []string) error
 	Delete(ctx context.Context, id primitive.ObjectID) error
+
+	FindBySKU(ctx context.Context, sku string) (*model.Product, error)
+	UpsertBySKU(ctx context.Context, p *model.Product, fields []string) (bool, error)
+	Stream(ctx context.Context, fn func(p *model.Product) error) error
+
+	Search(ctx context.Context, f model.ProductSearchFilter) (*model.ProductSearchResult, error)
+	SuggestWords(ctx context.Context, prefix string) ([]string, error)
+	SuggestCandidates(ctx context.Context, groups [][]string) ([]model.Product, error)
+
+	AddVariant(ctx context.Context, p *model.Product, v *model.Variant) error
+	UpdateVariant(ctx context.Context, p *model.Product, v *model.Variant) error
+	RemoveVariant(ctx context.Context, productID, variantID primitive.ObjectID) (bool, error)
+}
+
+// CategoryRepository is used to check category references and resolve slugs.
+type CategoryRepository interface {
+	FindBySlug(ctx context.Context, slug string) (*model.Category, error)
+	CountByIDs(ctx context.Context, ids []primitive.ObjectID) (int64, error)
 }
 
 type Service interface {
 	Create(ctx context.Context, req model.CreateProductRequest) (*model.Product, error)
-	GetAll(ctx context.Context) ([]model.Product, error)
+	GetAll(ctx context.Context, q model.ListProductsQuery) ([]model.Product, error)
 	GetByID(ctx context.Context, id string) (*model.Product, error)
-	Update(ctx context.Context, id string, req model.UpdateProductRequest) (*model.Product, error)
+	// Update fails with model.ErrVersionConflict when ifMatch (the version the
+	// caller last read) is not the current version. ifMatch 0 skips the check,
+	// but a concurrent write between read and save is still detected.
+	Update(ctx context.Context, id string, req model.UpdateProductRequest, ifMatch int64) (*model.Product, error)
+	// Patch applies a JSON Merge Patch and saves only the fields it contains.
+	Patch(ctx context.Context, id string, doc patch.Document, ifMatch int64) (*model.Product, error)
 	Delete(ctx context.Context, id string) error
+
+	// Search is a relevance-ranked text search with category and price facets.
+	Search(ctx context.Context, q model.SearchProductsQuery) (*model.ProductSearchResult, error)
+	// Suggest returns product names for autocomplete, tolerating small typos.
+	Suggest(ctx context.Context, q string, limit int) ([]model.ProductSuggestion, error)
+
+	// Import upserts products by SKU from a CSV or NDJSON stream. With dryRun
+	// nothing is written, the result only tells what would happen.
+	Import(ctx context.Context, r io.Reader, format string, dryRun bool) (*model.ProductImportResult, error)
+	Export(ctx context.Context, w io.Writer, format string) error
+
+	AddVariant(ctx context.Context, productID string, req model.VariantRequest) (*model.Variant, error)
+	UpdateVariant(ctx context.Context, productID, variantID string, req model.VariantRequest) (*model.Variant, error)
+	DeleteVariant(ctx context.Context, productID, variantID string) error
 }
 
 type service struct {
-	repo Repository
+	repo       Repository
+	categories CategoryRepository
 }
 
-func NewService(repo Repository) Service {
-	return &service{repo: repo}
+func NewService(repo Repository, categories CategoryRepository) Service {
+	return &service{repo: repo, categories: categories}
 }
 
 func (s *service) Create(ctx context.Context, req model.CreateProductRequest) (*model.Product, error) {
+	ctx, span := tracing.Start(ctx, "ProductService.Create")
+	defer span.End()
+
 	p := &model.Product{
+		SKU:   strings.TrimSpace(req.SKU),
 		Name:  req.Name,
 		Price: req.Price,
 		Stock: req.Stock,
 	}
 
+	// produk baru langsung dijual kecuali diminta draft
+	status := req.Status
+	if status == "" {
+		status = model.ProductStatusActive
+	}
+	if err := s.applyDetails(ctx, p, model.UpdateProductRequest(req), status); err != nil {
+		return nil, err
+	}
+
 	if err := s.repo.Create(ctx, p); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrSKUTaken
+		}
 		return nil, err
 	}
 
 	return p, nil
 }
 
-func (s *service) GetAll(ctx context.Context) ([]model.Product, error) {
-	return s.repo.FindAll(ctx)
+// /products (GET)
+func (s *service) GetAll(ctx context.Context, q model.ListProductsQuery) ([]model.Product, error) {
+	ctx, span := tracing.Start(ctx, "ProductService.GetAll")
+	defer span.End()
+
+	f := model.ProductFilter{
+		Tag:    normalizeTag(q.Tag),
+		Status: model.ProductStatusActive,
+	}
+
+	switch st := model.ProductStatus(strings.ToLower(q.Status)); {
+	case st == "all":
+		f.Status = ""
+	case st.Valid():
+		f.Status = st
+	case st != "":
+		return nil, fmt.Errorf("%w: status %q", ErrInvalidQuery, q.Status)
+	}
+
+	if q.Category != "" {
+		id, err := s.resolveCategory(ctx, q.Category)
+		if err != nil {
+			return nil, err
+		}
+		f.CategoryID = &id
+	}
+
+	return s.repo.FindAll(ctx, f)
 }
 
-func (s *service) GetByID(ctx context.Context, id string) (*model.Product, error) {
-	objID, err := primitive.ObjectIDFromHex(id)
+// resolveCategory accepts a category ID or slug.
+func (s *service) resolveCategory(ctx context.Context, ref string) (primitive.ObjectID, error) {
+	if id, err := primitive.ObjectIDFromHex(ref); err == nil {
+		return id, nil
+	}
+	c, err := s.categories.FindBySlug(ctx, strings.ToLower(ref))
 	if err != nil {
-		return nil, fmt.Errorf("invalid id")
+		return primitive.NilObjectID, fmt.Errorf("%w: unknown category %q", ErrInvalidQuery, ref)
 	}
-	return s.repo.FindByID(ctx, objID)
+	return c.ID, nil
 }
 
-func (s *service) Update(ctx context.Context, id string, req model.UpdateProductRequest) (*model.Product, error) {
+func (s *service) GetByID(ctx context.Context, id string) (*model.Product, error) {
+	ctx, span := tracing.Start(ctx, "ProductService.GetByID")
+	defer span.End()
+
 	objID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return nil, fmt.Errorf("invalid id")
 	}
-	p, err := s.repo.FindByID(ctx, objID)
+	return s.repo.FindByID(ctx, objID)
+}
+
+func (s *service) Update(ctx context.Context, id string, req model.UpdateProductRequest, ifMatch int64) (*model.Product, error) {
+	ctx, span := tracing.Start(ctx, "ProductService.Update")
+	defer span.End()
+
+	p, err := s.loadForWrite(ctx, id, ifMatch)
 	if err != nil {
 		return nil, err
 	}
 
+	// stok yang sedang di-reserve transaksi PENDING tidak boleh hilang
+	if req.Stock < p.Reserved {
+		return nil, fmt.Errorf("%w: stock cannot be lower than reserved stock (%d)", ErrInvalidProduct, p.Reserved)
+	}
+
+	p.SKU = strings.TrimSpace(req.SKU)
 	p.Name = req.Name
 	p.Price = req.Price
 	p.Stock = req.Stock
 
+	status := req.Status
+	if status == "" {
+		status = p.Status
+	}
+	if err := s.applyDetails(ctx, p, req, status); err != nil {
+		return nil, err
+	}
+
 	if err := s.repo.Update(ctx, p); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrSKUTaken
+		}
 		return nil, err
 	}
 	return p, nil
 }
 
+// /products/{id} (PATCH)
+func (s *service) Patch(ctx context.Context, id string, doc patch.Document, ifMatch int64) (*model.Product, error) {
+	ctx, span := tracing.Start(ctx, "ProductService.Patch")
+	defer span.End()
+
+	p, err := s.loadForWrite(ctx, id, ifMatch)
+	if err != nil {
+		return nil, err
+	}
+	if len(doc) == 0 {
+		return p, nil
+	}
+
+	// patch diterapkan ke request berisi nilai sekarang, jadi validasinya sama dengan PUT
+	req, err := patch.Apply(requestFrom(p), doc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidProduct, err)
+	}
+
+	fields := doc.Fields()
+	for _, f := range fields {
+		switch f {
+		case "name":
+			if strings.TrimSpace(req.Name) == "" {
+				return nil, fmt.Errorf("%w: name is required", ErrInvalidProduct)
+			}
+		case "price":
+			if req.Price <= 0 {
+				return nil, fmt.Errorf("%w: price must be > 0", ErrInvalidProduct)
+			}
+		case "stock":
+			if req.Stock < p.Reserved {
+				return nil, fmt.Errorf("%w: stock cannot be lower than reserved stock (%d)", ErrInvalidProduct, p.Reserved)
+			}
+		}
+	}
+
+	p.SKU = strings.TrimSpace(req.SKU)
+	p.Name = strings.TrimSpace(req.Name)
+	p.Price = req.Price
+	p.Stock = req.Stock
+	if err := s.applyDetails(ctx, p, req, req.Status); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.UpdateFields(ctx, p, fields); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrSKUTaken
+		}
+		return nil, err
+	}
+	return p, nil
+}
+
+// loadForWrite loads a product that is about to be changed and checks ifMatch
+// against its version (0 skips the check).
+func (s *service) loadForWrite(ctx context.Context, id string, ifMatch int64) (*model.Product, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id")
+	}
+	p, err := s.repo.FindByID(ctx, objID)
+	if err != nil {
+		return nil, err
+	}
+	if ifMatch != 0 && ifMatch != p.Version {
+		return nil, fmt.Errorf("%w: current version is %d", model.ErrVersionConflict, p.Version)
+	}
+	return p, nil
+}
+
+// requestFrom is the PUT body that would leave p unchanged.
+func requestFrom(p *model.Product) model.UpdateProductRequest {
+	categoryIDs := make([]string, 0, len(p.CategoryIDs))
+	for _, id := range p.CategoryIDs {
+		categoryIDs = append(categoryIDs, id.Hex())
+	}
+	return model.UpdateProductRequest{
+		SKU:         p.SKU,
+		Name:        p.Name,
+		Description: p.Description,
+		CategoryIDs: categoryIDs,
+		Tags:        p.Tags,
+		Images:      p.Images,
+		WeightGrams: p.WeightGrams,
+		Dimensions:  p.Dimensions,
+		Status:      p.Status,
+		Price:       p.Price,
+		Stock:       p.Stock,
+	}
+}
+
+// applyDetails validates and sets the catalog fields shared by create and update.
+func (s *service) applyDetails(ctx context.Context, p *model.Product, req model.UpdateProductRequest, status model.ProductStatus) error {
+	if !status.Valid() {
+		return fmt.Errorf("%w: status must be active, draft or archived", ErrInvalidProduct)
+	}
+	if req.WeightGrams < 0 {
+		return fmt.Errorf("%w: weight_grams must be >= 0", ErrInvalidProduct)
+	}
+	if d := req.Dimensions; d != nil && (d.Length < 0 || d.Width < 0 || d.Height < 0) {
+		return fmt.Errorf("%w: dimensions must be >= 0", ErrInvalidProduct)
+	}
+
+	categoryIDs, err := s.checkCategories(ctx, req.CategoryIDs)
+	if err != nil {
+		return err
+	}
+
+	images := []string{}
+	for _, raw := range req.Images {
+		u, err := url.Parse(strings.TrimSpace(raw))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%w: image %q must be an http(s) URL", ErrInvalidProduct, raw)
+		}
+		images = append(images, u.String())
+	}
+
+	p.Description = strings.TrimSpace(req.Description)
+	p.CategoryIDs = categoryIDs
+	p.Tags = normalizeTags(req.Tags)
+	p.Images = images
+	p.WeightGrams = req.WeightGrams
+	p.Dimensions = req.Dimensions
+	p.Status = status
+	return nil
+}
+
+// checkCategories parses and de-duplicates category IDs and makes sure they all exist.
+func (s *service) checkCategories(ctx context.Context, raw []string) ([]primitive.ObjectID, error) {
+	ids := []primitive.ObjectID{}
+	seen := map[primitive.ObjectID]bool{}
+	for _, v := range raw {
+		id, err := primitive.ObjectIDFromHex(v)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid category id %q", ErrInvalidProduct, v)
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return ids, nil
+	}
+
+	n, err := s.categories.CountByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	if n != int64(len(ids)) {
+		return nil, fmt.Errorf("%w: unknown category in category_ids", ErrInvalidProduct)
+	}
+	return ids, nil
+}
+
+func normalizeTag(t string) string {
+	return strings.ToLower(strings.TrimSpace(t))
+}
+
+// normalizeTags normalizes tags and drops empty and duplicate ones.
+func normalizeTags(raw []string) []string {
+	tags := []string{}
+	seen := map[string]bool{}
+	for _, t := range raw {
+		t = normalizeTag(t)
+		if t != "" && !seen[t] {
+			seen[t] = true
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
 func (s *service) Delete(ctx context.Context, id string) error {
+	ctx, span := tracing.Start(ctx, "ProductService.Delete")
+	defer span.End()
+
 	objID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return fmt.Errorf("invalid id")
@@ -0,0 +1,841 @@
+package product_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+
+	"ecom/model"
+	productsvc "ecom/service/product"
+	"ecom/util/patch"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type fakeProductRepo struct {
+	products []*model.Product
+
+	createErr    error
+	upsertCalls  int
+	beforeUpsert func()
+	lastFilter   model.ProductFilter
+
+	searches      []model.ProductSearchFilter
+	suggestGroups [][]string
+
+	updateCalls   int
+	updateErr     error
+	updatedFields []string
+	variantErr    error
+}
+
+func (f *fakeProductRepo) Create(ctx context.Context, p *model.Product) error {
+	if f.createErr != nil {
+		return f.createErr
+	}
+	p.ID = primitive.NewObjectID()
+	f.products = append(f.products, p)
+	return nil
+}
+
+func (f *fakeProductRepo) FindAll(ctx context.Context, filter model.ProductFilter) ([]model.Product, error) {
+	f.lastFilter = filter
+	out := []model.Product{}
+	for _, p := range f.products {
+		out = append(out, *p)
+	}
+	return out, nil
+}
+
+func (f *fakeProductRepo) FindByID(ctx context.Context, id primitive.ObjectID) (*model.Product, error) {
+	for _, p := range f.products {
+		if p.ID == id {
+			return p, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (f *fakeProductRepo) Update(ctx context.Context, p *model.Product) error {
+	f.updateCalls++
+	if f.updateErr != nil {
+		return f.updateErr
+	}
+	p.Version++
+	return nil
+}
+
+func (f *fakeProductRepo) UpdateFields(ctx context.Context, p *model.Product, fields []string) error {
+	f.updatedFields = fields
+	return f.Update(ctx, p)
+}
+
+func (f *fakeProductRepo) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return nil
+}
+
+func (f *fakeProductRepo) FindBySKU(ctx context.Context, sku string) (*model.Product, error) {
+	for _, p := range f.products {
+		if p.SKU == sku {
+			return p, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (f *fakeProductRepo) UpsertBySKU(ctx context.Context, p *model.Product, fields []string) (bool, error) {
+	f.upsertCalls++
+	if f.beforeUpsert != nil {
+		f.beforeUpsert()
+	}
+	existing, err := f.FindBySKU(ctx, p.SKU)
+	created := err != nil
+	if created {
+		existing = &model.Product{ID: primitive.NewObjectID(), SKU: p.SKU, Status: model.ProductStatusActive, Tags: []string{}}
+	} else if p.Stock < existing.Reserved {
+		return false, model.ErrStockBelowReserved
+	}
+	existing.Name, existing.Price, existing.Stock = p.Name, p.Price, p.Stock
+	for _, name := range fields {
+		switch name {
+		case "description":
+			existing.Description = p.Description
+		case "status":
+			existing.Status = p.Status
+		case "category_ids":
+			existing.CategoryIDs = p.CategoryIDs
+		case "tags":
+			existing.Tags = p.Tags
+		}
+	}
+	if created {
+		f.products = append(f.products, existing)
+	}
+	return created, nil
+}
+
+func (f *fakeProductRepo) Stream(ctx context.Context, fn func(p *model.Product) error) error {
+	for _, p := range f.products {
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fakeProductRepo) AddVariant(ctx context.Context, p *model.Product, v *model.Variant) error {
+	if f.variantErr != nil {
+		return f.variantErr
+	}
+	v.ID = primitive.NewObjectID()
+	p.Variants = append(p.Variants, *v)
+	p.Version++
+	return nil
+}
+
+func (f *fakeProductRepo) UpdateVariant(ctx context.Context, p *model.Product, v *model.Variant) error {
+	if f.variantErr != nil {
+		return f.variantErr
+	}
+	existing := p.FindVariant(v.ID)
+	if existing == nil {
+		return model.ErrVersionConflict
+	}
+	*existing = *v
+	p.Version++
+	return nil
+}
+
+func (f *fakeProductRepo) RemoveVariant(ctx context.Context, productID, variantID primitive.ObjectID) (bool, error) {
+	p, err := f.FindByID(ctx, productID)
+	if err != nil {
+		return false, nil
+	}
+	for i, v := range p.Variants {
+		if v.ID == variantID && v.Reserved == 0 {
+			p.Variants = append(p.Variants[:i], p.Variants[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Search matches products whose name contains every word of the text.
+func (f *fakeProductRepo) Search(ctx context.Context, filter model.ProductSearchFilter) (*model.ProductSearchResult, error) {
+	f.searches = append(f.searches, filter)
+	res := &model.ProductSearchResult{Items: []model.ProductSearchHit{}}
+	for _, p := range f.products {
+		name := strings.ToLower(p.Name)
+		hit := true
+		for _, w := range strings.Fields(strings.ToLower(filter.Text)) {
+			hit = hit && strings.Contains(name, w)
+		}
+		if hit {
+			res.Items = append(res.Items, model.ProductSearchHit{Product: *p, Score: 1})
+		}
+	}
+	res.Total = int64(len(res.Items))
+	return res, nil
+}
+
+func (f *fakeProductRepo) SuggestWords(ctx context.Context, prefix string) ([]string, error) {
+	out := []string{}
+	seen := map[string]bool{}
+	for _, p := range f.products {
+		for _, w := range model.SearchWords(p.Name, p.Tags) {
+			if strings.HasPrefix(w, prefix) && !seen[w] {
+				seen[w] = true
+				out = append(out, w)
+			}
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeProductRepo) SuggestCandidates(ctx context.Context, groups [][]string) ([]model.Product, error) {
+	f.suggestGroups = groups
+	out := []model.Product{}
+	for _, p := range f.products {
+		words := model.SearchWords(p.Name, p.Tags)
+		match := true
+		for _, g := range groups {
+			match = match && slices.ContainsFunc(g, func(w string) bool { return slices.Contains(words, w) })
+		}
+		if match {
+			out = append(out, *p)
+		}
+	}
+	return out, nil
+}
+
+type fakeCategoryRepo struct {
+	categories []model.Category
+}
+
+func (f *fakeCategoryRepo) FindBySlug(ctx context.Context, slug string) (*model.Category, error) {
+	for i := range f.categories {
+		if f.categories[i].Slug == slug {
+			return &f.categories[i], nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (f *fakeCategoryRepo) CountByIDs(ctx context.Context, ids []primitive.ObjectID) (int64, error) {
+	var n int64
+	for _, c := range f.categories {
+		for _, id := range ids {
+			if c.ID == id {
+				n++
+			}
+		}
+	}
+	return n, nil
+}
+
+func catalog() *fakeProductRepo {
+	return &fakeProductRepo{products: []*model.Product{
+		{ID: primitive.NewObjectID(), SKU: "BALL-01", Name: "Bola Futsal", Price: 250_000, Stock: 10, Reserved: 4},
+	}}
+}
+
+func TestImport_CSVUpsertAndRowErrors(t *testing.T) {
+	repo := catalog()
+	svc := productsvc.NewService(repo, &fakeCategoryRepo{})
+
+	csv := strings.Join([]string{
+		"sku,name,price,stock",
+		"BALL-01,Bola Futsal Pro,275000,12",
+		"NET-01,Jaring Gawang,150000,5",
+		",Tanpa SKU,1000,1",
+		"SOCK-01,Kaos Kaki,abc,3",
+		"NET-01,Jaring Lagi,150000,5",
+		"GLOVE-01,Sarung Tangan,0,3",
+	}, "\n")
+
+	res, err := svc.Import(context.Background(), strings.NewReader(csv), productsvc.FormatCSV, false)
+	if err != nil {
+		t.Fatalf("Import returned error: %v", err)
+	}
+
+	if res.Rows != 6 || res.Created != 1 || res.Updated != 1 || res.Failed != 4 {
+		t.Fatalf("expected 6 rows: 1 created, 1 updated, 4 failed; got %+v", res)
+	}
+	wantLines := []int{4, 5, 6, 7}
+	for i, e := range res.Errors {
+		if e.Line != wantLines[i] {
+			t.Fatalf("expected errors on lines %v, got %+v", wantLines, res.Errors)
+		}
+	}
+	if !strings.Contains(res.Errors[2].Error, "line 3") {
+		t.Fatalf("expected duplicate sku to point at line 3, got %q", res.Errors[2].Error)
+	}
+
+	ball, _ := repo.FindBySKU(context.Background(), "BALL-01")
+	if ball.Name != "Bola Futsal Pro" || ball.Stock != 12 || ball.Reserved != 4 {
+		t.Fatalf("expected BALL-01 updated and reserved untouched, got %+v", ball)
+	}
+}
+
+func TestImport_DryRunWritesNothing(t *testing.T) {
+	repo := catalog()
+	svc := productsvc.NewService(repo, &fakeCategoryRepo{})
+
+	ndjson := `{"sku":"BALL-01","name":"Bola","price":250000,"stock":2}
+{"sku":"NET-01","name":"Jaring","price":150000,"stock":5}
+
+{"sku":"BAD","name":"Rusak","price":"mahal"}
+`
+	res, err := svc.Import(context.Background(), strings.NewReader(ndjson), productsvc.FormatNDJSON, true)
+	if err != nil {
+		t.Fatalf("Import returned error: %v", err)
+	}
+	if !res.DryRun || res.Created != 1 || res.Failed != 2 || res.Updated != 0 {
+		t.Fatalf("expected dry run: 1 would be created, 2 failed, got %+v", res)
+	}
+	// stok 2 < reserved 4
+	if res.Errors[0].Line != 1 || !strings.Contains(res.Errors[0].Error, "reserved") {
+		t.Fatalf("expected reserved stock error on line 1, got %+v", res.Errors[0])
+	}
+	if res.Errors[1].Line != 4 {
+		t.Fatalf("expected json error on line 4, got %+v", res.Errors[1])
+	}
+	if repo.upsertCalls != 0 {
+		t.Fatalf("expected no writes in dry run, got %d upserts", repo.upsertCalls)
+	}
+}
+
+func TestImport_InvalidFile(t *testing.T) {
+	svc := productsvc.NewService(catalog(), &fakeCategoryRepo{})
+
+	if _, err := svc.Import(context.Background(), strings.NewReader("sku,name,price\nA,B,1"), productsvc.FormatCSV, false); !errors.Is(err, productsvc.ErrInvalidImport) {
+		t.Fatalf("expected ErrInvalidImport for missing column, got %v", err)
+	}
+	if _, err := svc.Import(context.Background(), strings.NewReader(""), "xlsx", false); !errors.Is(err, productsvc.ErrUnsupportedFormat) {
+		t.Fatalf("expected ErrUnsupportedFormat, got %v", err)
+	}
+}
+
+func TestImport_ReservedBetweenCheckAndWrite(t *testing.T) {
+	repo := catalog()
+	// checkout me-reserve stok setelah import membaca produk
+	repo.beforeUpsert = func() { repo.products[0].Reserved = 8 }
+	svc := productsvc.NewService(repo, &fakeCategoryRepo{})
+
+	csv := "sku,name,price,stock\nBALL-01,Bola Futsal,250000,6\nNET-01,Jaring,150000,5\n"
+	res, err := svc.Import(context.Background(), strings.NewReader(csv), productsvc.FormatCSV, false)
+	if err != nil {
+		t.Fatalf("Import returned error: %v", err)
+	}
+	if res.Failed != 1 || res.Created != 1 || res.Updated != 0 {
+		t.Fatalf("expected BALL-01 failed and NET-01 created, got %+v", res)
+	}
+	if res.Errors[0].Line != 2 || !strings.Contains(res.Errors[0].Error, "reserved") {
+		t.Fatalf("expected a reserved stock error on line 2, got %+v", res.Errors)
+	}
+	if ball := repo.products[0]; ball.Stock != 10 || ball.Reserved != 8 {
+		t.Fatalf("expected BALL-01 untouched, got %+v", ball)
+	}
+}
+
+func TestImport_TooManyRowsWritesNothing(t *testing.T) {
+	repo := catalog()
+	svc := productsvc.NewService(repo, &fakeCategoryRepo{})
+
+	var csv strings.Builder
+	csv.WriteString("sku,name,price,stock\n")
+	for i := 0; i < 10_001; i++ {
+		fmt.Fprintf(&csv, "SKU-%05d,Produk %d,1000,1\n", i, i)
+	}
+
+	res, err := svc.Import(context.Background(), strings.NewReader(csv.String()), productsvc.FormatCSV, false)
+	if !errors.Is(err, productsvc.ErrInvalidImport) || res != nil {
+		t.Fatalf("expected ErrInvalidImport for 10001 rows, got %+v (%v)", res, err)
+	}
+	if repo.upsertCalls != 0 || len(repo.products) != 1 {
+		t.Fatalf("expected nothing written, got %d upserts", repo.upsertCalls)
+	}
+}
+
+func TestExport_RoundTripsThroughImport(t *testing.T) {
+	sport := model.Category{ID: primitive.NewObjectID(), Name: "Olahraga", Slug: "olahraga"}
+	categories := &fakeCategoryRepo{categories: []model.Category{sport}}
+	repo := catalog()
+	ball := repo.products[0]
+	ball.Description = "Bola futsal, ukuran 4"
+	ball.Status = model.ProductStatusDraft
+	ball.CategoryIDs = []primitive.ObjectID{sport.ID}
+	ball.Tags = []string{"futsal", "indoor"}
+	svc := productsvc.NewService(repo, categories)
+
+	var buf bytes.Buffer
+	if err := svc.Export(context.Background(), &buf, productsvc.FormatCSV); err != nil {
+		t.Fatalf("Export returned error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	want := ball.ID.Hex() + `,BALL-01,Bola Futsal,"Bola futsal, ukuran 4",draft,` + sport.ID.Hex() + ",futsal|indoor,250000,10,4,"
+	if len(lines) != 2 || !strings.HasPrefix(lines[1], want) {
+		t.Fatalf("unexpected csv export:\n%s", buf.String())
+	}
+	csvExport := buf.String()
+
+	buf.Reset()
+	if err := svc.Export(context.Background(), &buf, productsvc.FormatNDJSON); err != nil {
+		t.Fatalf("Export returned error: %v", err)
+	}
+	if !strings.Contains(buf.String(), `"sku":"BALL-01"`) {
+		t.Fatalf("unexpected ndjson export: %s", buf.String())
+	}
+	ndjsonExport := buf.String()
+
+	for format, export := range map[string]string{productsvc.FormatCSV: csvExport, productsvc.FormatNDJSON: ndjsonExport} {
+		t.Run(format, func(t *testing.T) {
+			// katalog kosong: export dibuat ulang lewat import
+			empty := &fakeProductRepo{}
+			res, err := productsvc.NewService(empty, categories).Import(context.Background(), strings.NewReader(export), format, false)
+			if err != nil || res.Created != 1 || res.Failed != 0 {
+				t.Fatalf("expected export to import cleanly, got %+v (%v)", res, err)
+			}
+			got := empty.products[0]
+			if got.Description != ball.Description || got.Status != ball.Status ||
+				fmt.Sprint(got.CategoryIDs) != fmt.Sprint(ball.CategoryIDs) || fmt.Sprint(got.Tags) != fmt.Sprint(ball.Tags) {
+				t.Fatalf("expected catalog fields to round-trip, got %+v", got)
+			}
+		})
+	}
+}
+
+// Kolom katalog yang tidak ada di file tidak mengubah nilai tersimpan.
+func TestImport_MissingCatalogColumnsAreKept(t *testing.T) {
+	repo := catalog()
+	ball := repo.products[0]
+	ball.Status = model.ProductStatusDraft
+	ball.Tags = []string{"futsal"}
+	svc := productsvc.NewService(repo, &fakeCategoryRepo{})
+
+	csv := "sku,name,price,stock,tags\nBALL-01,Bola Futsal,250000,10, Indoor | futsal |\n"
+	res, err := svc.Import(context.Background(), strings.NewReader(csv), productsvc.FormatCSV, false)
+	if err != nil || res.Updated != 1 {
+		t.Fatalf("expected BALL-01 updated, got %+v (%v)", res, err)
+	}
+	if ball.Status != model.ProductStatusDraft || fmt.Sprint(ball.Tags) != "[indoor futsal]" {
+		t.Fatalf("expected status kept and tags normalized, got status %q tags %v", ball.Status, ball.Tags)
+	}
+
+	ndjson := `{"sku":"BALL-01","name":"Bola Futsal","price":250000,"stock":10,"status":"sold"}
+{"sku":"NET-01","name":"Jaring","price":150000,"stock":5,"category_ids":["` + primitive.NewObjectID().Hex() + `"]}
+`
+	res, err = svc.Import(context.Background(), strings.NewReader(ndjson), productsvc.FormatNDJSON, false)
+	if err != nil || res.Failed != 2 {
+		t.Fatalf("expected invalid status and unknown category rejected, got %+v (%v)", res, err)
+	}
+	if fmt.Sprint(ball.Tags) != "[indoor futsal]" {
+		t.Fatalf("expected tags kept, got %v", ball.Tags)
+	}
+}
+
+func TestCreate_DuplicateSKU(t *testing.T) {
+	repo := &fakeProductRepo{
+		createErr: mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000, Message: "E11000 duplicate key"}}},
+	}
+	svc := productsvc.NewService(repo, &fakeCategoryRepo{})
+
+	_, err := svc.Create(context.Background(), model.CreateProductRequest{SKU: "BALL-01", Name: "Bola", Price: 1, Stock: 1})
+	if !errors.Is(err, productsvc.ErrSKUTaken) {
+		t.Fatalf("expected ErrSKUTaken, got %v", err)
+	}
+}
+
+func TestCreate_CatalogFields(t *testing.T) {
+	sport := model.Category{ID: primitive.NewObjectID(), Name: "Olahraga", Slug: "olahraga"}
+	repo := &fakeProductRepo{}
+	svc := productsvc.NewService(repo, &fakeCategoryRepo{categories: []model.Category{sport}})
+
+	p, err := svc.Create(context.Background(), model.CreateProductRequest{
+		SKU:         " BALL-02 ",
+		Name:        "Bola Voli",
+		Description: "  Bola voli ukuran 5 ",
+		CategoryIDs: []string{sport.ID.Hex(), sport.ID.Hex()},
+		Tags:        []string{"Outdoor", " outdoor", "", "Tim"},
+		Images:      []string{"https://cdn.example.com/ball.jpg"},
+		WeightGrams: 270,
+		Dimensions:  &model.Dimensions{Length: 21, Width: 21, Height: 21},
+		Price:       150_000,
+		Stock:       5,
+	})
+	if err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+	if p.Status != model.ProductStatusActive {
+		t.Fatalf("expected default status active, got %q", p.Status)
+	}
+	if p.SKU != "BALL-02" || p.Description != "Bola voli ukuran 5" {
+		t.Fatalf("expected trimmed sku/description, got %q / %q", p.SKU, p.Description)
+	}
+	if len(p.CategoryIDs) != 1 || len(p.Tags) != 2 || p.Tags[0] != "outdoor" || p.Tags[1] != "tim" {
+		t.Fatalf("expected de-duplicated categories and normalized tags, got %v / %v", p.CategoryIDs, p.Tags)
+	}
+}
+
+func TestCreate_InvalidCatalogFields(t *testing.T) {
+	svc := productsvc.NewService(&fakeProductRepo{}, &fakeCategoryRepo{})
+
+	for name, req := range map[string]model.CreateProductRequest{
+		"unknown category": {CategoryIDs: []string{primitive.NewObjectID().Hex()}},
+		"bad category id":  {CategoryIDs: []string{"olahraga"}},
+		"bad status":       {Status: "deleted"},
+		"bad image":        {Images: []string{"ftp://example.com/a.jpg"}},
+		"negative weight":  {WeightGrams: -1},
+	} {
+		req.Name, req.Price, req.Stock = "Bola", 1, 1
+		if _, err := svc.Create(context.Background(), req); !errors.Is(err, productsvc.ErrInvalidProduct) {
+			t.Fatalf("%s: expected ErrInvalidProduct, got %v", name, err)
+		}
+	}
+}
+
+func TestGetAll_Filters(t *testing.T) {
+	sport := model.Category{ID: primitive.NewObjectID(), Name: "Olahraga", Slug: "olahraga"}
+	repo := &fakeProductRepo{}
+	svc := productsvc.NewService(repo, &fakeCategoryRepo{categories: []model.Category{sport}})
+
+	if _, err := svc.GetAll(context.Background(), model.ListProductsQuery{}); err != nil {
+		t.Fatalf("GetAll returned error: %v", err)
+	}
+	if repo.lastFilter.Status != model.ProductStatusActive {
+		t.Fatalf("expected only active products by default, got %+v", repo.lastFilter)
+	}
+
+	if _, err := svc.GetAll(context.Background(), model.ListProductsQuery{Category: "olahraga", Tag: " Outdoor", Status: "all"}); err != nil {
+		t.Fatalf("GetAll returned error: %v", err)
+	}
+	f := repo.lastFilter
+	if f.Status != "" || f.Tag != "outdoor" || f.CategoryID == nil || *f.CategoryID != sport.ID {
+		t.Fatalf("expected slug resolved, tag normalized and no status filter, got %+v", f)
+	}
+
+	for _, q := range []model.ListProductsQuery{{Status: "sold"}, {Category: "tidak-ada"}} {
+		if _, err := svc.GetAll(context.Background(), q); !errors.Is(err, productsvc.ErrInvalidQuery) {
+			t.Fatalf("expected ErrInvalidQuery for %+v, got %v", q, err)
+		}
+	}
+}
+
+func TestVariants_AddUpdateDelete(t *testing.T) {
+	repo := catalog()
+	svc := productsvc.NewService(repo, &fakeCategoryRepo{})
+	productID := repo.products[0].ID.Hex()
+
+	price := 300_000.0
+	m, err := svc.AddVariant(context.Background(), productID, model.VariantRequest{
+		SKU:     " BALL-01-M ",
+		Options: map[string]string{"Size": " M "},
+		Stock:   3,
+	})
+	if err != nil {
+		t.Fatalf("AddVariant returned error: %v", err)
+	}
+	if m.SKU != "BALL-01-M" || m.Options["size"] != "M" || m.Price != nil {
+		t.Fatalf("expected normalized variant without price override, got %+v", m)
+	}
+
+	l, err := svc.AddVariant(context.Background(), productID, model.VariantRequest{
+		SKU:     "BALL-01-L",
+		Options: map[string]string{"size": "L"},
+		Price:   &price,
+		Stock:   2,
+	})
+	if err != nil {
+		t.Fatalf("AddVariant returned error: %v", err)
+	}
+	if p := repo.products[0]; len(p.Variants) != 2 || p.PriceOf(p.FindVariant(l.ID)) != 300_000 {
+		t.Fatalf("expected 2 variants with L priced 300000, got %+v", p.Variants)
+	}
+
+	repo.products[0].FindVariant(l.ID).Reserved = 2
+	if _, err := svc.UpdateVariant(context.Background(), productID, l.ID.Hex(), model.VariantRequest{
+		SKU: "BALL-01-L", Options: map[string]string{"size": "L"}, Stock: 1,
+	}); !errors.Is(err, productsvc.ErrVariantInUse) {
+		t.Fatalf("expected ErrVariantInUse when stock drops below reserved, got %v", err)
+	}
+	if err := svc.DeleteVariant(context.Background(), productID, l.ID.Hex()); !errors.Is(err, productsvc.ErrVariantInUse) {
+		t.Fatalf("expected ErrVariantInUse deleting a reserved variant, got %v", err)
+	}
+
+	updated, err := svc.UpdateVariant(context.Background(), productID, m.ID.Hex(), model.VariantRequest{
+		SKU: "BALL-01-M", Options: map[string]string{"size": "M"}, Stock: 7,
+	})
+	if err != nil || updated.Stock != 7 {
+		t.Fatalf("expected variant stock updated to 7, got %+v (%v)", updated, err)
+	}
+
+	if err := svc.DeleteVariant(context.Background(), productID, m.ID.Hex()); err != nil {
+		t.Fatalf("DeleteVariant returned error: %v", err)
+	}
+	if err := svc.DeleteVariant(context.Background(), productID, m.ID.Hex()); !errors.Is(err, productsvc.ErrVariantNotFound) {
+		t.Fatalf("expected ErrVariantNotFound for a deleted variant, got %v", err)
+	}
+}
+
+func TestAddVariant_Invalid(t *testing.T) {
+	repo := catalog()
+	repo.products[0].Variants = []model.Variant{
+		{ID: primitive.NewObjectID(), SKU: "BALL-01-M", Options: map[string]string{"size": "M"}},
+	}
+	svc := productsvc.NewService(repo, &fakeCategoryRepo{})
+	productID := repo.products[0].ID.Hex()
+	zero := 0.0
+
+	cases := map[string]struct {
+		req  model.VariantRequest
+		want error
+	}{
+		"missing sku":    {model.VariantRequest{Options: map[string]string{"size": "L"}}, productsvc.ErrInvalidProduct},
+		"no options":     {model.VariantRequest{SKU: "X"}, productsvc.ErrInvalidProduct},
+		"empty value":    {model.VariantRequest{SKU: "X", Options: map[string]string{"size": " "}}, productsvc.ErrInvalidProduct},
+		"zero price":     {model.VariantRequest{SKU: "X", Options: map[string]string{"size": "L"}, Price: &zero}, productsvc.ErrInvalidProduct},
+		"negative stock": {model.VariantRequest{SKU: "X", Options: map[string]string{"size": "L"}, Stock: -1}, productsvc.ErrInvalidProduct},
+		"same options":   {model.VariantRequest{SKU: "X", Options: map[string]string{"Size": "m"}}, productsvc.ErrInvalidProduct},
+		"same sku":       {model.VariantRequest{SKU: "ball-01-m", Options: map[string]string{"size": "L"}}, productsvc.ErrSKUTaken},
+	}
+	for name, tc := range cases {
+		if _, err := svc.AddVariant(context.Background(), productID, tc.req); !errors.Is(err, tc.want) {
+			t.Errorf("%s: expected %v, got %v", name, tc.want, err)
+		}
+	}
+
+	if _, err := svc.AddVariant(context.Background(), primitive.NewObjectID().Hex(), model.VariantRequest{
+		SKU: "X", Options: map[string]string{"size": "L"},
+	}); !errors.Is(err, productsvc.ErrProductNotFound) {
+		t.Fatalf("expected ErrProductNotFound, got %v", err)
+	}
+}
+
+// Produk berubah di antara cek duplikat dan write: repository menolak dengan
+// ErrVersionConflict, service meneruskannya apa adanya.
+func TestVariants_VersionConflict(t *testing.T) {
+	repo := catalog()
+	svc := productsvc.NewService(repo, &fakeCategoryRepo{})
+	productID := repo.products[0].ID.Hex()
+
+	m, err := svc.AddVariant(context.Background(), productID, model.VariantRequest{
+		SKU: "BALL-01-M", Options: map[string]string{"size": "M"}, Stock: 3,
+	})
+	if err != nil {
+		t.Fatalf("AddVariant returned error: %v", err)
+	}
+	if repo.products[0].Version != 1 {
+		t.Fatalf("expected the product version bumped by the variant write, got %d", repo.products[0].Version)
+	}
+
+	repo.variantErr = model.ErrVersionConflict
+	if _, err := svc.AddVariant(context.Background(), productID, model.VariantRequest{
+		SKU: "BALL-01-L", Options: map[string]string{"size": "L"}, Stock: 3,
+	}); !errors.Is(err, model.ErrVersionConflict) {
+		t.Fatalf("expected ErrVersionConflict from AddVariant, got %v", err)
+	}
+	if _, err := svc.UpdateVariant(context.Background(), productID, m.ID.Hex(), model.VariantRequest{
+		SKU: "BALL-01-M", Options: map[string]string{"size": "M"}, Stock: 5,
+	}); !errors.Is(err, model.ErrVersionConflict) {
+		t.Fatalf("expected ErrVersionConflict from UpdateVariant, got %v", err)
+	}
+}
+
+func searchCatalog() *fakeProductRepo {
+	return &fakeProductRepo{products: []*model.Product{
+		{ID: primitive.NewObjectID(), Name: "Sepatu Adidas Predator", Tags: []string{"sepatu", "futsal"}, Price: 900_000},
+		{ID: primitive.NewObjectID(), Name: "Kaos Adidas", Tags: []string{"apparel"}, Price: 250_000},
+		{ID: primitive.NewObjectID(), Name: "Bola Futsal", Tags: []string{"bola"}, Price: 300_000},
+	}}
+}
+
+func TestSearch_DefaultsAndValidation(t *testing.T) {
+	repo := searchCatalog()
+	svc := productsvc.NewService(repo, &fakeCategoryRepo{})
+
+	res, err := svc.Search(context.Background(), model.SearchProductsQuery{Q: " adidas "})
+	if err != nil {
+		t.Fatalf("Search returned error: %v", err)
+	}
+	if res.Total != 2 || res.Query != "adidas" || res.CorrectedQuery != "" {
+		t.Fatalf("expected 2 hits for adidas without correction, got %+v", res)
+	}
+	f := repo.searches[0]
+	if f.Sort != model.SearchSortRelevance || f.Limit != 20 || len(f.PriceBoundaries) == 0 {
+		t.Fatalf("expected relevance sort, limit 20 and price boundaries, got %+v", f)
+	}
+
+	for name, q := range map[string]model.SearchProductsQuery{
+		"empty q":        {Q: " "},
+		"unknown sort":   {Q: "bola", Sort: "cheapest"},
+		"min over max":   {Q: "bola", MinPrice: 500, MaxPrice: 100},
+		"limit too high": {Q: "bola", Limit: 500},
+		"bad category":   {Q: "bola", Category: "no-such-category"},
+	} {
+		if _, err := svc.Search(context.Background(), q); !errors.Is(err, productsvc.ErrInvalidQuery) {
+			t.Errorf("%s: expected ErrInvalidQuery, got %v", name, err)
+		}
+	}
+}
+
+func TestSearch_CorrectsTypos(t *testing.T) {
+	repo := searchCatalog()
+	svc := productsvc.NewService(repo, &fakeCategoryRepo{})
+
+	res, err := svc.Search(context.Background(), model.SearchProductsQuery{Q: "sepatu addidas"})
+	if err != nil {
+		t.Fatalf("Search returned error: %v", err)
+	}
+	if res.CorrectedQuery != "sepatu adidas" || res.Total != 1 || res.Query != "sepatu addidas" {
+		t.Fatalf("expected results for corrected query \"sepatu adidas\", got %+v", res)
+	}
+}
+
+func TestSuggest_TypoTolerantPrefix(t *testing.T) {
+	svc := productsvc.NewService(searchCatalog(), &fakeCategoryRepo{})
+
+	cases := map[string][]string{
+		"adi":         {"Kaos Adidas", "Sepatu Adidas Predator"},
+		"addid":       {"Kaos Adidas", "Sepatu Adidas Predator"},
+		"sepatu pred": {"Sepatu Adidas Predator"},
+		"sepatu prd":  {},
+		"futs":        {"Bola Futsal", "Sepatu Adidas Predator"},
+		"a":           {},
+	}
+	for q, want := range cases {
+		got, err := svc.Suggest(context.Background(), q, 0)
+		if err != nil {
+			t.Fatalf("%q: Suggest returned error: %v", q, err)
+		}
+		names := []string{}
+		for _, s := range got {
+			names = append(names, s.Name)
+		}
+		if strings.Join(names, "|") != strings.Join(want, "|") {
+			t.Errorf("%q: expected %v, got %v", q, want, names)
+		}
+	}
+}
+
+// Kandidat dicari lewat kata katalog yang cocok, bukan regex pada nama.
+func TestSuggest_CandidatesByCatalogWords(t *testing.T) {
+	repo := searchCatalog()
+	svc := productsvc.NewService(repo, &fakeCategoryRepo{})
+
+	if _, err := svc.Suggest(context.Background(), "sepatu addid", 0); err != nil {
+		t.Fatalf("Suggest returned error: %v", err)
+	}
+	want := [][]string{{"adidas"}, {"sepatu"}}
+	if fmt.Sprint(repo.suggestGroups) != fmt.Sprint(want) {
+		t.Fatalf("expected candidate groups %v, got %v", want, repo.suggestGroups)
+	}
+
+	repo.suggestGroups = nil
+	got, err := svc.Suggest(context.Background(), "zebra", 0)
+	if err != nil || len(got) != 0 || repo.suggestGroups != nil {
+		t.Fatalf("expected no candidate lookup for a word not in the catalog, got %v, %v, groups %v", got, err, repo.suggestGroups)
+	}
+}
+
+func TestUpdate_VersionCheck(t *testing.T) {
+	repo := catalog()
+	repo.products[0].Version = 5
+	repo.products[0].Status = model.ProductStatusActive
+	svc := productsvc.NewService(repo, &fakeCategoryRepo{})
+	id := repo.products[0].ID.Hex()
+	req := model.UpdateProductRequest{SKU: "BALL-01", Name: "Bola Futsal", Price: 260_000, Stock: 10}
+
+	if _, err := svc.Update(context.Background(), id, req, 4); !errors.Is(err, model.ErrVersionConflict) {
+		t.Fatalf("expected ErrVersionConflict for stale If-Match, got %v", err)
+	}
+	if repo.updateCalls != 0 {
+		t.Fatal("expected no write for a stale version")
+	}
+
+	repo.updateErr = model.ErrVersionConflict
+	if _, err := svc.Update(context.Background(), id, req, 0); !errors.Is(err, model.ErrVersionConflict) {
+		t.Fatalf("expected ErrVersionConflict from the repository, got %v", err)
+	}
+
+	repo.updateErr = nil
+	p, err := svc.Update(context.Background(), id, req, 5)
+	if err != nil {
+		t.Fatalf("expected update with current version to succeed, got %v", err)
+	}
+	if p.Version != 6 || p.Price != 260_000 {
+		t.Fatalf("expected version 6 with new price, got version %d price %v", p.Version, p.Price)
+	}
+}
+
+func mustPatch(t *testing.T, body string) patch.Document {
+	t.Helper()
+	doc, err := patch.Decode(strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("decode patch %s: %v", body, err)
+	}
+	return doc
+}
+
+func TestPatch_OnlyGivenFields(t *testing.T) {
+	repo := catalog()
+	p := repo.products[0]
+	p.Status = model.ProductStatusActive
+	p.Description = "Bola ukuran 4"
+	p.Dimensions = &model.Dimensions{Length: 20, Width: 20, Height: 20}
+	svc := productsvc.NewService(repo, &fakeCategoryRepo{})
+
+	got, err := svc.Patch(context.Background(), p.ID.Hex(),
+		mustPatch(t, `{"price": 275000, "description": null, "dimensions": {"height": 25}}`), 0)
+	if err != nil {
+		t.Fatalf("Patch returned error: %v", err)
+	}
+
+	sort.Strings(repo.updatedFields)
+	if strings.Join(repo.updatedFields, ",") != "description,dimensions,price" {
+		t.Fatalf("expected only description, dimensions and price to be saved, got %v", repo.updatedFields)
+	}
+	if got.Price != 275_000 || got.Stock != 10 || got.Name != "Bola Futsal" {
+		t.Fatalf("expected new price with stock and name untouched, got %+v", got)
+	}
+	if got.Description != "" {
+		t.Fatalf("expected null to clear description, got %q", got.Description)
+	}
+	if d := got.Dimensions; d == nil || d.Length != 20 || d.Height != 25 {
+		t.Fatalf("expected dimensions merged (length 20, height 25), got %+v", d)
+	}
+}
+
+func TestPatch_Invalid(t *testing.T) {
+	repo := catalog()
+	repo.products[0].Status = model.ProductStatusActive
+	svc := productsvc.NewService(repo, &fakeCategoryRepo{})
+	id := repo.products[0].ID.Hex()
+
+	for _, body := range []string{
+		`{"price": 0}`,
+		`{"price": "murah"}`,
+		`{"name": null}`,
+		`{"stock": 3}`, // reserved 4
+		`{"status": null}`,
+		`{"status": "sold"}`,
+		`{"reserved": 0}`,
+		`{"version": 9}`,
+	} {
+		if _, err := svc.Patch(context.Background(), id, mustPatch(t, body), 0); !errors.Is(err, productsvc.ErrInvalidProduct) {
+			t.Errorf("%s: expected ErrInvalidProduct, got %v", body, err)
+		}
+	}
+	if repo.updateCalls != 0 {
+		t.Fatalf("expected no writes for invalid patches, got %d", repo.updateCalls)
+	}
+
+	if _, err := patch.Decode(strings.NewReader(`[{"op": "replace"}]`)); !errors.Is(err, patch.ErrNotObject) {
+		t.Fatalf("expected ErrNotObject for a JSON Patch array, got %v", err)
+	}
+}
@@ -0,0 +1,336 @@
+package product
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"ecom/model"
+	"ecom/util/tracing"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+
+	defaultSuggestLimit = 10
+	maxSuggestLimit     = 20
+	minSuggestLength    = 2
+)
+
+// searchPriceRanges are the lower bounds (IDR) of the price range facet.
+var searchPriceRanges = []float64{0, 50_000, 100_000, 250_000, 500_000, 1_000_000, 5_000_000}
+
+// /products/search (GET)
+func (s *service) Search(ctx context.Context, q model.SearchProductsQuery) (*model.ProductSearchResult, error) {
+	ctx, span := tracing.Start(ctx, "ProductService.Search")
+	defer span.End()
+
+	text := strings.TrimSpace(q.Q)
+	if text == "" {
+		return nil, fmt.Errorf("%w: q is required", ErrInvalidQuery)
+	}
+
+	f := model.ProductSearchFilter{
+		Text:            text,
+		MinPrice:        q.MinPrice,
+		MaxPrice:        q.MaxPrice,
+		Sort:            q.Sort,
+		Skip:            q.Offset,
+		Limit:           q.Limit,
+		PriceBoundaries: searchPriceRanges,
+	}
+
+	switch f.Sort {
+	case "":
+		f.Sort = model.SearchSortRelevance
+	case model.SearchSortRelevance, model.SearchSortPriceAsc, model.SearchSortPriceDesc, model.SearchSortNewest:
+	default:
+		return nil, fmt.Errorf("%w: sort must be relevance, price_asc, price_desc or newest", ErrInvalidQuery)
+	}
+	if f.MinPrice < 0 || f.MaxPrice < 0 || (f.MaxPrice > 0 && f.MinPrice > f.MaxPrice) {
+		return nil, fmt.Errorf("%w: invalid price range", ErrInvalidQuery)
+	}
+	if f.Skip < 0 || f.Limit < 0 || f.Limit > maxSearchLimit {
+		return nil, fmt.Errorf("%w: limit must be 1-%d and offset >= 0", ErrInvalidQuery, maxSearchLimit)
+	}
+	if f.Limit == 0 {
+		f.Limit = defaultSearchLimit
+	}
+
+	if q.Category != "" {
+		id, err := s.resolveCategory(ctx, q.Category)
+		if err != nil {
+			return nil, err
+		}
+		f.CategoryID = &id
+	}
+
+	res, err := s.repo.Search(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+
+	// tidak ada hasil: coba lagi dengan query yang typo-nya sudah dikoreksi
+	if res.Total == 0 {
+		corrected, err := s.correctQuery(ctx, text)
+		if err != nil {
+			return nil, err
+		}
+		if corrected != "" {
+			f.Text = corrected
+			retry, err := s.repo.Search(ctx, f)
+			if err != nil {
+				return nil, err
+			}
+			if retry.Total > 0 {
+				res = retry
+				res.CorrectedQuery = corrected
+			}
+		}
+	}
+
+	res.Query = text
+	return res, nil
+}
+
+// /products/search/suggest (GET)
+//
+// Suggest matches the last word of q as a prefix and the words before it as
+// whole words, allowing a typo or two depending on word length. Products
+// with fewer typos come first. Catalog words are looked up by their first
+// letter, so the first letter of every word has to be right.
+func (s *service) Suggest(ctx context.Context, q string, limit int) ([]model.ProductSuggestion, error) {
+	ctx, span := tracing.Start(ctx, "ProductService.Suggest")
+	defer span.End()
+
+	if limit < 0 || limit > maxSuggestLimit {
+		return nil, fmt.Errorf("%w: limit must be 1-%d", ErrInvalidQuery, maxSuggestLimit)
+	}
+	if limit == 0 {
+		limit = defaultSuggestLimit
+	}
+
+	tokens := tokenize(q)
+	suggestions := []model.ProductSuggestion{}
+	if len(tokens) == 0 || len(tokens[len(tokens)-1]) < minSuggestLength {
+		return suggestions, nil
+	}
+	words, last := tokens[:len(tokens)-1], tokens[len(tokens)-1]
+
+	// produk harus punya kata yang cukup dekat dengan setiap kata query
+	vocab := map[rune][][]rune{}
+	group, err := s.closeWords(ctx, vocab, last, prefixDistance)
+	if err != nil || len(group) == 0 {
+		return suggestions, err
+	}
+	groups := [][]string{group}
+	for _, w := range words {
+		group, err := s.closeWords(ctx, vocab, w, distance)
+		if err != nil || len(group) == 0 {
+			return suggestions, err
+		}
+		groups = append(groups, group)
+	}
+
+	candidates, err := s.repo.SuggestCandidates(ctx, groups)
+	if err != nil {
+		return nil, err
+	}
+
+	type match struct {
+		p     model.Product
+		typos int
+	}
+	var matches []match
+	for _, p := range candidates {
+		vocab := productWords(p)
+
+		typos, ok := bestMatch(last, vocab, prefixDistance)
+		for _, w := range words {
+			if !ok {
+				break
+			}
+			var d int
+			d, ok = bestMatch(w, vocab, distance)
+			typos += d
+		}
+		if ok {
+			matches = append(matches, match{p: p, typos: typos})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.typos != b.typos {
+			return a.typos < b.typos
+		}
+		if len(a.p.Name) != len(b.p.Name) {
+			return len(a.p.Name) < len(b.p.Name)
+		}
+		return a.p.Name < b.p.Name
+	})
+
+	for i := 0; i < len(matches) && i < limit; i++ {
+		suggestions = append(suggestions, model.ProductSuggestion{ID: matches[i].p.ID, Name: matches[i].p.Name})
+	}
+	return suggestions, nil
+}
+
+// correctQuery replaces words of q that aren't in the catalog with the closest
+// catalog word. It returns "" when nothing was corrected.
+func (s *service) correctQuery(ctx context.Context, q string) (string, error) {
+	tokens := tokenize(q)
+	vocabByInitial := map[rune][][]rune{}
+	changed := false
+
+	out := make([]string, len(tokens))
+	for i, t := range tokens {
+		out[i] = string(t)
+		if maxTypos(len(t)) == 0 {
+			continue
+		}
+
+		vocab, err := s.vocabulary(ctx, vocabByInitial, t[0])
+		if err != nil {
+			return "", err
+		}
+
+		best, bestDist := "", maxTypos(len(t))+1
+		for _, w := range vocab {
+			d := distance(t, w)
+			if d < bestDist || (d == bestDist && string(w) < best) {
+				best, bestDist = string(w), d
+			}
+		}
+		if best != "" && bestDist > 0 && bestDist <= maxTypos(len(t)) {
+			out[i] = best
+			changed = true
+		}
+	}
+
+	if !changed {
+		return "", nil
+	}
+	return strings.Join(out, " "), nil
+}
+
+// vocabulary returns the catalog words starting with initial, cached in cache
+// for the rest of the request.
+func (s *service) vocabulary(ctx context.Context, cache map[rune][][]rune, initial rune) ([][]rune, error) {
+	if vocab, ok := cache[initial]; ok {
+		return vocab, nil
+	}
+	words, err := s.repo.SuggestWords(ctx, string(initial))
+	if err != nil {
+		return nil, err
+	}
+	vocab := make([][]rune, len(words))
+	for i, w := range words {
+		vocab[i] = []rune(w)
+	}
+	cache[initial] = vocab
+	return vocab, nil
+}
+
+// closeWords returns the catalog words within the typo budget of word by dist.
+func (s *service) closeWords(ctx context.Context, cache map[rune][][]rune, word []rune, dist func(a, b []rune) int) ([]string, error) {
+	vocab, err := s.vocabulary(ctx, cache, word[0])
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, w := range vocab {
+		if dist(word, w) <= maxTypos(len(word)) {
+			out = append(out, string(w))
+		}
+	}
+	return out, nil
+}
+
+// maxTypos is how many edits a word of n letters may be off by.
+func maxTypos(n int) int {
+	switch {
+	case n >= 8:
+		return 2
+	case n >= 4:
+		return 1
+	}
+	return 0
+}
+
+// bestMatch returns the smallest dist between word and any of vocab, and
+// whether it is within the typo budget of word.
+func bestMatch(word []rune, vocab [][]rune, dist func(a, b []rune) int) (int, bool) {
+	budget := maxTypos(len(word))
+	best := budget + 1
+	for _, v := range vocab {
+		if d := dist(word, v); d < best {
+			best = d
+		}
+	}
+	return best, best <= budget
+}
+
+func tokenize(s string) [][]rune {
+	var tokens [][]rune
+	for _, f := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		tokens = append(tokens, []rune(f))
+	}
+	return tokens
+}
+
+func productWords(p model.Product) [][]rune {
+	words := tokenize(p.Name)
+	for _, t := range p.Tags {
+		words = append(words, tokenize(t)...)
+	}
+	return words
+}
+
+// prefixDistance is the edit distance between prefix and the closest prefix
+// of word, so "adid" and "addid" both match "adidas".
+func prefixDistance(prefix, word []rune) int {
+	budget := maxTypos(len(prefix))
+	best := len(prefix) + len(word)
+	for k := len(prefix) - budget; k <= len(prefix)+budget && k <= len(word); k++ {
+		if k < 0 {
+			continue
+		}
+		if d := distance(prefix, word[:k]); d < best {
+			best = d
+		}
+	}
+	return best
+}
+
+// distance is the optimal string alignment distance: insertions, deletions,
+// substitutions and swaps of two adjacent letters each count as one edit.
+func distance(a, b []rune) int {
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,190 @@
+package product
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"ecom/model"
+	"ecom/util/tracing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrProductNotFound = errors.New("product not found")
+	ErrVariantNotFound = errors.New("variant not found")
+	ErrVariantInUse    = errors.New("variant has reserved stock")
+)
+
+// /products/{id}/variants (POST)
+func (s *service) AddVariant(ctx context.Context, productID string, req model.VariantRequest) (*model.Variant, error) {
+	ctx, span := tracing.Start(ctx, "ProductService.AddVariant")
+	defer span.End()
+
+	p, err := s.findProduct(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &model.Variant{}
+	if err := applyVariant(p, v, req); err != nil {
+		return nil, err
+	}
+
+	// write gagal dengan ErrVersionConflict kalau produk berubah sejak dicek applyVariant
+	if err := s.repo.AddVariant(ctx, p, v); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrSKUTaken
+		}
+		return nil, err
+	}
+	return v, nil
+}
+
+// /products/{id}/variants/{variantId} (PUT)
+func (s *service) UpdateVariant(ctx context.Context, productID, variantID string, req model.VariantRequest) (*model.Variant, error) {
+	ctx, span := tracing.Start(ctx, "ProductService.UpdateVariant")
+	defer span.End()
+
+	p, v, err := s.findVariant(ctx, productID, variantID)
+	if err != nil {
+		return nil, err
+	}
+
+	// sama seperti stok produk, unit yang sedang di-reserve tidak boleh hilang
+	if req.Stock < v.Reserved {
+		return nil, fmt.Errorf("%w: stock cannot be lower than reserved stock (%d)", ErrVariantInUse, v.Reserved)
+	}
+	if err := applyVariant(p, v, req); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.UpdateVariant(ctx, p, v); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrSKUTaken
+		}
+		return nil, err
+	}
+	return v, nil
+}
+
+// /products/{id}/variants/{variantId} (DELETE), ditolak selama masih ada reservasi
+func (s *service) DeleteVariant(ctx context.Context, productID, variantID string) error {
+	ctx, span := tracing.Start(ctx, "ProductService.DeleteVariant")
+	defer span.End()
+
+	p, v, err := s.findVariant(ctx, productID, variantID)
+	if err != nil {
+		return err
+	}
+	if v.Reserved > 0 {
+		return fmt.Errorf("%w (%d units)", ErrVariantInUse, v.Reserved)
+	}
+
+	ok, err := s.repo.RemoveVariant(ctx, p.ID, v.ID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrVariantInUse
+	}
+	return nil
+}
+
+func (s *service) findProduct(ctx context.Context, id string) (*model.Product, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrProductNotFound
+	}
+	p, err := s.repo.FindByID(ctx, objID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrProductNotFound
+		}
+		return nil, err
+	}
+	return p, nil
+}
+
+func (s *service) findVariant(ctx context.Context, productID, variantID string) (*model.Product, *model.Variant, error) {
+	p, err := s.findProduct(ctx, productID)
+	if err != nil {
+		return nil, nil, err
+	}
+	id, err := primitive.ObjectIDFromHex(variantID)
+	if err != nil {
+		return nil, nil, ErrVariantNotFound
+	}
+	v := p.FindVariant(id)
+	if v == nil {
+		return nil, nil, ErrVariantNotFound
+	}
+	return p, v, nil
+}
+
+// applyVariant validates req against the other variants of p and sets it on v.
+// Option names are lowercased, so "Size" and "size" are the same option.
+func applyVariant(p *model.Product, v *model.Variant, req model.VariantRequest) error {
+	sku := strings.TrimSpace(req.SKU)
+	if sku == "" {
+		return fmt.Errorf("%w: variant sku is required", ErrInvalidProduct)
+	}
+	if len(req.Options) == 0 {
+		return fmt.Errorf("%w: variant needs at least one option", ErrInvalidProduct)
+	}
+	if req.Price != nil && *req.Price <= 0 {
+		return fmt.Errorf("%w: variant price must be > 0", ErrInvalidProduct)
+	}
+	if req.Stock < 0 {
+		return fmt.Errorf("%w: variant stock must be >= 0", ErrInvalidProduct)
+	}
+
+	options := make(map[string]string, len(req.Options))
+	for name, value := range req.Options {
+		name = strings.ToLower(strings.TrimSpace(name))
+		value = strings.TrimSpace(value)
+		if name == "" || value == "" {
+			return fmt.Errorf("%w: variant options need a name and a value", ErrInvalidProduct)
+		}
+		if _, dup := options[name]; dup {
+			return fmt.Errorf("%w: option %q given twice", ErrInvalidProduct, name)
+		}
+		options[name] = value
+	}
+
+	// unique index variants.sku hanya berlaku antar produk, duplikat dalam
+	// satu produk dicek di sini; write di repository mencocokkan version produk
+	key := optionsKey(options)
+	for _, other := range p.Variants {
+		if other.ID == v.ID {
+			continue
+		}
+		if strings.EqualFold(other.SKU, sku) {
+			return ErrSKUTaken
+		}
+		if optionsKey(other.Options) == key {
+			return fmt.Errorf("%w: a variant with options %s already exists", ErrInvalidProduct, key)
+		}
+	}
+
+	v.SKU = sku
+	v.Options = options
+	v.Price = req.Price
+	v.Stock = req.Stock
+	return nil
+}
+
+// optionsKey is a stable, case-insensitive representation of an option set,
+// e.g. "color=red,size=m".
+func optionsKey(options map[string]string) string {
+	parts := make([]string, 0, len(options))
+	for name, value := range options {
+		parts = append(parts, strings.ToLower(name)+"="+strings.ToLower(value))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
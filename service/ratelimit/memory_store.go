@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"ecom/model"
+)
+
+// sweepEvery is how often the memory store drops buckets that are full again.
+const sweepEvery = time.Minute
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+	fullAt    time.Time
+}
+
+type memoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// NewMemoryStore keeps buckets in this process. With several replicas every
+// replica has its own buckets, so the effective limit is multiplied.
+func NewMemoryStore() Store {
+	return &memoryStore{buckets: map[string]*bucket{}}
+}
+
+func (m *memoryStore) Take(ctx context.Context, key string, rule model.RateLimitRule, now time.Time) (float64, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sweep(now)
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(rule.Burst), updatedAt: now}
+		m.buckets[key] = b
+	}
+	if elapsed := now.Sub(b.updatedAt); elapsed > 0 {
+		b.tokens = math.Min(float64(rule.Burst), b.tokens+elapsed.Seconds()*rule.Rate)
+		b.updatedAt = now
+	}
+
+	taken := b.tokens >= 1
+	if taken {
+		b.tokens--
+	}
+	b.fullAt = now.Add(rule.Refill(float64(rule.Burst) - b.tokens))
+	return b.tokens, taken, nil
+}
+
+// sweep drops buckets that have refilled completely, so the map only holds
+// clients seen recently. Dipanggil dengan m.mu terkunci.
+func (m *memoryStore) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < sweepEvery {
+		return
+	}
+	m.lastSweep = now
+	for key, b := range m.buckets {
+		if !now.Before(b.fullAt) {
+			delete(m.buckets, key)
+		}
+	}
+}
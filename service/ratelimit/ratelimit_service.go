@@ -0,0 +1,120 @@
+// Package ratelimit limits how often a client (an IP, a customer email) may
+// call a route, with one token bucket per client in a Store.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"ecom/config"
+	"ecom/model"
+	"ecom/util/tracing"
+)
+
+var ErrInvalidRule = errors.New("invalid rate limit")
+
+// RuleFrom converts a route config into a token bucket rule.
+func RuleFrom(cfg config.RateLimitConfig) (model.RateLimitRule, error) {
+	if cfg.Requests <= 0 || cfg.Period <= 0 || cfg.Burst <= 0 {
+		return model.RateLimitRule{}, fmt.Errorf("%w: requests, period and burst must be positive", ErrInvalidRule)
+	}
+	return model.RateLimitRule{Rate: float64(cfg.Requests) / cfg.Period.Seconds(), Burst: cfg.Burst}, nil
+}
+
+// Store keeps the buckets. See NewMemoryStore, and repository/ratelimit for
+// the Mongo version shared by all replicas; any backend with an atomic
+// read-modify-write per key (e.g. Redis) can implement it as well.
+type Store interface {
+	// Take refills the bucket of key for the time since it was last used,
+	// then takes one token if there is a whole one. It returns the tokens
+	// left and whether one was taken. A missing bucket starts full.
+	Take(ctx context.Context, key string, rule model.RateLimitRule, now time.Time) (tokens float64, ok bool, err error)
+}
+
+type Service interface {
+	Allow(ctx context.Context, key string) (model.RateLimitDecision, error)
+}
+
+type service struct {
+	name  string
+	rule  model.RateLimitRule
+	store Store
+	now   func() time.Time
+}
+
+type Option func(*service)
+
+// WithClock replaces time.Now, for tests.
+func WithClock(now func() time.Time) Option {
+	return func(s *service) {
+		s.now = now
+	}
+}
+
+// Store kinds accepted in config.Config.RateLimitStore.
+const (
+	StoreMemory = "memory"
+	StoreMongo  = "mongo"
+)
+
+// Limiters builds a limiter for every enabled route of cfg.RateLimits, all on
+// one store: in memory, or shared() (repository/ratelimit) for "mongo".
+// Disabled routes have no entry, a nil limiter lets every request through.
+func Limiters(cfg config.Config, shared func() Store) (map[string]Service, error) {
+	var store Store
+	switch cfg.RateLimitStore {
+	case StoreMemory:
+		store = NewMemoryStore()
+	case StoreMongo:
+		store = shared()
+	default:
+		return nil, fmt.Errorf("unknown rate limit store %q (want memory or mongo)", cfg.RateLimitStore)
+	}
+
+	out := map[string]Service{}
+	for name, limit := range cfg.RateLimits {
+		if !limit.Enabled {
+			continue
+		}
+		rule, err := RuleFrom(limit)
+		if err != nil {
+			return nil, fmt.Errorf("rate limit %s: %w", name, err)
+		}
+		out[name] = NewService(name, rule, store)
+	}
+	return out, nil
+}
+
+// NewService limits route name with rule. Buckets are per route, so the same
+// client has separate budgets on different routes.
+func NewService(name string, rule model.RateLimitRule, store Store, opts ...Option) Service {
+	s := &service{name: name, rule: rule, store: store, now: time.Now}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *service) Allow(ctx context.Context, key string) (model.RateLimitDecision, error) {
+	ctx, span := tracing.Start(ctx, "RateLimitService.Allow")
+	defer span.End()
+
+	tokens, ok, err := s.store.Take(ctx, s.name+":"+key, s.rule, s.now())
+	if err != nil {
+		return model.RateLimitDecision{}, err
+	}
+
+	d := model.RateLimitDecision{
+		Allowed:   ok,
+		Limit:     s.rule.Burst,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     s.rule.Refill(float64(s.rule.Burst) - tokens),
+	}
+	if !ok {
+		d.RetryAfter = s.rule.Refill(1 - tokens)
+	}
+	return d, nil
+}
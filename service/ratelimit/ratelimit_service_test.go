@@ -0,0 +1,251 @@
+package ratelimit_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	appmiddleware "ecom/app/echoServer/middleware"
+	"ecom/config"
+	"ecom/model"
+	"ecom/service/ratelimit"
+
+	"github.com/labstack/echo/v4"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time          { return c.now }
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func newLimiter(t *testing.T, cfg config.RateLimitConfig, store ratelimit.Store, clock *fakeClock) ratelimit.Service {
+	t.Helper()
+	rule, err := ratelimit.RuleFrom(cfg)
+	if err != nil {
+		t.Fatalf("RuleFrom returned error: %v", err)
+	}
+	return ratelimit.NewService("transaction-create", rule, store, ratelimit.WithClock(clock.Now))
+}
+
+// 6 request per menit = 1 token tiap 10 detik, burst 3
+var sixPerMinute = config.RateLimitConfig{Requests: 6, Period: time.Minute, Burst: 3, Enabled: true}
+
+func TestAllow_BurstThenRetryAfter(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	svc := newLimiter(t, sixPerMinute, ratelimit.NewMemoryStore(), clock)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		d, err := svc.Allow(ctx, "ip:10.0.0.1")
+		if err != nil {
+			t.Fatalf("Allow returned error: %v", err)
+		}
+		if !d.Allowed || d.Limit != 3 || d.Remaining != 2-i {
+			t.Fatalf("request %d: expected allowed with %d remaining, got %+v", i+1, 2-i, d)
+		}
+	}
+
+	d, _ := svc.Allow(ctx, "ip:10.0.0.1")
+	if d.Allowed {
+		t.Fatal("expected the 4th request of the burst to be limited")
+	}
+	if d.RetryAfter != 10*time.Second {
+		t.Fatalf("expected retry after 10s, got %s", d.RetryAfter)
+	}
+	if d.Reset != 30*time.Second {
+		t.Fatalf("expected the bucket to be full after 30s, got %s", d.Reset)
+	}
+
+	// token berikutnya baru ada setelah 10 detik
+	clock.Advance(9 * time.Second)
+	if d, _ := svc.Allow(ctx, "ip:10.0.0.1"); d.Allowed {
+		t.Fatal("expected still limited before the next token")
+	}
+	clock.Advance(time.Second)
+	if d, _ := svc.Allow(ctx, "ip:10.0.0.1"); !d.Allowed || d.Remaining != 0 {
+		t.Fatalf("expected one token after 10s, got %+v", d)
+	}
+
+	// bucket tidak pernah lebih dari burst
+	clock.Advance(time.Hour)
+	if d, _ := svc.Allow(ctx, "ip:10.0.0.1"); d.Remaining != 2 {
+		t.Fatalf("expected refill capped at the burst, got %+v", d)
+	}
+}
+
+func TestAllow_KeysAndRoutesAreSeparate(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	store := ratelimit.NewMemoryStore()
+	tx := newLimiter(t, config.RateLimitConfig{Requests: 1, Period: time.Minute, Burst: 1}, store, clock)
+	rule, _ := ratelimit.RuleFrom(config.RateLimitConfig{Requests: 1, Period: time.Minute, Burst: 1})
+	login := ratelimit.NewService("auth", rule, store, ratelimit.WithClock(clock.Now))
+	ctx := context.Background()
+
+	if d, _ := tx.Allow(ctx, "email:a@example.com"); !d.Allowed {
+		t.Fatal("expected first request allowed")
+	}
+	if d, _ := tx.Allow(ctx, "email:a@example.com"); d.Allowed {
+		t.Fatal("expected second request of the same key limited")
+	}
+	if d, _ := tx.Allow(ctx, "email:b@example.com"); !d.Allowed {
+		t.Fatal("expected another key to have its own bucket")
+	}
+	if d, _ := login.Allow(ctx, "email:a@example.com"); !d.Allowed {
+		t.Fatal("expected another route to have its own bucket")
+	}
+}
+
+func TestRuleFrom_Invalid(t *testing.T) {
+	for _, cfg := range []config.RateLimitConfig{
+		{Requests: 0, Period: time.Minute, Burst: 1},
+		{Requests: 1, Period: 0, Burst: 1},
+		{Requests: 1, Period: time.Minute, Burst: 0},
+	} {
+		if _, err := ratelimit.RuleFrom(cfg); !errors.Is(err, ratelimit.ErrInvalidRule) {
+			t.Fatalf("%+v: expected ErrInvalidRule, got %v", cfg, err)
+		}
+	}
+}
+
+func TestLimiters(t *testing.T) {
+	cfg := config.Defaults()
+	cfg.RateLimits[config.RateLimitPaymentCreate] = config.RateLimitConfig{Enabled: false}
+
+	sharedCalled := false
+	shared := func() ratelimit.Store {
+		sharedCalled = true
+		return failingStore{}
+	}
+	limiters, err := ratelimit.Limiters(cfg, shared)
+	if err != nil {
+		t.Fatalf("Limiters returned error: %v", err)
+	}
+	if sharedCalled {
+		t.Fatal("expected the memory store not to touch the shared store")
+	}
+	if limiters[config.RateLimitAuth] == nil || limiters[config.RateLimitTransactionCreate] == nil {
+		t.Fatalf("expected a limiter per enabled route, got %v", limiters)
+	}
+	if _, ok := limiters[config.RateLimitPaymentCreate]; ok {
+		t.Fatal("expected no limiter for a disabled route")
+	}
+
+	cfg.RateLimitStore = ratelimit.StoreMongo
+	limiters, err = ratelimit.Limiters(cfg, shared)
+	if err != nil || !sharedCalled {
+		t.Fatalf("expected the shared store for mongo, got %v", err)
+	}
+	if _, err := limiters[config.RateLimitAuth].Allow(context.Background(), "ip:10.0.0.1"); err == nil {
+		t.Fatal("expected the limiter to use the shared store")
+	}
+
+	cfg.RateLimitStore = "redis"
+	if _, err := ratelimit.Limiters(cfg, shared); err == nil {
+		t.Fatal("expected an error for an unknown store")
+	}
+	cfg.RateLimitStore = ratelimit.StoreMemory
+	cfg.RateLimits[config.RateLimitAuth] = config.RateLimitConfig{Enabled: true}
+	if _, err := ratelimit.Limiters(cfg, shared); !errors.Is(err, ratelimit.ErrInvalidRule) {
+		t.Fatalf("expected ErrInvalidRule, got %v", err)
+	}
+}
+
+func TestRateLimitMiddleware_NilLimiterLetsThrough(t *testing.T) {
+	e := newServer(nil, appmiddleware.RateLimitByIP)
+	for i := 0; i < 3; i++ {
+		if rec := login(e, "10.0.0.1", "a@b.id"); rec.Code != http.StatusNoContent || rec.Header().Get("X-RateLimit-Limit") != "" {
+			t.Fatalf("expected a disabled route to be let through without headers, got %d", rec.Code)
+		}
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) Take(ctx context.Context, key string, rule model.RateLimitRule, now time.Time) (float64, bool, error) {
+	return 0, false, errors.New("mongo down")
+}
+
+func newServer(limiter appmiddleware.RateLimiter, keys ...appmiddleware.RateLimitKey) *echo.Echo {
+	e := echo.New()
+	e.POST("/auth/login", func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	}, appmiddleware.RateLimit(limiter, keys...))
+	return e
+}
+
+func login(e *echo.Echo, ip, email string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(`{"email":"`+email+`","password":"x"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(echo.HeaderXRealIP, ip)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRateLimitMiddleware_429WithHeaders(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	limiter := newLimiter(t, sixPerMinute, ratelimit.NewMemoryStore(), clock)
+	e := newServer(limiter, appmiddleware.RateLimitByIP, appmiddleware.RateLimitByBodyEmail)
+
+	// email sama dari IP berbeda tetap kena limit per email
+	for i, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		rec := login(e, ip, "victim@example.com")
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("request %d: expected 204, got %d", i+1, rec.Code)
+		}
+		if rec.Header().Get("X-RateLimit-Limit") != "3" || rec.Header().Get("X-RateLimit-Remaining") != []string{"2", "1", "0"}[i] {
+			t.Fatalf("request %d: unexpected rate limit headers %v", i+1, rec.Header())
+		}
+	}
+
+	rec := login(e, "10.0.0.4", "Victim@Example.com")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") != "10" || rec.Header().Get("X-RateLimit-Remaining") != "0" {
+		t.Fatalf("expected Retry-After 10 and nothing remaining, got %v", rec.Header())
+	}
+	if !strings.Contains(rec.Body.String(), `"retry_after_seconds":10`) {
+		t.Fatalf("expected retry_after_seconds in body, got %s", rec.Body)
+	}
+
+	// email lain dari IP yang belum dipakai masih boleh
+	if rec := login(e, "10.0.0.5", "other@example.com"); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected another client to pass, got %d", rec.Code)
+	}
+}
+
+func TestRateLimitMiddleware_BodyStillReadable(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	limiter := newLimiter(t, sixPerMinute, ratelimit.NewMemoryStore(), clock)
+	e := echo.New()
+	e.POST("/auth/login", func(c echo.Context) error {
+		var req model.LoginRequest
+		if err := c.Bind(&req); err != nil {
+			return err
+		}
+		return c.String(http.StatusOK, req.Email)
+	}, appmiddleware.RateLimit(limiter, appmiddleware.RateLimitByBodyEmail))
+
+	rec := login(e, "10.0.0.1", "user@example.com")
+	if rec.Code != http.StatusOK || rec.Body.String() != "user@example.com" {
+		t.Fatalf("expected the handler to read the body, got %d %q", rec.Code, rec.Body)
+	}
+}
+
+func TestRateLimitMiddleware_StoreDownLetsThrough(t *testing.T) {
+	limiter := newLimiter(t, sixPerMinute, failingStore{}, &fakeClock{now: time.Now()})
+	e := newServer(limiter, appmiddleware.RateLimitByIP)
+
+	for i := 0; i < 5; i++ {
+		if rec := login(e, "10.0.0.1", "user@example.com"); rec.Code != http.StatusNoContent {
+			t.Fatalf("expected requests to pass while the store is down, got %d", rec.Code)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package reconciliation
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"ecom/model"
+)
+
+// WriteJSON writes the full report (summary and mismatches) as indented JSON.
+func WriteJSON(w io.Writer, r *model.ReconciliationReport) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteCSV writes one row per mismatch, for finance to open in a spreadsheet.
+func WriteCSV(w io.Writer, r *model.ReconciliationReport) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{
+		"type", "transaction_id", "payment_id",
+		"transaction_status", "payment_status",
+		"transaction_amount", "payment_amount",
+	})
+	for _, m := range r.Mismatches {
+		_ = cw.Write([]string{
+			string(m.Type), m.TransactionID, m.PaymentID,
+			string(m.TransactionStatus), string(m.PaymentStatus),
+			formatAmount(m.TransactionAmount), formatAmount(m.PaymentAmount),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Write picks the writer by format ("json" or "csv").
+func Write(w io.Writer, r *model.ReconciliationReport, format string) error {
+	switch format {
+	case "json":
+		return WriteJSON(w, r)
+	case "csv":
+		return WriteCSV(w, r)
+	}
+	return fmt.Errorf("unknown format %q (json or csv)", format)
+}
+
+func formatAmount(v float64) string {
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
@@ -0,0 +1,297 @@
+package reconciliation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"ecom/model"
+	"ecom/util/tracing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrInvalidRange = errors.New("invalid date range")
+
+// maxRange keeps one run bounded; longer periods should be run day by day.
+const maxRange = 31 * 24 * time.Hour
+
+type Service interface {
+	// Run compares transactions and payments created in [from, to).
+	Run(ctx context.Context, from, to time.Time) (*model.ReconciliationReport, error)
+	Summary(ctx context.Context, q model.ReconciliationQuery) (*model.ReconciliationSummary, error)
+}
+
+type TransactionRepository interface {
+	FindCreatedBetween(ctx context.Context, from, to time.Time) ([]model.Transaction, error)
+	FindByIDs(ctx context.Context, ids []primitive.ObjectID) ([]model.Transaction, error)
+}
+
+type PaymentRepository interface {
+	FindCreatedBetween(ctx context.Context, from, to time.Time) ([]model.Payment, error)
+	FindByTransactionIDs(ctx context.Context, txIDs []primitive.ObjectID) ([]model.Payment, error)
+}
+
+type service struct {
+	txRepo      TransactionRepository
+	paymentRepo PaymentRepository
+	now         func() time.Time
+}
+
+func NewService(txRepo TransactionRepository, paymentRepo PaymentRepository) Service {
+	return &service{
+		txRepo:      txRepo,
+		paymentRepo: paymentRepo,
+		now:         time.Now,
+	}
+}
+
+// /reports/reconciliation/summary (GET)
+func (s *service) Summary(ctx context.Context, q model.ReconciliationQuery) (*model.ReconciliationSummary, error) {
+	ctx, span := tracing.Start(ctx, "ReconciliationService.Summary")
+	defer span.End()
+
+	from, to, err := ParseRange(q.From, q.To, s.now())
+	if err != nil {
+		return nil, err
+	}
+	report, err := s.Run(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return &report.Summary, nil
+}
+
+func (s *service) Run(ctx context.Context, from, to time.Time) (*model.ReconciliationReport, error) {
+	ctx, span := tracing.Start(ctx, "ReconciliationService.Run")
+	defer span.End()
+
+	if !from.Before(to) {
+		return nil, fmt.Errorf("%w: from must be before to", ErrInvalidRange)
+	}
+
+	txs, err := s.txRepo.FindCreatedBetween(ctx, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("load transactions: %w", err)
+	}
+	inRange, err := s.paymentRepo.FindCreatedBetween(ctx, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("load payments: %w", err)
+	}
+
+	// Pasangan dicari lewat ID, bukan lewat range, supaya transaksi jam 23:59
+	// dengan payment jam 00:00 keesokan harinya tidak dianggap hilang.
+	txByID := make(map[primitive.ObjectID]model.Transaction, len(txs))
+	for _, tx := range txs {
+		txByID[tx.ID] = tx
+	}
+	var missingTx []primitive.ObjectID
+	for _, p := range inRange {
+		if _, ok := txByID[p.TransactionID]; !ok && p.Status == model.PaymentStatusSuccess {
+			missingTx = append(missingTx, p.TransactionID)
+		}
+	}
+	extra, err := s.txRepo.FindByIDs(ctx, uniqueIDs(missingTx))
+	if err != nil {
+		return nil, fmt.Errorf("load transactions: %w", err)
+	}
+	for _, tx := range extra {
+		txByID[tx.ID] = tx
+	}
+
+	txIDs := make([]primitive.ObjectID, 0, len(txByID))
+	for id := range txByID {
+		txIDs = append(txIDs, id)
+	}
+	related, err := s.paymentRepo.FindByTransactionIDs(ctx, txIDs)
+	if err != nil {
+		return nil, fmt.Errorf("load payments: %w", err)
+	}
+
+	paymentsByTx := map[primitive.ObjectID][]model.Payment{}
+	seen := map[primitive.ObjectID]bool{}
+	for _, list := range [][]model.Payment{related, inRange} {
+		for _, p := range list {
+			if seen[p.ID] {
+				continue
+			}
+			seen[p.ID] = true
+			paymentsByTx[p.TransactionID] = append(paymentsByTx[p.TransactionID], p)
+		}
+	}
+
+	report := &model.ReconciliationReport{
+		Summary: model.ReconciliationSummary{
+			From:                from,
+			To:                  to,
+			GeneratedAt:         s.now(),
+			TransactionsChecked: len(txByID),
+			PaymentsChecked:     len(seen),
+			ByType:              map[model.MismatchType]int{},
+		},
+		Mismatches: []model.Mismatch{},
+	}
+
+	for _, tx := range txByID {
+		if tx.Status == model.TransactionStatusSuccess {
+			report.Summary.TransactionTotal += tx.TotalAmount
+		}
+		m, ok := compare(tx, pick(tx, paymentsByTx[tx.ID]))
+		if !ok {
+			report.Summary.Matched++
+			continue
+		}
+		addMismatch(report, m)
+	}
+
+	for txID, payments := range paymentsByTx {
+		for _, p := range payments {
+			if p.Status == model.PaymentStatusSuccess {
+				report.Summary.CapturedTotal += p.CapturedAmount
+			}
+		}
+		if _, ok := txByID[txID]; ok {
+			continue
+		}
+		for _, p := range payments {
+			if p.Status != model.PaymentStatusSuccess {
+				continue
+			}
+			addMismatch(report, model.Mismatch{
+				Type:          model.MismatchMissingTransaction,
+				TransactionID: txID.Hex(),
+				PaymentID:     p.ID.Hex(),
+				PaymentStatus: p.Status,
+				PaymentAmount: p.CapturedAmount,
+			})
+		}
+	}
+
+	sort.Slice(report.Mismatches, func(i, j int) bool {
+		a, b := report.Mismatches[i], report.Mismatches[j]
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.TransactionID < b.TransactionID
+	})
+	return report, nil
+}
+
+// compare returns the mismatch for a transaction and its payment, if any.
+// Transactions that never succeeded only matter when money was captured anyway.
+func compare(tx model.Transaction, p *model.Payment) (model.Mismatch, bool) {
+	m := model.Mismatch{
+		TransactionID:     tx.ID.Hex(),
+		TransactionStatus: tx.Status,
+		TransactionAmount: tx.TotalAmount,
+	}
+	if p != nil {
+		m.PaymentID = p.ID.Hex()
+		m.PaymentStatus = p.Status
+		m.PaymentAmount = p.CapturedAmount
+	}
+
+	switch {
+	case tx.Status == model.TransactionStatusSuccess && p == nil:
+		m.Type = model.MismatchMissingPayment
+	case tx.Status == model.TransactionStatusSuccess && p.Status != model.PaymentStatusSuccess:
+		m.Type = model.MismatchStatus
+	case tx.Status != model.TransactionStatusSuccess && p != nil && p.Status == model.PaymentStatusSuccess:
+		m.Type = model.MismatchStatus
+	case tx.Status == model.TransactionStatusSuccess && !sameAmount(tx.TotalAmount, p.CapturedAmount):
+		m.Type = model.MismatchAmount
+	default:
+		return m, false
+	}
+	return m, true
+}
+
+// pick chooses the payment a transaction settles against: the one it
+// references, else a captured attempt, else the latest attempt.
+func pick(tx model.Transaction, payments []model.Payment) *model.Payment {
+	var chosen *model.Payment
+	for i := range payments {
+		p := &payments[i]
+		if !tx.PaymentID.IsZero() && p.ID == tx.PaymentID {
+			return p
+		}
+		switch {
+		case chosen == nil:
+			chosen = p
+		case p.Status == model.PaymentStatusSuccess && chosen.Status != model.PaymentStatusSuccess:
+			chosen = p
+		case (p.Status == model.PaymentStatusSuccess) == (chosen.Status == model.PaymentStatusSuccess) && p.Attempt > chosen.Attempt:
+			chosen = p
+		}
+	}
+	return chosen
+}
+
+func sameAmount(a, b float64) bool {
+	return math.Abs(a-b) <= 1e-6
+}
+
+func uniqueIDs(ids []primitive.ObjectID) []primitive.ObjectID {
+	seen := map[primitive.ObjectID]bool{}
+	out := []primitive.ObjectID{}
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// ParseRange parses from/to as RFC3339 or a date. A date for to includes that
+// whole day. Without from and to the range is yesterday (UTC).
+func ParseRange(fromStr, toStr string, now time.Time) (time.Time, time.Time, error) {
+	today := now.UTC().Truncate(24 * time.Hour)
+	from, to := today.AddDate(0, 0, -1), today
+
+	if fromStr != "" {
+		t, _, err := parseTime(fromStr)
+		if err != nil {
+			return from, to, fmt.Errorf("%w: from", ErrInvalidRange)
+		}
+		from = t
+		if toStr == "" {
+			to = from.AddDate(0, 0, 1)
+		}
+	}
+	if toStr != "" {
+		t, dateOnly, err := parseTime(toStr)
+		if err != nil {
+			return from, to, fmt.Errorf("%w: to", ErrInvalidRange)
+		}
+		if dateOnly {
+			t = t.AddDate(0, 0, 1)
+		}
+		to = t
+	}
+
+	if !from.Before(to) {
+		return from, to, fmt.Errorf("%w: from must be before to", ErrInvalidRange)
+	}
+	if to.Sub(from) > maxRange {
+		return from, to, fmt.Errorf("%w: range longer than %d days", ErrInvalidRange, int(maxRange.Hours()/24))
+	}
+	return from, to, nil
+}
+
+func parseTime(v string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, false, nil
+	}
+	t, err := time.Parse(time.DateOnly, v)
+	return t, true, err
+}
+
+func addMismatch(r *model.ReconciliationReport, m model.Mismatch) {
+	r.Mismatches = append(r.Mismatches, m)
+	r.Summary.Mismatches++
+	r.Summary.ByType[m.Type]++
+}
@@ -0,0 +1,204 @@
+package reconciliation_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"ecom/model"
+	"ecom/service/reconciliation"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type fakeTxRepo struct {
+	txs []model.Transaction
+}
+
+func (f *fakeTxRepo) FindCreatedBetween(ctx context.Context, from, to time.Time) ([]model.Transaction, error) {
+	out := []model.Transaction{}
+	for _, tx := range f.txs {
+		if !tx.CreatedAt.Before(from) && tx.CreatedAt.Before(to) {
+			out = append(out, tx)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeTxRepo) FindByIDs(ctx context.Context, ids []primitive.ObjectID) ([]model.Transaction, error) {
+	out := []model.Transaction{}
+	for _, tx := range f.txs {
+		for _, id := range ids {
+			if tx.ID == id {
+				out = append(out, tx)
+			}
+		}
+	}
+	return out, nil
+}
+
+type fakePaymentRepo struct {
+	payments []model.Payment
+}
+
+func (f *fakePaymentRepo) FindCreatedBetween(ctx context.Context, from, to time.Time) ([]model.Payment, error) {
+	out := []model.Payment{}
+	for _, p := range f.payments {
+		if !p.CreatedAt.Before(from) && p.CreatedAt.Before(to) {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakePaymentRepo) FindByTransactionIDs(ctx context.Context, txIDs []primitive.ObjectID) ([]model.Payment, error) {
+	out := []model.Payment{}
+	for _, p := range f.payments {
+		for _, id := range txIDs {
+			if p.TransactionID == id {
+				out = append(out, p)
+			}
+		}
+	}
+	return out, nil
+}
+
+var day = time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC)
+
+func tx(status model.TransactionStatus, amount float64, at time.Time) model.Transaction {
+	return model.Transaction{ID: primitive.NewObjectID(), Status: status, TotalAmount: amount, CreatedAt: at}
+}
+
+func payment(txID primitive.ObjectID, status model.PaymentStatus, captured float64, at time.Time) model.Payment {
+	return model.Payment{
+		ID:             primitive.NewObjectID(),
+		TransactionID:  txID,
+		Status:         status,
+		Amount:         captured,
+		CapturedAmount: captured,
+		Attempt:        1,
+		CreatedAt:      at,
+	}
+}
+
+func TestRun_FindsEveryMismatchType(t *testing.T) {
+	noon := day.Add(12 * time.Hour)
+
+	matched := tx(model.TransactionStatusSuccess, 100_000, noon)
+	// dibayar lewat tengah malam, tetap cocok karena dicari lewat ID
+	lateNight := tx(model.TransactionStatusSuccess, 50_000, day.Add(23*time.Hour+59*time.Minute))
+	noPayment := tx(model.TransactionStatusSuccess, 70_000, noon)
+	wrongAmount := tx(model.TransactionStatusSuccess, 90_000, noon)
+	notCaptured := tx(model.TransactionStatusSuccess, 30_000, noon)
+	failedButPaid := tx(model.TransactionStatusFailed, 40_000, noon)
+	failed := tx(model.TransactionStatusFailed, 10_000, noon)
+	orphanTxID := primitive.NewObjectID()
+
+	retryFailed := payment(matched.ID, model.PaymentStatusFailed, 0, noon)
+	retrySuccess := payment(matched.ID, model.PaymentStatusSuccess, 100_000, noon)
+	retrySuccess.Attempt = 2
+
+	svc := reconciliation.NewService(
+		&fakeTxRepo{txs: []model.Transaction{matched, lateNight, noPayment, wrongAmount, notCaptured, failedButPaid, failed}},
+		&fakePaymentRepo{payments: []model.Payment{
+			retryFailed,
+			retrySuccess,
+			payment(lateNight.ID, model.PaymentStatusSuccess, 50_000, day.AddDate(0, 0, 1)),
+			payment(wrongAmount.ID, model.PaymentStatusSuccess, 85_000, noon),
+			payment(notCaptured.ID, model.PaymentStatusAuthorized, 0, noon),
+			payment(failedButPaid.ID, model.PaymentStatusSuccess, 40_000, noon),
+			payment(failed.ID, model.PaymentStatusFailed, 0, noon),
+			payment(orphanTxID, model.PaymentStatusSuccess, 20_000, noon),
+		}},
+	)
+
+	report, err := svc.Run(context.Background(), day, day.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	s := report.Summary
+	if s.TransactionsChecked != 7 || s.Matched != 3 || s.Mismatches != 5 {
+		t.Fatalf("expected 7 checked / 3 matched / 5 mismatches, got %+v", s)
+	}
+	want := map[model.MismatchType]int{
+		model.MismatchMissingPayment:     1,
+		model.MismatchMissingTransaction: 1,
+		model.MismatchAmount:             1,
+		model.MismatchStatus:             2,
+	}
+	for typ, n := range want {
+		if s.ByType[typ] != n {
+			t.Fatalf("expected %d %s, got %d (%v)", n, typ, s.ByType[typ], s.ByType)
+		}
+	}
+
+	for _, m := range report.Mismatches {
+		switch m.TransactionID {
+		case noPayment.ID.Hex():
+			if m.Type != model.MismatchMissingPayment {
+				t.Fatalf("expected missing_payment for %s, got %s", m.TransactionID, m.Type)
+			}
+		case wrongAmount.ID.Hex():
+			if m.Type != model.MismatchAmount || m.TransactionAmount != 90_000 || m.PaymentAmount != 85_000 {
+				t.Fatalf("expected amount_mismatch 90000 vs 85000, got %+v", m)
+			}
+		case orphanTxID.Hex():
+			if m.Type != model.MismatchMissingTransaction {
+				t.Fatalf("expected missing_transaction, got %s", m.Type)
+			}
+		case matched.ID.Hex(), lateNight.ID.Hex(), failed.ID.Hex():
+			t.Fatalf("expected %s to match, got %s", m.TransactionID, m.Type)
+		}
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	report := &model.ReconciliationReport{
+		Mismatches: []model.Mismatch{{
+			Type:              model.MismatchAmount,
+			TransactionID:     "tx1",
+			PaymentID:         "pay1",
+			TransactionStatus: model.TransactionStatusSuccess,
+			PaymentStatus:     model.PaymentStatusSuccess,
+			TransactionAmount: 90_000,
+			PaymentAmount:     85_000,
+		}},
+	}
+
+	var buf bytes.Buffer
+	if err := reconciliation.Write(&buf, report, "csv"); err != nil {
+		t.Fatalf("Write returned error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || lines[1] != "amount_mismatch,tx1,pay1,SUCCESS,SUCCESS,90000.00,85000.00" {
+		t.Fatalf("unexpected csv output:\n%s", buf.String())
+	}
+
+	if err := reconciliation.Write(&buf, report, "xml"); err == nil {
+		t.Fatal("expected error for unknown format, got nil")
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	now := time.Date(2025, 3, 11, 8, 30, 0, 0, time.UTC)
+
+	from, to, err := reconciliation.ParseRange("", "", now)
+	if err != nil || !from.Equal(day) || !to.Equal(day.AddDate(0, 0, 1)) {
+		t.Fatalf("expected yesterday by default, got %s - %s (%v)", from, to, err)
+	}
+
+	from, to, err = reconciliation.ParseRange("2025-03-01", "2025-03-07", now)
+	if err != nil || !to.Equal(time.Date(2025, 3, 8, 0, 0, 0, 0, time.UTC)) || !from.Equal(time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected inclusive date range, got %s - %s (%v)", from, to, err)
+	}
+
+	for _, tc := range [][2]string{{"2025-03-07", "2025-03-01"}, {"kemarin", ""}, {"2025-01-01", "2025-03-01"}} {
+		if _, _, err := reconciliation.ParseRange(tc[0], tc[1], now); !errors.Is(err, reconciliation.ErrInvalidRange) {
+			t.Fatalf("expected ErrInvalidRange for %v, got %v", tc, err)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package report
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"ecom/model"
+	"ecom/util/tracing"
+)
+
+var ErrInvalidQuery = errors.New("invalid query")
+
+const (
+	defaultRange = 30 * 24 * time.Hour
+	maxRange     = 366 * 24 * time.Hour
+
+	defaultTop = 10
+	maxTop     = 100
+)
+
+type Service interface {
+	Sales(ctx context.Context, q model.SalesReportQuery) (*model.SalesReport, error)
+}
+
+type TransactionRepository interface {
+	SalesByPeriod(ctx context.Context, from, to time.Time, groupBy model.SalesGroupBy) ([]model.SalesBucket, error)
+	TopProducts(ctx context.Context, from, to time.Time, sortBy string, limit int) ([]model.ProductSales, error)
+	CountByStatus(ctx context.Context, from, to time.Time) (map[model.TransactionStatus]int64, error)
+}
+
+type service struct {
+	txRepo TransactionRepository
+	now    func() time.Time
+}
+
+func NewService(txRepo TransactionRepository) Service {
+	return &service{
+		txRepo: txRepo,
+		now:    time.Now,
+	}
+}
+
+// /reports/sales (GET)
+func (s *service) Sales(ctx context.Context, q model.SalesReportQuery) (*model.SalesReport, error) {
+	ctx, span := tracing.Start(ctx, "ReportService.Sales")
+	defer span.End()
+
+	from, to, err := s.parseRange(q.From, q.To)
+	if err != nil {
+		return nil, err
+	}
+
+	groupBy := model.SalesGroupBy(strings.ToLower(q.GroupBy))
+	switch groupBy {
+	case "":
+		groupBy = model.SalesGroupByDay
+	case model.SalesGroupByDay, model.SalesGroupByWeek, model.SalesGroupByMonth:
+	default:
+		return nil, fmt.Errorf("%w: group_by must be day, week or month", ErrInvalidQuery)
+	}
+
+	top := q.Top
+	if top < 1 {
+		top = defaultTop
+	}
+	top = min(top, maxTop)
+
+	buckets, err := s.txRepo.SalesByPeriod(ctx, from, to, groupBy)
+	if err != nil {
+		return nil, fmt.Errorf("sales by period: %w", err)
+	}
+	byUnits, err := s.txRepo.TopProducts(ctx, from, to, "units", top)
+	if err != nil {
+		return nil, fmt.Errorf("top products: %w", err)
+	}
+	byRevenue, err := s.txRepo.TopProducts(ctx, from, to, "revenue", top)
+	if err != nil {
+		return nil, fmt.Errorf("top products: %w", err)
+	}
+	counts, err := s.txRepo.CountByStatus(ctx, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("count by status: %w", err)
+	}
+
+	r := &model.SalesReport{
+		From:         from,
+		To:           to,
+		GroupBy:      groupBy,
+		Buckets:      fillBuckets(buckets, from, to, groupBy),
+		TopByUnits:   byUnits,
+		TopByRevenue: byRevenue,
+		Conversion:   conversion(counts),
+	}
+	for _, b := range r.Buckets {
+		r.Revenue += b.Revenue
+		r.Orders += b.Orders
+	}
+	if r.Orders > 0 {
+		r.AverageOrderValue = r.Revenue / float64(r.Orders)
+	}
+	return r, nil
+}
+
+func conversion(counts map[model.TransactionStatus]int64) model.SalesConversion {
+	c := model.SalesConversion{
+		Success: counts[model.TransactionStatusSuccess],
+		Failed:  counts[model.TransactionStatusFailed],
+		Pending: counts[model.TransactionStatusPending],
+	}
+	if settled := c.Success + c.Failed; settled > 0 {
+		c.SuccessRate = float64(c.Success) / float64(settled)
+		c.FailedRate = float64(c.Failed) / float64(settled)
+	}
+	return c
+}
+
+// fillBuckets adds zero buckets for periods without sales, so charts get a
+// continuous series, and labels every bucket.
+func fillBuckets(buckets []model.SalesBucket, from, to time.Time, groupBy model.SalesGroupBy) []model.SalesBucket {
+	byStart := make(map[time.Time]model.SalesBucket, len(buckets))
+	for _, b := range buckets {
+		byStart[b.Start.UTC()] = b
+	}
+
+	out := []model.SalesBucket{}
+	for start := periodStart(from, groupBy); start.Before(to); start = nextPeriod(start, groupBy) {
+		b, ok := byStart[start]
+		if !ok {
+			b = model.SalesBucket{Start: start}
+		}
+		b.Start = start
+		b.Period = periodLabel(start, groupBy)
+		out = append(out, b)
+	}
+	return out
+}
+
+func periodStart(t time.Time, groupBy model.SalesGroupBy) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch groupBy {
+	case model.SalesGroupByWeek:
+		// minggu mulai Senin, sama dengan startOfWeek di pipeline
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset)
+	case model.SalesGroupByMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return day
+}
+
+func nextPeriod(t time.Time, groupBy model.SalesGroupBy) time.Time {
+	switch groupBy {
+	case model.SalesGroupByWeek:
+		return t.AddDate(0, 0, 7)
+	case model.SalesGroupByMonth:
+		return t.AddDate(0, 1, 0)
+	}
+	return t.AddDate(0, 0, 1)
+}
+
+func periodLabel(t time.Time, groupBy model.SalesGroupBy) string {
+	switch groupBy {
+	case model.SalesGroupByWeek:
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	case model.SalesGroupByMonth:
+		return t.Format("2006-01")
+	}
+	return t.Format(time.DateOnly)
+}
+
+// parseRange accepts RFC3339 or plain dates; a plain to date includes that
+// whole day. The default range is the last 30 days.
+func (s *service) parseRange(fromStr, toStr string) (time.Time, time.Time, error) {
+	to := s.now().UTC()
+	if toStr != "" {
+		t, dateOnly, err := parseTime(toStr)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("%w: to", ErrInvalidQuery)
+		}
+		if dateOnly {
+			t = t.AddDate(0, 0, 1)
+		}
+		to = t
+	}
+
+	from := to.Add(-defaultRange)
+	if fromStr != "" {
+		t, _, err := parseTime(fromStr)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("%w: from", ErrInvalidQuery)
+		}
+		from = t
+	}
+
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: from must be before to", ErrInvalidQuery)
+	}
+	if to.Sub(from) > maxRange {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: range longer than 366 days", ErrInvalidQuery)
+	}
+	return from, to, nil
+}
+
+func parseTime(v string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, false, nil
+	}
+	t, err := time.Parse(time.DateOnly, v)
+	return t, true, err
+}
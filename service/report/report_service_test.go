@@ -0,0 +1,118 @@
+package report_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"ecom/model"
+	"ecom/service/report"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type fakeTxRepo struct {
+	buckets []model.SalesBucket
+	top     map[string][]model.ProductSales
+	counts  map[model.TransactionStatus]int64
+
+	from, to time.Time
+	groupBy  model.SalesGroupBy
+	topLimit int
+}
+
+func (f *fakeTxRepo) SalesByPeriod(ctx context.Context, from, to time.Time, groupBy model.SalesGroupBy) ([]model.SalesBucket, error) {
+	f.from, f.to, f.groupBy = from, to, groupBy
+	return f.buckets, nil
+}
+
+func (f *fakeTxRepo) TopProducts(ctx context.Context, from, to time.Time, sortBy string, limit int) ([]model.ProductSales, error) {
+	f.topLimit = limit
+	return f.top[sortBy], nil
+}
+
+func (f *fakeTxRepo) CountByStatus(ctx context.Context, from, to time.Time) (map[model.TransactionStatus]int64, error) {
+	return f.counts, nil
+}
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestSales_DailyBucketsTotalsAndConversion(t *testing.T) {
+	shoes := model.ProductSales{ProductID: primitive.NewObjectID(), Name: "Sepatu", Units: 5, Revenue: 500_000}
+	repo := &fakeTxRepo{
+		buckets: []model.SalesBucket{
+			{Start: date(2025, 3, 1), Revenue: 300_000, Orders: 2, Units: 3, AverageOrderValue: 150_000},
+			{Start: date(2025, 3, 3), Revenue: 100_000, Orders: 2, Units: 2, AverageOrderValue: 50_000},
+		},
+		top: map[string][]model.ProductSales{
+			"units":   {shoes},
+			"revenue": {shoes},
+		},
+		counts: map[model.TransactionStatus]int64{
+			model.TransactionStatusSuccess: 4,
+			model.TransactionStatusFailed:  1,
+			model.TransactionStatusPending: 3,
+		},
+	}
+	svc := report.NewService(repo)
+
+	r, err := svc.Sales(context.Background(), model.SalesReportQuery{From: "2025-03-01", To: "2025-03-03"})
+	if err != nil {
+		t.Fatalf("Sales returned error: %v", err)
+	}
+
+	if !repo.to.Equal(date(2025, 3, 4)) || repo.groupBy != model.SalesGroupByDay || repo.topLimit != 10 {
+		t.Fatalf("expected inclusive range, day grouping and top 10, got to=%s group=%s top=%d", repo.to, repo.groupBy, repo.topLimit)
+	}
+	if len(r.Buckets) != 3 || r.Buckets[1].Period != "2025-03-02" || r.Buckets[1].Orders != 0 {
+		t.Fatalf("expected 3 daily buckets with an empty 2025-03-02, got %+v", r.Buckets)
+	}
+	if r.Revenue != 400_000 || r.Orders != 4 || r.AverageOrderValue != 100_000 {
+		t.Fatalf("expected revenue 400000 / 4 orders / aov 100000, got %v / %d / %v", r.Revenue, r.Orders, r.AverageOrderValue)
+	}
+	if r.Conversion.SuccessRate != 0.8 || r.Conversion.FailedRate != 0.2 || r.Conversion.Pending != 3 {
+		t.Fatalf("expected 80%% success over settled transactions, got %+v", r.Conversion)
+	}
+	if len(r.TopByUnits) != 1 || r.TopByUnits[0].Name != "Sepatu" {
+		t.Fatalf("expected top product Sepatu, got %+v", r.TopByUnits)
+	}
+}
+
+func TestSales_WeeklyAndMonthlyLabels(t *testing.T) {
+	svc := report.NewService(&fakeTxRepo{})
+
+	weekly, err := svc.Sales(context.Background(), model.SalesReportQuery{From: "2025-03-05", To: "2025-03-16", GroupBy: "week"})
+	if err != nil {
+		t.Fatalf("Sales returned error: %v", err)
+	}
+	// 5 Maret 2025 hari Rabu, minggu pertama mulai Senin 3 Maret
+	if len(weekly.Buckets) != 2 || !weekly.Buckets[0].Start.Equal(date(2025, 3, 3)) || weekly.Buckets[0].Period != "2025-W10" {
+		t.Fatalf("unexpected weekly buckets %+v", weekly.Buckets)
+	}
+
+	monthly, err := svc.Sales(context.Background(), model.SalesReportQuery{From: "2025-01-15", To: "2025-03-01", GroupBy: "MONTH", Top: 500})
+	if err != nil {
+		t.Fatalf("Sales returned error: %v", err)
+	}
+	if len(monthly.Buckets) != 3 || monthly.Buckets[2].Period != "2025-03" {
+		t.Fatalf("unexpected monthly buckets %+v", monthly.Buckets)
+	}
+}
+
+func TestSales_InvalidQuery(t *testing.T) {
+	svc := report.NewService(&fakeTxRepo{})
+
+	for _, q := range []model.SalesReportQuery{
+		{GroupBy: "year"},
+		{From: "kemarin"},
+		{From: "2025-03-10", To: "2025-03-01"},
+		{From: "2023-01-01", To: "2025-01-01"},
+	} {
+		if _, err := svc.Sales(context.Background(), q); !errors.Is(err, report.ErrInvalidQuery) {
+			t.Fatalf("expected ErrInvalidQuery for %+v, got %v", q, err)
+		}
+	}
+}
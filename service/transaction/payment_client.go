@@ -0,0 +1,132 @@
+package transaction
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"ecom/model"
+	"ecom/util/auth"
+	"ecom/util/logging"
+	"ecom/util/tracing"
+)
+
+// PaymentClient drives the payment intent lifecycle on the payment service.
+type PaymentClient interface {
+	CreateIntent(ctx context.Context, req model.CreatePaymentRequest) (*model.Payment, error)
+	Authorize(ctx context.Context, paymentID string) (*model.Payment, error)
+	Capture(ctx context.Context, paymentID string, amount float64) (*model.Payment, error)
+	Void(ctx context.Context, paymentID string) (*model.Payment, error)
+	Review(ctx context.Context, paymentID string, req model.ReviewPaymentRequest) (*model.Payment, error)
+}
+
+// ClientMetrics observes calls to the payment service. op is create_intent,
+// authorize, capture, void or review.
+type ClientMetrics interface {
+	ObservePaymentCall(op string, d time.Duration, err error)
+}
+
+type httpPaymentClient struct {
+	baseURL    string
+	secret     []byte
+	httpClient *http.Client
+	metrics    ClientMetrics
+}
+
+type ClientOption func(*httpPaymentClient)
+
+func WithClientMetrics(m ClientMetrics) ClientOption {
+	return func(c *httpPaymentClient) {
+		c.metrics = m
+	}
+}
+
+// NewHTTPPaymentClient calls the payment service, signing every request with the shared secret.
+func NewHTTPPaymentClient(baseURL, secret string, opts ...ClientOption) PaymentClient {
+	c := &httpPaymentClient{
+		baseURL: baseURL,
+		secret:  []byte(secret),
+		httpClient: &http.Client{
+			Timeout:   5 * time.Second,
+			Transport: tracing.Transport(logging.Transport(nil)),
+		},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func (c *httpPaymentClient) CreateIntent(ctx context.Context, req model.CreatePaymentRequest) (*model.Payment, error) {
+	return c.call(ctx, "create_intent", "/payments/intents", req)
+}
+
+func (c *httpPaymentClient) Authorize(ctx context.Context, paymentID string) (*model.Payment, error) {
+	return c.call(ctx, "authorize", "/payments/"+paymentID+"/authorize", struct{}{})
+}
+
+func (c *httpPaymentClient) Capture(ctx context.Context, paymentID string, amount float64) (*model.Payment, error) {
+	return c.call(ctx, "capture", "/payments/"+paymentID+"/capture", model.CapturePaymentRequest{Amount: amount})
+}
+
+func (c *httpPaymentClient) Void(ctx context.Context, paymentID string) (*model.Payment, error) {
+	return c.call(ctx, "void", "/payments/"+paymentID+"/void", struct{}{})
+}
+
+func (c *httpPaymentClient) Review(ctx context.Context, paymentID string, req model.ReviewPaymentRequest) (*model.Payment, error) {
+	return c.call(ctx, "review", "/payments/"+paymentID+"/review", req)
+}
+
+// call is post with a span and the latency and outcome reported to the metrics.
+func (c *httpPaymentClient) call(ctx context.Context, op, path string, payload any) (*model.Payment, error) {
+	ctx, span := tracing.Start(ctx, "PaymentClient."+op)
+	defer span.End()
+
+	start := time.Now()
+	p, err := c.post(ctx, path, payload)
+	if err != nil {
+		tracing.Fail(span, err)
+	}
+	if c.metrics != nil {
+		c.metrics.ObservePaymentCall(op, time.Since(start), err)
+	}
+	return p, err
+}
+
+func (c *httpPaymentClient) post(ctx context.Context, path string, payload any) (*model.Payment, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	url := c.baseURL + path
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if err := auth.SignRequest(httpReq, c.secret, body); err != nil {
+		return nil, fmt.Errorf("sign payment request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return nil, fmt.Errorf("payment service returned status %d", resp.StatusCode)
+	}
+
+	// response payment service dibungkus respondOK: {"message": ..., "data": payment}
+	var out model.APIResponse[model.Payment]
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	return &out.Data, nil
+}
@@ -1,110 +1,197 @@
 package transaction
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"net/http"
+	"log/slog"
+	"strings"
 	"time"
 
 	"ecom/model"
+	"ecom/util/patch"
+	"ecom/util/tracing"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+var (
+	ErrTransactionNotFound    = errors.New("transaction not found")
+	ErrTransactionNotPending  = errors.New("transaction is no longer pending")
+	ErrProductNotActive       = errors.New("product is not available for sale")
+	ErrVariantRequired        = errors.New("product has variants, variant_id is required")
+	ErrVariantNotFound        = errors.New("variant not found")
+	ErrInvalidTransaction     = errors.New("invalid transaction")
+	ErrTransactionNotEditable = errors.New("transaction can no longer be edited")
+	ErrPaymentNotInReview     = errors.New("transaction has no payment held for review")
+)
+
 type Service interface {
-	CreateTransaction(ctx context.Context, req model.CreateTransactionRequest) (*model.Transaction, error)
-	GetAll(ctx context.Context) ([]model.Transaction, error)
-	GetByID(ctx context.Context, id string) (*model.Transaction, error)
-	Update(ctx context.Context, id string, req model.UpdateTransactionRequest) (*model.Transaction, error)
-	Delete(ctx context.Context, id string) error
+	CreateTransaction(ctx context.Context, p model.Principal, req model.CreateTransactionRequest) (*model.Transaction, error)
+	GetAll(ctx context.Context, p model.Principal) ([]model.Transaction, error)
+	GetByID(ctx context.Context, p model.Principal, id string) (*model.Transaction, error)
+	Lookup(ctx context.Context, id string) (*model.Transaction, error)
+	// Update edits a PENDING transaction, for callers with
+	// PermissionTransactionWriteAll. It fails with model.ErrVersionConflict when
+	// ifMatch is set and is not the current version of the transaction.
+	Update(ctx context.Context, p model.Principal, id string, req model.UpdateTransactionRequest, ifMatch int64) (*model.Transaction, error)
+	// Patch applies a JSON Merge Patch and saves only the fields it contains.
+	Patch(ctx context.Context, p model.Principal, id string, doc patch.Document, ifMatch int64) (*model.Transaction, error)
+	Delete(ctx context.Context, p model.Principal, id string) error
 	RunExpireJob(ctx context.Context) (int64, error)
+	ReleaseExpiredReservations(ctx context.Context) (int64, error)
+
+	// ReviewPayment approves or rejects the payment held for review of
+	// transaction id, with p as the reviewer. The payment service reports the
+	// outcome through ResolvePaymentReview before it answers, so the returned
+	// transaction is already settled.
+	ReviewPayment(ctx context.Context, p model.Principal, id string, req model.TransactionPaymentReviewRequest) (*model.Transaction, error)
+	// ResolvePaymentReview finishes a transaction whose payment was held for review.
+	ResolvePaymentReview(ctx context.Context, id string, result model.PaymentReviewResult) (*model.Transaction, error)
 }
 
 type ProductRepository interface {
 	FindByID(ctx context.Context, id primitive.ObjectID) (*model.Product, error)
-	Update(ctx context.Context, p *model.Product) error
+	Reserve(ctx context.Context, id, variantID primitive.ObjectID, qty int) (bool, error)
+	CommitReserved(ctx context.Context, id, variantID primitive.ObjectID, qty int) error
+	ReleaseReserved(ctx context.Context, id, variantID primitive.ObjectID, qty int) error
+	Restock(ctx context.Context, id, variantID primitive.ObjectID, qty int) error
 }
 
 type TransactionRepository interface {
 	Create(ctx context.Context, t *model.Transaction) error
 	FindAll(ctx context.Context) ([]model.Transaction, error)
+	FindAllByCustomer(ctx context.Context, customerID primitive.ObjectID) ([]model.Transaction, error)
 	FindByID(ctx context.Context, id primitive.ObjectID) (*model.Transaction, error)
 	Update(ctx context.Context, t *model.Transaction) error
+	UpdateFields(ctx context.Context, t *model.Transaction, fields []string) error
+	SetStatus(ctx context.Context, t *model.Transaction, from []model.TransactionStatus) (bool, error)
 	Delete(ctx context.Context, id primitive.ObjectID) error
 	ExpireOldPending(ctx context.Context, olderThan time.Duration) (int64, error)
 }
 
-type PaymentClient interface {
-	CreatePayment(ctx context.Context, req model.CreatePaymentRequest) (*model.Payment, error)
+type ReservationRepository interface {
+	Create(ctx context.Context, r *model.Reservation) error
+	FindByTransactionID(ctx context.Context, txID primitive.ObjectID) (*model.Reservation, error)
+	FindExpired(ctx context.Context, now time.Time) ([]model.Reservation, error)
+	UpdateStatus(ctx context.Context, id primitive.ObjectID, from, to model.ReservationStatus) (bool, error)
+	UpdateQty(ctx context.Context, id primitive.ObjectID, from, to int) (bool, error)
+	Extend(ctx context.Context, id primitive.ObjectID, until time.Time) (bool, error)
 }
 
-type httpPaymentClient struct {
-	baseURL    string
-	httpClient *http.Client
+// Metrics records checkout KPIs. See util/metrics for the Prometheus version.
+type Metrics interface {
+	// TransactionStatus counts n transactions entering status.
+	TransactionStatus(status model.TransactionStatus, n int64)
+	Revenue(amount float64)
+	StockOut()
+	// Expired counts what the expire job cleaned up, kind is "transaction" or "reservation".
+	Expired(kind string, n int64)
 }
 
-func NewHTTPPaymentClient(baseURL string) PaymentClient {
-	return &httpPaymentClient{
-		baseURL: baseURL,
-		httpClient: &http.Client{
-			Timeout: 5 * time.Second,
-		},
-	}
-}
+type noopMetrics struct{}
 
-func (c *httpPaymentClient) CreatePayment(ctx context.Context, req model.CreatePaymentRequest) (*model.Payment, error) {
-	body, err := json.Marshal(req)
-	if err != nil {
-		return nil, err
-	}
+func (noopMetrics) TransactionStatus(model.TransactionStatus, int64) {}
+func (noopMetrics) Revenue(float64)                                  {}
+func (noopMetrics) StockOut()                                        {}
+func (noopMetrics) Expired(string, int64)                            {}
 
-	url := c.baseURL + "/payments"
+const (
+	defaultReservationTTL = 15 * time.Minute
+	defaultPendingTTL     = 30 * time.Minute
+	defaultReviewTTL      = 24 * time.Hour
+)
 
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
-	if err != nil {
-		return nil, err
+type service struct {
+	productRepo     ProductRepository
+	txRepo          TransactionRepository
+	reservationRepo ReservationRepository
+	payment         PaymentClient
+	reservationTTL  time.Duration
+	pendingTTL      time.Duration
+	reviewTTL       time.Duration
+	metrics         Metrics
+	logger          *slog.Logger
+}
+
+type Option func(*service)
+
+// WithReservationTTL sets how long stock stays reserved for a PENDING transaction.
+func WithReservationTTL(ttl time.Duration) Option {
+	return func(s *service) {
+		if ttl > 0 {
+			s.reservationTTL = ttl
+		}
 	}
-	httpReq.Header.Set("Content-Type", "application/json")
+}
 
-	resp, err := c.httpClient.Do(httpReq)
-	if err != nil {
-		return nil, err
+// WithPendingTTL sets how old a PENDING transaction gets before RunExpireJob fails it.
+func WithPendingTTL(ttl time.Duration) Option {
+	return func(s *service) {
+		if ttl > 0 {
+			s.pendingTTL = ttl
+		}
 	}
-	defer resp.Body.Close()
+}
 
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		return nil, fmt.Errorf("payment service returned status %d", resp.StatusCode)
+// WithReviewTTL sets how long a transaction whose payment is held for review
+// keeps its stock and stays PENDING. It should match the review TTL of the
+// payment service.
+func WithReviewTTL(ttl time.Duration) Option {
+	return func(s *service) {
+		if ttl > 0 {
+			s.reviewTTL = ttl
+		}
 	}
+}
 
-	var payment model.Payment
-	if err := json.NewDecoder(resp.Body).Decode(&payment); err != nil {
-		return nil, err
+// WithMetrics reports checkout KPIs to m; without it they are discarded.
+func WithMetrics(m Metrics) Option {
+	return func(s *service) {
+		if m != nil {
+			s.metrics = m
+		}
 	}
-	return &payment, nil
 }
 
-type service struct {
-	productRepo ProductRepository
-	txRepo      TransactionRepository
-	payment     PaymentClient
+// WithLogger sets the logger for payment failures and compensations (default slog.Default()).
+func WithLogger(l *slog.Logger) Option {
+	return func(s *service) {
+		if l != nil {
+			s.logger = l
+		}
+	}
 }
 
 func NewService(
 	productRepo ProductRepository,
 	txRepo TransactionRepository,
+	reservationRepo ReservationRepository,
 	payment PaymentClient,
+	opts ...Option,
 ) Service {
-	return &service{
-		productRepo: productRepo,
-		txRepo:      txRepo,
-		payment:     payment,
+	s := &service{
+		productRepo:     productRepo,
+		txRepo:          txRepo,
+		reservationRepo: reservationRepo,
+		payment:         payment,
+		reservationTTL:  defaultReservationTTL,
+		pendingTTL:      defaultPendingTTL,
+		reviewTTL:       defaultReviewTTL,
+		metrics:         noopMetrics{},
+		logger:          slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
 // /transactions (POST)
-func (s *service) CreateTransaction(ctx context.Context, req model.CreateTransactionRequest) (*model.Transaction, error) {
+func (s *service) CreateTransaction(ctx context.Context, p model.Principal, req model.CreateTransactionRequest) (*model.Transaction, error) {
+	ctx, span := tracing.Start(ctx, "TransactionService.CreateTransaction")
+	defer span.End()
+
 	// Ambil & validasi product
 	prodID, err := primitive.ObjectIDFromHex(req.ProductID)
 	if err != nil {
@@ -116,106 +203,556 @@ func (s *service) CreateTransaction(ctx context.Context, req model.CreateTransac
 		return nil, fmt.Errorf("product not found")
 	}
 
-	if prod.Stock < req.Qty {
+	if prod.Status != model.ProductStatusActive {
+		return nil, ErrProductNotActive
+	}
+
+	// Produk dengan variant: harga dan stok diambil dari variant yang dipilih
+	var variantID primitive.ObjectID
+	price, available := prod.Price, prod.AvailableStock()
+	if len(prod.Variants) > 0 || req.VariantID != "" {
+		v, err := pickVariant(prod, req.VariantID)
+		if err != nil {
+			return nil, err
+		}
+		variantID = v.ID
+		price, available = prod.PriceOf(v), v.AvailableStock()
+	}
+
+	if available < req.Qty {
+		s.metrics.StockOut()
+		return nil, fmt.Errorf("insufficient stock")
+	}
+
+	// Reserve stok dulu supaya unit yang sama tidak terjual dua kali selama call payment
+	ok, err := s.productRepo.Reserve(ctx, prod.ID, variantID, req.Qty)
+	if err != nil {
+		return nil, fmt.Errorf("reserve stock: %w", err)
+	}
+	if !ok {
+		s.metrics.StockOut()
 		return nil, fmt.Errorf("insufficient stock")
 	}
 
-	total := prod.Price * float64(req.Qty)
+	total := price * float64(req.Qty)
 
 	//  Buat transaksi PENDING
 	tx := &model.Transaction{
+		CustomerID:  p.CustomerID,
 		ProductID:   prod.ID,
+		VariantID:   variantID,
 		Qty:         req.Qty,
 		TotalAmount: total,
-		Email:       req.Email,
+		Email:       p.Email,
 		Status:      model.TransactionStatusPending,
 	}
 
 	if err := s.txRepo.Create(ctx, tx); err != nil {
+		_ = s.productRepo.ReleaseReserved(ctx, prod.ID, variantID, req.Qty)
 		return nil, fmt.Errorf("create transaction: %w", err)
 	}
+	s.metrics.TransactionStatus(model.TransactionStatusPending, 1)
+
+	res := &model.Reservation{
+		ProductID:     prod.ID,
+		VariantID:     variantID,
+		TransactionID: tx.ID,
+		Qty:           req.Qty,
+		Status:        model.ReservationStatusActive,
+		ExpiresAt:     time.Now().Add(s.reservationTTL),
+	}
+	if err := s.reservationRepo.Create(ctx, res); err != nil {
+		_ = s.productRepo.ReleaseReserved(ctx, prod.ID, variantID, req.Qty)
+		s.setStatus(tx, model.TransactionStatusFailed)
+		_ = s.txRepo.Update(ctx, tx)
+		return nil, fmt.Errorf("create reservation: %w", err)
+	}
 
 	// Call Payment service
 	payReq := model.CreatePaymentRequest{
 		TransactionID: tx.ID.Hex(),
 		Amount:        total,
-		Email:         req.Email,
+		Email:         tx.Email,
 	}
 
-	payment, err := s.payment.CreatePayment(ctx, payReq)
+	// Payment: create intent -> authorize -> commit stok -> capture
+	payment, err := s.payment.CreateIntent(ctx, payReq)
 	if err != nil {
 		// kalau error call payment  FAILED
-		tx.Status = model.TransactionStatusFailed
-		_ = s.txRepo.Update(ctx, tx)
-		return nil, fmt.Errorf("payment error: %w", err)
+		return nil, s.failTransaction(ctx, tx, res, fmt.Errorf("payment error: %w", err))
+	}
+	tx.PaymentID = payment.ID
+
+	if payment.Status == model.PaymentStatusReview {
+		// ditahan risk engine: transaksi tetap PENDING dan stok tetap di-reserve
+		// sampai payment service mengirim hasil review atau review TTL habis
+		hold := time.Now().Add(s.reviewTTL)
+		ok, err := s.reservationRepo.Extend(ctx, res.ID, hold)
+		if err == nil && !ok {
+			err = errors.New("reservation is no longer active")
+		}
+		if err != nil {
+			// tanpa reservasi, approve nanti gagal di commit stok dan payment di-void
+			s.logger.ErrorContext(ctx, "extend reservation for payment review",
+				"transaction_id", tx.ID.Hex(), "reservation_id", res.ID.Hex(), "error", err)
+		}
+		tx.HoldUntil = &hold
+		if err := s.txRepo.Update(ctx, tx); err != nil {
+			return nil, fmt.Errorf("update transaction: %w", err)
+		}
+		s.logger.InfoContext(ctx, "transaction held for payment review",
+			"transaction_id", tx.ID.Hex(), "payment_id", tx.PaymentID.Hex())
+		return tx, nil
+	}
+
+	return s.completePayment(ctx, tx, res, payment)
+}
+
+// pickVariant resolves the variant a transaction is for. Products with variants
+// can only be bought through one of them.
+func pickVariant(prod *model.Product, variantID string) (*model.Variant, error) {
+	if variantID == "" {
+		return nil, ErrVariantRequired
 	}
+	id, err := primitive.ObjectIDFromHex(variantID)
+	if err != nil {
+		return nil, ErrVariantNotFound
+	}
+	v := prod.FindVariant(id)
+	if v == nil {
+		return nil, ErrVariantNotFound
+	}
+	return v, nil
+}
 
-	//  Update status & stok berdasarkan hasil payment
-	if payment.Status == model.PaymentStatusSuccess {
-		tx.Status = model.TransactionStatusSuccess
-		prod.Stock -= req.Qty
+// completePayment takes an opened payment through authorize -> commit stock -> capture
+// and settles tx accordingly. A declined payment returns tx FAILED without error.
+func (s *service) completePayment(ctx context.Context, tx *model.Transaction, res *model.Reservation, payment *model.Payment) (*model.Transaction, error) {
+	var err error
+	if payment.Status == model.PaymentStatusCreated {
+		payment, err = s.payment.Authorize(ctx, tx.PaymentID.Hex())
+		if err != nil {
+			_, _ = s.payment.Void(ctx, tx.PaymentID.Hex())
+			return nil, s.failTransaction(ctx, tx, res, fmt.Errorf("payment error: %w", err))
+		}
+	}
 
-		if err := s.productRepo.Update(ctx, prod); err != nil {
-			return nil, fmt.Errorf("update product stock: %w", err)
+	if payment.Status != model.PaymentStatusAuthorized {
+		// ditolak payment service, transaksi FAILED dan stok dikembalikan
+		if err := s.failTransaction(ctx, tx, res, nil); err != nil {
+			return nil, err
 		}
-	} else {
-		tx.Status = model.TransactionStatusFailed
+		return tx, nil
 	}
 
-	if err := s.txRepo.Update(ctx, tx); err != nil {
+	// Stok di-commit dulu, baru payment di-capture
+	if err := s.settleReservation(ctx, res, model.ReservationStatusCommitted); err != nil {
+		s.logger.ErrorContext(ctx, "commit reserved stock failed, voiding payment",
+			"transaction_id", tx.ID.Hex(), "payment_id", tx.PaymentID.Hex(), "error", err)
+		_, _ = s.payment.Void(ctx, tx.PaymentID.Hex())
+		s.setStatus(tx, model.TransactionStatusFailed)
+		_ = s.txRepo.Update(ctx, tx)
+		return nil, fmt.Errorf("commit reserved stock: %w", err)
+	}
+
+	captured, err := s.payment.Capture(ctx, tx.PaymentID.Hex(), 0)
+	if err == nil && captured.Status != model.PaymentStatusSuccess {
+		err = fmt.Errorf("payment status %s after capture", captured.Status)
+	}
+	if err != nil {
+		// capture gagal: batalkan otorisasi dan kembalikan stok yang sudah di-commit
+		s.logger.ErrorContext(ctx, "capture failed, voiding payment and restocking",
+			"transaction_id", tx.ID.Hex(), "payment_id", tx.PaymentID.Hex(), "error", err)
+		_, _ = s.payment.Void(ctx, tx.PaymentID.Hex())
+		if rerr := s.productRepo.Restock(ctx, res.ProductID, res.VariantID, res.Qty); rerr != nil {
+			s.logger.ErrorContext(ctx, "restock after failed capture",
+				"transaction_id", tx.ID.Hex(), "product_id", res.ProductID.Hex(), "qty", res.Qty, "error", rerr)
+		}
+		s.setStatus(tx, model.TransactionStatusFailed)
+		_ = s.txRepo.Update(ctx, tx)
+		return nil, fmt.Errorf("capture payment: %w", err)
+	}
+
+	// Payment sudah di-capture dan stok sudah keluar, jadi SUCCESS tidak boleh
+	// gagal karena version naik (mis. expire job menandai FAILED di tengah capture)
+	s.setStatus(tx, model.TransactionStatusSuccess)
+	ok, err := s.txRepo.SetStatus(ctx, tx, []model.TransactionStatus{model.TransactionStatusPending, model.TransactionStatusFailed})
+	if err == nil && !ok {
+		err = ErrTransactionNotFound
+	}
+	if err != nil {
+		s.logger.ErrorContext(ctx, "payment captured but transaction not marked SUCCESS",
+			"transaction_id", tx.ID.Hex(), "payment_id", tx.PaymentID.Hex(), "error", err)
 		return nil, fmt.Errorf("update transaction: %w", err)
 	}
+	s.logger.InfoContext(ctx, "transaction completed",
+		"transaction_id", tx.ID.Hex(), "payment_id", tx.PaymentID.Hex(), "amount", tx.TotalAmount)
 
 	return tx, nil
 }
 
+// /transactions/{id}/payment-review (POST), admin
+func (s *service) ReviewPayment(ctx context.Context, p model.Principal, id string, req model.TransactionPaymentReviewRequest) (*model.Transaction, error) {
+	ctx, span := tracing.Start(ctx, "TransactionService.ReviewPayment")
+	defer span.End()
+
+	if !p.Can(model.PermissionPaymentReview) {
+		return nil, ErrTransactionNotFound
+	}
+	if !strings.EqualFold(req.Decision, "approve") && !strings.EqualFold(req.Decision, "reject") {
+		return nil, fmt.Errorf("%w: decision must be approve or reject", ErrInvalidTransaction)
+	}
+	tx, err := s.findAccessible(ctx, p, id, model.PermissionPaymentReview)
+	if err != nil {
+		return nil, err
+	}
+	if tx.Status != model.TransactionStatusPending || tx.HoldUntil == nil || tx.PaymentID.IsZero() {
+		return nil, ErrPaymentNotInReview
+	}
+
+	// reviewer selalu admin yang login
+	review := model.ReviewPaymentRequest{Decision: req.Decision, Reviewer: p.Email, Note: req.Note}
+	if _, err := s.payment.Review(ctx, tx.PaymentID.Hex(), review); err != nil {
+		return nil, fmt.Errorf("review payment: %w", err)
+	}
+	s.logger.InfoContext(ctx, "payment reviewed",
+		"transaction_id", tx.ID.Hex(), "payment_id", tx.PaymentID.Hex(), "decision", review.Decision, "reviewer", review.Reviewer)
+
+	return s.Lookup(ctx, id)
+}
+
+// /internal/transactions/{id}/payment-review (POST), dipanggil payment service
+func (s *service) ResolvePaymentReview(ctx context.Context, id string, result model.PaymentReviewResult) (*model.Transaction, error) {
+	ctx, span := tracing.Start(ctx, "TransactionService.ResolvePaymentReview")
+	defer span.End()
+
+	tx, err := s.Lookup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if tx.Status != model.TransactionStatusPending {
+		return nil, ErrTransactionNotPending
+	}
+
+	paymentID, err := primitive.ObjectIDFromHex(result.PaymentID)
+	if err != nil || paymentID != tx.PaymentID {
+		return nil, fmt.Errorf("payment %s does not belong to transaction %s", result.PaymentID, id)
+	}
+
+	res, err := s.reservationRepo.FindByTransactionID(ctx, tx.ID)
+	if err != nil {
+		return nil, fmt.Errorf("find reservation: %w", err)
+	}
+
+	if !result.Approved {
+		if err := s.failTransaction(ctx, tx, res, nil); err != nil {
+			return nil, err
+		}
+		return tx, nil
+	}
+
+	// payment sudah CREATED lagi setelah di-approve, lanjutkan dari authorize
+	return s.completePayment(ctx, tx, res, &model.Payment{ID: paymentID, Status: model.PaymentStatusCreated})
+}
+
+// failTransaction releases the reservation and marks tx FAILED. cause is returned
+// as is, so callers can use it directly as their error result.
+func (s *service) failTransaction(ctx context.Context, tx *model.Transaction, res *model.Reservation, cause error) error {
+	attrs := []any{"transaction_id", tx.ID.Hex()}
+	if cause != nil {
+		s.logger.WarnContext(ctx, "transaction failed", append(attrs, "error", cause)...)
+	} else {
+		s.logger.InfoContext(ctx, "transaction declined by payment", attrs...)
+	}
+	if err := s.settleReservation(ctx, res, model.ReservationStatusReleased); err != nil {
+		s.logger.ErrorContext(ctx, "release reservation", append(attrs, "error", err)...)
+	}
+	s.setStatus(tx, model.TransactionStatusFailed)
+	if err := s.txRepo.Update(ctx, tx); err != nil && cause == nil {
+		return fmt.Errorf("update transaction: %w", err)
+	}
+	return cause
+}
+
+// setStatus moves tx to status and counts it; SUCCESS also adds to revenue.
+func (s *service) setStatus(tx *model.Transaction, status model.TransactionStatus) {
+	tx.Status = status
+	s.metrics.TransactionStatus(status, 1)
+	if status == model.TransactionStatusSuccess {
+		s.metrics.Revenue(tx.TotalAmount)
+	}
+}
+
+// settleReservation closes an ACTIVE reservation. COMMITTED moves the units from
+// reserved to sold, every other status gives them back to available stock.
+func (s *service) settleReservation(ctx context.Context, res *model.Reservation, to model.ReservationStatus) error {
+	ok, err := s.reservationRepo.UpdateStatus(ctx, res.ID, model.ReservationStatusActive, to)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("reservation %s is no longer active", res.ID.Hex())
+	}
+	res.Status = to
+
+	if to == model.ReservationStatusCommitted {
+		return s.productRepo.CommitReserved(ctx, res.ProductID, res.VariantID, res.Qty)
+	}
+	return s.productRepo.ReleaseReserved(ctx, res.ProductID, res.VariantID, res.Qty)
+}
+
 // /transactions (GET)
-func (s *service) GetAll(ctx context.Context) ([]model.Transaction, error) {
-	return s.txRepo.FindAll(ctx)
+func (s *service) GetAll(ctx context.Context, p model.Principal) ([]model.Transaction, error) {
+	ctx, span := tracing.Start(ctx, "TransactionService.GetAll")
+	defer span.End()
+
+	if p.Can(model.PermissionTransactionReadAll) {
+		return s.txRepo.FindAll(ctx)
+	}
+	return s.txRepo.FindAllByCustomer(ctx, p.CustomerID)
 }
 
 // /transactions/{id} (GET)
-func (s *service) GetByID(ctx context.Context, id string) (*model.Transaction, error) {
+func (s *service) GetByID(ctx context.Context, p model.Principal, id string) (*model.Transaction, error) {
+	ctx, span := tracing.Start(ctx, "TransactionService.GetByID")
+	defer span.End()
+
+	return s.findAccessible(ctx, p, id, model.PermissionTransactionReadAll)
+}
+
+// /internal/transactions/{id} (GET), dipanggil payment service untuk verifikasi
+func (s *service) Lookup(ctx context.Context, id string) (*model.Transaction, error) {
+	ctx, span := tracing.Start(ctx, "TransactionService.Lookup")
+	defer span.End()
+
 	objID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return nil, fmt.Errorf("invalid id")
 	}
-	return s.txRepo.FindByID(ctx, objID)
+	tx, err := s.txRepo.FindByID(ctx, objID)
+	if err != nil {
+		return nil, ErrTransactionNotFound
+	}
+	return tx, nil
 }
 
 // /transactions/{id} (PUT)
-func (s *service) Update(ctx context.Context, id string, req model.UpdateTransactionRequest) (*model.Transaction, error) {
-	objID, err := primitive.ObjectIDFromHex(id)
+func (s *service) Update(ctx context.Context, p model.Principal, id string, req model.UpdateTransactionRequest, ifMatch int64) (*model.Transaction, error) {
+	ctx, span := tracing.Start(ctx, "TransactionService.Update")
+	defer span.End()
+
+	tx, err := s.findEditable(ctx, p, id, ifMatch)
 	if err != nil {
-		return nil, fmt.Errorf("invalid id")
+		return nil, err
 	}
-
-	tx, err := s.txRepo.FindByID(ctx, objID)
+	undo, err := s.edit(ctx, tx, req)
 	if err != nil {
 		return nil, err
 	}
-
-	tx.Qty = req.Qty
-	tx.Email = req.Email
 	tx.UpdatedAt = time.Now()
 
 	if err := s.txRepo.Update(ctx, tx); err != nil {
+		undo()
+		return nil, err
+	}
+	return tx, nil
+}
+
+// /transactions/{id} (PATCH)
+func (s *service) Patch(ctx context.Context, p model.Principal, id string, doc patch.Document, ifMatch int64) (*model.Transaction, error) {
+	ctx, span := tracing.Start(ctx, "TransactionService.Patch")
+	defer span.End()
+
+	tx, err := s.findEditable(ctx, p, id, ifMatch)
+	if err != nil {
+		return nil, err
+	}
+	if len(doc) == 0 {
+		return tx, nil
+	}
+
+	req, err := patch.Apply(model.UpdateTransactionRequest{Qty: tx.Qty, Email: tx.Email}, doc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTransaction, err)
+	}
+	qty := tx.Qty
+	undo, err := s.edit(ctx, tx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := doc.Fields()
+	if tx.Qty != qty {
+		fields = append(fields, "total_amount")
+	}
+	if err := s.txRepo.UpdateFields(ctx, tx, fields); err != nil {
+		undo()
+		return nil, err
+	}
+	return tx, nil
+}
+
+// findEditable loads a transaction for PUT/PATCH. Only callers with
+// PermissionTransactionWriteAll edit transactions, and only while PENDING:
+// after that qty and amount are what was paid and taken from stock.
+func (s *service) findEditable(ctx context.Context, p model.Principal, id string, ifMatch int64) (*model.Transaction, error) {
+	if !p.Can(model.PermissionTransactionWriteAll) {
+		return nil, ErrTransactionNotFound
+	}
+	tx, err := s.findAccessible(ctx, p, id, model.PermissionTransactionWriteAll)
+	if err != nil {
 		return nil, err
 	}
+	if ifMatch != 0 && ifMatch != tx.Version {
+		return nil, fmt.Errorf("%w: current version is %d", model.ErrVersionConflict, tx.Version)
+	}
+	if tx.Status != model.TransactionStatusPending {
+		return nil, fmt.Errorf("%w: status is %s", ErrTransactionNotEditable, tx.Status)
+	}
 	return tx, nil
 }
 
+// edit validates req and applies it to tx. A new qty is priced at the unit
+// price of the order and resizes its stock reservation; undo gives the stock
+// back when tx can't be saved. Once a payment is open its amount is fixed, so
+// only the email can still change.
+func (s *service) edit(ctx context.Context, tx *model.Transaction, req model.UpdateTransactionRequest) (undo func(), err error) {
+	undo = func() {}
+	if req.Qty <= 0 {
+		return undo, fmt.Errorf("%w: qty must be > 0", ErrInvalidTransaction)
+	}
+	email := strings.TrimSpace(req.Email)
+	if email == "" || !strings.Contains(email, "@") {
+		return undo, fmt.Errorf("%w: invalid email", ErrInvalidTransaction)
+	}
+
+	if req.Qty != tx.Qty {
+		if !tx.PaymentID.IsZero() {
+			return undo, fmt.Errorf("%w: qty cannot change once a payment is open", ErrTransactionNotEditable)
+		}
+		res, err := s.reservationRepo.FindByTransactionID(ctx, tx.ID)
+		if err != nil {
+			return undo, fmt.Errorf("find reservation: %w", err)
+		}
+		if err := s.resizeReservation(ctx, res, req.Qty); err != nil {
+			return undo, err
+		}
+		oldQty, oldTotal := tx.Qty, tx.TotalAmount
+		undo = func() {
+			if err := s.resizeReservation(ctx, res, oldQty); err != nil {
+				s.logger.ErrorContext(ctx, "undo reservation resize",
+					"transaction_id", tx.ID.Hex(), "reservation_id", res.ID.Hex(), "error", err)
+			}
+			tx.Qty, tx.TotalAmount = oldQty, oldTotal
+		}
+		tx.TotalAmount = tx.TotalAmount / float64(tx.Qty) * float64(req.Qty)
+		tx.Qty = req.Qty
+	}
+	tx.Email = email
+	return undo, nil
+}
+
+// resizeReservation moves an ACTIVE reservation to qty units, reserving or
+// releasing the difference on the product.
+func (s *service) resizeReservation(ctx context.Context, res *model.Reservation, qty int) error {
+	if res.Status != model.ReservationStatusActive {
+		return fmt.Errorf("%w: stock reservation is %s", ErrTransactionNotEditable, res.Status)
+	}
+	delta := qty - res.Qty
+	if delta > 0 {
+		ok, err := s.productRepo.Reserve(ctx, res.ProductID, res.VariantID, delta)
+		if err != nil {
+			return fmt.Errorf("reserve stock: %w", err)
+		}
+		if !ok {
+			s.metrics.StockOut()
+			return fmt.Errorf("%w: insufficient stock", ErrInvalidTransaction)
+		}
+	}
+
+	ok, err := s.reservationRepo.UpdateQty(ctx, res.ID, res.Qty, qty)
+	if err == nil && !ok {
+		err = fmt.Errorf("%w: stock reservation is no longer active", ErrTransactionNotEditable)
+	}
+	if err != nil {
+		if delta > 0 {
+			_ = s.productRepo.ReleaseReserved(ctx, res.ProductID, res.VariantID, delta)
+		}
+		return err
+	}
+	res.Qty = qty
+
+	if delta < 0 {
+		return s.productRepo.ReleaseReserved(ctx, res.ProductID, res.VariantID, -delta)
+	}
+	return nil
+}
+
 // /transactions/{id} (DELETE)
-func (s *service) Delete(ctx context.Context, id string) error {
+func (s *service) Delete(ctx context.Context, p model.Principal, id string) error {
+	ctx, span := tracing.Start(ctx, "TransactionService.Delete")
+	defer span.End()
+
+	tx, err := s.findAccessible(ctx, p, id, model.PermissionTransactionDelete)
+	if err != nil {
+		return err
+	}
+	return s.txRepo.Delete(ctx, tx.ID)
+}
+
+// findAccessible loads a transaction that belongs to the caller, or any transaction
+// when the caller's role has perm. Transactions the caller may not touch are
+// reported as not found so their IDs can't be probed.
+func (s *service) findAccessible(ctx context.Context, p model.Principal, id string, perm model.Permission) (*model.Transaction, error) {
 	objID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return fmt.Errorf("invalid id")
+		return nil, fmt.Errorf("invalid id")
+	}
+
+	tx, err := s.txRepo.FindByID(ctx, objID)
+	if err != nil {
+		return nil, ErrTransactionNotFound
+	}
+	if tx.CustomerID != p.CustomerID && !p.Can(perm) {
+		return nil, ErrTransactionNotFound
 	}
-	return s.txRepo.Delete(ctx, objID)
+	return tx, nil
 }
 
 // cron job transaksi PENDING yang terlalu lama
 func (s *service) RunExpireJob(ctx context.Context) (int64, error) {
-	// expire PENDING lebih tua dari 30 menit
-	return s.txRepo.ExpireOldPending(ctx, 30*time.Minute)
+	ctx, span := tracing.Start(ctx, "TransactionService.RunExpireJob")
+	defer span.End()
+
+	// expire PENDING lebih tua dari pendingTTL (default 30 menit)
+	n, err := s.txRepo.ExpireOldPending(ctx, s.pendingTTL)
+	if err != nil {
+		return 0, err
+	}
+	s.metrics.Expired("transaction", n)
+	s.metrics.TransactionStatus(model.TransactionStatusFailed, n)
+	return n, nil
+}
+
+// cron job reservasi yang sudah lewat expires_at, stok dikembalikan ke available
+func (s *service) ReleaseExpiredReservations(ctx context.Context) (int64, error) {
+	ctx, span := tracing.Start(ctx, "TransactionService.ReleaseExpiredReservations")
+	defer span.End()
+
+	expired, err := s.reservationRepo.FindExpired(ctx, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	var released int64
+	for i := range expired {
+		if err := s.settleReservation(ctx, &expired[i], model.ReservationStatusExpired); err != nil {
+			s.logger.WarnContext(ctx, "release expired reservation",
+				"reservation_id", expired[i].ID.Hex(), "transaction_id", expired[i].TransactionID.Hex(), "error", err)
+			continue
+		}
+		released++
+	}
+	s.metrics.Expired("reservation", released)
+	return released, nil
 }
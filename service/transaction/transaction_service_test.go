@@ -1,34 +1,90 @@
 package transaction_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"ecom/model"
 	txsvc "ecom/service/transaction"
+	"ecom/util/auth"
+	"ecom/util/logging"
+	"ecom/util/patch"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 type fakeProductRepo struct {
 	findByIDResult *model.Product
 	findByIDErr    error
 
-	updateCalled bool
-	updateInput  *model.Product
-	updateErr    error
+	reserveCalled bool
+	reserveFail   bool
+	reserveErr    error
+
+	commitCalled  bool
+	releaseCalled bool
+	restockCalled bool
 }
 
 func (f *fakeProductRepo) FindByID(ctx context.Context, id primitive.ObjectID) (*model.Product, error) {
 	return f.findByIDResult, f.findByIDErr
 }
 
-func (f *fakeProductRepo) Update(ctx context.Context, p *model.Product) error {
-	f.updateCalled = true
-	f.updateInput = p
-	return f.updateErr
+// counters returns the stock fields the call targets: the product, or one of its variants.
+func (f *fakeProductRepo) counters(variantID primitive.ObjectID) (stock, reserved *int) {
+	if variantID.IsZero() {
+		return &f.findByIDResult.Stock, &f.findByIDResult.Reserved
+	}
+	v := f.findByIDResult.FindVariant(variantID)
+	return &v.Stock, &v.Reserved
+}
+
+func (f *fakeProductRepo) Reserve(ctx context.Context, id, variantID primitive.ObjectID, qty int) (bool, error) {
+	f.reserveCalled = true
+	if f.reserveErr != nil || f.reserveFail {
+		return false, f.reserveErr
+	}
+	_, reserved := f.counters(variantID)
+	*reserved += qty
+	return true, nil
+}
+
+func (f *fakeProductRepo) CommitReserved(ctx context.Context, id, variantID primitive.ObjectID, qty int) error {
+	f.commitCalled = true
+	stock, reserved := f.counters(variantID)
+	*stock -= qty
+	*reserved -= qty
+	return nil
+}
+
+func (f *fakeProductRepo) Restock(ctx context.Context, id, variantID primitive.ObjectID, qty int) error {
+	f.restockCalled = true
+	stock, _ := f.counters(variantID)
+	*stock += qty
+	return nil
+}
+
+func (f *fakeProductRepo) ReleaseReserved(ctx context.Context, id, variantID primitive.ObjectID, qty int) error {
+	f.releaseCalled = true
+	if f.findByIDResult != nil {
+		_, reserved := f.counters(variantID)
+		*reserved -= qty
+	}
+	return nil
 }
 
 type fakeTxRepo struct {
@@ -36,8 +92,10 @@ type fakeTxRepo struct {
 	createInput  *model.Transaction
 	createErr    error
 
-	findAllResult []model.Transaction
-	findAllErr    error
+	findAllCalled       bool
+	findAllResult       []model.Transaction
+	findAllErr          error
+	findAllByCustomerID primitive.ObjectID
 
 	findByIDResult *model.Transaction
 	findByIDErr    error
@@ -46,6 +104,11 @@ type fakeTxRepo struct {
 	updateInput  *model.Transaction
 	updateErr    error
 
+	updatedFields []string
+
+	setStatusFrom []model.TransactionStatus
+	setStatusMiss bool
+
 	deleteCalled bool
 	deleteID     primitive.ObjectID
 	deleteErr    error
@@ -70,6 +133,12 @@ func (f *fakeTxRepo) Create(ctx context.Context, t *model.Transaction) error {
 }
 
 func (f *fakeTxRepo) FindAll(ctx context.Context) ([]model.Transaction, error) {
+	f.findAllCalled = true
+	return f.findAllResult, f.findAllErr
+}
+
+func (f *fakeTxRepo) FindAllByCustomer(ctx context.Context, customerID primitive.ObjectID) ([]model.Transaction, error) {
+	f.findAllByCustomerID = customerID
 	return f.findAllResult, f.findAllErr
 }
 
@@ -83,6 +152,22 @@ func (f *fakeTxRepo) Update(ctx context.Context, t *model.Transaction) error {
 	return f.updateErr
 }
 
+func (f *fakeTxRepo) UpdateFields(ctx context.Context, t *model.Transaction, fields []string) error {
+	f.updatedFields = fields
+	return f.Update(ctx, t)
+}
+
+func (f *fakeTxRepo) SetStatus(ctx context.Context, t *model.Transaction, from []model.TransactionStatus) (bool, error) {
+	f.updateCalled = true
+	f.updateInput = t
+	f.setStatusFrom = from
+	if f.setStatusMiss {
+		return false, nil
+	}
+	t.Version++
+	return true, nil
+}
+
 func (f *fakeTxRepo) Delete(ctx context.Context, id primitive.ObjectID) error {
 	f.deleteCalled = true
 	f.deleteID = id
@@ -95,36 +180,176 @@ func (f *fakeTxRepo) ExpireOldPending(ctx context.Context, olderThan time.Durati
 	return f.expireResult, f.expireErr
 }
 
+type fakeReservationRepo struct {
+	created []*model.Reservation
+
+	findExpiredResult []model.Reservation
+	findExpiredErr    error
+
+	// status per reservation ID, dipakai untuk simulasi UpdateStatus bersyarat
+	statuses map[primitive.ObjectID]model.ReservationStatus
+}
+
+func (f *fakeReservationRepo) Create(ctx context.Context, r *model.Reservation) error {
+	if r.ID.IsZero() {
+		r.ID = primitive.NewObjectID()
+	}
+	f.created = append(f.created, r)
+	f.setStatus(r.ID, r.Status)
+	return nil
+}
+
+func (f *fakeReservationRepo) FindByTransactionID(ctx context.Context, txID primitive.ObjectID) (*model.Reservation, error) {
+	for _, r := range f.created {
+		if r.TransactionID == txID {
+			return r, nil
+		}
+	}
+	return nil, errors.New("not found")
+}
+
+func (f *fakeReservationRepo) FindExpired(ctx context.Context, now time.Time) ([]model.Reservation, error) {
+	for _, r := range f.findExpiredResult {
+		if _, ok := f.statuses[r.ID]; !ok {
+			f.setStatus(r.ID, r.Status)
+		}
+	}
+	return f.findExpiredResult, f.findExpiredErr
+}
+
+func (f *fakeReservationRepo) UpdateStatus(ctx context.Context, id primitive.ObjectID, from, to model.ReservationStatus) (bool, error) {
+	if f.statuses[id] != from {
+		return false, nil
+	}
+	f.setStatus(id, to)
+	return true, nil
+}
+
+func (f *fakeReservationRepo) UpdateQty(ctx context.Context, id primitive.ObjectID, from, to int) (bool, error) {
+	for _, r := range f.created {
+		if r.ID == id && f.statuses[id] == model.ReservationStatusActive && r.Qty == from {
+			r.Qty = to
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *fakeReservationRepo) Extend(ctx context.Context, id primitive.ObjectID, until time.Time) (bool, error) {
+	for _, r := range f.created {
+		if r.ID == id && f.statuses[id] == model.ReservationStatusActive {
+			r.ExpiresAt = until
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *fakeReservationRepo) setStatus(id primitive.ObjectID, st model.ReservationStatus) {
+	if f.statuses == nil {
+		f.statuses = map[primitive.ObjectID]model.ReservationStatus{}
+	}
+	f.statuses[id] = st
+}
+
 type fakePaymentClient struct {
-	resp *model.Payment
-	err  error
+	err        error // error dari CreateIntent
+	declined   bool  // intent langsung FAILED (verifikasi gagal)
+	review     bool  // intent ditahan risk engine (REVIEW)
+	captureErr error
+
+	beforeCapture func()
+	// onReview meniru payment service yang memanggil balik shopping dengan hasil review
+	onReview    func(req model.ReviewPaymentRequest)
+	reviewInput model.ReviewPaymentRequest
 
 	called bool
 	input  model.CreatePaymentRequest
+	calls  []string
 }
 
-func (f *fakePaymentClient) CreatePayment(ctx context.Context, req model.CreatePaymentRequest) (*model.Payment, error) {
+func (f *fakePaymentClient) CreateIntent(ctx context.Context, req model.CreatePaymentRequest) (*model.Payment, error) {
 	f.called = true
 	f.input = req
-	return f.resp, f.err
+	f.calls = append(f.calls, "intent")
+	if f.err != nil {
+		return nil, f.err
+	}
+	status := model.PaymentStatusCreated
+	if f.declined {
+		status = model.PaymentStatusFailed
+	}
+	if f.review {
+		status = model.PaymentStatusReview
+	}
+	return &model.Payment{ID: primitive.NewObjectID(), Amount: req.Amount, Status: status}, nil
+}
+
+func (f *fakePaymentClient) Authorize(ctx context.Context, paymentID string) (*model.Payment, error) {
+	f.calls = append(f.calls, "authorize")
+	return &model.Payment{Status: model.PaymentStatusAuthorized}, nil
+}
+
+func (f *fakePaymentClient) Capture(ctx context.Context, paymentID string, amount float64) (*model.Payment, error) {
+	if f.beforeCapture != nil {
+		f.beforeCapture()
+	}
+	f.calls = append(f.calls, "capture")
+	if f.captureErr != nil {
+		return nil, f.captureErr
+	}
+	return &model.Payment{Status: model.PaymentStatusSuccess}, nil
 }
 
+func (f *fakePaymentClient) Review(ctx context.Context, paymentID string, req model.ReviewPaymentRequest) (*model.Payment, error) {
+	f.calls = append(f.calls, "review")
+	f.reviewInput = req
+	if f.onReview != nil {
+		f.onReview(req)
+	}
+	return &model.Payment{Status: model.PaymentStatusCreated}, nil
+}
+
+func (f *fakePaymentClient) Void(ctx context.Context, paymentID string) (*model.Payment, error) {
+	f.calls = append(f.calls, "void")
+	return &model.Payment{Status: model.PaymentStatusVoided}, nil
+}
+
+var (
+	customer = model.Principal{
+		CustomerID: primitive.NewObjectID(),
+		Email:      "user@example.com",
+		Role:       model.RoleCustomer,
+	}
+	staff = model.Principal{
+		CustomerID: primitive.NewObjectID(),
+		Email:      "staff@example.com",
+		Role:       model.RoleStaff,
+	}
+	admin = model.Principal{
+		CustomerID: primitive.NewObjectID(),
+		Email:      "admin@example.com",
+		Role:       model.RoleAdmin,
+	}
+)
+
 func newService(
 	prodRepo txsvc.ProductRepository,
 	txRepo txsvc.TransactionRepository,
 	payment txsvc.PaymentClient,
 ) txsvc.Service {
-	return txsvc.NewService(prodRepo, txRepo, payment)
+	return txsvc.NewService(prodRepo, txRepo, &fakeReservationRepo{}, payment)
 }
 
 func TestCreateTransaction_SuccessPaymentSuccess(t *testing.T) {
 
 	productID := primitive.NewObjectID()
 	product := &model.Product{
-		ID:    productID,
-		Name:  "Lapangan Futsal",
-		Price: 100_000,
-		Stock: 10,
+		ID:     productID,
+		Name:   "Lapangan Futsal",
+		Price:  100_000,
+		Stock:  10,
+		Status: model.ProductStatusActive,
 	}
 
 	prodRepo := &fakeProductRepo{
@@ -132,10 +357,11 @@ func TestCreateTransaction_SuccessPaymentSuccess(t *testing.T) {
 	}
 
 	txRepo := &fakeTxRepo{}
-	paymentClient := &fakePaymentClient{
-		resp: &model.Payment{
-			Status: model.PaymentStatusSuccess,
-		},
+	paymentClient := &fakePaymentClient{}
+	paymentClient.beforeCapture = func() {
+		if !prodRepo.commitCalled {
+			t.Error("expected stock to be committed before capture")
+		}
 	}
 
 	svc := newService(prodRepo, txRepo, paymentClient)
@@ -143,10 +369,9 @@ func TestCreateTransaction_SuccessPaymentSuccess(t *testing.T) {
 	req := model.CreateTransactionRequest{
 		ProductID: productID.Hex(),
 		Qty:       2,
-		Email:     "user@example.com",
 	}
 
-	tx, err := svc.CreateTransaction(context.Background(), req)
+	tx, err := svc.CreateTransaction(context.Background(), customer, req)
 	if err != nil {
 		t.Fatalf("CreateTransaction returned error: %v", err)
 	}
@@ -160,25 +385,71 @@ func TestCreateTransaction_SuccessPaymentSuccess(t *testing.T) {
 	if !txRepo.updateCalled {
 		t.Fatal("expected txRepo.Update to be called")
 	}
-	if !prodRepo.updateCalled {
-		t.Fatal("expected productRepo.Update to be called when payment success")
+	if !prodRepo.reserveCalled {
+		t.Fatal("expected productRepo.Reserve to be called before payment")
+	}
+	if !prodRepo.commitCalled {
+		t.Fatal("expected productRepo.CommitReserved to be called when payment success")
 	}
 
 	if tx.Status != model.TransactionStatusSuccess {
 		t.Fatalf("expected transaction status SUCCESS, got %s", tx.Status)
 	}
-	if prodRepo.updateInput.Stock != 8 { // 10 - 2
-		t.Fatalf("expected product stock 8, got %d", prodRepo.updateInput.Stock)
+	if product.Stock != 8 { // 10 - 2
+		t.Fatalf("expected product stock 8, got %d", product.Stock)
+	}
+	if product.Reserved != 0 {
+		t.Fatalf("expected product reserved 0, got %d", product.Reserved)
+	}
+	if tx.CustomerID != customer.CustomerID || tx.Email != customer.Email {
+		t.Fatalf("expected transaction linked to customer %s, got %s (%s)", customer.CustomerID.Hex(), tx.CustomerID.Hex(), tx.Email)
+	}
+	if paymentClient.input.Email != customer.Email {
+		t.Fatalf("expected payment email %s, got %s", customer.Email, paymentClient.input.Email)
+	}
+}
+
+// Expire job menaikkan version saat capture berjalan: transaksi tetap SUCCESS.
+func TestCreateTransaction_SuccessDespiteVersionConflict(t *testing.T) {
+	product := &model.Product{ID: primitive.NewObjectID(), Price: 100_000, Stock: 10, Status: model.ProductStatusActive}
+	prodRepo := &fakeProductRepo{findByIDResult: product}
+	txRepo := &fakeTxRepo{}
+	paymentClient := &fakePaymentClient{}
+	paymentClient.beforeCapture = func() { txRepo.updateErr = model.ErrVersionConflict }
+	svc := newService(prodRepo, txRepo, paymentClient)
+
+	tx, err := svc.CreateTransaction(context.Background(), customer, model.CreateTransactionRequest{ProductID: product.ID.Hex(), Qty: 1})
+	if err != nil {
+		t.Fatalf("CreateTransaction returned error: %v", err)
+	}
+	if tx.Status != model.TransactionStatusSuccess {
+		t.Fatalf("expected SUCCESS, got %s", tx.Status)
+	}
+	want := []model.TransactionStatus{model.TransactionStatusPending, model.TransactionStatusFailed}
+	if len(txRepo.setStatusFrom) != 2 || txRepo.setStatusFrom[0] != want[0] || txRepo.setStatusFrom[1] != want[1] {
+		t.Fatalf("expected SUCCESS to be set from %v regardless of version, got %v", want, txRepo.setStatusFrom)
+	}
+}
+
+func TestCreateTransaction_CapturedButTransactionGone(t *testing.T) {
+	product := &model.Product{ID: primitive.NewObjectID(), Price: 100_000, Stock: 10, Status: model.ProductStatusActive}
+	txRepo := &fakeTxRepo{setStatusMiss: true}
+	svc := newService(&fakeProductRepo{findByIDResult: product}, txRepo, &fakePaymentClient{})
+
+	_, err := svc.CreateTransaction(context.Background(), customer, model.CreateTransactionRequest{ProductID: product.ID.Hex(), Qty: 1})
+	if !errors.Is(err, txsvc.ErrTransactionNotFound) {
+		t.Fatalf("expected ErrTransactionNotFound when the transaction can't be marked SUCCESS, got %v", err)
 	}
 }
 
 func TestCreateTransaction_InsufficientStock(t *testing.T) {
 	productID := primitive.NewObjectID()
 	product := &model.Product{
-		ID:    productID,
-		Name:  "Lapangan Futsal",
-		Price: 100_000,
-		Stock: 1, // stok cuma 1
+		ID:     productID,
+		Name:   "Lapangan Futsal",
+		Price:  100_000,
+		Stock:  1, // stok cuma 1
+		Status: model.ProductStatusActive,
 	}
 
 	prodRepo := &fakeProductRepo{
@@ -193,10 +464,9 @@ func TestCreateTransaction_InsufficientStock(t *testing.T) {
 	req := model.CreateTransactionRequest{
 		ProductID: productID.Hex(),
 		Qty:       2, // butuh 2
-		Email:     "user@example.com",
 	}
 
-	_, err := svc.CreateTransaction(context.Background(), req)
+	_, err := svc.CreateTransaction(context.Background(), customer, req)
 	if err == nil {
 		t.Fatal("expected error for insufficient stock, got nil")
 	}
@@ -212,10 +482,11 @@ func TestCreateTransaction_InsufficientStock(t *testing.T) {
 func TestCreateTransaction_PaymentErrorMarksFailed(t *testing.T) {
 	productID := primitive.NewObjectID()
 	product := &model.Product{
-		ID:    productID,
-		Name:  "Lapangan Futsal",
-		Price: 100_000,
-		Stock: 10,
+		ID:     productID,
+		Name:   "Lapangan Futsal",
+		Price:  100_000,
+		Stock:  10,
+		Status: model.ProductStatusActive,
 	}
 
 	prodRepo := &fakeProductRepo{
@@ -232,10 +503,9 @@ func TestCreateTransaction_PaymentErrorMarksFailed(t *testing.T) {
 	req := model.CreateTransactionRequest{
 		ProductID: productID.Hex(),
 		Qty:       2,
-		Email:     "user@example.com",
 	}
 
-	_, err := svc.CreateTransaction(context.Background(), req)
+	_, err := svc.CreateTransaction(context.Background(), customer, req)
 	if err == nil {
 		t.Fatal("expected error when payment client fails, got nil")
 	}
@@ -246,6 +516,169 @@ func TestCreateTransaction_PaymentErrorMarksFailed(t *testing.T) {
 	if txRepo.updateInput.Status != model.TransactionStatusFailed {
 		t.Fatalf("expected transaction status FAILED, got %s", txRepo.updateInput.Status)
 	}
+	if !prodRepo.releaseCalled {
+		t.Fatal("expected reserved stock to be released when payment fails")
+	}
+	if product.Stock != 10 || product.Reserved != 0 {
+		t.Fatalf("expected stock 10 / reserved 0, got %d / %d", product.Stock, product.Reserved)
+	}
+}
+
+func TestCreateTransaction_PaymentDeclined(t *testing.T) {
+	product := &model.Product{ID: primitive.NewObjectID(), Price: 100_000, Stock: 10, Status: model.ProductStatusActive}
+	prodRepo := &fakeProductRepo{findByIDResult: product}
+	txRepo := &fakeTxRepo{}
+	paymentClient := &fakePaymentClient{declined: true}
+
+	svc := newService(prodRepo, txRepo, paymentClient)
+
+	tx, err := svc.CreateTransaction(context.Background(), customer, model.CreateTransactionRequest{
+		ProductID: product.ID.Hex(),
+		Qty:       2,
+	})
+	if err != nil {
+		t.Fatalf("CreateTransaction returned error: %v", err)
+	}
+	if tx.Status != model.TransactionStatusFailed {
+		t.Fatalf("expected transaction status FAILED, got %s", tx.Status)
+	}
+	if prodRepo.commitCalled || !prodRepo.releaseCalled {
+		t.Fatal("expected reserved stock to be released, not committed")
+	}
+	for _, c := range paymentClient.calls {
+		if c == "capture" || c == "authorize" {
+			t.Fatalf("expected no %s call for a declined intent", c)
+		}
+	}
+}
+
+func TestCreateTransaction_CaptureFailureRestocks(t *testing.T) {
+	product := &model.Product{ID: primitive.NewObjectID(), Price: 100_000, Stock: 10, Status: model.ProductStatusActive}
+	prodRepo := &fakeProductRepo{findByIDResult: product}
+	txRepo := &fakeTxRepo{}
+	paymentClient := &fakePaymentClient{captureErr: errors.New("capture timeout")}
+
+	svc := newService(prodRepo, txRepo, paymentClient)
+
+	_, err := svc.CreateTransaction(context.Background(), customer, model.CreateTransactionRequest{
+		ProductID: product.ID.Hex(),
+		Qty:       2,
+	})
+	if err == nil {
+		t.Fatal("expected error when capture fails, got nil")
+	}
+	if txRepo.updateInput.Status != model.TransactionStatusFailed {
+		t.Fatalf("expected transaction status FAILED, got %s", txRepo.updateInput.Status)
+	}
+	if !prodRepo.restockCalled || product.Stock != 10 || product.Reserved != 0 {
+		t.Fatalf("expected stock restored to 10 / reserved 0, got %d / %d", product.Stock, product.Reserved)
+	}
+	if last := paymentClient.calls[len(paymentClient.calls)-1]; last != "void" {
+		t.Fatalf("expected authorization to be voided, last call %s", last)
+	}
+}
+
+func TestCreateTransaction_ReservedStockNotAvailable(t *testing.T) {
+	productID := primitive.NewObjectID()
+	product := &model.Product{
+		ID:       productID,
+		Name:     "Lapangan Futsal",
+		Price:    100_000,
+		Stock:    3,
+		Reserved: 2, // 2 unit sedang di-reserve transaksi lain
+		Status:   model.ProductStatusActive,
+	}
+
+	prodRepo := &fakeProductRepo{
+		findByIDResult: product,
+	}
+
+	txRepo := &fakeTxRepo{}
+	paymentClient := &fakePaymentClient{}
+
+	svc := newService(prodRepo, txRepo, paymentClient)
+
+	req := model.CreateTransactionRequest{
+		ProductID: productID.Hex(),
+		Qty:       2,
+	}
+
+	_, err := svc.CreateTransaction(context.Background(), customer, req)
+	if err == nil {
+		t.Fatal("expected error when stock is already reserved, got nil")
+	}
+	if txRepo.createCalled || paymentClient.called {
+		t.Fatal("expected no transaction and no payment when stock is reserved")
+	}
+}
+
+func TestCreateTransaction_ReserveRaceLost(t *testing.T) {
+	productID := primitive.NewObjectID()
+	product := &model.Product{
+		ID:     productID,
+		Price:  100_000,
+		Stock:  2,
+		Status: model.ProductStatusActive,
+	}
+
+	// FindByID masih lihat stok cukup, tapi reserve atomik kalah duluan
+	prodRepo := &fakeProductRepo{
+		findByIDResult: product,
+		reserveFail:    true,
+	}
+
+	txRepo := &fakeTxRepo{}
+	paymentClient := &fakePaymentClient{}
+
+	svc := newService(prodRepo, txRepo, paymentClient)
+
+	_, err := svc.CreateTransaction(context.Background(), customer, model.CreateTransactionRequest{
+		ProductID: productID.Hex(),
+		Qty:       2,
+	})
+	if err == nil {
+		t.Fatal("expected insufficient stock error, got nil")
+	}
+	if txRepo.createCalled || paymentClient.called {
+		t.Fatal("expected no transaction and no payment when reserve fails")
+	}
+}
+
+func TestReleaseExpiredReservations(t *testing.T) {
+	product := &model.Product{ID: primitive.NewObjectID(), Stock: 10, Reserved: 5}
+	prodRepo := &fakeProductRepo{findByIDResult: product}
+
+	active := model.Reservation{
+		ID:        primitive.NewObjectID(),
+		ProductID: product.ID,
+		Qty:       3,
+		Status:    model.ReservationStatusActive,
+	}
+	alreadyCommitted := model.Reservation{
+		ID:        primitive.NewObjectID(),
+		ProductID: product.ID,
+		Qty:       2,
+		Status:    model.ReservationStatusCommitted,
+	}
+	resRepo := &fakeReservationRepo{
+		findExpiredResult: []model.Reservation{active, alreadyCommitted},
+	}
+
+	svc := txsvc.NewService(prodRepo, &fakeTxRepo{}, resRepo, &fakePaymentClient{})
+
+	released, err := svc.ReleaseExpiredReservations(context.Background())
+	if err != nil {
+		t.Fatalf("ReleaseExpiredReservations returned error: %v", err)
+	}
+	if released != 1 {
+		t.Fatalf("expected 1 released reservation, got %d", released)
+	}
+	if product.Reserved != 2 {
+		t.Fatalf("expected reserved 2 after release, got %d", product.Reserved)
+	}
+	if resRepo.statuses[active.ID] != model.ReservationStatusExpired {
+		t.Fatalf("expected reservation status EXPIRED, got %s", resRepo.statuses[active.ID])
+	}
 }
 
 func TestRunExpireJob_CallsRepoWithDuration(t *testing.T) {
@@ -269,4 +702,852 @@ func TestRunExpireJob_CallsRepoWithDuration(t *testing.T) {
 	if modified != 5 {
 		t.Fatalf("expected modified = 5, got %d", modified)
 	}
+	if txRepo.expireOlderThan != 30*time.Minute {
+		t.Fatalf("expected default pending TTL 30m, got %s", txRepo.expireOlderThan)
+	}
+}
+
+func TestRunExpireJob_PendingTTLOption(t *testing.T) {
+	txRepo := &fakeTxRepo{}
+	svc := txsvc.NewService(&fakeProductRepo{}, txRepo, &fakeReservationRepo{}, &fakePaymentClient{},
+		txsvc.WithPendingTTL(2*time.Hour),
+	)
+
+	if _, err := svc.RunExpireJob(context.Background()); err != nil {
+		t.Fatalf("RunExpireJob returned error: %v", err)
+	}
+	if txRepo.expireOlderThan != 2*time.Hour {
+		t.Fatalf("expected ExpireOldPending with 2h, got %s", txRepo.expireOlderThan)
+	}
+}
+
+func TestGetAll_OnlyCallerTransactions(t *testing.T) {
+	txRepo := &fakeTxRepo{}
+	svc := newService(&fakeProductRepo{}, txRepo, &fakePaymentClient{})
+
+	if _, err := svc.GetAll(context.Background(), customer); err != nil {
+		t.Fatalf("GetAll returned error: %v", err)
+	}
+	if txRepo.findAllByCustomerID != customer.CustomerID {
+		t.Fatalf("expected FindAllByCustomer with %s, got %s", customer.CustomerID.Hex(), txRepo.findAllByCustomerID.Hex())
+	}
+	if txRepo.findAllCalled {
+		t.Fatal("expected customer NOT to list every transaction")
+	}
+}
+
+func TestGetAll_StaffSeesAllTransactions(t *testing.T) {
+	txRepo := &fakeTxRepo{}
+	svc := newService(&fakeProductRepo{}, txRepo, &fakePaymentClient{})
+
+	if _, err := svc.GetAll(context.Background(), staff); err != nil {
+		t.Fatalf("GetAll returned error: %v", err)
+	}
+	if !txRepo.findAllCalled {
+		t.Fatal("expected staff to list every transaction")
+	}
+}
+
+func TestStaffCanViewButNotDelete(t *testing.T) {
+	other := &model.Transaction{
+		ID:         primitive.NewObjectID(),
+		CustomerID: customer.CustomerID,
+	}
+	txRepo := &fakeTxRepo{findByIDResult: other}
+	svc := newService(&fakeProductRepo{}, txRepo, &fakePaymentClient{})
+
+	if _, err := svc.GetByID(context.Background(), staff, other.ID.Hex()); err != nil {
+		t.Fatalf("expected staff to view transaction, got %v", err)
+	}
+	if err := svc.Delete(context.Background(), staff, other.ID.Hex()); !errors.Is(err, txsvc.ErrTransactionNotFound) {
+		t.Fatalf("expected staff delete to be refused, got %v", err)
+	}
+	if txRepo.deleteCalled {
+		t.Fatal("expected txRepo.Delete NOT to be called for staff")
+	}
+
+	if err := svc.Delete(context.Background(), admin, other.ID.Hex()); err != nil {
+		t.Fatalf("expected admin delete to succeed, got %v", err)
+	}
+	if !txRepo.deleteCalled || txRepo.deleteID != other.ID {
+		t.Fatal("expected txRepo.Delete to be called for admin")
+	}
+}
+
+func TestGetByID_OtherCustomerIsNotFound(t *testing.T) {
+	other := &model.Transaction{
+		ID:         primitive.NewObjectID(),
+		CustomerID: primitive.NewObjectID(),
+		Status:     model.TransactionStatusSuccess,
+	}
+	txRepo := &fakeTxRepo{findByIDResult: other}
+	svc := newService(&fakeProductRepo{}, txRepo, &fakePaymentClient{})
+
+	_, err := svc.GetByID(context.Background(), customer, other.ID.Hex())
+	if !errors.Is(err, txsvc.ErrTransactionNotFound) {
+		t.Fatalf("expected ErrTransactionNotFound, got %v", err)
+	}
+
+	if err := svc.Delete(context.Background(), customer, other.ID.Hex()); !errors.Is(err, txsvc.ErrTransactionNotFound) {
+		t.Fatalf("expected ErrTransactionNotFound on delete, got %v", err)
+	}
+	if txRepo.deleteCalled {
+		t.Fatal("expected txRepo.Delete NOT to be called for another customer's transaction")
+	}
+}
+
+func TestHTTPPaymentClient_SignsRequests(t *testing.T) {
+	verifier := auth.NewSignatureVerifier("shared-secret", time.Minute)
+
+	var verifyErr, replayErr error
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		verifyErr = verifier.VerifyRequest(r, body)
+		// request yang sama dikirim ulang harus ditolak
+		replayErr = verifier.VerifyRequest(r, body)
+
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(model.APIResponse[model.Payment]{
+			Message: "success",
+			Data:    model.Payment{Status: model.PaymentStatusSuccess},
+		})
+	}))
+	defer srv.Close()
+
+	client := txsvc.NewHTTPPaymentClient(srv.URL, "shared-secret")
+	payment, err := client.CreateIntent(context.Background(), model.CreatePaymentRequest{
+		TransactionID: primitive.NewObjectID().Hex(),
+		Amount:        100_000,
+		Email:         "user@example.com",
+	})
+	if err != nil {
+		t.Fatalf("CreatePayment returned error: %v", err)
+	}
+	if payment.Status != model.PaymentStatusSuccess {
+		t.Fatalf("expected payment status SUCCESS from response envelope, got %q", payment.Status)
+	}
+	if verifyErr != nil {
+		t.Fatalf("expected signed request to verify, got %v", verifyErr)
+	}
+	if !errors.Is(replayErr, auth.ErrReplayedRequest) {
+		t.Fatalf("expected replayed request to be rejected, got %v", replayErr)
+	}
+}
+
+func TestHTTPPaymentClient_WrongSecretRejected(t *testing.T) {
+	verifier := auth.NewSignatureVerifier("shared-secret", time.Minute)
+
+	var verifyErr error
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		verifyErr = verifier.VerifyRequest(r, body)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	client := txsvc.NewHTTPPaymentClient(srv.URL, "other-secret")
+	_, err := client.CreateIntent(context.Background(), model.CreatePaymentRequest{
+		TransactionID: primitive.NewObjectID().Hex(),
+		Amount:        100_000,
+		Email:         "user@example.com",
+	})
+	if err == nil {
+		t.Fatal("expected error when payment service rejects the request, got nil")
+	}
+	if !errors.Is(verifyErr, auth.ErrBadSignature) {
+		t.Fatalf("expected ErrBadSignature, got %v", verifyErr)
+	}
+}
+
+// heldForReview membuat transaksi yang payment-nya ditahan risk engine.
+func heldForReview(t *testing.T) (txsvc.Service, *fakeProductRepo, *fakeTxRepo, *fakePaymentClient, *model.Transaction) {
+	t.Helper()
+
+	product := &model.Product{ID: primitive.NewObjectID(), Name: "Lapangan Futsal", Price: 100_000, Stock: 10, Status: model.ProductStatusActive}
+	prodRepo := &fakeProductRepo{findByIDResult: product}
+	txRepo := &fakeTxRepo{}
+	paymentClient := &fakePaymentClient{review: true}
+	svc := txsvc.NewService(prodRepo, txRepo, &fakeReservationRepo{}, paymentClient)
+
+	tx, err := svc.CreateTransaction(context.Background(), customer, model.CreateTransactionRequest{
+		ProductID: product.ID.Hex(),
+		Qty:       2,
+	})
+	if err != nil {
+		t.Fatalf("CreateTransaction returned error: %v", err)
+	}
+	txRepo.findByIDResult = tx
+	return svc, prodRepo, txRepo, paymentClient, tx
+}
+
+func TestCreateTransaction_PaymentHeldForReview(t *testing.T) {
+	_, prodRepo, _, paymentClient, tx := heldForReview(t)
+
+	if tx.Status != model.TransactionStatusPending || tx.PaymentID.IsZero() {
+		t.Fatalf("expected PENDING transaction linked to the payment, got %s", tx.Status)
+	}
+	if len(paymentClient.calls) != 1 || paymentClient.calls[0] != "intent" {
+		t.Fatalf("expected only the intent call while held, got %v", paymentClient.calls)
+	}
+	if p := prodRepo.findByIDResult; p.Reserved != 2 || p.Stock != 10 {
+		t.Fatalf("expected stock to stay reserved (stock 10, reserved 2), got stock %d reserved %d", p.Stock, p.Reserved)
+	}
+}
+
+// Selama review, reservasi dan transaksi tidak boleh di-expire dengan TTL checkout biasa.
+func TestCreateTransaction_HeldForReviewOutlivesCheckoutTTLs(t *testing.T) {
+	product := &model.Product{ID: primitive.NewObjectID(), Price: 100_000, Stock: 10, Status: model.ProductStatusActive}
+	txRepo := &fakeTxRepo{}
+	resRepo := &fakeReservationRepo{}
+	svc := txsvc.NewService(&fakeProductRepo{findByIDResult: product}, txRepo, resRepo, &fakePaymentClient{review: true},
+		txsvc.WithReservationTTL(15*time.Minute),
+		txsvc.WithPendingTTL(30*time.Minute),
+		txsvc.WithReviewTTL(6*time.Hour),
+	)
+
+	tx, err := svc.CreateTransaction(context.Background(), customer, model.CreateTransactionRequest{ProductID: product.ID.Hex(), Qty: 1})
+	if err != nil {
+		t.Fatalf("CreateTransaction returned error: %v", err)
+	}
+	if tx.HoldUntil == nil || txRepo.updateInput.HoldUntil == nil {
+		t.Fatal("expected hold_until to be saved on the held transaction")
+	}
+	if left := time.Until(*tx.HoldUntil); left < 5*time.Hour || left > 6*time.Hour {
+		t.Fatalf("expected the transaction held for the review TTL, %s left", left)
+	}
+	if res := resRepo.created[0]; !res.ExpiresAt.Equal(*tx.HoldUntil) {
+		t.Fatalf("expected the reservation to be kept until %s, expires at %s", tx.HoldUntil, res.ExpiresAt)
+	}
+}
+
+func TestResolvePaymentReview_Approved(t *testing.T) {
+	svc, prodRepo, _, paymentClient, tx := heldForReview(t)
+
+	got, err := svc.ResolvePaymentReview(context.Background(), tx.ID.Hex(), model.PaymentReviewResult{
+		PaymentID: tx.PaymentID.Hex(),
+		Approved:  true,
+	})
+	if err != nil {
+		t.Fatalf("ResolvePaymentReview returned error: %v", err)
+	}
+	if got.Status != model.TransactionStatusSuccess {
+		t.Fatalf("expected transaction SUCCESS, got %s", got.Status)
+	}
+	if want := []string{"intent", "authorize", "capture"}; len(paymentClient.calls) != len(want) || paymentClient.calls[2] != "capture" {
+		t.Fatalf("expected payment calls %v, got %v", want, paymentClient.calls)
+	}
+	if p := prodRepo.findByIDResult; p.Reserved != 0 || p.Stock != 8 {
+		t.Fatalf("expected stock 8 reserved 0, got stock %d reserved %d", p.Stock, p.Reserved)
+	}
+
+	if _, err := svc.ResolvePaymentReview(context.Background(), tx.ID.Hex(), model.PaymentReviewResult{
+		PaymentID: tx.PaymentID.Hex(),
+		Approved:  true,
+	}); !errors.Is(err, txsvc.ErrTransactionNotPending) {
+		t.Fatalf("expected ErrTransactionNotPending on second result, got %v", err)
+	}
+}
+
+func TestReviewPayment_ReviewerIsTheAdmin(t *testing.T) {
+	svc, _, _, paymentClient, tx := heldForReview(t)
+	paymentClient.onReview = func(req model.ReviewPaymentRequest) {
+		if _, err := svc.ResolvePaymentReview(context.Background(), tx.ID.Hex(), model.PaymentReviewResult{
+			PaymentID: tx.PaymentID.Hex(),
+			Approved:  req.Decision == "approve",
+		}); err != nil {
+			t.Errorf("ResolvePaymentReview returned error: %v", err)
+		}
+	}
+
+	got, err := svc.ReviewPayment(context.Background(), admin, tx.ID.Hex(), model.TransactionPaymentReviewRequest{
+		Decision: "approve",
+		Note:     "customer confirmed by phone",
+	})
+	if err != nil {
+		t.Fatalf("ReviewPayment returned error: %v", err)
+	}
+	if paymentClient.reviewInput.Reviewer != admin.Email || paymentClient.reviewInput.Note != "customer confirmed by phone" {
+		t.Fatalf("expected the review sent as %s, got %+v", admin.Email, paymentClient.reviewInput)
+	}
+	if got.Status != model.TransactionStatusSuccess {
+		t.Fatalf("expected the settled transaction back, got %s", got.Status)
+	}
+
+	// sudah tidak ditahan lagi
+	if _, err := svc.ReviewPayment(context.Background(), admin, tx.ID.Hex(), model.TransactionPaymentReviewRequest{Decision: "reject"}); !errors.Is(err, txsvc.ErrPaymentNotInReview) {
+		t.Fatalf("expected ErrPaymentNotInReview, got %v", err)
+	}
+}
+
+func TestReviewPayment_Rejected(t *testing.T) {
+	tests := []struct {
+		name     string
+		p        model.Principal
+		decision string
+		wantErr  error
+	}{
+		{name: "owner", p: customer, decision: "approve", wantErr: txsvc.ErrTransactionNotFound},
+		{name: "staff", p: staff, decision: "approve", wantErr: txsvc.ErrTransactionNotFound},
+		{name: "unknown decision", p: admin, decision: "maybe", wantErr: txsvc.ErrInvalidTransaction},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, _, _, paymentClient, tx := heldForReview(t)
+
+			_, err := svc.ReviewPayment(context.Background(), tt.p, tx.ID.Hex(), model.TransactionPaymentReviewRequest{Decision: tt.decision})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			if len(paymentClient.calls) != 1 {
+				t.Fatalf("expected no review sent to payment, got %v", paymentClient.calls)
+			}
+		})
+	}
+}
+
+func TestResolvePaymentReview_Rejected(t *testing.T) {
+	svc, prodRepo, _, _, tx := heldForReview(t)
+
+	if _, err := svc.ResolvePaymentReview(context.Background(), tx.ID.Hex(), model.PaymentReviewResult{
+		PaymentID: primitive.NewObjectID().Hex(),
+	}); err == nil {
+		t.Fatal("expected error for a payment of another transaction, got nil")
+	}
+
+	got, err := svc.ResolvePaymentReview(context.Background(), tx.ID.Hex(), model.PaymentReviewResult{
+		PaymentID: tx.PaymentID.Hex(),
+		Approved:  false,
+	})
+	if err != nil {
+		t.Fatalf("ResolvePaymentReview returned error: %v", err)
+	}
+	if got.Status != model.TransactionStatusFailed {
+		t.Fatalf("expected transaction FAILED, got %s", got.Status)
+	}
+	if p := prodRepo.findByIDResult; p.Reserved != 0 || p.Stock != 10 {
+		t.Fatalf("expected reservation released (stock 10, reserved 0), got stock %d reserved %d", p.Stock, p.Reserved)
+	}
+}
+
+func TestCreateTransaction_ProductNotActive(t *testing.T) {
+	for _, status := range []model.ProductStatus{model.ProductStatusDraft, model.ProductStatusArchived} {
+		product := &model.Product{ID: primitive.NewObjectID(), Price: 100_000, Stock: 10, Status: status}
+		prodRepo := &fakeProductRepo{findByIDResult: product}
+		paymentClient := &fakePaymentClient{}
+		svc := newService(prodRepo, &fakeTxRepo{}, paymentClient)
+
+		_, err := svc.CreateTransaction(context.Background(), customer, model.CreateTransactionRequest{
+			ProductID: product.ID.Hex(),
+			Qty:       1,
+		})
+		if !errors.Is(err, txsvc.ErrProductNotActive) {
+			t.Fatalf("expected ErrProductNotActive for %s product, got %v", status, err)
+		}
+		if prodRepo.reserveCalled || paymentClient.called {
+			t.Fatalf("expected no reservation or payment for %s product", status)
+		}
+	}
+}
+
+func variantProduct() *model.Product {
+	price := 150_000.0
+	return &model.Product{
+		ID:     primitive.NewObjectID(),
+		Name:   "Kaos Polos",
+		Price:  100_000,
+		Status: model.ProductStatusActive,
+		Variants: []model.Variant{
+			{ID: primitive.NewObjectID(), SKU: "KAOS-M", Options: map[string]string{"size": "m"}, Stock: 5},
+			{ID: primitive.NewObjectID(), SKU: "KAOS-XL", Options: map[string]string{"size": "xl"}, Price: &price, Stock: 1},
+		},
+	}
+}
+
+func TestCreateTransaction_VariantStockAndPrice(t *testing.T) {
+	product := variantProduct()
+	xl := product.Variants[1].ID
+	prodRepo := &fakeProductRepo{findByIDResult: product}
+	txRepo := &fakeTxRepo{}
+	paymentClient := &fakePaymentClient{}
+	svc := newService(prodRepo, txRepo, paymentClient)
+
+	tx, err := svc.CreateTransaction(context.Background(), customer, model.CreateTransactionRequest{
+		ProductID: product.ID.Hex(),
+		VariantID: xl.Hex(),
+		Qty:       1,
+	})
+	if err != nil {
+		t.Fatalf("CreateTransaction returned error: %v", err)
+	}
+
+	if tx.Status != model.TransactionStatusSuccess || tx.VariantID != xl {
+		t.Fatalf("expected SUCCESS transaction for variant %s, got %s for %s", xl.Hex(), tx.Status, tx.VariantID.Hex())
+	}
+	if tx.TotalAmount != 150_000 || paymentClient.input.Amount != 150_000 {
+		t.Fatalf("expected variant price override 150000, got total %v payment %v", tx.TotalAmount, paymentClient.input.Amount)
+	}
+	if v := product.Variants[1]; v.Stock != 0 || v.Reserved != 0 {
+		t.Fatalf("expected variant stock 0 reserved 0, got stock %d reserved %d", v.Stock, v.Reserved)
+	}
+	if v := product.Variants[0]; v.Stock != 5 {
+		t.Fatalf("expected other variant untouched, got stock %d", v.Stock)
+	}
+}
+
+func TestCreateTransaction_VariantRequired(t *testing.T) {
+	product := variantProduct()
+	prodRepo := &fakeProductRepo{findByIDResult: product}
+	svc := newService(prodRepo, &fakeTxRepo{}, &fakePaymentClient{})
+
+	for variantID, want := range map[string]error{
+		"":                            txsvc.ErrVariantRequired,
+		"not-an-id":                   txsvc.ErrVariantNotFound,
+		primitive.NewObjectID().Hex(): txsvc.ErrVariantNotFound,
+	} {
+		_, err := svc.CreateTransaction(context.Background(), customer, model.CreateTransactionRequest{
+			ProductID: product.ID.Hex(),
+			VariantID: variantID,
+			Qty:       1,
+		})
+		if !errors.Is(err, want) {
+			t.Fatalf("variant %q: expected %v, got %v", variantID, want, err)
+		}
+	}
+	if prodRepo.reserveCalled {
+		t.Fatal("expected no reservation without a valid variant")
+	}
+}
+
+func TestCreateTransaction_VariantInsufficientStock(t *testing.T) {
+	product := variantProduct()
+	prodRepo := &fakeProductRepo{findByIDResult: product}
+	paymentClient := &fakePaymentClient{}
+	svc := newService(prodRepo, &fakeTxRepo{}, paymentClient)
+
+	// XL cuma 1, walaupun total stok semua variant cukup
+	_, err := svc.CreateTransaction(context.Background(), customer, model.CreateTransactionRequest{
+		ProductID: product.ID.Hex(),
+		VariantID: product.Variants[1].ID.Hex(),
+		Qty:       2,
+	})
+	if err == nil {
+		t.Fatal("expected insufficient stock error, got nil")
+	}
+	if prodRepo.reserveCalled || paymentClient.called {
+		t.Fatal("expected no reservation or payment when variant stock is insufficient")
+	}
+}
+
+func TestUpdate_VersionCheck(t *testing.T) {
+	tx := &model.Transaction{ID: primitive.NewObjectID(), CustomerID: customer.CustomerID, Qty: 1, Email: customer.Email, Status: model.TransactionStatusPending, Version: 3}
+	txRepo := &fakeTxRepo{findByIDResult: tx}
+	svc := newService(&fakeProductRepo{}, txRepo, &fakePaymentClient{})
+	req := model.UpdateTransactionRequest{Qty: 1, Email: "baru@example.com"}
+
+	if _, err := svc.Update(context.Background(), admin, tx.ID.Hex(), req, 2); !errors.Is(err, model.ErrVersionConflict) {
+		t.Fatalf("expected ErrVersionConflict for stale If-Match, got %v", err)
+	}
+	if txRepo.updateCalled {
+		t.Fatal("expected txRepo.Update NOT to be called for a stale version")
+	}
+
+	// tulisan lain masuk di antara read dan save
+	txRepo.updateErr = model.ErrVersionConflict
+	if _, err := svc.Update(context.Background(), admin, tx.ID.Hex(), req, 3); !errors.Is(err, model.ErrVersionConflict) {
+		t.Fatalf("expected ErrVersionConflict from the repository, got %v", err)
+	}
+
+	txRepo.updateErr = nil
+	if _, err := svc.Update(context.Background(), admin, tx.ID.Hex(), req, 3); err != nil {
+		t.Fatalf("expected update with current version to succeed, got %v", err)
+	}
+	if txRepo.updateInput.Email != "baru@example.com" {
+		t.Fatalf("expected the new email to be saved, got %q", txRepo.updateInput.Email)
+	}
+}
+
+func TestPatch_Transaction(t *testing.T) {
+	tx := &model.Transaction{ID: primitive.NewObjectID(), CustomerID: customer.CustomerID, Qty: 1, Email: customer.Email, Status: model.TransactionStatusPending}
+	txRepo := &fakeTxRepo{findByIDResult: tx}
+	svc := newService(&fakeProductRepo{}, txRepo, &fakePaymentClient{})
+
+	doc, _ := patch.Decode(strings.NewReader(`{"email": " baru@example.com "}`))
+	got, err := svc.Patch(context.Background(), admin, tx.ID.Hex(), doc, 0)
+	if err != nil {
+		t.Fatalf("Patch returned error: %v", err)
+	}
+	if got.Email != "baru@example.com" || got.Qty != 1 {
+		t.Fatalf("expected only email changed, got %+v", got)
+	}
+	if len(txRepo.updatedFields) != 1 || txRepo.updatedFields[0] != "email" {
+		t.Fatalf("expected only email to be saved, got %v", txRepo.updatedFields)
+	}
+
+	for _, body := range []string{`{"qty": 0}`, `{"email": null}`, `{"status": "SUCCESS"}`} {
+		doc, _ := patch.Decode(strings.NewReader(body))
+		if _, err := svc.Patch(context.Background(), admin, tx.ID.Hex(), doc, 0); !errors.Is(err, txsvc.ErrInvalidTransaction) {
+			t.Errorf("%s: expected ErrInvalidTransaction, got %v", body, err)
+		}
+	}
+}
+
+func TestEdit_OnlyAdminOnPendingTransactions(t *testing.T) {
+	tests := []struct {
+		name    string
+		p       model.Principal
+		status  model.TransactionStatus
+		wantErr error
+	}{
+		{name: "owner", p: customer, status: model.TransactionStatusPending, wantErr: txsvc.ErrTransactionNotFound},
+		{name: "staff", p: staff, status: model.TransactionStatusPending, wantErr: txsvc.ErrTransactionNotFound},
+		{name: "admin on SUCCESS", p: admin, status: model.TransactionStatusSuccess, wantErr: txsvc.ErrTransactionNotEditable},
+		{name: "admin on FAILED", p: admin, status: model.TransactionStatusFailed, wantErr: txsvc.ErrTransactionNotEditable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := &model.Transaction{ID: primitive.NewObjectID(), CustomerID: customer.CustomerID, Qty: 1, Email: customer.Email, Status: tt.status}
+			txRepo := &fakeTxRepo{findByIDResult: tx}
+			svc := newService(&fakeProductRepo{}, txRepo, &fakePaymentClient{})
+
+			req := model.UpdateTransactionRequest{Qty: 5, Email: customer.Email}
+			if _, err := svc.Update(context.Background(), tt.p, tx.ID.Hex(), req, 0); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Update: expected %v, got %v", tt.wantErr, err)
+			}
+			doc, _ := patch.Decode(strings.NewReader(`{"qty": 5}`))
+			if _, err := svc.Patch(context.Background(), tt.p, tx.ID.Hex(), doc, 0); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Patch: expected %v, got %v", tt.wantErr, err)
+			}
+			if txRepo.updateCalled || txRepo.updatedFields != nil {
+				t.Fatal("expected nothing to be saved")
+			}
+		})
+	}
+}
+
+// Qty baru dihitung ulang dengan harga satuan pesanan dan reservasinya ikut diubah.
+func TestEdit_QtyRecomputesAmountAndReservation(t *testing.T) {
+	for _, method := range []string{"PUT", "PATCH"} {
+		t.Run(method, func(t *testing.T) {
+			product := &model.Product{ID: primitive.NewObjectID(), Price: 50_000, Stock: 10, Reserved: 2}
+			prodRepo := &fakeProductRepo{findByIDResult: product}
+			tx := &model.Transaction{
+				ID: primitive.NewObjectID(), ProductID: product.ID, Qty: 2, TotalAmount: 90_000,
+				Email: customer.Email, Status: model.TransactionStatusPending,
+			}
+			txRepo := &fakeTxRepo{findByIDResult: tx}
+			resRepo := &fakeReservationRepo{}
+			res := &model.Reservation{TransactionID: tx.ID, ProductID: product.ID, Qty: 2, Status: model.ReservationStatusActive}
+			_ = resRepo.Create(context.Background(), res)
+			svc := txsvc.NewService(prodRepo, txRepo, resRepo, &fakePaymentClient{})
+
+			edit := func(qty int) (*model.Transaction, error) {
+				if method == "PUT" {
+					return svc.Update(context.Background(), admin, tx.ID.Hex(), model.UpdateTransactionRequest{Qty: qty, Email: customer.Email}, 0)
+				}
+				doc, _ := patch.Decode(strings.NewReader(fmt.Sprintf(`{"qty": %d}`, qty)))
+				return svc.Patch(context.Background(), admin, tx.ID.Hex(), doc, 0)
+			}
+
+			// harga satuan diambil dari pesanan (diskon ikut), bukan harga produk sekarang
+			got, err := edit(3)
+			if err != nil {
+				t.Fatalf("expected qty 3 to be accepted, got %v", err)
+			}
+			if got.Qty != 3 || got.TotalAmount != 135_000 {
+				t.Fatalf("expected qty 3 for 135000, got %d for %v", got.Qty, got.TotalAmount)
+			}
+			if res.Qty != 3 || product.Reserved != 3 {
+				t.Fatalf("expected reservation and product to hold 3, got %d and %d", res.Qty, product.Reserved)
+			}
+			if method == "PATCH" && strings.Join(txRepo.updatedFields, ",") != "qty,total_amount" {
+				t.Fatalf("expected qty and total_amount to be saved, got %v", txRepo.updatedFields)
+			}
+
+			if got, err = edit(1); err != nil {
+				t.Fatalf("expected qty 1 to be accepted, got %v", err)
+			}
+			if got.TotalAmount != 45_000 || res.Qty != 1 || product.Reserved != 1 {
+				t.Fatalf("expected 45000 and 1 reserved, got %v, %d and %d", got.TotalAmount, res.Qty, product.Reserved)
+			}
+
+			prodRepo.reserveFail = true
+			if _, err := edit(4); !errors.Is(err, txsvc.ErrInvalidTransaction) {
+				t.Fatalf("expected insufficient stock, got %v", err)
+			}
+			if tx.Qty != 1 || res.Qty != 1 {
+				t.Fatalf("expected nothing to change without stock, got qty %d and reservation %d", tx.Qty, res.Qty)
+			}
+		})
+	}
+}
+
+func TestEdit_QtyFixedOnceAPaymentIsOpen(t *testing.T) {
+	tx := &model.Transaction{
+		ID: primitive.NewObjectID(), Qty: 2, TotalAmount: 100_000, Email: customer.Email,
+		Status: model.TransactionStatusPending, PaymentID: primitive.NewObjectID(),
+	}
+	txRepo := &fakeTxRepo{findByIDResult: tx}
+	svc := newService(&fakeProductRepo{}, txRepo, &fakePaymentClient{})
+
+	req := model.UpdateTransactionRequest{Qty: 3, Email: customer.Email}
+	if _, err := svc.Update(context.Background(), admin, tx.ID.Hex(), req, 0); !errors.Is(err, txsvc.ErrTransactionNotEditable) {
+		t.Fatalf("expected ErrTransactionNotEditable, got %v", err)
+	}
+	if tx.Qty != 2 || tx.TotalAmount != 100_000 || txRepo.updateCalled {
+		t.Fatalf("expected the transaction to stay as it was, got %+v", tx)
+	}
+
+	// email masih boleh dikoreksi
+	doc, _ := patch.Decode(strings.NewReader(`{"email": "baru@example.com"}`))
+	if _, err := svc.Patch(context.Background(), admin, tx.ID.Hex(), doc, 0); err != nil {
+		t.Fatalf("expected the email to be editable, got %v", err)
+	}
+}
+
+type fakeMetrics struct {
+	statuses  map[model.TransactionStatus]int64
+	revenue   float64
+	stockOuts int
+	expired   map[string]int64
+
+	paymentCalls  map[string]int
+	paymentErrors map[string]int
+}
+
+func newFakeMetrics() *fakeMetrics {
+	return &fakeMetrics{
+		statuses:      map[model.TransactionStatus]int64{},
+		expired:       map[string]int64{},
+		paymentCalls:  map[string]int{},
+		paymentErrors: map[string]int{},
+	}
+}
+
+func (f *fakeMetrics) TransactionStatus(status model.TransactionStatus, n int64) {
+	f.statuses[status] += n
+}
+
+func (f *fakeMetrics) Revenue(amount float64) { f.revenue += amount }
+func (f *fakeMetrics) StockOut()              { f.stockOuts++ }
+
+func (f *fakeMetrics) Expired(kind string, n int64) { f.expired[kind] += n }
+
+func (f *fakeMetrics) ObservePaymentCall(op string, d time.Duration, err error) {
+	f.paymentCalls[op]++
+	if err != nil {
+		f.paymentErrors[op]++
+	}
+}
+
+func TestMetrics_CheckoutKPIs(t *testing.T) {
+	product := &model.Product{ID: primitive.NewObjectID(), Price: 100_000, Stock: 3, Status: model.ProductStatusActive}
+	prodRepo := &fakeProductRepo{findByIDResult: product}
+	paymentClient := &fakePaymentClient{}
+	metrics := newFakeMetrics()
+	svc := txsvc.NewService(prodRepo, &fakeTxRepo{}, &fakeReservationRepo{}, paymentClient, txsvc.WithMetrics(metrics))
+
+	buy := func(qty int) {
+		_, _ = svc.CreateTransaction(context.Background(), customer, model.CreateTransactionRequest{
+			ProductID: product.ID.Hex(),
+			Qty:       qty,
+		})
+	}
+
+	buy(2) // SUCCESS
+	paymentClient.declined = true
+	buy(1) // FAILED
+	buy(5) // stok tidak cukup, transaksi tidak dibuat
+
+	if metrics.statuses[model.TransactionStatusPending] != 2 {
+		t.Fatalf("expected 2 transactions created, got %d", metrics.statuses[model.TransactionStatusPending])
+	}
+	if metrics.statuses[model.TransactionStatusSuccess] != 1 || metrics.statuses[model.TransactionStatusFailed] != 1 {
+		t.Fatalf("expected 1 SUCCESS and 1 FAILED, got %v", metrics.statuses)
+	}
+	if metrics.revenue != 200_000 {
+		t.Fatalf("expected revenue 200000, got %v", metrics.revenue)
+	}
+	if metrics.stockOuts != 1 {
+		t.Fatalf("expected 1 stock-out, got %d", metrics.stockOuts)
+	}
+}
+
+func TestMetrics_ExpireJobs(t *testing.T) {
+	product := &model.Product{ID: primitive.NewObjectID(), Stock: 5, Reserved: 2}
+	resRepo := &fakeReservationRepo{findExpiredResult: []model.Reservation{
+		{ID: primitive.NewObjectID(), ProductID: product.ID, Qty: 2, Status: model.ReservationStatusActive},
+	}}
+	metrics := newFakeMetrics()
+	svc := txsvc.NewService(&fakeProductRepo{findByIDResult: product}, &fakeTxRepo{expireResult: 3}, resRepo,
+		&fakePaymentClient{}, txsvc.WithMetrics(metrics))
+
+	if _, err := svc.ReleaseExpiredReservations(context.Background()); err != nil {
+		t.Fatalf("ReleaseExpiredReservations returned error: %v", err)
+	}
+	if _, err := svc.RunExpireJob(context.Background()); err != nil {
+		t.Fatalf("RunExpireJob returned error: %v", err)
+	}
+
+	if metrics.expired["reservation"] != 1 || metrics.expired["transaction"] != 3 {
+		t.Fatalf("expected 1 reservation and 3 transactions expired, got %v", metrics.expired)
+	}
+	if metrics.statuses[model.TransactionStatusFailed] != 3 {
+		t.Fatalf("expected expired transactions counted as FAILED, got %v", metrics.statuses)
+	}
+}
+
+func TestHTTPPaymentClient_Metrics(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/capture") {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(model.APIResponse[model.Payment]{Data: model.Payment{Status: model.PaymentStatusAuthorized}})
+	}))
+	defer srv.Close()
+
+	metrics := newFakeMetrics()
+	client := txsvc.NewHTTPPaymentClient(srv.URL, "shared-secret", txsvc.WithClientMetrics(metrics))
+	id := primitive.NewObjectID().Hex()
+
+	if _, err := client.Authorize(context.Background(), id); err != nil {
+		t.Fatalf("Authorize returned error: %v", err)
+	}
+	if _, err := client.Capture(context.Background(), id, 0); err == nil {
+		t.Fatal("expected capture error")
+	}
+
+	if metrics.paymentCalls["authorize"] != 1 || metrics.paymentCalls["capture"] != 1 {
+		t.Fatalf("expected one authorize and one capture call, got %v", metrics.paymentCalls)
+	}
+	if metrics.paymentErrors["authorize"] != 0 || metrics.paymentErrors["capture"] != 1 {
+		t.Fatalf("expected only the capture to be counted as error, got %v", metrics.paymentErrors)
+	}
+}
+
+func installTracer(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	exp := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+	prevTP, prevProp := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevTP)
+		otel.SetTextMapPropagator(prevProp)
+	})
+	return exp
+}
+
+func spanNamed(spans tracetest.SpanStubs, name string) *tracetest.SpanStub {
+	for i := range spans {
+		if spans[i].Name == name {
+			return &spans[i]
+		}
+	}
+	return nil
+}
+
+func TestTracing_CreateTransactionSpan(t *testing.T) {
+	exp := installTracer(t)
+	prodRepo := &fakeProductRepo{findByIDResult: &model.Product{
+		ID:     primitive.NewObjectID(),
+		Price:  50_000,
+		Stock:  5,
+		Status: model.ProductStatusActive,
+	}}
+	svc := newService(prodRepo, &fakeTxRepo{}, &fakePaymentClient{})
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "POST /transactions")
+	if _, err := svc.CreateTransaction(ctx, customer, model.CreateTransactionRequest{ProductID: prodRepo.findByIDResult.ID.Hex(), Qty: 1}); err != nil {
+		t.Fatalf("CreateTransaction returned error: %v", err)
+	}
+	parent.End()
+
+	span := spanNamed(exp.GetSpans(), "TransactionService.CreateTransaction")
+	if span == nil {
+		t.Fatalf("expected a TransactionService.CreateTransaction span, got %v", exp.GetSpans())
+	}
+	if span.Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Fatal("expected the service span to be a child of the request span")
+	}
+}
+
+// Span HTTP dari tracing.Transport harus jadi child span payment client.
+func TestTracing_PaymentClientSpan(t *testing.T) {
+	exp := installTracer(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(model.APIResponse[model.Payment]{Data: model.Payment{Status: model.PaymentStatusAuthorized}})
+	}))
+	defer srv.Close()
+
+	client := txsvc.NewHTTPPaymentClient(srv.URL, "shared-secret")
+	if _, err := client.Authorize(context.Background(), primitive.NewObjectID().Hex()); err != nil {
+		t.Fatalf("Authorize returned error: %v", err)
+	}
+
+	spans := exp.GetSpans()
+	call := spanNamed(spans, "PaymentClient.authorize")
+	httpSpan := spanNamed(spans, "HTTP POST")
+	if call == nil || httpSpan == nil {
+		t.Fatalf("expected payment client and HTTP spans, got %v", spans)
+	}
+	if httpSpan.Parent.SpanID() != call.SpanContext.SpanID() {
+		t.Fatal("expected the HTTP span to be a child of the payment client span")
+	}
+}
+
+// Request ID dari context ikut terkirim ke payment dan tercatat di setiap log.
+func TestRequestID_PropagatedToPaymentAndLogs(t *testing.T) {
+	const requestID = "checkout-42"
+
+	var seen []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = append(seen, r.Header.Get(logging.HeaderRequestID))
+		if strings.HasSuffix(r.URL.Path, "/capture") {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(model.APIResponse[model.Payment]{Data: model.Payment{
+			ID:     primitive.NewObjectID(),
+			Status: model.PaymentStatusAuthorized,
+		}})
+	}))
+	defer srv.Close()
+
+	var logs bytes.Buffer
+	logger := logging.New(&logs, slog.LevelInfo, "shopping")
+	prodRepo := &fakeProductRepo{findByIDResult: &model.Product{
+		ID:     primitive.NewObjectID(),
+		Price:  10_000,
+		Stock:  3,
+		Status: model.ProductStatusActive,
+	}}
+	svc := txsvc.NewService(prodRepo, &fakeTxRepo{}, &fakeReservationRepo{},
+		txsvc.NewHTTPPaymentClient(srv.URL, "shared-secret"),
+		txsvc.WithLogger(logger),
+	)
+
+	ctx := logging.WithRequestID(context.Background(), requestID)
+	if _, err := svc.CreateTransaction(ctx, customer, model.CreateTransactionRequest{ProductID: prodRepo.findByIDResult.ID.Hex(), Qty: 1}); err == nil {
+		t.Fatal("expected an error after the failed capture")
+	}
+
+	if len(seen) == 0 {
+		t.Fatal("payment service was not called")
+	}
+	for _, id := range seen {
+		if id != requestID {
+			t.Fatalf("expected every payment call to carry %q, got %v", requestID, seen)
+		}
+	}
+
+	if !strings.Contains(logs.String(), `"msg":"capture failed, voiding payment and restocking"`) {
+		t.Fatalf("expected the capture failure to be logged, got %s", logs.String())
+	}
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		if !strings.Contains(line, `"request_id":"`+requestID+`"`) {
+			t.Fatalf("expected request_id on every log line, got %s", line)
+		}
+	}
 }
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+)
+
+type nonceEntry struct {
+	nonce     string
+	expiresAt time.Time
+}
+
+// nonceQueue is a min-heap on expiresAt, so expired nonces are popped from the
+// front instead of scanning every nonce on each request.
+type nonceQueue []nonceEntry
+
+func (q nonceQueue) Len() int           { return len(q) }
+func (q nonceQueue) Less(i, j int) bool { return q[i].expiresAt.Before(q[j].expiresAt) }
+func (q nonceQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *nonceQueue) Push(x any)        { *q = append(*q, x.(nonceEntry)) }
+func (q *nonceQueue) Pop() any {
+	old := *q
+	e := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return e
+}
+
+type memoryNonceStore struct {
+	mu     sync.Mutex
+	used   map[string]struct{}
+	expiry nonceQueue
+}
+
+// NewMemoryNonceStore keeps nonces in this process. With several replicas
+// every replica has its own nonces, so a request can be replayed against
+// another replica.
+func NewMemoryNonceStore() NonceStore {
+	return &memoryNonceStore{used: map[string]struct{}{}}
+}
+
+func (m *memoryNonceStore) Use(ctx context.Context, nonce string, expiresAt, now time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for len(m.expiry) > 0 && now.After(m.expiry[0].expiresAt) {
+		e := heap.Pop(&m.expiry).(nonceEntry)
+		delete(m.used, e.nonce)
+	}
+
+	if _, ok := m.used[nonce]; ok {
+		return false, nil
+	}
+	m.used[nonce] = struct{}{}
+	heap.Push(&m.expiry, nonceEntry{nonce: nonce, expiresAt: expiresAt})
+	return true, nil
+}
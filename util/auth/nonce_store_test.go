@@ -0,0 +1,37 @@
+package auth_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"ecom/util/auth"
+)
+
+func TestMemoryNonceStore_ForgetsExpiredNonces(t *testing.T) {
+	ctx := context.Background()
+	store := auth.NewMemoryNonceStore()
+	now := time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	use := func(nonce string, expiresAt, at time.Time, want bool) {
+		t.Helper()
+		fresh, err := store.Use(ctx, nonce, expiresAt, at)
+		if err != nil {
+			t.Fatalf("Use returned error: %v", err)
+		}
+		if fresh != want {
+			t.Fatalf("nonce %q at %s: expected fresh=%v, got %v", nonce, at.Format(time.TimeOnly), want, fresh)
+		}
+	}
+
+	// dimasukkan tidak urut expiry
+	use("late", now.Add(2*time.Minute), now, true)
+	use("early", now.Add(time.Minute), now, true)
+	use("early", now.Add(time.Minute), now.Add(30*time.Second), false)
+	use("late", now.Add(2*time.Minute), now.Add(90*time.Second), false)
+
+	// setelah expiry nonce dilupakan dan boleh dipakai lagi
+	use("early", now.Add(3*time.Minute), now.Add(90*time.Second), true)
+	use("late", now.Add(4*time.Minute), now.Add(150*time.Second), true)
+	use("early", now.Add(3*time.Minute), now.Add(150*time.Second), false)
+}
@@ -0,0 +1,72 @@
+package auth_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"ecom/util/auth"
+)
+
+func signed(t *testing.T, target string, secret string) *http.Request {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	if err := auth.SignRequest(req, []byte(secret), nil); err != nil {
+		t.Fatalf("SignRequest returned error: %v", err)
+	}
+	return req
+}
+
+func TestVerifyRequest_QueryIsSigned(t *testing.T) {
+	tests := []struct {
+		name   string
+		signed string
+		sent   string
+		want   error
+	}{
+		{name: "same query", signed: "/payments?status=SUCCESS&limit=10", sent: "/payments?status=SUCCESS&limit=10"},
+		{name: "reordered and re-escaped", signed: "/payments?status=SUCCESS&email=a%40b.id", sent: "/payments?email=a@b.id&status=SUCCESS"},
+		{name: "value changed", signed: "/payments?status=SUCCESS", sent: "/payments?status=FAILED", want: auth.ErrBadSignature},
+		{name: "parameter added", signed: "/payments?limit=10", sent: "/payments?limit=10&email=other@example.com", want: auth.ErrBadSignature},
+		{name: "query removed", signed: "/payments?limit=10", sent: "/payments", want: auth.ErrBadSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier := auth.NewSignatureVerifier("shared-secret", time.Minute)
+			req := signed(t, tt.signed, "shared-secret")
+
+			sent := httptest.NewRequest(http.MethodGet, tt.sent, nil)
+			sent.Header = req.Header
+			if err := verifier.VerifyRequest(sent, nil); !errors.Is(err, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestVerifyRequest_RejectsUnsignedStaleAndReplayed(t *testing.T) {
+	verifier := auth.NewSignatureVerifier("shared-secret", time.Minute)
+
+	if err := verifier.VerifyRequest(httptest.NewRequest(http.MethodGet, "/payments", nil), nil); !errors.Is(err, auth.ErrMissingSignature) {
+		t.Fatalf("expected ErrMissingSignature, got %v", err)
+	}
+	if err := verifier.VerifyRequest(signed(t, "/payments", "other-secret"), nil); !errors.Is(err, auth.ErrBadSignature) {
+		t.Fatalf("expected ErrBadSignature, got %v", err)
+	}
+
+	stale := signed(t, "/payments", "shared-secret")
+	stale.Header.Set(auth.HeaderSignatureTimestamp, "1")
+	if err := verifier.VerifyRequest(stale, nil); !errors.Is(err, auth.ErrStaleSignature) {
+		t.Fatalf("expected ErrStaleSignature, got %v", err)
+	}
+
+	req := signed(t, "/payments", "shared-secret")
+	if err := verifier.VerifyRequest(req, nil); err != nil {
+		t.Fatalf("expected signed request to verify, got %v", err)
+	}
+	if err := verifier.VerifyRequest(req, nil); !errors.Is(err, auth.ErrReplayedRequest) {
+		t.Fatalf("expected ErrReplayedRequest, got %v", err)
+	}
+}
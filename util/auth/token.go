@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"ecom/model"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type TokenType string
+
+const (
+	TokenTypeAccess  TokenType = "access"
+	TokenTypeRefresh TokenType = "refresh"
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+type Claims struct {
+	Email string     `json:"email"`
+	Role  model.Role `json:"role"`
+	Type  TokenType  `json:"typ"`
+	jwt.RegisteredClaims
+}
+
+// TokenManager issues and verifies HS256 signed access/refresh tokens.
+type TokenManager struct {
+	secret     []byte
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+}
+
+func NewTokenManager(secret string, accessTTL, refreshTTL time.Duration) *TokenManager {
+	return &TokenManager{
+		secret:     []byte(secret),
+		accessTTL:  accessTTL,
+		refreshTTL: refreshTTL,
+	}
+}
+
+func (m *TokenManager) Issue(c *model.Customer) (*model.AuthTokens, error) {
+	now := time.Now()
+
+	access, err := m.sign(c, TokenTypeAccess, now, now.Add(m.accessTTL))
+	if err != nil {
+		return nil, err
+	}
+	refresh, err := m.sign(c, TokenTypeRefresh, now, now.Add(m.refreshTTL))
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.AuthTokens{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresAt:    now.Add(m.accessTTL),
+	}, nil
+}
+
+// Parse verifies the signature, expiry and token type, and returns the caller.
+func (m *TokenManager) Parse(token string, typ TokenType) (*model.Principal, error) {
+	var claims Claims
+	_, err := jwt.ParseWithClaims(token, &claims, func(t *jwt.Token) (any, error) {
+		return m.secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	if claims.Type != typ {
+		return nil, fmt.Errorf("%w: expected %s token", ErrInvalidToken, typ)
+	}
+
+	customerID, err := primitive.ObjectIDFromHex(claims.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid subject", ErrInvalidToken)
+	}
+
+	role := claims.Role
+	if !role.Valid() {
+		role = model.RoleCustomer
+	}
+
+	return &model.Principal{
+		CustomerID: customerID,
+		Email:      claims.Email,
+		Role:       role,
+	}, nil
+}
+
+func (m *TokenManager) ParseAccess(token string) (*model.Principal, error) {
+	return m.Parse(token, TokenTypeAccess)
+}
+
+func (m *TokenManager) ParseRefresh(token string) (*model.Principal, error) {
+	return m.Parse(token, TokenTypeRefresh)
+}
+
+func (m *TokenManager) sign(c *model.Customer, typ TokenType, now, exp time.Time) (string, error) {
+	claims := Claims{
+		Email: c.Email,
+		Role:  c.Role,
+		Type:  typ,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   c.ID.Hex(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(exp),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(m.secret)
+}
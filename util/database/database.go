@@ -2,51 +2,312 @@ package database
 
 import (
 	"context"
-	"log"
+	"errors"
+	"log/slog"
 	"time"
 
 	"ecom/config"
+	"ecom/model"
+	"ecom/util/logging"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
-func NewMongoClient(cfg config.Config) *mongo.Client {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// NewMongoClient connects to Mongo and blocks until the server answers a
+// ping, so the service only starts serving once its database is reachable.
+func NewMongoClient(cfg config.Config, opts ...ClientOption) *mongo.Client {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.MongoConnectTimeout)
 	defer cancel()
 
 	serverAPI := options.ServerAPI(options.ServerAPIVersion1)
 	clientOpts := options.Client().
 		ApplyURI(cfg.MongoURI).
 		SetServerAPIOptions(serverAPI)
+	var monitors []*event.CommandMonitor
+	for _, opt := range opts {
+		monitors = append(monitors, opt())
+	}
+	if len(monitors) > 0 {
+		clientOpts.SetMonitor(combineMonitors(monitors))
+	}
 
 	client, err := mongo.Connect(ctx, clientOpts)
 	if err != nil {
-		log.Fatalf("mongo: connect error: %v", err)
+		logging.Fatal("mongo: connect", "error", err)
+	}
+
+	// mongo.Connect tidak benar-benar konek, ping sampai server menjawab
+	for {
+		pingCtx, cancelPing := context.WithTimeout(ctx, 5*time.Second)
+		err = client.Ping(pingCtx, readpref.Primary())
+		cancelPing()
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			logging.Fatal("mongo: not reachable", "timeout", cfg.MongoConnectTimeout, "error", err)
+		}
+		slog.Warn("mongo: waiting for server", "error", err)
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+		}
 	}
 
 	return client
 }
 
+// PaymentCollection returns the payments collection and manages its indexes.
+// Only the payment service owns this collection; other readers use
+// PaymentCollectionReadOnly.
 func PaymentCollection(client *mongo.Client, cfg config.Config) *mongo.Collection {
-	col := client.Database(cfg.MongoDBName).Collection("payments")
+	col := PaymentCollectionReadOnly(client, cfg)
+
+	// index lama unique transaction_id diganti (transaction_id, attempt) supaya
+	// transaksi yang payment-nya FAILED bisa dicoba lagi
+	if _, err := col.Indexes().DropOne(context.Background(), "transaction_id_1"); err != nil {
+		var cmdErr mongo.CommandError
+		// 26 = NamespaceNotFound (collection baru), 27 = IndexNotFound
+		if !errors.As(err, &cmdErr) || !(cmdErr.HasErrorCode(26) || cmdErr.HasErrorCode(27)) {
+			slog.Error("mongo: drop index", "error", err)
+		}
+	}
+
+	_, err := col.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "transaction_id", Value: 1}, {Key: "attempt", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			// expire job: REVIEW/CREATED/AUTHORIZED yang lewat expires_at
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "expires_at", Value: 1}},
+		},
+		{
+			// GET /payments?email=&from=&to=
+			Keys: bson.D{{Key: "email", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+		{
+			// GET /payments?status=&from=&to=
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+		{
+			Keys: bson.M{"created_at": -1},
+		},
+	})
+	if err != nil {
+		slog.Error("mongo: create index", "error", err)
+	}
+
+	return col
+}
+
+// PaymentCollectionReadOnly returns the payments collection without touching
+// its indexes, for services that only read it (reconciliation).
+func PaymentCollectionReadOnly(client *mongo.Client, cfg config.Config) *mongo.Collection {
+	return client.Database(cfg.MongoDBName).Collection("payments")
+}
+
+func ProductCollection(client *mongo.Client, cfg config.Config) *mongo.Collection {
+	col := client.Database(cfg.MongoDBName).Collection("products")
+
+	// produk lama belum punya status, dianggap sudah dijual (active)
+	_, err := col.UpdateMany(context.Background(),
+		bson.M{"status": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"status": model.ProductStatusActive}},
+	)
+	if err != nil {
+		slog.Error("mongo: backfill product status", "error", err)
+	}
+	backfillVersion(col)
+	backfillProductWords(col)
+
+	_, err = col.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		// produk lama belum punya SKU, jadi unique hanya untuk yang sudah diisi
+		{
+			Keys: bson.M{"sku": 1},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"sku": bson.M{"$type": "string"}}),
+		},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "category_ids", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "tags", Value: 1}}},
+		// autocomplete: prefix ^kata pada kata nama/tag yang sudah lowercase
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "words", Value: 1}}},
+		// SKU variant unik antar produk; duplikat di dalam satu produk dicek service
+		{
+			Keys: bson.M{"variants.sku": 1},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"variants.sku": bson.M{"$type": "string"}}),
+		},
+		// satu-satunya text index untuk /products/search; language "none" karena
+		// katalog campuran bahasa Indonesia dan Inggris (tanpa stemming/stop words)
+		{
+			Keys: bson.D{
+				{Key: "name", Value: "text"},
+				{Key: "tags", Value: "text"},
+				{Key: "description", Value: "text"},
+			},
+			Options: options.Index().
+				SetName("product_text").
+				SetDefaultLanguage("none").
+				SetWeights(bson.M{"name": 10, "tags": 5, "description": 1}),
+		},
+	})
+	if err != nil {
+		slog.Error("mongo: create index", "error", err)
+	}
+
+	return col
+}
+
+// backfillProductWords fills words (see model.SearchWords) for products
+// written before autocomplete used them.
+func backfillProductWords(col *mongo.Collection) {
+	ctx := context.Background()
+	cur, err := col.Find(ctx,
+		bson.M{"words": bson.M{"$exists": false}},
+		options.Find().SetProjection(bson.M{"name": 1, "tags": 1}),
+	)
+	if err != nil {
+		slog.Error("mongo: backfill product words", "error", err)
+		return
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var p model.Product
+		if err := cur.Decode(&p); err != nil {
+			slog.Error("mongo: backfill product words", "error", err)
+			return
+		}
+		_, err := col.UpdateOne(ctx,
+			bson.M{"_id": p.ID, "words": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"words": model.SearchWords(p.Name, p.Tags)}},
+		)
+		if err != nil {
+			slog.Error("mongo: backfill product words", "product_id", p.ID.Hex(), "error", err)
+		}
+	}
+	if err := cur.Err(); err != nil {
+		slog.Error("mongo: backfill product words", "error", err)
+	}
+}
+
+func CategoryCollection(client *mongo.Client, cfg config.Config) *mongo.Collection {
+	col := client.Database(cfg.MongoDBName).Collection("categories")
 
 	_, err := col.Indexes().CreateOne(context.Background(), mongo.IndexModel{
-		Keys:    bson.M{"transaction_id": 1},
+		Keys:    bson.M{"slug": 1},
 		Options: options.Index().SetUnique(true),
 	})
 	if err != nil {
-		log.Printf("mongo: create index error: %v", err)
+		slog.Error("mongo: create index", "error", err)
 	}
 
 	return col
 }
 
-func ProductCollection(client *mongo.Client, cfg config.Config) *mongo.Collection {
-	return client.Database(cfg.MongoDBName).Collection("products")
+// backfillVersion gives documents written before optimistic locking version 1,
+// so Update (which matches on version) can find them.
+func backfillVersion(col *mongo.Collection) {
+	_, err := col.UpdateMany(context.Background(),
+		bson.M{"version": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"version": 1}},
+	)
+	if err != nil {
+		slog.Error("mongo: backfill version", "collection", col.Name(), "error", err)
+	}
 }
 
 func TransactionCollection(client *mongo.Client, cfg config.Config) *mongo.Collection {
-	return client.Database(cfg.MongoDBName).Collection("transactions")
+	col := client.Database(cfg.MongoDBName).Collection("transactions")
+	backfillVersion(col)
+
+	_, err := col.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "customer_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		// range scan untuk rekonsiliasi dan report conversion
+		{Keys: bson.D{{Key: "created_at", Value: -1}}},
+		// $match status SUCCESS + range created_at di report sales
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	if err != nil {
+		slog.Error("mongo: create index", "error", err)
+	}
+
+	return col
+}
+
+func CustomerCollection(client *mongo.Client, cfg config.Config) *mongo.Collection {
+	col := client.Database(cfg.MongoDBName).Collection("customers")
+
+	_, err := col.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.M{"email": 1},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		slog.Error("mongo: create index", "error", err)
+	}
+
+	return col
+}
+
+func ReservationCollection(client *mongo.Client, cfg config.Config) *mongo.Collection {
+	col := client.Database(cfg.MongoDBName).Collection("reservations")
+
+	_, err := col.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{
+			Keys:    bson.M{"transaction_id": 1},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "expires_at", Value: 1}},
+		},
+	})
+	if err != nil {
+		slog.Error("mongo: create index", "error", err)
+	}
+
+	return col
+}
+
+func JobLockCollection(client *mongo.Client, cfg config.Config) *mongo.Collection {
+	return client.Database(cfg.MongoDBName).Collection("job_locks")
+}
+
+func RateLimitCollection(client *mongo.Client, cfg config.Config) *mongo.Collection {
+	col := client.Database(cfg.MongoDBName).Collection("rate_limits")
+
+	// bucket yang sudah penuh lagi tidak perlu disimpan
+	_, err := col.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.M{"expires_at": 1},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		slog.Error("mongo: create index", "error", err)
+	}
+
+	return col
+}
+
+func JobRunCollection(client *mongo.Client, cfg config.Config) *mongo.Collection {
+	col := client.Database(cfg.MongoDBName).Collection("job_runs")
+
+	_, err := col.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "job", Value: 1}, {Key: "started_at", Value: -1}}},
+		// histori run dibuang otomatis setelah 30 hari
+		{
+			Keys:    bson.M{"started_at": 1},
+			Options: options.Index().SetExpireAfterSeconds(int32((30 * 24 * time.Hour).Seconds())),
+		},
+	})
+	if err != nil {
+		slog.Error("mongo: create index", "error", err)
+	}
+
+	return col
 }
@@ -0,0 +1,124 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"ecom/util/tracing"
+
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.39.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ClientOption adds a command monitor to the client of NewMongoClient.
+type ClientOption func() *event.CommandMonitor
+
+// CommandMetrics observes every command sent to Mongo. See util/metrics for
+// the Prometheus version.
+type CommandMetrics interface {
+	ObserveMongoCommand(command, collection string, d time.Duration, err error)
+}
+
+// WithCommandMetrics reports the latency and errors of every Mongo command to m.
+func WithCommandMetrics(m CommandMetrics) ClientOption {
+	return func() *event.CommandMonitor {
+		// nama collection hanya ada di event started, disimpan per request id
+		var collections sync.Map
+		observe := func(requestID int64, command string, d time.Duration, err error) {
+			collection, _ := collections.LoadAndDelete(requestID)
+			name, _ := collection.(string)
+			m.ObserveMongoCommand(command, name, d, err)
+		}
+		return &event.CommandMonitor{
+			Started: func(_ context.Context, e *event.CommandStartedEvent) {
+				if name, ok := commandCollection(e); ok {
+					collections.Store(e.RequestID, name)
+				}
+			},
+			Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+				observe(e.RequestID, e.CommandName, e.Duration, nil)
+			},
+			Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+				observe(e.RequestID, e.CommandName, e.Duration, errors.New(e.Failure))
+			},
+		}
+	}
+}
+
+// WithCommandTracing opens a client span for every Mongo command, as a child
+// of the span in the context the command was run with.
+func WithCommandTracing() ClientOption {
+	return func() *event.CommandMonitor {
+		var spans sync.Map
+		end := func(requestID int64, err error) {
+			v, ok := spans.LoadAndDelete(requestID)
+			if !ok {
+				return
+			}
+			span := v.(trace.Span)
+			if err != nil {
+				tracing.Fail(span, err)
+			}
+			span.End()
+		}
+		return &event.CommandMonitor{
+			Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+				attrs := []attribute.KeyValue{
+					semconv.DBSystemNameMongoDB,
+					semconv.DBNamespace(e.DatabaseName),
+					semconv.DBOperationName(e.CommandName),
+				}
+				name := "mongo." + e.CommandName
+				if collection, ok := commandCollection(e); ok {
+					attrs = append(attrs, semconv.DBCollectionName(collection))
+					name += " " + collection
+				}
+				_, span := tracing.Tracer().Start(ctx, name,
+					trace.WithSpanKind(trace.SpanKindClient),
+					trace.WithAttributes(attrs...),
+				)
+				spans.Store(e.RequestID, span)
+			},
+			Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+				end(e.RequestID, nil)
+			},
+			Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+				end(e.RequestID, errors.New(e.Failure))
+			},
+		}
+	}
+}
+
+// combineMonitors fans every event out to each of monitors.
+func combineMonitors(monitors []*event.CommandMonitor) *event.CommandMonitor {
+	if len(monitors) == 1 {
+		return monitors[0]
+	}
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			for _, m := range monitors {
+				m.Started(ctx, e)
+			}
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			for _, m := range monitors {
+				m.Succeeded(ctx, e)
+			}
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			for _, m := range monitors {
+				m.Failed(ctx, e)
+			}
+		},
+	}
+}
+
+// commandCollection returns the collection a command runs on, e.g. "products"
+// for {find: "products", ...}.
+func commandCollection(e *event.CommandStartedEvent) (string, bool) {
+	return e.Command.Lookup(e.CommandName).StringValueOK()
+}
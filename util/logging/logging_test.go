@@ -0,0 +1,69 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ecom/util/logging"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestNew_AddsRequestAndTraceID(t *testing.T) {
+	var out bytes.Buffer
+	logger := logging.New(&out, slog.LevelInfo, "shopping")
+
+	ctx := logging.WithRequestID(context.Background(), "req-1")
+	ctx, span := sdktrace.NewTracerProvider().Tracer("test").Start(ctx, "op")
+	defer span.End()
+	logger.InfoContext(ctx, "hello")
+	logger.Debug("dropped below the level")
+
+	var line map[string]any
+	if err := json.Unmarshal(out.Bytes(), &line); err != nil {
+		t.Fatalf("expected exactly one JSON line, got %q", out.String())
+	}
+	if line["service"] != "shopping" || line["request_id"] != "req-1" || line["trace_id"] != span.SpanContext().TraceID().String() {
+		t.Fatalf("expected service, request_id and trace_id, got %v", line)
+	}
+}
+
+func TestTransport_ForwardsRequestID(t *testing.T) {
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get(logging.HeaderRequestID))
+	}))
+	defer srv.Close()
+	client := &http.Client{Transport: logging.Transport(nil)}
+
+	send := func(ctx context.Context, header string) {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+		if header != "" {
+			req.Header.Set(logging.HeaderRequestID, header)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if req.Header.Get(logging.HeaderRequestID) != header {
+			t.Fatal("expected the caller's request to be left untouched")
+		}
+	}
+	withID := logging.WithRequestID(context.Background(), "req-1")
+	send(withID, "")
+	send(withID, "set-by-caller")
+	send(context.Background(), "")
+
+	want := []string{"req-1", "set-by-caller", ""}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected X-Request-ID %q, got %v", want, got)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+// Package metrics is the Prometheus implementation of the metric interfaces
+// of the HTTP middleware, the payment client, the scheduler, the Mongo client
+// and the transaction service.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"ecom/model"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "ecom"
+
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpRequests *prometheus.CounterVec
+	httpDuration *prometheus.HistogramVec
+
+	paymentDuration *prometheus.HistogramVec
+	paymentErrors   *prometheus.CounterVec
+
+	jobRuns     *prometheus.CounterVec
+	jobDuration *prometheus.HistogramVec
+
+	mongoDuration *prometheus.HistogramVec
+	mongoErrors   *prometheus.CounterVec
+
+	transactions *prometheus.CounterVec
+	revenue      prometheus.Counter
+	stockOuts    prometheus.Counter
+	expired      *prometheus.CounterVec
+}
+
+// New registers every metric on a fresh registry, together with the Go
+// runtime and process collectors.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by method, route and status code.",
+		}, []string{"method", "route", "status"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by method, route and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+
+		paymentDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "payment_client_duration_seconds",
+			Help:      "Latency of calls to the payment service by operation.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"op"}),
+		paymentErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "payment_client_errors_total",
+			Help:      "Failed calls to the payment service by operation.",
+		}, []string{"op"}),
+
+		jobRuns: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "job_runs_total",
+			Help:      "Scheduled job runs by job and outcome.",
+		}, []string{"job", "status"}),
+		jobDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "job_duration_seconds",
+			Help:      "Duration of scheduled job runs.",
+			Buckets:   []float64{.01, .05, .1, .5, 1, 5, 10, 30, 60, 300},
+		}, []string{"job"}),
+
+		mongoDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "mongo_command_duration_seconds",
+			Help:      "Latency of Mongo commands by command and collection.",
+			Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"command", "collection"}),
+		mongoErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "mongo_command_errors_total",
+			Help:      "Failed Mongo commands by command and collection.",
+		}, []string{"command", "collection"}),
+
+		transactions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "transactions_total",
+			Help:      "Transactions entering each status.",
+		}, []string{"status"}),
+		revenue: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "revenue_total",
+			Help:      "Total amount of SUCCESS transactions (IDR).",
+		}),
+		stockOuts: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "stock_outs_total",
+			Help:      "Checkouts rejected because the product was out of stock.",
+		}),
+		expired: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "expired_total",
+			Help:      "Pending transactions and reservations expired by the expire job.",
+		}, []string{"kind"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests, m.httpDuration,
+		m.paymentDuration, m.paymentErrors,
+		m.jobRuns, m.jobDuration,
+		m.mongoDuration, m.mongoErrors,
+		m.transactions, m.revenue, m.stockOuts, m.expired,
+	)
+	return m
+}
+
+// Handler serves the registry in the Prometheus text format, for GET /metrics.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+func (m *Metrics) ObserveHTTPRequest(method, route string, status int, d time.Duration) {
+	code := strconv.Itoa(status)
+	m.httpRequests.WithLabelValues(method, route, code).Inc()
+	m.httpDuration.WithLabelValues(method, route, code).Observe(d.Seconds())
+}
+
+func (m *Metrics) ObservePaymentCall(op string, d time.Duration, err error) {
+	m.paymentDuration.WithLabelValues(op).Observe(d.Seconds())
+	if err != nil {
+		m.paymentErrors.WithLabelValues(op).Inc()
+	}
+}
+
+func (m *Metrics) ObserveJobRun(job string, status model.JobRunStatus, d time.Duration) {
+	m.jobRuns.WithLabelValues(job, string(status)).Inc()
+	m.jobDuration.WithLabelValues(job).Observe(d.Seconds())
+}
+
+func (m *Metrics) ObserveMongoCommand(command, collection string, d time.Duration, err error) {
+	m.mongoDuration.WithLabelValues(command, collection).Observe(d.Seconds())
+	if err != nil {
+		m.mongoErrors.WithLabelValues(command, collection).Inc()
+	}
+}
+
+func (m *Metrics) TransactionStatus(status model.TransactionStatus, n int64) {
+	m.transactions.WithLabelValues(string(status)).Add(float64(n))
+}
+
+func (m *Metrics) Revenue(amount float64) {
+	m.revenue.Add(amount)
+}
+
+func (m *Metrics) StockOut() {
+	m.stockOuts.Inc()
+}
+
+func (m *Metrics) Expired(kind string, n int64) {
+	m.expired.WithLabelValues(kind).Add(float64(n))
+}
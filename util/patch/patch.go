@@ -0,0 +1,106 @@
+// Package patch applies JSON Merge Patch documents (RFC 7386) to request structs.
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MediaType is the Content-Type of a JSON Merge Patch body.
+const MediaType = "application/merge-patch+json"
+
+// Document is a decoded merge patch: a field set to null is cleared, a field
+// that is missing is left alone.
+type Document map[string]json.RawMessage
+
+var ErrNotObject = errors.New("merge patch must be a JSON object")
+
+// Decode reads a merge patch from r. Only objects are accepted: a patch that
+// is an array or a scalar would replace the whole resource.
+func Decode(r io.Reader) (Document, error) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, err
+	}
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || raw[0] != '{' {
+		return nil, ErrNotObject
+	}
+
+	var doc Document
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// Fields returns the top level fields the patch touches.
+func (d Document) Fields() []string {
+	fields := make([]string, 0, len(d))
+	for f := range d {
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// Apply merges d into target and decodes the result into a new T. Fields of
+// the patch that T doesn't have are an error, so read-only or misspelled
+// fields aren't silently dropped.
+func Apply[T any](target T, d Document) (T, error) {
+	var out T
+
+	b, err := json.Marshal(target)
+	if err != nil {
+		return out, err
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return out, fmt.Errorf("target must encode to a JSON object: %w", err)
+	}
+
+	for field, raw := range d {
+		var v any
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return out, fmt.Errorf("field %q: %w", field, err)
+		}
+		doc = merge(doc, field, v)
+	}
+
+	b, err = json.Marshal(doc)
+	if err != nil {
+		return out, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&out); err != nil {
+		return out, err
+	}
+	return out, nil
+}
+
+// merge sets field of doc to v following RFC 7386: null removes the field and
+// objects are merged recursively.
+func merge(doc map[string]any, field string, v any) map[string]any {
+	if doc == nil {
+		doc = map[string]any{}
+	}
+	if v == nil {
+		delete(doc, field)
+		return doc
+	}
+
+	patch, ok := v.(map[string]any)
+	if !ok {
+		doc[field] = v
+		return doc
+	}
+	current, _ := doc[field].(map[string]any)
+	for k, pv := range patch {
+		current = merge(current, k, pv)
+	}
+	doc[field] = current
+	return doc
+}
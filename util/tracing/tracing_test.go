@@ -0,0 +1,92 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ecom/util/tracing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func installTracer(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	exp := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+	prevTP, prevProp := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevTP)
+		otel.SetTextMapPropagator(prevProp)
+	})
+	return exp
+}
+
+func TestStart_ChildSpanAndFail(t *testing.T) {
+	exp := installTracer(t)
+
+	ctx, parent := tracing.Start(context.Background(), "parent")
+	_, child := tracing.Start(ctx, "child")
+	tracing.Fail(child, errors.New("boom"))
+	child.End()
+	parent.End()
+
+	spans := exp.GetSpans()
+	if len(spans) != 2 || spans[0].Name != "child" {
+		t.Fatalf("expected child then parent span, got %v", spans)
+	}
+	if spans[0].Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Fatal("expected child to have parent as parent span")
+	}
+	if spans[0].Status.Code != codes.Error || spans[0].Status.Description != "boom" || len(spans[0].Events) != 1 {
+		t.Fatalf("expected the error recorded on the child span, got %+v", spans[0].Status)
+	}
+}
+
+func TestTransport_PropagatesTraceContext(t *testing.T) {
+	exp := installTracer(t)
+	var traceparent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	ctx, parent := tracing.Start(context.Background(), "checkout")
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, srv.URL+"/payments", nil)
+	resp, err := (&http.Client{Transport: tracing.Transport(nil)}).Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	parent.End()
+
+	if req.Header.Get("traceparent") != "" {
+		t.Fatal("expected the caller's request to be left untouched")
+	}
+	spans := exp.GetSpans()
+	if len(spans) != 2 || spans[0].Name != "HTTP POST" {
+		t.Fatalf("expected an HTTP POST span, got %v", spans)
+	}
+	httpSpan := spans[0]
+	if httpSpan.SpanKind != trace.SpanKindClient || httpSpan.Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Fatal("expected a client span, child of the caller's span")
+	}
+	if !strings.Contains(traceparent, parent.SpanContext().TraceID().String()) ||
+		!strings.Contains(traceparent, httpSpan.SpanContext.SpanID().String()) {
+		t.Fatalf("expected traceparent to carry the HTTP span, got %q", traceparent)
+	}
+	if httpSpan.Status.Code != codes.Error {
+		t.Fatal("expected a 5xx response to mark the span as failed")
+	}
+}